@@ -1,27 +1,61 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/alanmaizon/homer/backend/internal/api"
+	"github.com/alanmaizon/homer/backend/internal/llm"
 	"github.com/alanmaizon/homer/backend/internal/middleware"
+	"github.com/alanmaizon/homer/backend/internal/moderation"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 )
 
+const (
+	// shutdownTimeout bounds how long in-flight requests may run after
+	// SIGTERM.
+	shutdownTimeout = 30 * time.Second
+	// callbackDrainTimeout bounds how long pending callbacks may keep
+	// retrying after that before they are dead-lettered.
+	callbackDrainTimeout = 15 * time.Second
+)
+
 func main() {
+	if err := llm.LoadPromptTemplatesFromEnv(); err != nil {
+		log.Fatalf("failed to load prompt templates: %v", err)
+	}
+	policy, err := moderation.NewPolicyFromEnv()
+	if err != nil {
+		log.Fatalf("failed to configure moderation: %v", err)
+	}
+	moderation.SetPolicy(policy)
+
+	config, err := api.ConfigFromEnv()
+	if err != nil {
+		log.Fatalf("failed to configure the API: %v", err)
+	}
+
+	reloadMockFixturesOnSIGHUP()
+
 	router := gin.New()
 	router.Use(gin.Recovery())
 	router.Use(middleware.RequestID())
 	router.Use(middleware.Logging())
+	router.Use(middleware.Metrics())
 	router.Use(cors.New(cors.Config{
 		AllowOrigins: []string{
 			"http://localhost:3000",
 			"http://localhost:5173",
 			"http://localhost",
 		},
-		AllowMethods: []string{"GET", "POST", "OPTIONS"},
+		AllowMethods: []string{"GET", "POST", "DELETE", "OPTIONS"},
 		AllowHeaders: []string{
 			"Origin",
 			"Content-Type",
@@ -30,17 +64,67 @@ func main() {
 			"X-Request-Id",
 			"X-Connector-Key",
 			"X-Connector-Session",
+			"X-API-Key",
+			"X-Admin-Key",
+			"Idempotency-Key",
 		},
 	}))
 
-	api.RegisterRoutes(router)
+	jobManager, dispatcher := api.RegisterRoutes(router, config)
 
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8080"
 	}
 
-	if err := router.Run(":" + port); err != nil {
-		log.Fatalf("failed to start server on port %s: %v", port, err)
+	serveUntilSignalled(&http.Server{Addr: ":" + port, Handler: router})
+	// Queued and running jobs are canceled and report through their
+	// callbacks, so the dispatcher closes last.
+	jobManager.Close()
+	drainCtx, cancel := context.WithTimeout(context.Background(), callbackDrainTimeout)
+	defer cancel()
+	dispatcher.Close(drainCtx)
+	log.Printf("component=server event=stopped")
+}
+
+// serveUntilSignalled serves until SIGINT or SIGTERM, then stops accepting
+// connections and waits up to shutdownTimeout for in-flight requests.
+func serveUntilSignalled(server *http.Server) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	failed := make(chan error, 1)
+	go func() {
+		if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			failed <- err
+		}
+	}()
+
+	select {
+	case err := <-failed:
+		log.Fatalf("failed to start server on %s: %v", server.Addr, err)
+	case <-ctx.Done():
 	}
+	stop()
+
+	log.Printf("component=server event=shutting_down timeout_ms=%d", shutdownTimeout.Milliseconds())
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Printf("component=server event=shutdown_incomplete error=%q", err.Error())
+	}
+}
+
+// reloadMockFixturesOnSIGHUP reloads MOCK_FIXTURES_FILE whenever the process
+// receives SIGHUP.
+func reloadMockFixturesOnSIGHUP() {
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	go func() {
+		for range hangups {
+			if _, err := llm.ReloadMockFixtures(); err != nil {
+				log.Printf("component=mock_fixtures event=sighup_ignored error=%q", err.Error())
+			}
+		}
+	}()
 }
@@ -0,0 +1,254 @@
+package agents
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/alanmaizon/homer/backend/internal/domain"
+	"github.com/alanmaizon/homer/backend/internal/llm"
+	"github.com/alanmaizon/homer/backend/internal/middleware"
+)
+
+const (
+	BudgetStrategyReject   = "reject"
+	BudgetStrategyTruncate = "truncate"
+	BudgetStrategyDrop     = "drop"
+
+	budgetActionNone      = "none"
+	budgetActionTruncated = "truncated"
+	budgetActionDropped   = "dropped"
+
+	// promptOverheadTokens covers the system prompt and template text around
+	// the request fields; perDocumentOverheadTokens covers document framing.
+	promptOverheadTokens      = 512
+	perDocumentOverheadTokens = 16
+	minTruncatedDocTokens     = 32
+	truncationMarker          = " [truncated]"
+)
+
+// ErrContextBudgetExceeded is matched by errors returned when a request does
+// not fit the model's context window under the configured strategy.
+var ErrContextBudgetExceeded = errors.New("request exceeds the model context window")
+
+type ContextBudgetError struct {
+	Model           string
+	EstimatedTokens int
+	BudgetTokens    int
+}
+
+func (e *ContextBudgetError) Error() string {
+	return fmt.Sprintf("request needs about %d input tokens but %s allows %d", e.EstimatedTokens, e.Model, e.BudgetTokens)
+}
+
+func (e *ContextBudgetError) Unwrap() error {
+	return ErrContextBudgetExceeded
+}
+
+// contextBudgetStrategyFromEnv reads CONTEXT_BUDGET_STRATEGY: reject (the
+// default), truncate or drop.
+func contextBudgetStrategyFromEnv() string {
+	switch strategy := strings.ToLower(strings.TrimSpace(os.Getenv("CONTEXT_BUDGET_STRATEGY"))); strategy {
+	case BudgetStrategyTruncate, BudgetStrategyDrop:
+		return strategy
+	default:
+		return BudgetStrategyReject
+	}
+}
+
+// applyContextBudget fits req to the current provider's model before it is
+// sent upstream.
+func applyContextBudget(ctx context.Context, req domain.TaskRequest, params domain.GenerationParams) (domain.TaskRequest, *domain.ContextBudgetMetadata, error) {
+	model := llm.ModelFor(llm.CurrentProvider())
+	fitted, budget, err := fitContextBudget(req, params, model, contextBudgetStrategyFromEnv())
+	if err != nil {
+		return domain.TaskRequest{}, nil, err
+	}
+
+	if budget.Action != budgetActionNone {
+		log.Printf(
+			"request_id=%s component=context_budget model=%s action=%s estimated_tokens=%d budget_tokens=%d documents=%d",
+			middleware.GetRequestIDFromContext(ctx),
+			budget.Model,
+			budget.Action,
+			budget.EstimatedTokens,
+			budget.InputBudgetTokens,
+			len(budget.AffectedDocuments),
+		)
+	}
+	return fitted, budget, nil
+}
+
+func fitContextBudget(req domain.TaskRequest, params domain.GenerationParams, model llm.ModelInfo, strategy string) (domain.TaskRequest, *domain.ContextBudgetMetadata, error) {
+	budget := &domain.ContextBudgetMetadata{
+		Model:             model.Name,
+		ContextWindow:     model.ContextWindow,
+		InputBudgetTokens: max(promptBudgetTokens(model, params)-promptOverheadTokens, 0),
+		EstimatedTokens:   EstimateRequestTokens(req),
+		Strategy:          strategy,
+		Action:            budgetActionNone,
+	}
+	if budget.EstimatedTokens <= budget.InputBudgetTokens {
+		return req, budget, nil
+	}
+
+	exceeded := &ContextBudgetError{Model: model.Name, EstimatedTokens: budget.EstimatedTokens, BudgetTokens: budget.InputBudgetTokens}
+	if req.Task != domain.TaskSummarize {
+		return req, nil, exceeded
+	}
+
+	var (
+		docs     []domain.Document
+		affected []string
+		ok       bool
+	)
+	switch strategy {
+	case BudgetStrategyTruncate:
+		docs, affected, ok = truncateDocumentsEvenly(req, budget.InputBudgetTokens)
+		budget.Action = budgetActionTruncated
+	case BudgetStrategyDrop:
+		docs, affected, ok = dropLowPriorityDocuments(req, budget.InputBudgetTokens)
+		budget.Action = budgetActionDropped
+	}
+	if !ok {
+		return req, nil, exceeded
+	}
+
+	req.Documents = docs
+	budget.AffectedDocuments = affected
+	return req, budget, nil
+}
+
+// promptBudgetTokens is what the context window leaves for the rendered
+// prompt once the output is reserved.
+func promptBudgetTokens(model llm.ModelInfo, params domain.GenerationParams) int {
+	outputReserve := min(model.MaxOutputTokens, maxOutputTokensFromEnv())
+	if params.MaxTokens != nil {
+		outputReserve = *params.MaxTokens
+	}
+	return max(model.ContextWindow-outputReserve, 0)
+}
+
+// EstimateRequestTokens approximates the prompt tokens req will use before
+// templates are applied.
+func EstimateRequestTokens(req domain.TaskRequest) int {
+	tokens := llm.EstimateTokens(req.Instructions)
+	if req.Task == domain.TaskRewrite {
+		return tokens + llm.EstimateTokens(req.Mode) + llm.EstimateTokens(req.Text)
+	}
+
+	tokens += llm.EstimateTokens(req.Style)
+	for _, doc := range req.Documents {
+		tokens += documentFrameTokens(doc) + llm.EstimateTokens(doc.Content)
+	}
+	return tokens
+}
+
+func documentFrameTokens(doc domain.Document) int {
+	return perDocumentOverheadTokens + llm.EstimateTokens(doc.Title)
+}
+
+// truncateDocumentsEvenly gives every document an equal share of the budget
+// left after the fixed prompt parts; documents smaller than their share keep
+// their full text and pass the remainder on to the larger ones.
+func truncateDocumentsEvenly(req domain.TaskRequest, budget int) ([]domain.Document, []string, bool) {
+	available := budget - llm.EstimateTokens(req.Instructions) - llm.EstimateTokens(req.Style)
+	contentTokens := make([]int, len(req.Documents))
+	for i, doc := range req.Documents {
+		available -= documentFrameTokens(doc)
+		contentTokens[i] = llm.EstimateTokens(doc.Content)
+	}
+	if available < minTruncatedDocTokens*len(req.Documents) {
+		return nil, nil, false
+	}
+
+	order := make([]int, len(req.Documents))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return contentTokens[order[a]] < contentTokens[order[b]] })
+
+	shares := make([]int, len(req.Documents))
+	for position, docIndex := range order {
+		share := available / (len(order) - position)
+		shares[docIndex] = min(contentTokens[docIndex], share)
+		available -= shares[docIndex]
+	}
+
+	docs := make([]domain.Document, len(req.Documents))
+	affected := make([]string, 0, len(req.Documents))
+	for i, doc := range req.Documents {
+		docs[i] = doc
+		if shares[i] < contentTokens[i] {
+			docs[i].Content = truncateToTokens(doc.Content, shares[i])
+			affected = append(affected, doc.ID)
+		}
+	}
+	return docs, affected, true
+}
+
+// dropLowPriorityDocuments removes documents, lowest priority first and later
+// documents before earlier ones on ties, until the request fits. At least one
+// document is always kept.
+func dropLowPriorityDocuments(req domain.TaskRequest, budget int) ([]domain.Document, []string, bool) {
+	order := make([]int, len(req.Documents))
+	for i := range order {
+		order[i] = len(req.Documents) - 1 - i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return req.Documents[order[a]].Priority < req.Documents[order[b]].Priority
+	})
+
+	estimate := EstimateRequestTokens(req)
+	dropped := make(map[int]bool)
+	affected := make([]string, 0, len(req.Documents))
+	for _, docIndex := range order {
+		if estimate <= budget || len(dropped) == len(req.Documents)-1 {
+			break
+		}
+		doc := req.Documents[docIndex]
+		estimate -= documentFrameTokens(doc) + llm.EstimateTokens(doc.Content)
+		dropped[docIndex] = true
+		affected = append(affected, doc.ID)
+	}
+	if estimate > budget {
+		return nil, nil, false
+	}
+
+	docs := make([]domain.Document, 0, len(req.Documents)-len(dropped))
+	for i, doc := range req.Documents {
+		if !dropped[i] {
+			docs = append(docs, doc)
+		}
+	}
+	return docs, affected, true
+}
+
+// truncateToTokens keeps the longest prefix of text, cut at whitespace where
+// possible, whose estimate plus the truncation marker fits limit.
+func truncateToTokens(text string, limit int) string {
+	limit -= llm.EstimateTokens(truncationMarker)
+	runes := []rune(text)
+	low, high := 0, len(runes)
+	for low < high {
+		mid := (low + high + 1) / 2
+		if llm.EstimateTokens(string(runes[:mid])) <= limit {
+			low = mid
+		} else {
+			high = mid - 1
+		}
+	}
+
+	cut := low
+	for i := low; i > low*4/5; i-- {
+		if i < len(runes) && (runes[i] == ' ' || runes[i] == '\n') {
+			cut = i
+			break
+		}
+	}
+	return strings.TrimRight(string(runes[:cut]), " \n") + truncationMarker
+}
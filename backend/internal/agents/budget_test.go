@@ -0,0 +1,115 @@
+package agents
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/alanmaizon/homer/backend/internal/domain"
+	"github.com/alanmaizon/homer/backend/internal/llm"
+)
+
+// tinyModel leaves 1200 - 100 - promptOverheadTokens = 588 input tokens.
+var tinyModel = llm.ModelInfo{Name: "tiny", ContextWindow: 1200, MaxOutputTokens: 100}
+
+func oversizedSummarizeRequest() domain.TaskRequest {
+	return domain.TaskRequest{
+		Task: domain.TaskSummarize,
+		Documents: []domain.Document{
+			{ID: "a", Title: "A", Content: strings.Repeat("alpha ", 300), Priority: 1},
+			{ID: "b", Title: "B", Content: strings.Repeat("bravo ", 50), Priority: 5},
+			{ID: "c", Title: "C", Content: strings.Repeat("charlie ", 300)},
+		},
+	}
+}
+
+func TestFitContextBudgetRejectsOversizedRequest(t *testing.T) {
+	_, _, err := fitContextBudget(oversizedSummarizeRequest(), domain.GenerationParams{}, tinyModel, BudgetStrategyReject)
+
+	var budgetErr *ContextBudgetError
+	if !errors.As(err, &budgetErr) || !errors.Is(err, ErrContextBudgetExceeded) {
+		t.Fatalf("expected ContextBudgetError, got %v", err)
+	}
+	if budgetErr.BudgetTokens != 588 || budgetErr.EstimatedTokens <= 588 {
+		t.Fatalf("unexpected budget error %+v", budgetErr)
+	}
+}
+
+func TestFitContextBudgetTruncatesEvenly(t *testing.T) {
+	fitted, budget, err := fitContextBudget(oversizedSummarizeRequest(), domain.GenerationParams{}, tinyModel, BudgetStrategyTruncate)
+	if err != nil {
+		t.Fatalf("fitContextBudget returned error: %v", err)
+	}
+
+	if budget.Action != budgetActionTruncated || strings.Join(budget.AffectedDocuments, ",") != "a,c" {
+		t.Fatalf("unexpected budget metadata %+v", budget)
+	}
+	if len(fitted.Documents) != 3 || fitted.Documents[1].Content != strings.Repeat("bravo ", 50) {
+		t.Fatalf("expected the small document to stay intact, got %+v", fitted.Documents[1])
+	}
+	if !strings.HasSuffix(fitted.Documents[0].Content, truncationMarker) {
+		t.Fatalf("expected truncation marker, got %q", fitted.Documents[0].Content)
+	}
+	if estimate := EstimateRequestTokens(fitted); estimate > budget.InputBudgetTokens {
+		t.Fatalf("truncated request still needs %d tokens, budget %d", estimate, budget.InputBudgetTokens)
+	}
+
+	first, second := llm.EstimateTokens(fitted.Documents[0].Content), llm.EstimateTokens(fitted.Documents[2].Content)
+	if diff := first - second; diff < -10 || diff > 10 {
+		t.Fatalf("expected even shares, got %d and %d tokens", first, second)
+	}
+}
+
+func TestFitContextBudgetDropsLowestPriority(t *testing.T) {
+	fitted, budget, err := fitContextBudget(oversizedSummarizeRequest(), domain.GenerationParams{}, tinyModel, BudgetStrategyDrop)
+	if err != nil {
+		t.Fatalf("fitContextBudget returned error: %v", err)
+	}
+
+	if budget.Action != budgetActionDropped || strings.Join(budget.AffectedDocuments, ",") != "c,a" {
+		t.Fatalf("unexpected budget metadata %+v", budget)
+	}
+	if len(fitted.Documents) != 1 || fitted.Documents[0].ID != "b" {
+		t.Fatalf("expected only the highest priority document, got %+v", fitted.Documents)
+	}
+}
+
+func TestFitContextBudgetRejectsOversizedRewrite(t *testing.T) {
+	req := domain.TaskRequest{Task: domain.TaskRewrite, Mode: "simplify", Text: strings.Repeat("alpha ", 400)}
+
+	_, _, err := fitContextBudget(req, domain.GenerationParams{}, tinyModel, BudgetStrategyTruncate)
+	if !errors.Is(err, ErrContextBudgetExceeded) {
+		t.Fatalf("expected rewrite text to never be truncated, got %v", err)
+	}
+}
+
+func TestFitContextBudgetReservesRequestedOutput(t *testing.T) {
+	maxTokens := 600
+	req := domain.TaskRequest{Task: domain.TaskSummarize, Documents: []domain.Document{{ID: "a", Content: strings.Repeat("alpha ", 100)}}}
+
+	if _, budget, err := fitContextBudget(req, domain.GenerationParams{}, tinyModel, BudgetStrategyReject); err != nil || budget.Action != budgetActionNone {
+		t.Fatalf("expected request to fit by default, got %+v err=%v", budget, err)
+	}
+	if _, _, err := fitContextBudget(req, domain.GenerationParams{MaxTokens: &maxTokens}, tinyModel, BudgetStrategyReject); !errors.Is(err, ErrContextBudgetExceeded) {
+		t.Fatalf("expected a large maxTokens to shrink the input budget, got %v", err)
+	}
+}
+
+func TestExecuteTaskReportsContextBudget(t *testing.T) {
+	llm.SetProvider(llm.NewMockProvider())
+	t.Setenv("CONTEXT_BUDGET_STRATEGY", "")
+
+	response, err := ExecuteTask(context.Background(), domain.TaskRequest{
+		Task:      domain.TaskSummarize,
+		Documents: []domain.Document{{ID: "1", Title: "Doc", Content: "Hello world"}},
+	})
+	if err != nil {
+		t.Fatalf("ExecuteTask returned error: %v", err)
+	}
+
+	budget := response.Metadata.ContextBudget
+	if budget == nil || budget.Model != "mock" || budget.Strategy != BudgetStrategyReject || budget.Action != budgetActionNone {
+		t.Fatalf("unexpected context budget metadata %+v", budget)
+	}
+}
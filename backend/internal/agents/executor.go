@@ -8,13 +8,13 @@ import (
 	"github.com/alanmaizon/homer/backend/internal/llm"
 )
 
-func ExecuteStep(ctx context.Context, step domain.PlanStep, req domain.TaskRequest) (string, error) {
+func ExecuteStep(ctx context.Context, step domain.PlanStep, req domain.TaskRequest, params domain.GenerationParams) (string, error) {
 	provider := llm.CurrentProvider()
 	switch step.Action {
 	case string(domain.TaskSummarize):
-		return provider.Summarize(ctx, req.Documents, req.Style, req.Instructions)
+		return provider.Summarize(ctx, req.Documents, req.Style, req.Instructions, params)
 	case string(domain.TaskRewrite):
-		return provider.Rewrite(ctx, req.Text, req.Mode, req.Instructions)
+		return provider.Rewrite(ctx, req.Text, req.Mode, req.Instructions, params)
 	default:
 		return "", errors.New("unsupported executor action")
 	}
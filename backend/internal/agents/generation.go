@@ -0,0 +1,94 @@
+package agents
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/alanmaizon/homer/backend/internal/domain"
+)
+
+const (
+	defaultMaxOutputTokens = 4096
+	maxStopSequences       = 4
+	maxStopSequenceLength  = 64
+)
+
+// taskGenerationDefaults keeps summaries factual and gives rewrites more room
+// for wording changes. Fields left nil fall through to the provider default.
+var taskGenerationDefaults = map[domain.TaskType]domain.GenerationParams{
+	domain.TaskSummarize: {Temperature: float64Ptr(0.2)},
+	domain.TaskRewrite:   {Temperature: float64Ptr(0.7)},
+}
+
+// ValidateGenerationParams checks requested generation parameters against the
+// server-side bounds. A nil value is valid and means "use the defaults".
+func ValidateGenerationParams(params *domain.GenerationParams) error {
+	if params == nil {
+		return nil
+	}
+
+	if params.Temperature != nil && (*params.Temperature < 0 || *params.Temperature > 2) {
+		return fmt.Errorf("temperature must be between 0 and 2")
+	}
+	if params.TopP != nil && (*params.TopP <= 0 || *params.TopP > 1) {
+		return fmt.Errorf("topP must be greater than 0 and at most 1")
+	}
+	if params.MaxTokens != nil {
+		limit := maxOutputTokensFromEnv()
+		if *params.MaxTokens < 1 || *params.MaxTokens > limit {
+			return fmt.Errorf("maxTokens must be between 1 and %d", limit)
+		}
+	}
+	if len(params.Stop) > maxStopSequences {
+		return fmt.Errorf("stop accepts at most %d sequences", maxStopSequences)
+	}
+	for _, sequence := range params.Stop {
+		if sequence == "" || len(sequence) > maxStopSequenceLength {
+			return fmt.Errorf("stop sequences must be 1 to %d characters", maxStopSequenceLength)
+		}
+	}
+
+	return nil
+}
+
+// ResolveGenerationParams layers the requested parameters over the per-task
+// defaults.
+func ResolveGenerationParams(task domain.TaskType, requested *domain.GenerationParams) domain.GenerationParams {
+	resolved := taskGenerationDefaults[task]
+	if requested == nil {
+		return resolved
+	}
+
+	if requested.Temperature != nil {
+		resolved.Temperature = requested.Temperature
+	}
+	if requested.MaxTokens != nil {
+		resolved.MaxTokens = requested.MaxTokens
+	}
+	if requested.TopP != nil {
+		resolved.TopP = requested.TopP
+	}
+	if len(requested.Stop) > 0 {
+		resolved.Stop = requested.Stop
+	}
+	return resolved
+}
+
+func maxOutputTokensFromEnv() int {
+	raw := strings.TrimSpace(os.Getenv("LLM_MAX_OUTPUT_TOKENS"))
+	if raw == "" {
+		return defaultMaxOutputTokens
+	}
+
+	value, err := strconv.Atoi(raw)
+	if err != nil || value <= 0 {
+		return defaultMaxOutputTokens
+	}
+	return value
+}
+
+func float64Ptr(value float64) *float64 {
+	return &value
+}
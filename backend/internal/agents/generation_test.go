@@ -0,0 +1,70 @@
+package agents
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/alanmaizon/homer/backend/internal/domain"
+)
+
+func TestValidateGenerationParams(t *testing.T) {
+	negative, tooHot, zero, half := -0.1, 2.5, 0.0, 0.5
+	tooMany, ok := 5000, 100
+
+	testCases := []struct {
+		name    string
+		params  *domain.GenerationParams
+		wantErr string
+	}{
+		{name: "nil", params: nil},
+		{name: "valid", params: &domain.GenerationParams{Temperature: &half, TopP: &half, MaxTokens: &ok, Stop: []string{"END"}}},
+		{name: "negative_temperature", params: &domain.GenerationParams{Temperature: &negative}, wantErr: "temperature"},
+		{name: "temperature_too_high", params: &domain.GenerationParams{Temperature: &tooHot}, wantErr: "temperature"},
+		{name: "zero_top_p", params: &domain.GenerationParams{TopP: &zero}, wantErr: "topP"},
+		{name: "max_tokens_above_limit", params: &domain.GenerationParams{MaxTokens: &tooMany}, wantErr: "maxTokens must be between 1 and 4096"},
+		{name: "too_many_stop", params: &domain.GenerationParams{Stop: []string{"a", "b", "c", "d", "e"}}, wantErr: "stop"},
+		{name: "empty_stop", params: &domain.GenerationParams{Stop: []string{""}}, wantErr: "stop"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Setenv("LLM_MAX_OUTPUT_TOKENS", "")
+
+			err := ValidateGenerationParams(tc.params)
+			if tc.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestValidateGenerationParamsHonorsConfiguredLimit(t *testing.T) {
+	t.Setenv("LLM_MAX_OUTPUT_TOKENS", "8000")
+
+	maxTokens := 6000
+	if err := ValidateGenerationParams(&domain.GenerationParams{MaxTokens: &maxTokens}); err != nil {
+		t.Fatalf("expected configured limit to allow 6000 tokens, got %v", err)
+	}
+}
+
+func TestResolveGenerationParams(t *testing.T) {
+	summary := ResolveGenerationParams(domain.TaskSummarize, nil)
+	if summary.Temperature == nil || *summary.Temperature != 0.2 {
+		t.Fatalf("unexpected summarize defaults: %+v", summary)
+	}
+
+	temperature := 1.1
+	rewrite := ResolveGenerationParams(domain.TaskRewrite, &domain.GenerationParams{Temperature: &temperature, Stop: []string{"END"}})
+	if *rewrite.Temperature != 1.1 || len(rewrite.Stop) != 1 {
+		t.Fatalf("expected requested params to override defaults: %+v", rewrite)
+	}
+	if again := ResolveGenerationParams(domain.TaskRewrite, nil); *again.Temperature != 0.7 {
+		t.Fatalf("defaults were mutated: %+v", again)
+	}
+}
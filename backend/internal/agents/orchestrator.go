@@ -6,21 +6,53 @@ import (
 
 	"github.com/alanmaizon/homer/backend/internal/domain"
 	"github.com/alanmaizon/homer/backend/internal/llm"
+	"github.com/alanmaizon/homer/backend/internal/moderation"
 )
 
 func ExecuteTask(ctx context.Context, req domain.TaskRequest) (domain.TaskResponse, error) {
 	started := time.Now()
+	ctx, callInfo := llm.WithCallInfo(ctx)
 
 	plan, err := Plan(req)
 	if err != nil {
 		return domain.TaskResponse{}, err
 	}
 
+	policy := moderation.CurrentPolicy()
+	inputDecisions, err := policy.Check(ctx, moderation.StageInput, moderationInputs(req))
+	if err != nil {
+		return domain.TaskResponse{}, err
+	}
+
+	params := ResolveGenerationParams(req.Task, req.Generation)
+
+	var retrieval *domain.RetrievalMetadata
+	if req.Task == domain.TaskSummarize {
+		req.Documents, retrieval = selectRelevantChunks(ctx, req)
+	}
+
+	req, budget, err := applyContextBudget(ctx, req, params)
+	if err != nil {
+		return domain.TaskResponse{}, err
+	}
+
 	result := ""
+	executed := make([]domain.PlanStep, 0, len(plan))
 	for _, step := range plan {
+		executed = append(executed, step)
 		switch step.Role {
 		case domain.RoleExecutor:
-			result, err = ExecuteStep(ctx, step, req)
+			if req.EnableTools {
+				var (
+					toolSteps     []domain.PlanStep
+					toolDecisions []domain.ModerationDecision
+				)
+				result, toolSteps, toolDecisions, err = executeWithTools(ctx, step, req, params)
+				executed = append(executed, toolSteps...)
+				inputDecisions = append(inputDecisions, toolDecisions...)
+			} else {
+				result, err = ExecuteStep(ctx, step, req, params)
+			}
 			if err != nil {
 				return domain.TaskResponse{}, err
 			}
@@ -28,6 +60,14 @@ func ExecuteTask(ctx context.Context, req domain.TaskRequest) (domain.TaskRespon
 			result = Critique(result)
 		}
 	}
+	plan = executed
+
+	outputDecisions, err := policy.Check(ctx, moderation.StageOutput, []string{result})
+	if err != nil {
+		return domain.TaskResponse{}, err
+	}
+
+	promptTemplate, promptVersion := callInfo.Prompt()
 
 	return domain.TaskResponse{
 		Result: result,
@@ -35,6 +75,21 @@ func ExecuteTask(ctx context.Context, req domain.TaskRequest) (domain.TaskRespon
 		Metadata: domain.Metadata{
 			Provider:        llm.CurrentProvider().Name(),
 			ExecutionTimeMs: time.Since(started).Milliseconds(),
+			PromptTemplate:  promptTemplate,
+			PromptVersion:   promptVersion,
+			Generation:      &params,
+			Retrieval:       retrieval,
+			ContextBudget:   budget,
+			Moderation:      moderation.Warnings(append(inputDecisions, outputDecisions...)),
 		},
 	}, nil
 }
+
+// moderationInputs lists the user-supplied texts checked before execution.
+func moderationInputs(req domain.TaskRequest) []string {
+	inputs := []string{req.Instructions, req.Text}
+	for _, doc := range req.Documents {
+		inputs = append(inputs, doc.Title, doc.Content)
+	}
+	return inputs
+}
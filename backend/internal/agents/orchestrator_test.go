@@ -46,3 +46,26 @@ func TestExecuteTaskCritic(t *testing.T) {
 		t.Fatalf("critic output missing: %s", response.Result)
 	}
 }
+
+func TestExecuteTaskEchoesGenerationParams(t *testing.T) {
+	llm.SetProvider(llm.NewMockProvider())
+
+	maxTokens := 300
+	response, err := ExecuteTask(context.Background(), domain.TaskRequest{
+		Task:       domain.TaskRewrite,
+		Text:       "Rewrite this.",
+		Mode:       "professional",
+		Generation: &domain.GenerationParams{MaxTokens: &maxTokens},
+	})
+	if err != nil {
+		t.Fatalf("ExecuteTask returned error: %v", err)
+	}
+
+	generation := response.Metadata.Generation
+	if generation == nil || generation.Temperature == nil || *generation.Temperature != 0.7 {
+		t.Fatalf("expected rewrite default temperature, got %+v", generation)
+	}
+	if generation.MaxTokens == nil || *generation.MaxTokens != 300 {
+		t.Fatalf("expected requested maxTokens, got %+v", generation)
+	}
+}
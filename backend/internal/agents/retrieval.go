@@ -0,0 +1,268 @@
+package agents
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alanmaizon/homer/backend/internal/domain"
+	"github.com/alanmaizon/homer/backend/internal/llm"
+	"github.com/alanmaizon/homer/backend/internal/middleware"
+	"github.com/alanmaizon/homer/backend/internal/vectorindex"
+)
+
+const (
+	defaultRetrievalChunkChars = 1500
+	defaultRetrievalMinChars   = 12000
+	retrievalChunkOverlap      = 150
+	defaultVectorIndexEntries  = 10000
+)
+
+// indexSaveDelay batches the chunks embedded by concurrent requests into one
+// write of VECTOR_INDEX_PATH.
+var indexSaveDelay = 5 * time.Second
+
+type retrievalConfig struct {
+	topK       int
+	chunkChars int
+	minChars   int
+	indexPath  string
+	maxEntries int
+}
+
+// loadRetrievalConfigFromEnv reads RETRIEVAL_TOP_K (0 disables retrieval),
+// RETRIEVAL_CHUNK_CHARS, RETRIEVAL_MIN_CHARS, VECTOR_INDEX_PATH and
+// VECTOR_INDEX_MAX_ENTRIES.
+func loadRetrievalConfigFromEnv() retrievalConfig {
+	return retrievalConfig{
+		topK:       intFromEnv("RETRIEVAL_TOP_K", 0),
+		chunkChars: intFromEnv("RETRIEVAL_CHUNK_CHARS", defaultRetrievalChunkChars),
+		minChars:   intFromEnv("RETRIEVAL_MIN_CHARS", defaultRetrievalMinChars),
+		indexPath:  strings.TrimSpace(os.Getenv("VECTOR_INDEX_PATH")),
+		maxEntries: intFromEnv("VECTOR_INDEX_MAX_ENTRIES", defaultVectorIndexEntries),
+	}
+}
+
+func intFromEnv(key string, fallback int) int {
+	raw := strings.TrimSpace(os.Getenv(key))
+	if raw == "" {
+		return fallback
+	}
+	value, err := strconv.Atoi(raw)
+	if err != nil || value < 0 {
+		return fallback
+	}
+	return value
+}
+
+// chunkIndex caches chunk embeddings across requests, keyed by a hash of the
+// chunk text; the text itself is not kept. It holds the most recently used
+// VECTOR_INDEX_MAX_ENTRIES chunks, is loaded from VECTOR_INDEX_PATH on first
+// use and is saved in the background after new chunks are embedded, so
+// restarts do not re-embed known text.
+var chunkIndex struct {
+	mu          sync.Mutex
+	index       *vectorindex.Index
+	savePending bool
+}
+
+func indexForModel(model string, config retrievalConfig) *vectorindex.Index {
+	chunkIndex.mu.Lock()
+	defer chunkIndex.mu.Unlock()
+
+	if chunkIndex.index == nil || chunkIndex.index.Model() != model {
+		chunkIndex.index = loadIndex(model, config.indexPath)
+	}
+	chunkIndex.index.SetMaxEntries(config.maxEntries)
+	return chunkIndex.index
+}
+
+func loadIndex(model string, path string) *vectorindex.Index {
+	index := vectorindex.New(model)
+	if path != "" {
+		loaded, err := vectorindex.Load(path)
+		switch {
+		case err == nil && loaded.Model() == model:
+			index = loaded
+		case err == nil:
+			log.Printf("component=retrieval event=index_reset path=%s stored_model=%s model=%s", path, loaded.Model(), model)
+		case !errors.Is(err, os.ErrNotExist):
+			log.Printf("component=retrieval event=index_load_failed path=%s error=%q", path, err.Error())
+		}
+	}
+	return index
+}
+
+// scheduleIndexSave writes index to path after indexSaveDelay unless a write
+// is already scheduled.
+func scheduleIndexSave(index *vectorindex.Index, path string) {
+	chunkIndex.mu.Lock()
+	defer chunkIndex.mu.Unlock()
+	if chunkIndex.savePending {
+		return
+	}
+	chunkIndex.savePending = true
+	time.AfterFunc(indexSaveDelay, func() {
+		chunkIndex.mu.Lock()
+		chunkIndex.savePending = false
+		chunkIndex.mu.Unlock()
+		if err := index.Save(path); err != nil {
+			log.Printf("component=retrieval event=index_save_failed path=%s error=%q", path, err.Error())
+		}
+	})
+}
+
+type documentChunk struct {
+	id       string
+	docIndex int
+	text     string
+}
+
+// selectRelevantChunks narrows a large summarize request to the chunks most
+// similar to its instructions. It returns the original documents, and nil
+// metadata, whenever retrieval does not apply or embedding fails.
+func selectRelevantChunks(ctx context.Context, req domain.TaskRequest) ([]domain.Document, *domain.RetrievalMetadata) {
+	config := loadRetrievalConfigFromEnv()
+	query := strings.TrimSpace(req.Instructions)
+	if config.topK == 0 || query == "" || totalContentChars(req.Documents) < config.minChars {
+		return req.Documents, nil
+	}
+
+	embedder, err := llm.EmbedderFor(llm.CurrentProvider())
+	if err != nil {
+		return req.Documents, nil
+	}
+
+	chunks := chunkDocuments(req.Documents, config.chunkChars)
+	if len(chunks) <= config.topK {
+		return req.Documents, nil
+	}
+
+	selected, err := rankChunks(ctx, embedder, config, query, chunks)
+	if err != nil {
+		log.Printf(
+			"request_id=%s component=retrieval event=skipped error=%q",
+			middleware.GetRequestIDFromContext(ctx),
+			err.Error(),
+		)
+		return req.Documents, nil
+	}
+
+	log.Printf(
+		"request_id=%s component=retrieval event=selected model=%s chunks=%d selected=%d",
+		middleware.GetRequestIDFromContext(ctx),
+		embedder.EmbeddingModel(),
+		len(chunks),
+		len(selected),
+	)
+	return assembleDocuments(req.Documents, chunks, selected), &domain.RetrievalMetadata{
+		EmbeddingModel: embedder.EmbeddingModel(),
+		TotalChunks:    len(chunks),
+		SelectedChunks: len(selected),
+	}
+}
+
+func rankChunks(ctx context.Context, embedder llm.Embedder, config retrievalConfig, query string, chunks []documentChunk) (map[string]bool, error) {
+	index := indexForModel(embedder.EmbeddingModel(), config)
+
+	// The request's chunks are ranked in their own index so cache eviction
+	// cannot drop them.
+	ranked := vectorindex.New(embedder.EmbeddingModel())
+	wanted := make(map[string]bool, len(chunks))
+	missing := make([]documentChunk, 0, len(chunks))
+	for _, chunk := range chunks {
+		if wanted[chunk.id] {
+			continue
+		}
+		wanted[chunk.id] = true
+		if entry, ok := index.Get(chunk.id); ok {
+			if err := ranked.Upsert(entry); err != nil {
+				return nil, err
+			}
+		} else {
+			missing = append(missing, chunk)
+		}
+	}
+
+	texts := make([]string, 0, len(missing)+1)
+	for _, chunk := range missing {
+		texts = append(texts, chunk.text)
+	}
+	vectors, err := embedder.Embed(ctx, append(texts, query))
+	if err != nil {
+		return nil, err
+	}
+	if len(vectors) != len(texts)+1 {
+		return nil, errors.New("embedder returned an unexpected number of vectors")
+	}
+
+	entries := make([]vectorindex.Entry, 0, len(missing))
+	for i, chunk := range missing {
+		entries = append(entries, vectorindex.Entry{ID: chunk.id, Vector: vectors[i]})
+	}
+	if err := ranked.Upsert(entries...); err != nil {
+		return nil, err
+	}
+	if err := index.Upsert(entries...); err != nil {
+		return nil, err
+	}
+	if len(entries) > 0 && config.indexPath != "" {
+		scheduleIndexSave(index, config.indexPath)
+	}
+
+	results, err := ranked.Search(vectors[len(vectors)-1], config.topK, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	selected := make(map[string]bool, len(results))
+	for _, result := range results {
+		selected[result.ID] = true
+	}
+	return selected, nil
+}
+
+func chunkDocuments(docs []domain.Document, size int) []documentChunk {
+	chunks := make([]documentChunk, 0, len(docs))
+	for docIndex, doc := range docs {
+		for _, text := range vectorindex.Chunk(doc.Content, size, retrievalChunkOverlap) {
+			sum := sha256.Sum256([]byte(text))
+			chunks = append(chunks, documentChunk{id: hex.EncodeToString(sum[:12]), docIndex: docIndex, text: text})
+		}
+	}
+	return chunks
+}
+
+// assembleDocuments keeps the selected chunks in their original order, one
+// document per source document that contributed at least one chunk.
+func assembleDocuments(docs []domain.Document, chunks []documentChunk, selected map[string]bool) []domain.Document {
+	parts := make(map[int][]string)
+	for _, chunk := range chunks {
+		if selected[chunk.id] {
+			parts[chunk.docIndex] = append(parts[chunk.docIndex], chunk.text)
+		}
+	}
+
+	narrowed := make([]domain.Document, 0, len(parts))
+	for docIndex, doc := range docs {
+		if texts, ok := parts[docIndex]; ok {
+			narrowed = append(narrowed, domain.Document{ID: doc.ID, Title: doc.Title, Content: strings.Join(texts, "\n\n")})
+		}
+	}
+	return narrowed
+}
+
+func totalContentChars(docs []domain.Document) int {
+	total := 0
+	for _, doc := range docs {
+		total += len([]rune(doc.Content))
+	}
+	return total
+}
@@ -0,0 +1,113 @@
+package agents
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alanmaizon/homer/backend/internal/domain"
+	"github.com/alanmaizon/homer/backend/internal/llm"
+	"github.com/alanmaizon/homer/backend/internal/vectorindex"
+)
+
+// capturingProvider records the documents passed to Summarize and embeds with
+// the mock's hashed bag-of-words vectors.
+type capturingProvider struct {
+	*llm.MockProvider
+	docs []domain.Document
+}
+
+func (c *capturingProvider) Summarize(ctx context.Context, docs []domain.Document, style string, instructions string, params domain.GenerationParams) (string, error) {
+	c.docs = docs
+	return c.MockProvider.Summarize(ctx, docs, style, instructions, params)
+}
+
+func largeRetrievalDocuments() []domain.Document {
+	var filler strings.Builder
+	for i := 0; i < 40; i++ {
+		fmt.Fprintf(&filler, "Office plants were watered on day %d and the kitchen was restocked.\n\n", i)
+	}
+	return []domain.Document{
+		{ID: "ops", Title: "Operations", Content: filler.String()},
+		{ID: "finance", Title: "Finance", Content: "Quarterly revenue grew twelve percent driven by European revenue and new revenue contracts."},
+	}
+}
+
+func TestExecuteTaskSummarizeSelectsRelevantChunks(t *testing.T) {
+	indexPath := filepath.Join(t.TempDir(), "index.json")
+	t.Setenv("RETRIEVAL_TOP_K", "2")
+	t.Setenv("RETRIEVAL_CHUNK_CHARS", "300")
+	t.Setenv("RETRIEVAL_MIN_CHARS", "1000")
+	t.Setenv("VECTOR_INDEX_PATH", indexPath)
+	previousDelay := indexSaveDelay
+	indexSaveDelay = 0
+	t.Cleanup(func() { indexSaveDelay = previousDelay })
+
+	provider := &capturingProvider{MockProvider: llm.NewMockProvider()}
+	llm.SetProvider(provider)
+	t.Cleanup(func() { llm.SetProvider(llm.NewMockProvider()) })
+
+	response, err := ExecuteTask(context.Background(), domain.TaskRequest{
+		Task:         domain.TaskSummarize,
+		Documents:    largeRetrievalDocuments(),
+		Style:        "brief",
+		Instructions: "What happened to quarterly revenue?",
+	})
+	if err != nil {
+		t.Fatalf("ExecuteTask returned error: %v", err)
+	}
+
+	retrieval := response.Metadata.Retrieval
+	if retrieval == nil || retrieval.SelectedChunks != 2 || retrieval.TotalChunks <= 2 {
+		t.Fatalf("unexpected retrieval metadata %+v", retrieval)
+	}
+	found := false
+	for _, doc := range provider.docs {
+		if doc.ID == "finance" && strings.Contains(doc.Content, "Quarterly revenue") {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatalf("expected the finance chunk to be selected, got %+v", provider.docs)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	persisted, err := vectorindex.Load(indexPath)
+	for err != nil && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+		persisted, err = vectorindex.Load(indexPath)
+	}
+	if err != nil {
+		t.Fatalf("expected the index to be persisted: %v", err)
+	}
+	if persisted.Len() != retrieval.TotalChunks {
+		t.Fatalf("expected %d persisted chunks, got %d", retrieval.TotalChunks, persisted.Len())
+	}
+}
+
+func TestExecuteTaskSummarizeSkipsRetrievalWhenDisabled(t *testing.T) {
+	t.Setenv("RETRIEVAL_TOP_K", "")
+
+	provider := &capturingProvider{MockProvider: llm.NewMockProvider()}
+	llm.SetProvider(provider)
+	t.Cleanup(func() { llm.SetProvider(llm.NewMockProvider()) })
+
+	docs := largeRetrievalDocuments()
+	response, err := ExecuteTask(context.Background(), domain.TaskRequest{
+		Task:         domain.TaskSummarize,
+		Documents:    docs,
+		Instructions: "What happened to quarterly revenue?",
+	})
+	if err != nil {
+		t.Fatalf("ExecuteTask returned error: %v", err)
+	}
+	if response.Metadata.Retrieval != nil {
+		t.Fatalf("expected no retrieval metadata, got %+v", response.Metadata.Retrieval)
+	}
+	if len(provider.docs) != len(docs) || provider.docs[0].Content != docs[0].Content {
+		t.Fatalf("expected documents to pass through unchanged")
+	}
+}
@@ -0,0 +1,242 @@
+package agents
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/alanmaizon/homer/backend/internal/connectors"
+	"github.com/alanmaizon/homer/backend/internal/domain"
+	"github.com/alanmaizon/homer/backend/internal/llm"
+)
+
+// scriptedToolProvider replies to GenerateWithTools with its turns in order
+// and records the conversation it was sent each time.
+type scriptedToolProvider struct {
+	*llm.MockProvider
+	turns []llm.ToolTurn
+	seen  [][]llm.Message
+	tools []llm.ToolDefinition
+}
+
+func (s *scriptedToolProvider) GenerateWithTools(_ context.Context, messages []llm.Message, tools []llm.ToolDefinition, _ domain.GenerationParams) (llm.ToolTurn, error) {
+	s.seen = append(s.seen, append([]llm.Message(nil), messages...))
+	s.tools = tools
+	if len(s.seen) > len(s.turns) {
+		return s.turns[len(s.turns)-1], nil
+	}
+	return s.turns[len(s.seen)-1], nil
+}
+
+type fakeConnector struct {
+	documents map[string]domain.Document
+}
+
+func (f *fakeConnector) Name() string {
+	return "fake_docs"
+}
+
+func (f *fakeConnector) ImportDocument(_ context.Context, req connectors.ImportRequest) (domain.Document, error) {
+	doc, ok := f.documents[req.DocumentID]
+	if !ok {
+		return domain.Document{}, connectors.ErrDocumentNotFound
+	}
+	return doc, nil
+}
+
+func (f *fakeConnector) ExportContent(context.Context, connectors.ExportRequest) error {
+	return connectors.ErrNotImplemented
+}
+
+func toolCall(id string, name string, arguments string) llm.ToolCall {
+	return llm.ToolCall{ID: id, Name: name, Arguments: json.RawMessage(arguments)}
+}
+
+func setToolProviderForTest(t *testing.T, provider llm.LLMProvider) {
+	t.Helper()
+	llm.SetProvider(provider)
+	t.Cleanup(func() { llm.SetProvider(llm.NewMockProvider()) })
+}
+
+func TestExecuteTaskWithToolsImportsAndSearches(t *testing.T) {
+	provider := &scriptedToolProvider{
+		MockProvider: llm.NewMockProvider(),
+		turns: []llm.ToolTurn{
+			{Calls: []llm.ToolCall{
+				toolCall("c1", ToolImportDocument, `{"documentId":"roadmap"}`),
+				toolCall("c2", ToolImportDocument, `{"documentId":"missing"}`),
+			}},
+			{Calls: []llm.ToolCall{toolCall("c3", ToolSearchDocuments, `{"query":"launch date"}`)}},
+			{Text: "The launch is planned for May."},
+		},
+	}
+	setToolProviderForTest(t, provider)
+
+	ctx := WithConnector(context.Background(), &fakeConnector{documents: map[string]domain.Document{
+		"roadmap": {ID: "roadmap", Title: "Roadmap", Content: "The public launch date moved to May after beta feedback."},
+	}}, "session-1", 0)
+	ctx, callInfo := llm.WithCallInfo(ctx)
+	response, err := ExecuteTask(ctx, domain.TaskRequest{
+		Task:         domain.TaskSummarize,
+		Documents:    []domain.Document{{ID: "notes", Title: "Notes", Content: "Team notes without dates."}},
+		Style:        "brief",
+		Instructions: "When is the launch?",
+		EnableTools:  true,
+		EnableCritic: true,
+	})
+	if err != nil {
+		t.Fatalf("ExecuteTask returned error: %v", err)
+	}
+	if !strings.HasPrefix(response.Result, "The launch is planned for May.") {
+		t.Fatalf("unexpected result %q", response.Result)
+	}
+
+	if len(provider.tools) != 2 || provider.tools[0].Name != ToolImportDocument || provider.tools[1].Name != ToolSearchDocuments {
+		t.Fatalf("expected import and search tools, got %+v", provider.tools)
+	}
+
+	wantPlan := []struct {
+		id     string
+		role   domain.AgentRole
+		action string
+		failed bool
+	}{
+		{"step-1", domain.RoleExecutor, "summarize", false},
+		{"step-1.1", domain.RoleTool, ToolImportDocument, false},
+		{"step-1.2", domain.RoleTool, ToolImportDocument, true},
+		{"step-1.3", domain.RoleTool, ToolSearchDocuments, false},
+		{"step-2", domain.RoleCritic, "review_result", false},
+	}
+	if len(response.Plan) != len(wantPlan) {
+		t.Fatalf("expected %d plan steps, got %+v", len(wantPlan), response.Plan)
+	}
+	for i, want := range wantPlan {
+		got := response.Plan[i]
+		if got.ID != want.id || got.Role != want.role || got.Action != want.action || (got.Error != "") != want.failed {
+			t.Fatalf("plan step %d: expected %+v, got %+v", i, want, got)
+		}
+	}
+
+	// The failed import is reported to the model, and the search covers the
+	// imported document.
+	final := provider.seen[2]
+	if !strings.Contains(final[len(final)-3].Content, "error: connector document not found") {
+		t.Fatalf("expected import error to be shown to the model, got %+v", final[len(final)-3])
+	}
+	if result := final[len(final)-1]; result.ToolCallID != "c3" || !strings.Contains(result.Content, "[roadmap] Roadmap") {
+		t.Fatalf("expected search to find the imported document, got %+v", result)
+	}
+	if callInfo.ToolLoopTokens() == 0 {
+		t.Fatalf("expected the tool turns to be recorded for quota")
+	}
+}
+
+func TestExecuteTaskWithToolsCapsImportedDocuments(t *testing.T) {
+	provider := &scriptedToolProvider{
+		MockProvider: llm.NewMockProvider(),
+		turns: []llm.ToolTurn{
+			{Calls: []llm.ToolCall{
+				toolCall("c1", ToolImportDocument, `{"documentId":"roadmap"}`),
+				toolCall("c2", ToolImportDocument, `{"documentId":"roadmap"}`),
+			}},
+			{Text: "Done."},
+		},
+	}
+	setToolProviderForTest(t, provider)
+
+	ctx := WithConnector(context.Background(), &fakeConnector{documents: map[string]domain.Document{
+		"roadmap": {ID: "roadmap", Title: "Roadmap", Content: "Launch in May."},
+	}}, "session-1", 2)
+	response, err := ExecuteTask(ctx, domain.TaskRequest{
+		Task:        domain.TaskSummarize,
+		Documents:   []domain.Document{{ID: "notes", Title: "Notes", Content: "Team notes."}},
+		EnableTools: true,
+	})
+	if err != nil {
+		t.Fatalf("ExecuteTask returned error: %v", err)
+	}
+	if response.Plan[1].Error != "" || !strings.Contains(response.Plan[2].Error, "maximum of 2 documents") {
+		t.Fatalf("expected only the first import to be allowed, got %+v", response.Plan)
+	}
+}
+
+func TestExecuteTaskWithToolsChecksContextBudgetEachTurn(t *testing.T) {
+	provider := &scriptedToolProvider{
+		MockProvider: llm.NewMockProvider(),
+		turns: []llm.ToolTurn{
+			{Calls: []llm.ToolCall{
+				toolCall("c1", ToolImportDocument, `{"documentId":"large"}`),
+				toolCall("c2", ToolImportDocument, `{"documentId":"large"}`),
+			}},
+			{Text: "Done."},
+		},
+	}
+	setToolProviderForTest(t, provider)
+
+	// Punctuation counts one token per character, so each truncated import
+	// is about 16000 tokens against the mock model's 32768-token window.
+	ctx := WithConnector(context.Background(), &fakeConnector{documents: map[string]domain.Document{
+		"large": {ID: "large", Title: "Large", Content: strings.Repeat("!", 20000)},
+	}}, "session-1", 0)
+	_, err := ExecuteTask(ctx, domain.TaskRequest{
+		Task:        domain.TaskSummarize,
+		Documents:   []domain.Document{{ID: "notes", Title: "Notes", Content: "Team notes."}},
+		EnableTools: true,
+	})
+	if !errors.Is(err, ErrContextBudgetExceeded) {
+		t.Fatalf("expected ErrContextBudgetExceeded, got %v", err)
+	}
+	if len(provider.seen) != 1 {
+		t.Fatalf("expected the over-budget turn not to be sent, got %d turns", len(provider.seen))
+	}
+}
+
+func TestExecuteTaskWithToolsStopsAtStepLimit(t *testing.T) {
+	t.Setenv("AGENT_MAX_TOOL_STEPS", "2")
+	provider := &scriptedToolProvider{
+		MockProvider: llm.NewMockProvider(),
+		turns:        []llm.ToolTurn{{Calls: []llm.ToolCall{toolCall("c", ToolSearchDocuments, `{"query":"anything"}`)}}},
+	}
+	setToolProviderForTest(t, provider)
+
+	_, err := ExecuteTask(context.Background(), domain.TaskRequest{
+		Task:        domain.TaskRewrite,
+		Text:        "Rewrite this.",
+		EnableTools: true,
+	})
+	if !errors.Is(err, ErrToolStepsExceeded) {
+		t.Fatalf("expected ErrToolStepsExceeded, got %v", err)
+	}
+	if len(provider.seen) != 3 {
+		t.Fatalf("expected 2 tool turns and one over the limit, got %d", len(provider.seen))
+	}
+}
+
+func TestExecuteTaskWithToolsRequiresToolCaller(t *testing.T) {
+	setToolProviderForTest(t, llm.NewMockProvider())
+
+	_, err := ExecuteTask(context.Background(), domain.TaskRequest{
+		Task:        domain.TaskRewrite,
+		Text:        "Rewrite this.",
+		EnableTools: true,
+	})
+	if !errors.Is(err, llm.ErrToolsUnsupported) {
+		t.Fatalf("expected ErrToolsUnsupported, got %v", err)
+	}
+}
+
+func TestToolRegistryRejectsDuplicatesAndUnknownTools(t *testing.T) {
+	registry := NewToolRegistry()
+	documents := &toolDocuments{}
+	if err := registry.Register(&searchDocumentsTool{documents: documents}); err != nil {
+		t.Fatalf("Register returned error: %v", err)
+	}
+	if err := registry.Register(&searchDocumentsTool{documents: documents}); err == nil {
+		t.Fatalf("expected duplicate registration to fail")
+	}
+	if _, err := registry.Call(context.Background(), toolCall("x", "delete_everything", `{}`)); !errors.Is(err, ErrUnknownTool) {
+		t.Fatalf("expected ErrUnknownTool, got %v", err)
+	}
+}
@@ -0,0 +1,287 @@
+package agents
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/alanmaizon/homer/backend/internal/connectors"
+	"github.com/alanmaizon/homer/backend/internal/domain"
+	"github.com/alanmaizon/homer/backend/internal/llm"
+	"github.com/alanmaizon/homer/backend/internal/metrics"
+	"github.com/alanmaizon/homer/backend/internal/middleware"
+	"github.com/alanmaizon/homer/backend/internal/moderation"
+	"github.com/alanmaizon/homer/backend/internal/vectorindex"
+)
+
+const (
+	ToolImportDocument  = "import_document"
+	ToolSearchDocuments = "search_documents"
+
+	searchChunkChars       = 600
+	searchChunkOverlap     = 100
+	defaultSearchResults   = 3
+	maxSearchResults       = 10
+	defaultToolOutputChars = 16000
+)
+
+// ErrUnknownTool is matched by errors returned when the model calls a tool
+// that is not registered.
+var ErrUnknownTool = errors.New("unknown tool")
+
+// Tool is a function the model may call during a task. Call receives the
+// model's JSON arguments and returns text that is sent back to the model.
+type Tool interface {
+	Definition() llm.ToolDefinition
+	Call(ctx context.Context, arguments json.RawMessage) (string, error)
+}
+
+// ToolRegistry holds the tools offered to the model, in registration order.
+type ToolRegistry struct {
+	tools map[string]Tool
+	order []string
+}
+
+func NewToolRegistry() *ToolRegistry {
+	return &ToolRegistry{tools: make(map[string]Tool)}
+}
+
+func (r *ToolRegistry) Register(tool Tool) error {
+	name := tool.Definition().Name
+	if name == "" {
+		return errors.New("tool name is required")
+	}
+	if _, exists := r.tools[name]; exists {
+		return fmt.Errorf("tool %q is already registered", name)
+	}
+	r.tools[name] = tool
+	r.order = append(r.order, name)
+	return nil
+}
+
+func (r *ToolRegistry) Definitions() []llm.ToolDefinition {
+	definitions := make([]llm.ToolDefinition, 0, len(r.order))
+	for _, name := range r.order {
+		definitions = append(definitions, r.tools[name].Definition())
+	}
+	return definitions
+}
+
+// Call runs the tool the model asked for and records the outcome.
+func (r *ToolRegistry) Call(ctx context.Context, call llm.ToolCall) (string, error) {
+	started := time.Now()
+	tool, ok := r.tools[call.Name]
+	var (
+		output string
+		err    error
+	)
+	if ok {
+		output, err = tool.Call(ctx, call.Arguments)
+	} else {
+		err = fmt.Errorf("%w %q", ErrUnknownTool, call.Name)
+	}
+
+	status := "success"
+	if err != nil {
+		status = "error"
+	}
+	metrics.RecordToolCall(call.Name, status)
+	log.Printf(
+		"request_id=%s component=agent_tools tool=%s status=%s duration_ms=%d",
+		middleware.GetRequestIDFromContext(ctx),
+		call.Name,
+		status,
+		time.Since(started).Milliseconds(),
+	)
+	return output, err
+}
+
+// toolDocuments is the document set tools share during one task: the
+// request documents plus any imported by the model.
+type toolDocuments struct {
+	mu        sync.Mutex
+	documents []domain.Document
+	decisions []domain.ModerationDecision
+}
+
+func (d *toolDocuments) add(doc domain.Document, decisions []domain.ModerationDecision) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.documents = append(d.documents, doc)
+	d.decisions = append(d.decisions, decisions...)
+}
+
+func (d *toolDocuments) count() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.documents)
+}
+
+func (d *toolDocuments) snapshot() []domain.Document {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]domain.Document(nil), d.documents...)
+}
+
+func (d *toolDocuments) moderationDecisions() []domain.ModerationDecision {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]domain.ModerationDecision(nil), d.decisions...)
+}
+
+// importDocumentTool fetches a document through the configured connector.
+// Imported text passes input moderation before the model sees it. Imports
+// are refused once the task holds maxDocuments documents.
+type importDocumentTool struct {
+	connector    connectors.Connector
+	sessionKey   string
+	documents    *toolDocuments
+	maxDocuments int
+	maxChars     int
+}
+
+func (t *importDocumentTool) Definition() llm.ToolDefinition {
+	return llm.ToolDefinition{
+		Name:        ToolImportDocument,
+		Description: fmt.Sprintf("Import a document from the %s connector by its document ID and return its title and text.", t.connector.Name()),
+		Parameters: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"documentId": map[string]any{"type": "string", "description": "The connector document ID."},
+			},
+			"required": []string{"documentId"},
+		},
+	}
+}
+
+func (t *importDocumentTool) Call(ctx context.Context, arguments json.RawMessage) (string, error) {
+	var args struct {
+		DocumentID string `json:"documentId"`
+	}
+	if err := json.Unmarshal(arguments, &args); err != nil || strings.TrimSpace(args.DocumentID) == "" {
+		return "", errors.New("documentId is required")
+	}
+	if t.maxDocuments > 0 && t.documents.count() >= t.maxDocuments {
+		return "", fmt.Errorf("the task already has the maximum of %d documents", t.maxDocuments)
+	}
+
+	started := time.Now()
+	doc, err := t.connector.ImportDocument(ctx, connectors.ImportRequest{
+		DocumentID: strings.TrimSpace(args.DocumentID),
+		SessionKey: t.sessionKey,
+	})
+	if err != nil {
+		metrics.RecordConnectorCall(t.connector.Name(), "import", "error", "tool_call_failed", time.Since(started))
+		return "", err
+	}
+	metrics.RecordConnectorCall(t.connector.Name(), "import", "success", "none", time.Since(started))
+
+	decisions, err := moderation.CurrentPolicy().Check(ctx, moderation.StageInput, []string{doc.Title, doc.Content})
+	if err != nil {
+		return "", err
+	}
+	t.documents.add(doc, decisions)
+
+	return truncateToolOutput(fmt.Sprintf("Document %s: %s\n\n%s", doc.ID, doc.Title, doc.Content), t.maxChars), nil
+}
+
+// searchDocumentsTool ranks passages of the task documents by how many of
+// the query terms they contain.
+type searchDocumentsTool struct {
+	documents *toolDocuments
+	maxChars  int
+}
+
+func (t *searchDocumentsTool) Definition() llm.ToolDefinition {
+	return llm.ToolDefinition{
+		Name:        ToolSearchDocuments,
+		Description: "Search the task documents, including imported ones, and return the passages that best match the query.",
+		Parameters: map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"query": map[string]any{"type": "string", "description": "Words to look for."},
+				"limit": map[string]any{"type": "integer", "description": fmt.Sprintf("Passages to return, at most %d.", maxSearchResults)},
+			},
+			"required": []string{"query"},
+		},
+	}
+}
+
+func (t *searchDocumentsTool) Call(_ context.Context, arguments json.RawMessage) (string, error) {
+	var args struct {
+		Query string `json:"query"`
+		Limit int    `json:"limit"`
+	}
+	if err := json.Unmarshal(arguments, &args); err != nil {
+		return "", errors.New("arguments must be a JSON object")
+	}
+	terms := searchTerms(args.Query)
+	if len(terms) == 0 {
+		return "", errors.New("query is required")
+	}
+	limit := args.Limit
+	if limit <= 0 {
+		limit = defaultSearchResults
+	}
+	limit = min(limit, maxSearchResults)
+
+	type match struct {
+		doc   domain.Document
+		text  string
+		score int
+	}
+	matches := make([]match, 0)
+	for _, doc := range t.documents.snapshot() {
+		for _, chunk := range vectorindex.Chunk(doc.Content, searchChunkChars, searchChunkOverlap) {
+			words := searchTerms(chunk)
+			score := 0
+			for term := range terms {
+				if words[term] {
+					score++
+				}
+			}
+			if score > 0 {
+				matches = append(matches, match{doc: doc, text: chunk, score: score})
+			}
+		}
+	}
+	if len(matches) == 0 {
+		return "No passages matched the query.", nil
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].score > matches[j].score })
+
+	var builder strings.Builder
+	for i, m := range matches[:min(limit, len(matches))] {
+		if i > 0 {
+			builder.WriteString("\n\n")
+		}
+		fmt.Fprintf(&builder, "[%s] %s\n%s", m.doc.ID, m.doc.Title, strings.TrimSpace(m.text))
+	}
+	return truncateToolOutput(builder.String(), t.maxChars), nil
+}
+
+// searchTerms returns the set of lower-cased words in text.
+func searchTerms(text string) map[string]bool {
+	terms := make(map[string]bool)
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		terms[word] = true
+	}
+	return terms
+}
+
+func truncateToolOutput(output string, maxChars int) string {
+	runes := []rune(output)
+	if maxChars <= 0 || len(runes) <= maxChars {
+		return output
+	}
+	return string(runes[:maxChars]) + truncationMarker
+}
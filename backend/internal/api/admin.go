@@ -0,0 +1,119 @@
+package api
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/alanmaizon/homer/backend/internal/auth"
+	"github.com/alanmaizon/homer/backend/internal/llm"
+	"github.com/alanmaizon/homer/backend/internal/webhooks"
+	"github.com/gin-gonic/gin"
+)
+
+type chaosStatusResponse struct {
+	Enabled  bool            `json:"enabled"`
+	Provider string          `json:"provider"`
+	Config   llm.ChaosConfig `json:"config"`
+}
+
+type deadLettersResponse struct {
+	DeadLetters []webhooks.DeadLetter `json:"deadLetters"`
+}
+
+func registerAdminRoutes(router *gin.Engine, authn authenticator, dispatcher *webhooks.Dispatcher) {
+	admin := router.Group("/api/admin", authn.require(auth.ScopeAdmin), authorizeAdminRequest)
+
+	admin.GET("/chaos", func(c *gin.Context) {
+		writeChaosStatus(c)
+	})
+
+	admin.PUT("/chaos", func(c *gin.Context) {
+		var config llm.ChaosConfig
+		if err := c.ShouldBindJSON(&config); err != nil {
+			writeError(c, http.StatusBadRequest, "invalid_payload", "invalid chaos configuration payload")
+			return
+		}
+		if err := llm.EnableChaos(config); err != nil {
+			writeError(c, http.StatusBadRequest, "invalid_chaos_config", err.Error())
+			return
+		}
+		writeChaosStatus(c)
+	})
+
+	admin.DELETE("/chaos", func(c *gin.Context) {
+		llm.DisableChaos()
+		writeChaosStatus(c)
+	})
+
+	admin.GET("/mock/fixtures", func(c *gin.Context) {
+		status, ok := llm.CurrentMockFixtures()
+		if !ok {
+			writeError(c, http.StatusConflict, "mock_fixtures_unavailable", llm.ErrMockFixturesUnavailable.Error())
+			return
+		}
+		c.JSON(http.StatusOK, status)
+	})
+
+	admin.POST("/mock/fixtures/reload", func(c *gin.Context) {
+		status, err := llm.ReloadMockFixtures()
+		switch {
+		case errors.Is(err, llm.ErrMockFixturesUnavailable):
+			writeError(c, http.StatusConflict, "mock_fixtures_unavailable", err.Error())
+		case err != nil:
+			writeError(c, http.StatusUnprocessableEntity, "invalid_mock_fixtures", err.Error())
+		default:
+			c.JSON(http.StatusOK, status)
+		}
+	})
+
+	admin.GET("/webhooks/dead-letters", func(c *gin.Context) {
+		letters, err := dispatcher.DeadLetters().List(c.Request.Context())
+		if err != nil {
+			writeError(c, http.StatusInternalServerError, "internal_error", err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, deadLettersResponse{DeadLetters: letters})
+	})
+}
+
+func writeChaosStatus(c *gin.Context) {
+	config, enabled := llm.CurrentChaosConfig()
+	c.JSON(http.StatusOK, chaosStatusResponse{
+		Enabled:  enabled,
+		Provider: llm.CurrentProvider().Name(),
+		Config:   config,
+	})
+}
+
+// authorizeAdminRequest requires ADMIN_API_KEY via X-Admin-Key or a bearer
+// token from requests that were not authenticated with a scoped API key.
+// Without API keys, admin routes are disabled when no admin key is
+// configured.
+func authorizeAdminRequest(c *gin.Context) {
+	if _, ok := principalFromRequest(c); ok {
+		return
+	}
+
+	requiredKey := strings.TrimSpace(os.Getenv("ADMIN_API_KEY"))
+	if requiredKey == "" {
+		writeError(c, http.StatusNotFound, "admin_disabled", "admin API is not enabled")
+		c.Abort()
+		return
+	}
+
+	providedKey := strings.TrimSpace(c.GetHeader("X-Admin-Key"))
+	if providedKey == "" {
+		authorization := strings.TrimSpace(c.GetHeader("Authorization"))
+		if strings.HasPrefix(strings.ToLower(authorization), "bearer ") {
+			providedKey = strings.TrimSpace(authorization[7:])
+		}
+	}
+
+	if subtle.ConstantTimeCompare([]byte(requiredKey), []byte(providedKey)) != 1 {
+		writeError(c, http.StatusUnauthorized, "admin_unauthorized", "admin API key is invalid")
+		c.Abort()
+	}
+}
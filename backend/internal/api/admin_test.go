@@ -0,0 +1,150 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alanmaizon/homer/backend/internal/llm"
+)
+
+func TestAdminChaosDisabledWithoutKey(t *testing.T) {
+	t.Setenv("ADMIN_API_KEY", "")
+
+	req := httptest.NewRequest(http.MethodGet, "/api/admin/chaos", nil)
+	res := httptest.NewRecorder()
+	testRouter().ServeHTTP(res, req)
+
+	if res.Code != http.StatusNotFound {
+		t.Fatalf("expected status 404, got %d", res.Code)
+	}
+}
+
+func TestAdminChaosUnauthorized(t *testing.T) {
+	t.Setenv("ADMIN_API_KEY", "admin-secret")
+
+	req := httptest.NewRequest(http.MethodPut, "/api/admin/chaos", strings.NewReader(`{}`))
+	req.Header.Set("X-Admin-Key", "wrong")
+	res := httptest.NewRecorder()
+	testRouter().ServeHTTP(res, req)
+
+	if res.Code != http.StatusUnauthorized {
+		t.Fatalf("expected status 401, got %d", res.Code)
+	}
+}
+
+func TestAdminChaosEnableInjectsFaultsAndDisable(t *testing.T) {
+	t.Setenv("ADMIN_API_KEY", "admin-secret")
+	t.Setenv("LLM_MAX_RETRIES", "0")
+	setProviderForTest(t, llm.NewMockProvider())
+	router := testRouter()
+
+	adminRequest := func(method string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/api/admin/chaos", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer admin-secret")
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, req)
+		return res
+	}
+
+	if res := adminRequest(http.MethodPut, `{"rates":{"timeout":3}}`); res.Code != http.StatusBadRequest {
+		t.Fatalf("expected invalid config to return 400, got %d", res.Code)
+	}
+
+	res := adminRequest(http.MethodPut, `{"schedule":["server_error"]}`)
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d body=%s", res.Code, res.Body.String())
+	}
+	var status chaosStatusResponse
+	if err := json.Unmarshal(res.Body.Bytes(), &status); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if !status.Enabled || status.Provider != "mock" || len(status.Config.Schedule) != 1 {
+		t.Fatalf("unexpected chaos status %+v", status)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/task", strings.NewReader(`{"task":"rewrite","text":"hello"}`))
+	req.Header.Set("Content-Type", "application/json")
+	taskRes := httptest.NewRecorder()
+	router.ServeHTTP(taskRes, req)
+	if taskRes.Code != http.StatusInternalServerError {
+		t.Fatalf("expected injected failure to surface as 500, got %d body=%s", taskRes.Code, taskRes.Body.String())
+	}
+
+	res = adminRequest(http.MethodDelete, "")
+	if err := json.Unmarshal(res.Body.Bytes(), &status); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if status.Enabled {
+		t.Fatalf("expected chaos to be disabled, got %+v", status)
+	}
+}
+
+func TestAdminMockFixturesReload(t *testing.T) {
+	t.Setenv("ADMIN_API_KEY", "admin-secret")
+	path := filepath.Join(t.TempDir(), "fixtures.yaml")
+	writeFixtures := func(response string) {
+		body := "fixtures:\n  - match: {operation: rewrite}\n    response: " + response + "\n"
+		if err := os.WriteFile(path, []byte(body), 0o644); err != nil {
+			t.Fatalf("write fixtures: %v", err)
+		}
+	}
+	writeFixtures("first draft")
+	t.Setenv("MOCK_FIXTURES_FILE", path)
+	mock, err := llm.NewMockProviderFromEnv()
+	if err != nil {
+		t.Fatalf("NewMockProviderFromEnv returned error: %v", err)
+	}
+	setProviderForTest(t, mock)
+	router := testRouter()
+
+	rewrite := func() string {
+		req := httptest.NewRequest(http.MethodPost, "/api/task", strings.NewReader(`{"task":"rewrite","text":"hello"}`))
+		req.Header.Set("Content-Type", "application/json")
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, req)
+		var body struct {
+			Result string `json:"result"`
+		}
+		if err := json.Unmarshal(res.Body.Bytes(), &body); err != nil {
+			t.Fatalf("failed to decode task response: %v", err)
+		}
+		return body.Result
+	}
+	reload := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/admin/mock/fixtures/reload", nil)
+		req.Header.Set("X-Admin-Key", "admin-secret")
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, req)
+		return res
+	}
+
+	if output := rewrite(); output != "first draft" {
+		t.Fatalf("expected fixture response, got %q", output)
+	}
+
+	writeFixtures("second draft")
+	if res := reload(); res.Code != http.StatusOK || !strings.Contains(res.Body.String(), `"fixtures":1`) {
+		t.Fatalf("expected reload to succeed, got %d body=%s", res.Code, res.Body.String())
+	}
+	if output := rewrite(); output != "second draft" {
+		t.Fatalf("expected reloaded fixture response, got %q", output)
+	}
+
+	if err := os.WriteFile(path, []byte("fixtures: ["), 0o644); err != nil {
+		t.Fatalf("write fixtures: %v", err)
+	}
+	if res := reload(); res.Code != http.StatusUnprocessableEntity || !strings.Contains(res.Body.String(), "invalid_mock_fixtures") {
+		t.Fatalf("expected invalid fixtures to return 422, got %d body=%s", res.Code, res.Body.String())
+	}
+
+	setProviderForTest(t, llm.NewMockProvider())
+	if res := reload(); res.Code != http.StatusConflict || !strings.Contains(res.Body.String(), "mock_fixtures_unavailable") {
+		t.Fatalf("expected 409 without a fixtures file, got %d body=%s", res.Code, res.Body.String())
+	}
+}
@@ -0,0 +1,111 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/alanmaizon/homer/backend/internal/auth"
+	"github.com/alanmaizon/homer/backend/internal/metrics"
+	"github.com/alanmaizon/homer/backend/internal/middleware"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	principalKey = "principal"
+
+	// defaultTenant is used for every request while authentication is
+	// disabled.
+	defaultTenant = "default"
+)
+
+// authenticator checks API keys against keys and JWT bearer tokens against
+// tokens. Authentication is disabled when both are nil.
+type authenticator struct {
+	keys   *auth.Keystore
+	tokens *auth.TokenVerifier
+}
+
+func (a authenticator) enabled() bool {
+	return a.keys != nil || a.tokens != nil
+}
+
+// require demands an API key or bearer token with scope when authentication
+// is enabled and records the caller's tenant on the request. Without it every
+// request belongs to the default tenant and the older CONNECTOR_API_KEY and
+// ADMIN_API_KEY checks apply.
+func (a authenticator) require(scope auth.Scope) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !a.enabled() {
+			middleware.SetTenant(c, defaultTenant)
+			return
+		}
+
+		credential := apiKeyFromRequest(c)
+		if credential == "" {
+			metrics.RecordAuthFailure("missing_key")
+			writeError(c, http.StatusUnauthorized, "unauthorized", "an API key or bearer token is required")
+			c.Abort()
+			return
+		}
+		principal, ok := a.principal(c, credential)
+		if !ok {
+			return
+		}
+
+		middleware.SetTenant(c, principal.Tenant)
+		c.Set(principalKey, principal)
+		if !principal.HasScope(scope) {
+			metrics.RecordAuthFailure("insufficient_scope")
+			writeError(c, http.StatusForbidden, "insufficient_scope", "credential lacks the "+string(scope)+" scope")
+			c.Abort()
+		}
+	}
+}
+
+// principal resolves credential as a JWT when OIDC is configured and it has
+// the shape of one, and as an API key otherwise. It writes the 401 itself.
+func (a authenticator) principal(c *gin.Context, credential string) (auth.Principal, bool) {
+	if a.tokens != nil && auth.LooksLikeJWT(credential) {
+		principal, err := a.tokens.Verify(c.Request.Context(), credential)
+		if err != nil {
+			metrics.RecordAuthFailure("invalid_token")
+			log.Printf("request_id=%s component=auth event=token_rejected error=%q", middleware.GetRequestID(c), err.Error())
+			writeError(c, http.StatusUnauthorized, "unauthorized", "bearer token is invalid")
+			c.Abort()
+			return auth.Principal{}, false
+		}
+		return principal, true
+	}
+
+	if a.keys != nil {
+		if principal, ok := a.keys.Authenticate(credential); ok {
+			return principal, true
+		}
+	}
+	metrics.RecordAuthFailure("invalid_key")
+	writeError(c, http.StatusUnauthorized, "unauthorized", "API key is invalid")
+	c.Abort()
+	return auth.Principal{}, false
+}
+
+func principalFromRequest(c *gin.Context) (auth.Principal, bool) {
+	value, ok := c.Get(principalKey)
+	if !ok {
+		return auth.Principal{}, false
+	}
+	principal, ok := value.(auth.Principal)
+	return principal, ok
+}
+
+// apiKeyFromRequest reads X-API-Key or a bearer token.
+func apiKeyFromRequest(c *gin.Context) string {
+	if key := strings.TrimSpace(c.GetHeader("X-API-Key")); key != "" {
+		return key
+	}
+	authorization := strings.TrimSpace(c.GetHeader("Authorization"))
+	if strings.HasPrefix(strings.ToLower(authorization), "bearer ") {
+		return strings.TrimSpace(authorization[7:])
+	}
+	return ""
+}
@@ -0,0 +1,183 @@
+package api
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alanmaizon/homer/backend/internal/auth"
+	"github.com/alanmaizon/homer/backend/internal/llm"
+)
+
+func setAPIKeysForTest(t *testing.T) {
+	t.Helper()
+	t.Setenv("OIDC_ISSUER", "")
+	t.Setenv("API_KEYS_FILE", "")
+	t.Setenv("API_KEYS", `[
+		{"id":"acme-task","tenant":"acme","scopes":["task"],"sha256":"`+auth.HashKey("acme-key")+`"},
+		{"id":"globex-task","tenant":"globex","scopes":["task"],"sha256":"`+auth.HashKey("globex-key")+`"},
+		{"id":"ops","tenant":"acme","scopes":["admin"],"sha256":"`+auth.HashKey("ops-key")+`"}
+	]`)
+}
+
+func serveWithKey(t *testing.T, router http.Handler, method string, path string, body string, key string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if key != "" {
+		req.Header.Set("X-API-Key", key)
+	}
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	return res
+}
+
+func TestTaskRequiresAPIKeyWhenConfigured(t *testing.T) {
+	setAPIKeysForTest(t)
+	setProviderForTest(t, llm.NewMockProvider())
+	router := testRouter()
+	body := `{"task":"rewrite","text":"hello"}`
+
+	res := serveWithKey(t, router, http.MethodPost, "/api/task", body, "")
+	if res.Code != http.StatusUnauthorized || !strings.Contains(res.Body.String(), `"unauthorized"`) {
+		t.Fatalf("expected 401 without a key, got %d body=%s", res.Code, res.Body.String())
+	}
+	res = serveWithKey(t, router, http.MethodPost, "/api/task", body, "wrong")
+	if res.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401 for an unknown key, got %d", res.Code)
+	}
+	res = serveWithKey(t, router, http.MethodPost, "/api/task", body, "ops-key")
+	if res.Code != http.StatusForbidden || !strings.Contains(res.Body.String(), "insufficient_scope") {
+		t.Fatalf("expected 403 insufficient_scope, got %d body=%s", res.Code, res.Body.String())
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/api/task", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer acme-key")
+	res = httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected a bearer task key to succeed, got %d body=%s", res.Code, res.Body.String())
+	}
+}
+
+func TestJobsAreScopedToTenant(t *testing.T) {
+	setAPIKeysForTest(t)
+	setProviderForTest(t, llm.NewMockProvider())
+	router := testRouter()
+
+	res := serveWithKey(t, router, http.MethodPost, "/api/jobs", `{"task":"rewrite","text":"hello"}`, "acme-key")
+	if res.Code != http.StatusAccepted {
+		t.Fatalf("expected status 202, got %d body=%s", res.Code, res.Body.String())
+	}
+	location := res.Header().Get("Location")
+
+	if res := serveWithKey(t, router, http.MethodGet, location, "", "acme-key"); res.Code != http.StatusOK {
+		t.Fatalf("expected the owning tenant to read its job, got %d", res.Code)
+	}
+	if res := serveWithKey(t, router, http.MethodGet, location, "", "globex-key"); res.Code != http.StatusNotFound {
+		t.Fatalf("expected another tenant's job to be hidden, got %d", res.Code)
+	}
+	if res := serveWithKey(t, router, http.MethodDelete, location, "", "globex-key"); res.Code != http.StatusNotFound {
+		t.Fatalf("expected another tenant to be unable to cancel the job, got %d", res.Code)
+	}
+}
+
+func TestAdminScopeReplacesAdminAPIKey(t *testing.T) {
+	setAPIKeysForTest(t)
+	t.Setenv("ADMIN_API_KEY", "")
+	router := testRouter()
+
+	if res := serveWithKey(t, router, http.MethodGet, "/api/admin/chaos", "", "ops-key"); res.Code != http.StatusOK {
+		t.Fatalf("expected an admin key to reach admin routes, got %d body=%s", res.Code, res.Body.String())
+	}
+	if res := serveWithKey(t, router, http.MethodGet, "/api/admin/chaos", "", "acme-key"); res.Code != http.StatusForbidden {
+		t.Fatalf("expected a task key to be forbidden, got %d", res.Code)
+	}
+}
+
+// setOIDCForTest serves a JWKS for a fresh RSA key and returns a function that
+// signs tokens with it.
+func setOIDCForTest(t *testing.T) func(claims map[string]any) string {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	jwks, _ := json.Marshal(map[string]any{"keys": []map[string]string{{
+		"kty": "RSA",
+		"kid": "test",
+		"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}}})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(jwks)
+	}))
+	t.Cleanup(server.Close)
+
+	t.Setenv("API_KEYS_FILE", "")
+	t.Setenv("API_KEYS", "")
+	t.Setenv("OIDC_ISSUER", "https://idp.example.com")
+	t.Setenv("OIDC_AUDIENCE", "homer")
+	t.Setenv("OIDC_JWKS_URL", server.URL)
+	t.Setenv("OIDC_JWKS_FILE", "")
+
+	return func(claims map[string]any) string {
+		header, _ := json.Marshal(map[string]string{"alg": "RS256", "kid": "test"})
+		payload, _ := json.Marshal(claims)
+		signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+		digest := sha256.Sum256([]byte(signed))
+		signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatalf("failed to sign token: %v", err)
+		}
+		return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+	}
+}
+
+func TestTaskAcceptsOIDCBearerTokens(t *testing.T) {
+	sign := setOIDCForTest(t)
+	setProviderForTest(t, llm.NewMockProvider())
+	router := testRouter()
+	body := `{"task":"rewrite","text":"hello"}`
+	claims := func(scope string, expires time.Time) map[string]any {
+		return map[string]any{
+			"iss":    "https://idp.example.com",
+			"aud":    "homer",
+			"sub":    "svc-reporting",
+			"tenant": "acme",
+			"scope":  scope,
+			"exp":    expires.Unix(),
+		}
+	}
+	bearer := func(token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/task", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", "Bearer "+token)
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, req)
+		return res
+	}
+
+	if res := bearer(sign(claims("task", time.Now().Add(time.Hour)))); res.Code != http.StatusOK {
+		t.Fatalf("expected a valid token to succeed, got %d body=%s", res.Code, res.Body.String())
+	}
+	if res := bearer(sign(claims("task", time.Now().Add(-time.Hour)))); res.Code != http.StatusUnauthorized {
+		t.Fatalf("expected an expired token to return 401, got %d", res.Code)
+	}
+	if res := bearer(sign(claims("connector:import", time.Now().Add(time.Hour)))); res.Code != http.StatusForbidden {
+		t.Fatalf("expected a token without the task scope to return 403, got %d", res.Code)
+	}
+	if res := bearer("static-key"); res.Code != http.StatusUnauthorized {
+		t.Fatalf("expected a static key without a keystore to return 401, got %d", res.Code)
+	}
+}
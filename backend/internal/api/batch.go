@@ -0,0 +1,209 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alanmaizon/homer/backend/internal/agents"
+	"github.com/alanmaizon/homer/backend/internal/auth"
+	"github.com/alanmaizon/homer/backend/internal/domain"
+	"github.com/alanmaizon/homer/backend/internal/middleware"
+	"github.com/alanmaizon/homer/backend/internal/quota"
+	"github.com/alanmaizon/homer/backend/internal/webhooks"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultBatchConcurrency = 4
+	defaultBatchMaxItems    = 100
+
+	ndjsonContentType = "application/x-ndjson"
+)
+
+func registerBatchRoutes(router *gin.Engine, authn authenticator, dispatcher *webhooks.Dispatcher, enforcer *quota.Enforcer, rateLimit *rateLimitGroup, limits domain.RequestLimits) {
+	router.POST("/api/task/batch", authn.require(auth.ScopeTask), func(c *gin.Context) {
+		var req domain.BatchTaskRequest
+		if !bindJSON(c, limits, &req, "invalid batch payload") {
+			return
+		}
+		if validationErr := validateBatchRequest(req, limits); validationErr != nil {
+			writeError(c, http.StatusBadRequest, validationErr.Code, validationErr.Message)
+			return
+		}
+		// Each item counts against the task rate limit like a POST /api/task.
+		if !rateLimit.enforceN(c, len(req.Items)) {
+			return
+		}
+
+		runner := batchItemRunner{
+			limits:              limits,
+			dispatcher:          dispatcher,
+			enforcer:            enforcer,
+			tenant:              middleware.GetTenant(c),
+			requestID:           middleware.GetRequestID(c),
+			connectorAuthorized: connectorKeyValid(c),
+			connectorSession:    connectorSessionKeyFromRequest(c),
+		}
+		ctx := c.Request.Context()
+		run := func(i int) domain.BatchTaskResult { return runner.run(ctx, req.Items[i]) }
+		concurrency := positiveIntFromEnv("BATCH_CONCURRENCY", defaultBatchConcurrency)
+		streaming := strings.Contains(c.GetHeader("Accept"), ndjsonContentType)
+
+		started := time.Now()
+		response := domain.BatchTaskResponse{Items: make([]domain.BatchTaskResult, len(req.Items))}
+		if streaming {
+			c.Header("Content-Type", ndjsonContentType)
+			c.Status(http.StatusOK)
+			encoder := json.NewEncoder(c.Writer)
+			runBatch(len(req.Items), concurrency, run, func(i int, result domain.BatchTaskResult) {
+				response.Items[i] = result
+				_ = encoder.Encode(result)
+				c.Writer.Flush()
+			})
+		} else {
+			runBatch(len(req.Items), concurrency, run, func(i int, result domain.BatchTaskResult) {
+				response.Items[i] = result
+			})
+		}
+
+		for _, item := range response.Items {
+			if item.Error != nil {
+				response.Failed++
+			} else {
+				response.Succeeded++
+			}
+		}
+		log.Printf(
+			"request_id=%s tenant=%s component=batch items=%d succeeded=%d failed=%d stream=%t duration_ms=%d",
+			runner.requestID,
+			middleware.GetTenant(c),
+			len(req.Items),
+			response.Succeeded,
+			response.Failed,
+			streaming,
+			time.Since(started).Milliseconds(),
+		)
+		if !streaming {
+			c.JSON(http.StatusOK, response)
+		}
+	})
+}
+
+func validateBatchRequest(req domain.BatchTaskRequest, limits domain.RequestLimits) *domain.APIError {
+	if len(req.Items) == 0 {
+		return &domain.APIError{Code: "missing_items", Message: "items are required"}
+	}
+	if len(req.Items) > limits.MaxBatchItems {
+		return &domain.APIError{Code: "too_many_items", Message: fmt.Sprintf("a batch may contain at most %d items", limits.MaxBatchItems)}
+	}
+
+	seen := make(map[string]bool, len(req.Items))
+	for i, item := range req.Items {
+		id := strings.TrimSpace(item.ID)
+		if id == "" {
+			return &domain.APIError{Code: "missing_item_id", Message: fmt.Sprintf("items[%d].id is required", i)}
+		}
+		if apiErr := validateIDLength(fmt.Sprintf("items[%d].id", i), id, limits); apiErr != nil {
+			return apiErr
+		}
+		if seen[id] {
+			return &domain.APIError{Code: "duplicate_item_id", Message: fmt.Sprintf("item id %q is used more than once", id)}
+		}
+		seen[id] = true
+	}
+	return nil
+}
+
+// runBatch calls run for each of count items on at most concurrency
+// goroutines and passes each result to emit as soon as it is ready. emit is
+// only called from the calling goroutine.
+func runBatch(count int, concurrency int, run func(i int) domain.BatchTaskResult, emit func(i int, result domain.BatchTaskResult)) {
+	type finished struct {
+		index  int
+		result domain.BatchTaskResult
+	}
+	indexes := make(chan int)
+	results := make(chan finished)
+	for range min(concurrency, count) {
+		go func() {
+			for i := range indexes {
+				results <- finished{index: i, result: run(i)}
+			}
+		}()
+	}
+	go func() {
+		for i := range count {
+			indexes <- i
+		}
+		close(indexes)
+	}()
+
+	for range count {
+		done := <-results
+		emit(done.index, done.result)
+	}
+}
+
+// batchItemRunner executes batch items the way POST /api/task executes a
+// request, reporting failures per item.
+type batchItemRunner struct {
+	limits              domain.RequestLimits
+	dispatcher          *webhooks.Dispatcher
+	enforcer            *quota.Enforcer
+	tenant              string
+	requestID           string
+	connectorAuthorized bool
+	connectorSession    string
+}
+
+func (r batchItemRunner) run(ctx context.Context, item domain.BatchTaskItem) domain.BatchTaskResult {
+	id := strings.TrimSpace(item.ID)
+	fail := func(status int, code string, message string) domain.BatchTaskResult {
+		return domain.BatchTaskResult{
+			ID:     id,
+			Status: status,
+			Error:  &domain.APIError{Code: code, Message: message, RequestID: r.requestID},
+		}
+	}
+
+	if validationErr := validateTaskRequest(item.TaskRequest, r.limits); validationErr != nil {
+		return fail(http.StatusBadRequest, validationErr.Code, validationErr.Message)
+	}
+	if callbackErr := validateCallbackURL(r.dispatcher, item.CallbackURL); callbackErr != nil {
+		return fail(http.StatusBadRequest, callbackErr.Code, callbackErr.Message)
+	}
+	reservation, exceeded := reserveQuota(ctx, r.enforcer, r.tenant, item.TaskRequest)
+	if exceeded != nil {
+		return domain.BatchTaskResult{ID: id, Status: http.StatusTooManyRequests, Error: quotaAPIError(exceeded, r.requestID)}
+	}
+
+	if item.EnableTools && r.connectorAuthorized {
+		ctx = agents.WithConnector(ctx, newConnectorFromEnv(), r.connectorSession, r.limits.MaxDocuments)
+	}
+	response, err := executeReservedTask(ctx, r.enforcer, r.tenant, reservation, item.TaskRequest)
+	if err != nil {
+		status, code, message := taskExecutionError(err)
+		result := fail(status, code, message)
+		sendTaskCallback(r.dispatcher, item.CallbackURL, "", nil, result.Error)
+		return result
+	}
+	response.Metadata.RequestID = r.requestID
+	recordOutputTokens(ctx, r.enforcer, r.tenant, response)
+	sendTaskCallback(r.dispatcher, item.CallbackURL, "", &response, nil)
+	return domain.BatchTaskResult{ID: id, Status: http.StatusOK, Result: &response}
+}
+
+func positiveIntFromEnv(key string, fallback int) int {
+	value, err := strconv.Atoi(strings.TrimSpace(os.Getenv(key)))
+	if err != nil || value <= 0 {
+		return fallback
+	}
+	return value
+}
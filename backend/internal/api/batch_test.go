@@ -0,0 +1,158 @@
+package api
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alanmaizon/homer/backend/internal/domain"
+	"github.com/alanmaizon/homer/backend/internal/llm"
+)
+
+// concurrencyProvider records the most calls it had in flight at once.
+type concurrencyProvider struct {
+	mu          sync.Mutex
+	inFlight    int
+	maxInFlight int
+}
+
+func (p *concurrencyProvider) track() string {
+	p.mu.Lock()
+	p.inFlight++
+	p.maxInFlight = max(p.maxInFlight, p.inFlight)
+	p.mu.Unlock()
+
+	time.Sleep(10 * time.Millisecond)
+
+	p.mu.Lock()
+	p.inFlight--
+	p.mu.Unlock()
+	return "tracked"
+}
+
+func (p *concurrencyProvider) Name() string {
+	return "mock"
+}
+
+func (p *concurrencyProvider) Summarize(context.Context, []domain.Document, string, string, domain.GenerationParams) (string, error) {
+	return p.track(), nil
+}
+
+func (p *concurrencyProvider) Rewrite(context.Context, string, string, string, domain.GenerationParams) (string, error) {
+	return p.track(), nil
+}
+
+func (p *concurrencyProvider) Generate(context.Context, []llm.Message, domain.GenerationParams) (string, error) {
+	return p.track(), nil
+}
+
+func serveBatch(t *testing.T, body string, accept string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/api/task/batch", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	res := httptest.NewRecorder()
+	testRouter().ServeHTTP(res, req)
+	return res
+}
+
+func TestTaskBatchReportsPerItemResults(t *testing.T) {
+	setProviderForTest(t, llm.NewMockProvider())
+
+	res := serveBatch(t, `{"items":[
+		{"id":"ok","task":"rewrite","text":"hello","style":"formal"},
+		{"id":"bad","task":"rewrite"},
+		{"id":"also-ok","task":"summarize","documents":[{"id":"d1","title":"Doc","content":"Text"}]}
+	]}`, "")
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d body=%s", res.Code, res.Body.String())
+	}
+
+	var payload domain.BatchTaskResponse
+	if err := json.Unmarshal(res.Body.Bytes(), &payload); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if payload.Succeeded != 2 || payload.Failed != 1 || len(payload.Items) != 3 {
+		t.Fatalf("unexpected summary %+v", payload)
+	}
+	if item := payload.Items[0]; item.ID != "ok" || item.Status != http.StatusOK || item.Result == nil || item.Result.Metadata.RequestID != res.Header().Get("X-Request-Id") {
+		t.Fatalf("unexpected first item %+v", item)
+	}
+	if item := payload.Items[1]; item.ID != "bad" || item.Status != http.StatusBadRequest || item.Error == nil || item.Error.Code != "missing_text" {
+		t.Fatalf("unexpected failed item %+v", item)
+	}
+	if item := payload.Items[2]; item.ID != "also-ok" || item.Result == nil {
+		t.Fatalf("unexpected third item %+v", item)
+	}
+}
+
+func TestTaskBatchBoundsConcurrency(t *testing.T) {
+	t.Setenv("BATCH_CONCURRENCY", "2")
+	provider := &concurrencyProvider{}
+	setProviderForTest(t, provider)
+
+	items := make([]string, 0, 6)
+	for _, id := range []string{"a", "b", "c", "d", "e", "f"} {
+		items = append(items, `{"id":"`+id+`","task":"rewrite","text":"hello"}`)
+	}
+	res := serveBatch(t, `{"items":[`+strings.Join(items, ",")+`]}`, "")
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d body=%s", res.Code, res.Body.String())
+	}
+	if provider.maxInFlight > 2 {
+		t.Fatalf("expected at most 2 concurrent provider calls, got %d", provider.maxInFlight)
+	}
+}
+
+func TestTaskBatchStreamsNDJSON(t *testing.T) {
+	setProviderForTest(t, llm.NewMockProvider())
+
+	res := serveBatch(t, `{"items":[
+		{"id":"one","task":"rewrite","text":"hello"},
+		{"id":"two","task":"rewrite","text":""}
+	]}`, "application/x-ndjson")
+	if res.Code != http.StatusOK || res.Header().Get("Content-Type") != "application/x-ndjson" {
+		t.Fatalf("expected an NDJSON response, got %d %q", res.Code, res.Header().Get("Content-Type"))
+	}
+
+	seen := make(map[string]domain.BatchTaskResult)
+	scanner := bufio.NewScanner(res.Body)
+	for scanner.Scan() {
+		var result domain.BatchTaskResult
+		if err := json.Unmarshal(scanner.Bytes(), &result); err != nil {
+			t.Fatalf("failed to decode line %q: %v", scanner.Text(), err)
+		}
+		seen[result.ID] = result
+	}
+	if len(seen) != 2 || seen["one"].Result == nil || seen["two"].Error == nil {
+		t.Fatalf("unexpected streamed results %+v", seen)
+	}
+}
+
+func TestTaskBatchValidatesItemIDs(t *testing.T) {
+	cases := map[string]string{
+		`{"items":[]}`: "missing_items",
+		`{"items":[{"task":"rewrite","text":"a"}]}`:                                                 "missing_item_id",
+		`{"items":[{"id":"x","task":"rewrite","text":"a"},{"id":"x","task":"rewrite","text":"b"}]}`: "duplicate_item_id",
+	}
+	for body, code := range cases {
+		res := serveBatch(t, body, "")
+		if res.Code != http.StatusBadRequest || !strings.Contains(res.Body.String(), code) {
+			t.Fatalf("%s: expected %s, got %d body=%s", body, code, res.Code, res.Body.String())
+		}
+	}
+
+	t.Setenv("BATCH_MAX_ITEMS", "1")
+	res := serveBatch(t, `{"items":[{"id":"x","task":"rewrite","text":"a"},{"id":"y","task":"rewrite","text":"b"}]}`, "")
+	if res.Code != http.StatusBadRequest || !strings.Contains(res.Body.String(), "too_many_items") {
+		t.Fatalf("expected too_many_items, got %d body=%s", res.Code, res.Body.String())
+	}
+}
@@ -1,6 +1,62 @@
 package api
 
-import "github.com/alanmaizon/homer/backend/internal/connectors"
+import (
+	"fmt"
+
+	"github.com/alanmaizon/homer/backend/internal/auth"
+	"github.com/alanmaizon/homer/backend/internal/connectors"
+	"github.com/alanmaizon/homer/backend/internal/jobs"
+	"github.com/alanmaizon/homer/backend/internal/quota"
+	"github.com/alanmaizon/homer/backend/internal/sharedstate"
+	"github.com/alanmaizon/homer/backend/internal/webhooks"
+)
 
 var newConnectorFromEnv = connectors.NewConnectorFromEnv
 var newGoogleDocsOAuthManagerFromEnv = connectors.NewGoogleDocsOAuthManagerFromEnv
+var newJobStoreFromEnv = jobs.NewStoreFromEnv
+var newWebhookDispatcherFromEnv = webhooks.NewDispatcherFromEnv
+
+// Config holds the services RegisterRoutes shares between routes.
+type Config struct {
+	// Keys and Tokens authenticate callers. Authentication is disabled when
+	// both are nil.
+	Keys   *auth.Keystore
+	Tokens *auth.TokenVerifier
+	// Quota charges tasks to tenants. Nil applies no limits.
+	Quota *quota.Enforcer
+	// SharedState backs rate limits, idempotency keys and OAuth sessions.
+	// Nil keeps them in process memory.
+	SharedState sharedstate.Store
+	// OAuthTokens replaces the in-memory OAuth session store when set.
+	OAuthTokens connectors.OAuthTokenStore
+}
+
+// ConfigFromEnv reads the API key, OIDC, quota and shared state settings and
+// returns the first one that is invalid.
+func ConfigFromEnv() (Config, error) {
+	keys, err := auth.NewKeystoreFromEnv()
+	if err != nil {
+		return Config{}, fmt.Errorf("API keys: %w", err)
+	}
+	tokens, err := auth.NewTokenVerifierFromEnv()
+	if err != nil {
+		return Config{}, fmt.Errorf("OIDC token validation: %w", err)
+	}
+	enforcer, err := quota.NewEnforcerFromEnv()
+	if err != nil {
+		return Config{}, fmt.Errorf("quotas: %w", err)
+	}
+	shared, err := sharedstate.NewStoreFromEnv()
+	if err != nil {
+		return Config{}, fmt.Errorf("shared state: %w", err)
+	}
+	config := Config{Keys: keys, Tokens: tokens, Quota: enforcer, SharedState: shared}
+	if shared != nil {
+		oauthTokens, err := connectors.NewSharedOAuthTokenStoreFromEnv(shared)
+		if err != nil {
+			return Config{}, fmt.Errorf("shared state: %w", err)
+		}
+		config.OAuthTokens = oauthTokens
+	}
+	return config, nil
+}
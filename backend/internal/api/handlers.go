@@ -10,16 +10,41 @@ import (
 	"time"
 
 	"github.com/alanmaizon/homer/backend/internal/agents"
+	"github.com/alanmaizon/homer/backend/internal/auth"
 	"github.com/alanmaizon/homer/backend/internal/connectors"
 	"github.com/alanmaizon/homer/backend/internal/domain"
+	"github.com/alanmaizon/homer/backend/internal/jobs"
 	"github.com/alanmaizon/homer/backend/internal/llm"
 	"github.com/alanmaizon/homer/backend/internal/metrics"
 	"github.com/alanmaizon/homer/backend/internal/middleware"
+	"github.com/alanmaizon/homer/backend/internal/moderation"
+	"github.com/alanmaizon/homer/backend/internal/quota"
+	"github.com/alanmaizon/homer/backend/internal/webhooks"
 	"github.com/gin-gonic/gin"
 )
 
-func RegisterRoutes(router *gin.Engine) {
-	connectorRateLimiter := newConnectorRateLimiterFromEnv()
+// RegisterRoutes mounts the API on router. It returns the job manager and
+// webhook dispatcher it started, which the caller closes on shutdown once the
+// server stops taking requests.
+func RegisterRoutes(router *gin.Engine, config Config) (*jobs.Manager, *webhooks.Dispatcher) {
+	shared := config.SharedState
+	if config.OAuthTokens != nil {
+		connectors.UseOAuthStore(config.OAuthTokens)
+	}
+	taskRateLimit := newTaskRateLimitFromEnv(shared)
+	connectorRateLimit := newConnectorRateLimitFromEnv(shared)
+	dispatcher := newWebhookDispatcherFromEnv()
+	authn := authenticator{keys: config.Keys, tokens: config.Tokens}
+	enforcer := config.Quota
+	if enforcer == nil {
+		enforcer = quota.NewEnforcer(quota.Config{}, quota.NewMemoryStore())
+	}
+	limits := requestLimitsFromEnv()
+	idempotencyManager := loadIdempotency(shared)
+	registerAdminRoutes(router, authn, dispatcher)
+	jobManager := registerJobRoutes(router, authn, dispatcher, enforcer, taskRateLimit, limits)
+	registerBatchRoutes(router, authn, dispatcher, enforcer, taskRateLimit, limits)
+	registerUsageRoutes(router, authn, enforcer)
 
 	router.GET("/api/health", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"ok": true})
@@ -49,7 +74,9 @@ func RegisterRoutes(router *gin.Engine) {
 				Critic:          true,
 				ConnectorImport: activeConnector != "none",
 				ConnectorExport: activeConnector != "none",
+				ToolCalling:     toolCallingSupported(),
 			},
+			Limits: limits,
 		})
 	})
 
@@ -131,45 +158,68 @@ func RegisterRoutes(router *gin.Engine) {
 		c.JSON(http.StatusOK, response)
 	})
 
-	router.POST("/api/task", func(c *gin.Context) {
+	router.POST("/api/task", authn.require(auth.ScopeTask), idempotent(idempotencyManager, limits), func(c *gin.Context) {
+		if !taskRateLimit.enforce(c) {
+			return
+		}
+
 		var req domain.TaskRequest
-		if err := c.ShouldBindJSON(&req); err != nil {
-			writeError(c, http.StatusBadRequest, "invalid_payload", "invalid task payload")
+		if !bindJSON(c, limits, &req, "invalid task payload") {
 			return
 		}
 
-		if validationErr := validateTaskRequest(req); validationErr != nil {
+		if validationErr := validateTaskRequest(req, limits); validationErr != nil {
 			writeError(c, http.StatusBadRequest, validationErr.Code, validationErr.Message)
 			return
 		}
+		if callbackErr := validateCallbackURL(dispatcher, req.CallbackURL); callbackErr != nil {
+			writeError(c, http.StatusBadRequest, callbackErr.Code, callbackErr.Message)
+			return
+		}
+		reservation, ok := reserveTaskQuota(c, enforcer, req)
+		if !ok {
+			return
+		}
 
-		response, err := agents.ExecuteTask(c.Request.Context(), req)
+		ctx := c.Request.Context()
+		if req.EnableTools && connectorKeyValid(c) {
+			ctx = agents.WithConnector(ctx, newConnectorFromEnv(), connectorSessionKeyFromRequest(c), limits.MaxDocuments)
+		}
+
+		response, err := executeReservedTask(ctx, enforcer, middleware.GetTenant(c), reservation, req)
 		if err != nil {
-			writeError(c, http.StatusInternalServerError, "internal_error", err.Error())
+			status, code, message := taskExecutionError(err)
+			sendTaskCallback(dispatcher, req.CallbackURL, "", nil, &domain.APIError{Code: code, Message: message, RequestID: middleware.GetRequestID(c)})
+			writeError(c, status, code, message)
 			return
 		}
 		response.Metadata.RequestID = middleware.GetRequestID(c)
+		recordOutputTokens(ctx, enforcer, middleware.GetTenant(c), response)
+		sendTaskCallback(dispatcher, req.CallbackURL, "", &response, nil)
 
 		c.JSON(http.StatusOK, response)
 	})
 
-	router.POST("/api/connectors/import", func(c *gin.Context) {
+	router.POST("/api/connectors/import", authn.require(auth.ScopeConnectorImport), func(c *gin.Context) {
 		if !authorizeConnectorRequest(c) {
 			return
 		}
-		if !enforceConnectorRateLimit(c, connectorRateLimiter) {
+		if !connectorRateLimit.enforce(c) {
 			return
 		}
 
 		var req domain.ConnectorImportRequest
-		if err := c.ShouldBindJSON(&req); err != nil {
-			writeError(c, http.StatusBadRequest, "invalid_payload", "invalid connector import payload")
+		if !bindJSON(c, limits, &req, "invalid connector import payload") {
 			return
 		}
 		if strings.TrimSpace(req.DocumentID) == "" {
 			writeError(c, http.StatusBadRequest, "missing_document_id", "documentId is required")
 			return
 		}
+		if apiErr := validateIDLength("documentId", req.DocumentID, limits); apiErr != nil {
+			writeError(c, http.StatusBadRequest, apiErr.Code, apiErr.Message)
+			return
+		}
 
 		started := time.Now()
 		requestID := middleware.GetRequestID(c)
@@ -225,17 +275,15 @@ func RegisterRoutes(router *gin.Engine) {
 		})
 	})
 
-	router.POST("/api/connectors/export", func(c *gin.Context) {
-		if !authorizeConnectorRequest(c) {
-			return
-		}
-		if !enforceConnectorRateLimit(c, connectorRateLimiter) {
+	// Connector authorization runs before idempotency so a stored export is
+	// only replayed to callers allowed to export.
+	router.POST("/api/connectors/export", authn.require(auth.ScopeConnectorExport), requireConnectorAuthorization, idempotent(idempotencyManager, limits), func(c *gin.Context) {
+		if !connectorRateLimit.enforce(c) {
 			return
 		}
 
 		var req domain.ConnectorExportRequest
-		if err := c.ShouldBindJSON(&req); err != nil {
-			writeError(c, http.StatusBadRequest, "invalid_payload", "invalid connector export payload")
+		if !bindJSON(c, limits, &req, "invalid connector export payload") {
 			return
 		}
 		if strings.TrimSpace(req.DocumentID) == "" {
@@ -246,6 +294,23 @@ func RegisterRoutes(router *gin.Engine) {
 			writeError(c, http.StatusBadRequest, "missing_content", "content is required")
 			return
 		}
+		if apiErr := validateIDLength("documentId", req.DocumentID, limits); apiErr != nil {
+			writeError(c, http.StatusBadRequest, apiErr.Code, apiErr.Message)
+			return
+		}
+		if apiErr := validateDocumentLength("content", req.Content, limits); apiErr != nil {
+			writeError(c, http.StatusBadRequest, apiErr.Code, apiErr.Message)
+			return
+		}
+
+		// Exported text is published to a shared document, so it gets the
+		// same output moderation as task results.
+		decisions, err := moderation.CurrentPolicy().Check(c.Request.Context(), moderation.StageOutput, []string{req.Content})
+		if err != nil {
+			status, code, message, _ := moderationError(err)
+			writeError(c, status, code, message)
+			return
+		}
 
 		started := time.Now()
 		requestID := middleware.GetRequestID(c)
@@ -268,7 +333,7 @@ func RegisterRoutes(router *gin.Engine) {
 			strings.TrimSpace(req.DocumentID),
 		)
 
-		err := connector.ExportContent(c.Request.Context(), connectors.ExportRequest{
+		err = connector.ExportContent(c.Request.Context(), connectors.ExportRequest{
 			DocumentID: req.DocumentID,
 			Content:    req.Content,
 			SessionKey: connectorSessionKeyFromRequest(c),
@@ -297,10 +362,13 @@ func RegisterRoutes(router *gin.Engine) {
 		)
 
 		c.JSON(http.StatusOK, domain.ConnectorExportResponse{
-			Connector: connector.Name(),
-			Exported:  true,
+			Connector:  connector.Name(),
+			Exported:   true,
+			Moderation: moderation.Warnings(decisions),
 		})
 	})
+
+	return jobManager, dispatcher
 }
 
 func connectorSessionKeyFromRequest(c *gin.Context) string {
@@ -324,7 +392,48 @@ func connectorOperationError(err error, operation string) (status int, code stri
 	}
 }
 
-func validateTaskRequest(req domain.TaskRequest) *domain.APIError {
+func toolCallingSupported() bool {
+	_, err := llm.ToolCallerFor(llm.CurrentProvider())
+	return err == nil
+}
+
+func taskExecutionError(err error) (status int, code string, message string) {
+	if status, code, message, ok := moderationError(err); ok {
+		return status, code, message
+	}
+
+	switch {
+	case errors.Is(err, llm.ErrContentFiltered):
+		return http.StatusUnprocessableEntity, "content_filtered", "provider content filter rejected the request"
+	case errors.Is(err, llm.ErrProviderSaturated):
+		return http.StatusServiceUnavailable, "provider_saturated", "provider capacity is unavailable, retry later"
+	case errors.Is(err, agents.ErrContextBudgetExceeded):
+		return http.StatusRequestEntityTooLarge, "context_length_exceeded", err.Error()
+	case errors.Is(err, llm.ErrToolsUnsupported):
+		return http.StatusBadRequest, "tools_unsupported", "the active provider does not support tool calling"
+	case errors.Is(err, agents.ErrToolStepsExceeded):
+		return http.StatusUnprocessableEntity, "tool_steps_exceeded", err.Error()
+	case errors.Is(err, agents.ErrToolLoopTimeout):
+		return http.StatusGatewayTimeout, "tool_loop_timeout", err.Error()
+	default:
+		return http.StatusInternalServerError, "internal_error", err.Error()
+	}
+}
+
+// moderationError maps moderation failures; ok is false for other errors.
+func moderationError(err error) (status int, code string, message string, ok bool) {
+	var blocked *moderation.BlockedError
+	switch {
+	case errors.As(err, &blocked):
+		return http.StatusUnprocessableEntity, blocked.Code(), blocked.Error(), true
+	case errors.Is(err, moderation.ErrModerationUnavailable):
+		return http.StatusServiceUnavailable, "moderation_unavailable", "content moderation is unavailable, retry later", true
+	default:
+		return http.StatusInternalServerError, "internal_error", err.Error(), false
+	}
+}
+
+func validateTaskRequest(req domain.TaskRequest, limits domain.RequestLimits) *domain.APIError {
 	task := strings.TrimSpace(string(req.Task))
 	if task == "" {
 		return &domain.APIError{Code: "missing_task", Message: "task is required"}
@@ -352,6 +461,17 @@ func validateTaskRequest(req domain.TaskRequest) *domain.APIError {
 		}
 	}
 
+	if apiErr := validateTaskLimits(req, limits); apiErr != nil {
+		return apiErr
+	}
+
+	if err := agents.ValidateGenerationParams(req.Generation); err != nil {
+		return &domain.APIError{
+			Code:    "invalid_generation_params",
+			Message: err.Error(),
+		}
+	}
+
 	return nil
 }
 
@@ -374,7 +494,35 @@ func envOrDefault(key string, fallback string) string {
 	return value
 }
 
+// authorizeConnectorRequest applies CONNECTOR_API_KEY to requests that were
+// not authenticated with a scoped API key.
 func authorizeConnectorRequest(c *gin.Context) bool {
+	if _, ok := principalFromRequest(c); ok {
+		return true
+	}
+	if connectorKeyValid(c) {
+		return true
+	}
+
+	writeError(c, http.StatusUnauthorized, "connector_unauthorized", "connector API key is invalid")
+	return false
+}
+
+// requireConnectorAuthorization is authorizeConnectorRequest as middleware.
+func requireConnectorAuthorization(c *gin.Context) {
+	if !authorizeConnectorRequest(c) {
+		c.Abort()
+	}
+}
+
+// connectorKeyValid reports whether the request may use the connector: its
+// API key has the connector:import scope or, without API keys, it carries
+// CONNECTOR_API_KEY or no key is configured.
+func connectorKeyValid(c *gin.Context) bool {
+	if principal, ok := principalFromRequest(c); ok {
+		return principal.HasScope(auth.ScopeConnectorImport)
+	}
+
 	requiredKey := strings.TrimSpace(os.Getenv("CONNECTOR_API_KEY"))
 	if requiredKey == "" {
 		return true
@@ -388,10 +536,5 @@ func authorizeConnectorRequest(c *gin.Context) bool {
 		}
 	}
 
-	if subtle.ConstantTimeCompare([]byte(requiredKey), []byte(providedKey)) == 1 {
-		return true
-	}
-
-	writeError(c, http.StatusUnauthorized, "connector_unauthorized", "connector API key is invalid")
-	return false
+	return subtle.ConstantTimeCompare([]byte(requiredKey), []byte(providedKey)) == 1
 }
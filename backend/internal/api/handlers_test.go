@@ -1,7 +1,9 @@
 package api
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -9,9 +11,11 @@ import (
 	"testing"
 
 	"github.com/alanmaizon/homer/backend/internal/connectors"
+	"github.com/alanmaizon/homer/backend/internal/domain"
 	"github.com/alanmaizon/homer/backend/internal/llm"
 	"github.com/alanmaizon/homer/backend/internal/metrics"
 	"github.com/alanmaizon/homer/backend/internal/middleware"
+	"github.com/alanmaizon/homer/backend/internal/moderation"
 	"github.com/gin-gonic/gin"
 )
 
@@ -65,7 +69,11 @@ func testRouter() *gin.Engine {
 	gin.SetMode(gin.TestMode)
 	router := gin.New()
 	router.Use(middleware.RequestID())
-	RegisterRoutes(router)
+	config, err := ConfigFromEnv()
+	if err != nil {
+		panic(err)
+	}
+	RegisterRoutes(router, config)
 	return router
 }
 
@@ -703,6 +711,18 @@ func TestTaskValidationErrors(t *testing.T) {
 			wantCode:   "missing_text",
 			wantStatus: http.StatusBadRequest,
 		},
+		{
+			name:       "temperature_out_of_range",
+			body:       "{\"task\":\"rewrite\",\"text\":\"hi\",\"generation\":{\"temperature\":3}}",
+			wantCode:   "invalid_generation_params",
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "max_tokens_above_limit",
+			body:       "{\"task\":\"rewrite\",\"text\":\"hi\",\"generation\":{\"maxTokens\":100000}}",
+			wantCode:   "invalid_generation_params",
+			wantStatus: http.StatusBadRequest,
+		},
 	}
 
 	for _, tc := range testCases {
@@ -771,3 +791,279 @@ func TestTaskSuccess(t *testing.T) {
 		t.Fatalf("expected requestId in metadata")
 	}
 }
+
+type stubProvider struct {
+	name string
+	err  error
+}
+
+func (s *stubProvider) Name() string {
+	return s.name
+}
+
+func (s *stubProvider) Summarize(_ context.Context, _ []domain.Document, _ string, _ string, _ domain.GenerationParams) (string, error) {
+	return "stub summary", s.err
+}
+
+func (s *stubProvider) Rewrite(_ context.Context, _ string, _ string, _ string, _ domain.GenerationParams) (string, error) {
+	return "stub rewrite", s.err
+}
+
+func (s *stubProvider) Generate(_ context.Context, _ []llm.Message, _ domain.GenerationParams) (string, error) {
+	return "stub generate", s.err
+}
+
+func setProviderForTest(t *testing.T, provider llm.LLMProvider) {
+	t.Helper()
+
+	previous := llm.CurrentProvider()
+	llm.SetProvider(provider)
+	t.Cleanup(func() {
+		llm.SetProvider(previous)
+	})
+}
+
+func TestTaskContentFilteredError(t *testing.T) {
+	setProviderForTest(t, &stubProvider{name: "azure_openai", err: fmt.Errorf("upstream: %w", llm.ErrContentFiltered)})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/task", strings.NewReader(`{"task":"rewrite","text":"hello"}`))
+	req.Header.Set("Content-Type", "application/json")
+	res := httptest.NewRecorder()
+
+	testRouter().ServeHTTP(res, req)
+
+	if res.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected status 422, got %d body=%s", res.Code, res.Body.String())
+	}
+
+	var payload errorEnvelope
+	if err := json.Unmarshal(res.Body.Bytes(), &payload); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if payload.Error.Code != "content_filtered" {
+		t.Fatalf("expected content_filtered, got %q", payload.Error.Code)
+	}
+}
+
+func TestTaskToolsUnsupportedError(t *testing.T) {
+	setProviderForTest(t, llm.NewMockProvider())
+
+	req := httptest.NewRequest(http.MethodPost, "/api/task", strings.NewReader(`{"task":"rewrite","text":"hello","enableTools":true}`))
+	req.Header.Set("Content-Type", "application/json")
+	res := httptest.NewRecorder()
+
+	testRouter().ServeHTTP(res, req)
+
+	if res.Code != http.StatusBadRequest {
+		t.Fatalf("expected status 400, got %d body=%s", res.Code, res.Body.String())
+	}
+
+	var payload errorEnvelope
+	if err := json.Unmarshal(res.Body.Bytes(), &payload); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if payload.Error.Code != "tools_unsupported" {
+		t.Fatalf("expected tools_unsupported, got %q", payload.Error.Code)
+	}
+}
+
+func TestTaskProviderSaturatedError(t *testing.T) {
+	setProviderForTest(t, &stubProvider{name: "openai", err: fmt.Errorf("queue: %w", llm.ErrProviderSaturated)})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/task", strings.NewReader(`{"task":"rewrite","text":"hello"}`))
+	req.Header.Set("Content-Type", "application/json")
+	res := httptest.NewRecorder()
+
+	testRouter().ServeHTTP(res, req)
+
+	if res.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected status 503, got %d body=%s", res.Code, res.Body.String())
+	}
+
+	var payload errorEnvelope
+	if err := json.Unmarshal(res.Body.Bytes(), &payload); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if payload.Error.Code != "provider_saturated" {
+		t.Fatalf("expected provider_saturated, got %q", payload.Error.Code)
+	}
+}
+
+func TestTaskRejectsRequestsOverContextWindow(t *testing.T) {
+	setProviderForTest(t, llm.NewMockProvider())
+	t.Setenv("CONTEXT_BUDGET_STRATEGY", "reject")
+	t.Setenv("LLM_CONTEXT_WINDOW_TOKENS", "1000")
+
+	body, _ := json.Marshal(domain.TaskRequest{
+		Task:      domain.TaskSummarize,
+		Documents: []domain.Document{{ID: "d1", Content: strings.Repeat("lengthy ", 500)}},
+	})
+	req := httptest.NewRequest(http.MethodPost, "/api/task", strings.NewReader(string(body)))
+	req.Header.Set("Content-Type", "application/json")
+	res := httptest.NewRecorder()
+
+	testRouter().ServeHTTP(res, req)
+
+	if res.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("expected status 413, got %d body=%s", res.Code, res.Body.String())
+	}
+
+	var payload errorEnvelope
+	if err := json.Unmarshal(res.Body.Bytes(), &payload); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if payload.Error.Code != "context_length_exceeded" || !strings.Contains(payload.Error.Message, "mock allows") {
+		t.Fatalf("unexpected error %+v", payload.Error)
+	}
+}
+
+func TestTaskReplaysRecordedCassettes(t *testing.T) {
+	t.Setenv("REPLAY_MODE", "replay")
+	t.Setenv("REPLAY_CASSETTE_DIR", "testdata/cassettes")
+	provider, err := llm.NewReplayProviderFromEnv()
+	if err != nil {
+		t.Fatalf("NewReplayProviderFromEnv returned error: %v", err)
+	}
+	setProviderForTest(t, provider)
+
+	testCases := []struct {
+		name       string
+		body       string
+		wantStatus int
+		wantResult string
+	}{
+		{
+			name:       "summarize",
+			body:       `{"task":"summarize","style":"bullet","documents":[{"id":"d1","title":"Roadmap","content":"We launch in Q1.\nSupport hiring begins in Q2."}]}`,
+			wantStatus: http.StatusOK,
+			wantResult: "- The launch is scheduled for Q1.\n- Hiring for the support team starts in Q2.",
+		},
+		{
+			name:       "rewrite",
+			body:       `{"task":"rewrite","mode":"professional","text":"send me the quarterly report by friday"}`,
+			wantStatus: http.StatusOK,
+			wantResult: "Could you please send the quarterly report by Friday?",
+		},
+		{
+			name:       "miss",
+			body:       `{"task":"rewrite","mode":"casual","text":"not recorded"}`,
+			wantStatus: http.StatusInternalServerError,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/task", strings.NewReader(tc.body))
+			req.Header.Set("Content-Type", "application/json")
+			res := httptest.NewRecorder()
+
+			testRouter().ServeHTTP(res, req)
+
+			if res.Code != tc.wantStatus {
+				t.Fatalf("expected status %d, got %d body=%s", tc.wantStatus, res.Code, res.Body.String())
+			}
+			if tc.wantStatus != http.StatusOK {
+				return
+			}
+
+			var payload taskEnvelope
+			if err := json.Unmarshal(res.Body.Bytes(), &payload); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if payload.Result != tc.wantResult || payload.Metadata.Provider != "replay" {
+				t.Fatalf("unexpected replayed response: %+v", payload)
+			}
+		})
+	}
+}
+
+func setModerationPolicyForTest(t *testing.T, policy *moderation.Policy) {
+	t.Helper()
+
+	previous := moderation.CurrentPolicy()
+	moderation.SetPolicy(policy)
+	t.Cleanup(func() {
+		moderation.SetPolicy(previous)
+	})
+}
+
+func TestTaskModeration(t *testing.T) {
+	setProviderForTest(t, llm.NewMockProvider())
+	moderator, err := moderation.NewRegexModerator([]moderation.Rule{{Category: "profanity", Pattern: `\bdarn\b`}})
+	if err != nil {
+		t.Fatalf("NewRegexModerator returned error: %v", err)
+	}
+
+	testCases := []struct {
+		name         string
+		inputAction  moderation.Action
+		outputAction moderation.Action
+		wantStatus   int
+		wantCode     string
+	}{
+		{name: "block_input", inputAction: moderation.ActionBlock, outputAction: moderation.ActionBlock, wantStatus: http.StatusUnprocessableEntity, wantCode: "moderation_input_blocked"},
+		{name: "block_output", inputAction: moderation.ActionLog, outputAction: moderation.ActionBlock, wantStatus: http.StatusUnprocessableEntity, wantCode: "moderation_output_blocked"},
+		{name: "warn", inputAction: moderation.ActionWarn, outputAction: moderation.ActionWarn, wantStatus: http.StatusOK},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			setModerationPolicyForTest(t, moderation.NewPolicy([]moderation.Moderator{moderator}, tc.inputAction, tc.outputAction))
+
+			req := httptest.NewRequest(http.MethodPost, "/api/task", strings.NewReader(`{"task":"rewrite","mode":"simplify","text":"darn this report"}`))
+			req.Header.Set("Content-Type", "application/json")
+			res := httptest.NewRecorder()
+
+			testRouter().ServeHTTP(res, req)
+
+			if res.Code != tc.wantStatus {
+				t.Fatalf("expected status %d, got %d body=%s", tc.wantStatus, res.Code, res.Body.String())
+			}
+			if tc.wantCode != "" {
+				var payload errorEnvelope
+				if err := json.Unmarshal(res.Body.Bytes(), &payload); err != nil {
+					t.Fatalf("failed to decode response: %v", err)
+				}
+				if payload.Error.Code != tc.wantCode || !strings.Contains(payload.Error.Message, "profanity") {
+					t.Fatalf("unexpected error %+v", payload.Error)
+				}
+				return
+			}
+
+			var response domain.TaskResponse
+			if err := json.Unmarshal(res.Body.Bytes(), &response); err != nil {
+				t.Fatalf("failed to decode response: %v", err)
+			}
+			if len(response.Metadata.Moderation) != 2 || response.Metadata.Moderation[0].Code != "moderation_input_flagged" {
+				t.Fatalf("expected input and output warnings, got %+v", response.Metadata.Moderation)
+			}
+		})
+	}
+}
+
+func TestConnectorExportBlockedByModeration(t *testing.T) {
+	moderator, err := moderation.NewRegexModerator([]moderation.Rule{{Category: "profanity", Pattern: `\bdarn\b`}})
+	if err != nil {
+		t.Fatalf("NewRegexModerator returned error: %v", err)
+	}
+	setModerationPolicyForTest(t, moderation.NewPolicy([]moderation.Moderator{moderator}, moderation.ActionBlock, moderation.ActionBlock))
+	connector := &stubConnector{name: "google_docs"}
+	setConnectorFactoryForTest(t, connector)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/connectors/export", strings.NewReader(`{"documentId":"doc-1","content":"darn it"}`))
+	req.Header.Set("Content-Type", "application/json")
+	res := httptest.NewRecorder()
+
+	testRouter().ServeHTTP(res, req)
+
+	if res.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected status 422, got %d body=%s", res.Code, res.Body.String())
+	}
+	var payload errorEnvelope
+	if err := json.Unmarshal(res.Body.Bytes(), &payload); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if payload.Error.Code != "moderation_output_blocked" {
+		t.Fatalf("expected moderation_output_blocked, got %q", payload.Error.Code)
+	}
+}
@@ -0,0 +1,158 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/alanmaizon/homer/backend/internal/domain"
+	"github.com/alanmaizon/homer/backend/internal/idempotency"
+	"github.com/alanmaizon/homer/backend/internal/metrics"
+	"github.com/alanmaizon/homer/backend/internal/middleware"
+	"github.com/alanmaizon/homer/backend/internal/sharedstate"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	idempotencyKeyHeader      = "Idempotency-Key"
+	idempotentReplayedHeader  = "Idempotent-Replayed"
+	maxIdempotencyKeyLength   = 255
+	idempotencyInProgressCode = "idempotency_request_in_progress"
+)
+
+func loadIdempotency(shared sharedstate.Store) *idempotency.Manager {
+	config := idempotency.ConfigFromEnv()
+	return idempotency.NewManager(idempotency.NewStore(shared, config), config)
+}
+
+// idempotent answers retries of a request carrying an Idempotency-Key from
+// the first response, stored per tenant and key with a fingerprint of the
+// method, route and body. A reused key with a different request gets 422
+// idempotency_key_conflict, and a duplicate of a request still running waits
+// for it. Responses with a 5xx or 429 status are not stored so the retry
+// runs again. Store failures are logged and the request runs unguarded.
+func idempotent(manager *idempotency.Manager, limits domain.RequestLimits) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := strings.TrimSpace(c.GetHeader(idempotencyKeyHeader))
+		if key == "" {
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			writeError(c, http.StatusBadRequest, "invalid_idempotency_key", "Idempotency-Key must be at most 255 characters")
+			c.Abort()
+			return
+		}
+
+		body, ok := peekBody(c, limits)
+		if !ok {
+			// The handler refuses the oversized body.
+			return
+		}
+
+		ctx := c.Request.Context()
+		tenant := middleware.GetTenant(c)
+		storeKey := url.QueryEscape(tenant) + ":" + key
+		fingerprint := idempotency.Fingerprint(c.Request.Method, c.FullPath(), body)
+		claim, stored, err := manager.Begin(ctx, storeKey, fingerprint)
+		switch {
+		case errors.Is(err, idempotency.ErrConflict):
+			metrics.RecordIdempotentRequest("conflict")
+			writeError(c, http.StatusUnprocessableEntity, "idempotency_key_conflict", "Idempotency-Key was already used with a different request")
+			c.Abort()
+			return
+		case err != nil && ctx.Err() != nil:
+			writeError(c, http.StatusConflict, idempotencyInProgressCode, "a request with this Idempotency-Key is still in progress")
+			c.Abort()
+			return
+		case err != nil:
+			log.Printf("request_id=%s tenant=%s component=idempotency event=store_error error=%q", middleware.GetRequestID(c), tenant, err.Error())
+			return
+		case stored != nil:
+			metrics.RecordIdempotentRequest("replayed")
+			c.Header(idempotentReplayedHeader, "true")
+			c.Data(stored.Status, stored.ContentType, stored.Body)
+			c.Abort()
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		completed := false
+		defer func() {
+			// Detached from the request so a disconnecting client does not
+			// leave the key claimed until the lock expires.
+			storeCtx := context.WithoutCancel(ctx)
+			if completed {
+				response := idempotency.Response{
+					Status:      recorder.Status(),
+					ContentType: recorder.Header().Get("Content-Type"),
+					Body:        recorder.body.Bytes(),
+				}
+				if err := manager.Complete(storeCtx, storeKey, claim, fingerprint, response); err != nil {
+					logIdempotencyStoreError(c, tenant, err)
+					metrics.RecordIdempotentRequest("not_stored")
+					return
+				}
+				metrics.RecordIdempotentRequest("stored")
+				return
+			}
+			if err := manager.Release(storeCtx, storeKey, claim); err != nil {
+				logIdempotencyStoreError(c, tenant, err)
+			}
+			metrics.RecordIdempotentRequest("not_stored")
+		}()
+
+		c.Next()
+		status := recorder.Status()
+		completed = status < http.StatusInternalServerError && status != http.StatusTooManyRequests
+	}
+}
+
+// logIdempotencyStoreError logs a failed Complete or Release. A lost claim
+// means the request outlived its lock and another request took the key over.
+func logIdempotencyStoreError(c *gin.Context, tenant string, err error) {
+	event := "store_error"
+	switch {
+	case errors.Is(err, idempotency.ErrClaimLost):
+		event = "claim_lost"
+	case errors.Is(err, idempotency.ErrResponseTooLarge):
+		event = "response_too_large"
+	}
+	log.Printf("request_id=%s tenant=%s component=idempotency event=%s error=%q", middleware.GetRequestID(c), tenant, event, err.Error())
+}
+
+// peekBody reads the request body and puts it back for the handler. It
+// reports false, leaving the body unread, when the body exceeds
+// MaxBodyBytes.
+func peekBody(c *gin.Context, limits domain.RequestLimits) ([]byte, bool) {
+	if c.Request.ContentLength > int64(limits.MaxBodyBytes) {
+		return nil, false
+	}
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, int64(limits.MaxBodyBytes)+1))
+	c.Request.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), c.Request.Body))
+	if err != nil || len(body) > limits.MaxBodyBytes {
+		return nil, false
+	}
+	return body, true
+}
+
+// responseRecorder keeps a copy of the body written through it.
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
@@ -0,0 +1,177 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alanmaizon/homer/backend/internal/domain"
+	"github.com/alanmaizon/homer/backend/internal/llm"
+)
+
+// gatedProvider counts calls and holds each one until gate is closed.
+type gatedProvider struct {
+	calls atomic.Int32
+	gate  chan struct{}
+	err   error
+}
+
+func (p *gatedProvider) wait() (string, error) {
+	p.calls.Add(1)
+	if p.gate != nil {
+		<-p.gate
+	}
+	return "gated", p.err
+}
+
+func (p *gatedProvider) Name() string {
+	return "mock"
+}
+
+func (p *gatedProvider) Summarize(context.Context, []domain.Document, string, string, domain.GenerationParams) (string, error) {
+	return p.wait()
+}
+
+func (p *gatedProvider) Rewrite(context.Context, string, string, string, domain.GenerationParams) (string, error) {
+	return p.wait()
+}
+
+func (p *gatedProvider) Generate(context.Context, []llm.Message, domain.GenerationParams) (string, error) {
+	return p.wait()
+}
+
+func serveIdempotent(t *testing.T, router http.Handler, path string, body string, apiKey string, idempotencyKey string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", idempotencyKey)
+	if apiKey != "" {
+		req.Header.Set("X-API-Key", apiKey)
+	}
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	return res
+}
+
+func TestTaskReplaysResponseForIdempotencyKey(t *testing.T) {
+	provider := &gatedProvider{}
+	setProviderForTest(t, provider)
+	router := testRouter()
+	body := `{"task":"rewrite","text":"hello"}`
+
+	first := serveIdempotent(t, router, "/api/task", body, "", "retry-1")
+	if first.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d body=%s", first.Code, first.Body.String())
+	}
+	calls := provider.calls.Load()
+
+	second := serveIdempotent(t, router, "/api/task", body, "", "retry-1")
+	if second.Code != http.StatusOK || second.Body.String() != first.Body.String() {
+		t.Fatalf("expected the stored response, got %d body=%s", second.Code, second.Body.String())
+	}
+	if second.Header().Get("Idempotent-Replayed") != "true" {
+		t.Fatalf("expected Idempotent-Replayed header on the replay")
+	}
+	if provider.calls.Load() != calls {
+		t.Fatalf("expected the replay not to call the provider again")
+	}
+
+	res := serveIdempotent(t, router, "/api/task", `{"task":"rewrite","text":"goodbye"}`, "", "retry-1")
+	if res.Code != http.StatusUnprocessableEntity || decodeErrorCode(t, res) != "idempotency_key_conflict" {
+		t.Fatalf("expected 422 idempotency_key_conflict, got %d body=%s", res.Code, res.Body.String())
+	}
+}
+
+func TestIdempotencyKeysAreScopedToTenant(t *testing.T) {
+	setAPIKeysForTest(t)
+	setProviderForTest(t, &gatedProvider{})
+	router := testRouter()
+
+	if res := serveIdempotent(t, router, "/api/task", `{"task":"rewrite","text":"hello"}`, "acme-key", "shared"); res.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d body=%s", res.Code, res.Body.String())
+	}
+	res := serveIdempotent(t, router, "/api/task", `{"task":"rewrite","text":"other"}`, "globex-key", "shared")
+	if res.Code != http.StatusOK || res.Header().Get("Idempotent-Replayed") != "" {
+		t.Fatalf("expected another tenant's key to run independently, got %d body=%s", res.Code, res.Body.String())
+	}
+}
+
+func TestTaskDuplicateWaitsForInFlightRequest(t *testing.T) {
+	provider := &gatedProvider{gate: make(chan struct{})}
+	setProviderForTest(t, provider)
+	router := testRouter()
+	body := `{"task":"rewrite","text":"hello"}`
+
+	var wg sync.WaitGroup
+	responses := make([]*httptest.ResponseRecorder, 2)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		responses[0] = serveIdempotent(t, router, "/api/task", body, "", "slow")
+	}()
+	for provider.calls.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		responses[1] = serveIdempotent(t, router, "/api/task", body, "", "slow")
+	}()
+
+	time.Sleep(20 * time.Millisecond)
+	if calls := provider.calls.Load(); calls != 1 {
+		t.Fatalf("expected the duplicate to wait instead of running, got %d provider calls", calls)
+	}
+	close(provider.gate)
+	wg.Wait()
+
+	if responses[0].Code != http.StatusOK || responses[1].Body.String() != responses[0].Body.String() {
+		t.Fatalf("expected the duplicate to receive the first response, got %d body=%s", responses[1].Code, responses[1].Body.String())
+	}
+	if responses[1].Header().Get("Idempotent-Replayed") != "true" {
+		t.Fatalf("expected the duplicate to be marked as a replay")
+	}
+}
+
+func TestTaskServerErrorsAreNotStored(t *testing.T) {
+	provider := &gatedProvider{err: errors.New("upstream down")}
+	setProviderForTest(t, provider)
+	router := testRouter()
+	body := `{"task":"rewrite","text":"hello"}`
+
+	if res := serveIdempotent(t, router, "/api/task", body, "", "flaky"); res.Code < http.StatusInternalServerError {
+		t.Fatalf("expected a server error, got %d body=%s", res.Code, res.Body.String())
+	}
+
+	provider.err = nil
+	res := serveIdempotent(t, router, "/api/task", body, "", "flaky")
+	if res.Code != http.StatusOK || res.Header().Get("Idempotent-Replayed") != "" {
+		t.Fatalf("expected the retry to run again, got %d body=%s", res.Code, res.Body.String())
+	}
+}
+
+func TestConnectorExportReplaysResponseForIdempotencyKey(t *testing.T) {
+	setConnectorFactoryForTest(t, &stubConnector{name: "google_docs"})
+	router := testRouter()
+	body := `{"documentId":"doc-1","content":"final text"}`
+
+	first := serveIdempotent(t, router, "/api/connectors/export", body, "", "export-1")
+	if first.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d body=%s", first.Code, first.Body.String())
+	}
+	second := serveIdempotent(t, router, "/api/connectors/export", body, "", "export-1")
+	if second.Header().Get("Idempotent-Replayed") != "true" || second.Body.String() != first.Body.String() {
+		t.Fatalf("expected the export to be replayed, got %d body=%s", second.Code, second.Body.String())
+	}
+
+	res := serveIdempotent(t, router, "/api/task", `{"task":"rewrite","text":"hello"}`, "", "export-1")
+	if res.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected reusing the key on another route to conflict, got %d body=%s", res.Code, res.Body.String())
+	}
+}
@@ -0,0 +1,169 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/alanmaizon/homer/backend/internal/agents"
+	"github.com/alanmaizon/homer/backend/internal/auth"
+	"github.com/alanmaizon/homer/backend/internal/domain"
+	"github.com/alanmaizon/homer/backend/internal/jobs"
+	"github.com/alanmaizon/homer/backend/internal/middleware"
+	"github.com/alanmaizon/homer/backend/internal/quota"
+	"github.com/alanmaizon/homer/backend/internal/webhooks"
+	"github.com/gin-gonic/gin"
+)
+
+func registerJobRoutes(router *gin.Engine, authn authenticator, dispatcher *webhooks.Dispatcher, enforcer *quota.Enforcer, rateLimit *rateLimitGroup, limits domain.RequestLimits) *jobs.Manager {
+	store, err := newJobStoreFromEnv()
+	if err != nil {
+		log.Printf("component=jobs event=store_fallback store=memory error=%q", err.Error())
+		store = jobs.NewMemoryStore()
+	}
+	run := func(ctx context.Context, job jobs.Job) (domain.TaskResponse, *domain.APIError) {
+		response, apiErr := runTaskJob(ctx, enforcer, limits, job)
+		if apiErr == nil {
+			recordOutputTokens(ctx, enforcer, job.Tenant, response)
+		}
+		return response, apiErr
+	}
+	manager := jobs.NewManager(store, run, jobs.ConfigFromEnv())
+	manager.OnFinish(func(job jobs.Job) {
+		if job.Status == jobs.StatusCanceled && job.StartedAt.IsZero() {
+			// Canceled while queued, so it never ran.
+			refundQuota(middleware.WithRequestID(context.Background(), job.RequestID), enforcer, job.Reservation)
+		}
+		sendJobCallback(dispatcher, job)
+	})
+
+	group := router.Group("/api/jobs", authn.require(auth.ScopeTask))
+
+	group.POST("", func(c *gin.Context) {
+		if !rateLimit.enforce(c) {
+			return
+		}
+
+		var req domain.TaskRequest
+		if !bindJSON(c, limits, &req, "invalid task payload") {
+			return
+		}
+		if validationErr := validateTaskRequest(req, limits); validationErr != nil {
+			writeError(c, http.StatusBadRequest, validationErr.Code, validationErr.Message)
+			return
+		}
+		if callbackErr := validateCallbackURL(dispatcher, req.CallbackURL); callbackErr != nil {
+			writeError(c, http.StatusBadRequest, callbackErr.Code, callbackErr.Message)
+			return
+		}
+		reservation, ok := reserveTaskQuota(c, enforcer, req)
+		if !ok {
+			return
+		}
+
+		job := jobs.Job{Request: req, RequestID: middleware.GetRequestID(c), Tenant: middleware.GetTenant(c), Reservation: reservation}
+		if req.EnableTools && connectorKeyValid(c) {
+			job.UseConnector = true
+			job.ConnectorSession = connectorSessionKeyFromRequest(c)
+		}
+
+		job, err := manager.Submit(c.Request.Context(), job)
+		if err != nil {
+			refundQuota(c.Request.Context(), enforcer, reservation)
+			if errors.Is(err, jobs.ErrQueueFull) {
+				writeError(c, http.StatusServiceUnavailable, "job_queue_full", "job queue is full, retry later")
+				return
+			}
+			writeError(c, http.StatusInternalServerError, "internal_error", err.Error())
+			return
+		}
+
+		c.Header("Location", "/api/jobs/"+job.ID)
+		c.JSON(http.StatusAccepted, jobResponse(job))
+	})
+
+	group.GET("/:id", func(c *gin.Context) {
+		job, err := getTenantJob(c, manager)
+		if err != nil {
+			writeJobError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, jobResponse(job))
+	})
+
+	group.DELETE("/:id", func(c *gin.Context) {
+		if _, err := getTenantJob(c, manager); err != nil {
+			writeJobError(c, err)
+			return
+		}
+		job, err := manager.Cancel(c.Request.Context(), c.Param("id"))
+		if err != nil {
+			writeJobError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, jobResponse(job))
+	})
+
+	return manager
+}
+
+// runTaskJob executes a job's task the way POST /api/task does and maps
+// failures to the same error codes.
+func runTaskJob(ctx context.Context, enforcer *quota.Enforcer, limits domain.RequestLimits, job jobs.Job) (domain.TaskResponse, *domain.APIError) {
+	if job.Request.EnableTools && job.UseConnector {
+		ctx = agents.WithConnector(ctx, newConnectorFromEnv(), job.ConnectorSession, limits.MaxDocuments)
+	}
+
+	response, err := executeReservedTask(ctx, enforcer, job.Tenant, job.Reservation, job.Request)
+	if err != nil {
+		_, code, message := taskExecutionError(err)
+		return domain.TaskResponse{}, &domain.APIError{Code: code, Message: message, RequestID: job.RequestID}
+	}
+	response.Metadata.RequestID = job.RequestID
+	return response, nil
+}
+
+// getTenantJob loads the job named in the path, treating other tenants' jobs
+// as not found.
+func getTenantJob(c *gin.Context, manager *jobs.Manager) (jobs.Job, error) {
+	job, err := manager.Get(c.Request.Context(), c.Param("id"))
+	if err != nil {
+		return jobs.Job{}, err
+	}
+	if job.Tenant != middleware.GetTenant(c) {
+		return jobs.Job{}, jobs.ErrJobNotFound
+	}
+	return job, nil
+}
+
+func writeJobError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, jobs.ErrJobNotFound):
+		writeError(c, http.StatusNotFound, "job_not_found", "job was not found or has expired")
+	case errors.Is(err, jobs.ErrJobFinished):
+		writeError(c, http.StatusConflict, "job_already_finished", "job has already finished")
+	default:
+		writeError(c, http.StatusInternalServerError, "internal_error", err.Error())
+	}
+}
+
+func jobResponse(job jobs.Job) domain.JobResponse {
+	return domain.JobResponse{
+		ID:         job.ID,
+		Status:     string(job.Status),
+		CreatedAt:  formatJobTime(job.CreatedAt),
+		StartedAt:  formatJobTime(job.StartedAt),
+		FinishedAt: formatJobTime(job.FinishedAt),
+		Result:     job.Result,
+		Error:      job.Error,
+	}
+}
+
+func formatJobTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,134 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alanmaizon/homer/backend/internal/domain"
+	"github.com/alanmaizon/homer/backend/internal/llm"
+	"github.com/gin-gonic/gin"
+)
+
+func serveJobRequest(t *testing.T, router *gin.Engine, method string, path string, body string) (*httptest.ResponseRecorder, domain.JobResponse) {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+
+	var job domain.JobResponse
+	if res.Code < 300 {
+		if err := json.Unmarshal(res.Body.Bytes(), &job); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+	}
+	return res, job
+}
+
+func waitForJob(t *testing.T, router *gin.Engine, id string) domain.JobResponse {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		res, job := serveJobRequest(t, router, http.MethodGet, "/api/jobs/"+id, "")
+		if res.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d body=%s", res.Code, res.Body.String())
+		}
+		if job.Status != "queued" && job.Status != "running" {
+			return job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job %s did not finish, status %s", id, job.Status)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestJobsRunTasksAsynchronously(t *testing.T) {
+	setProviderForTest(t, llm.NewMockProvider())
+	router := testRouter()
+
+	res, job := serveJobRequest(t, router, http.MethodPost, "/api/jobs", `{"task":"rewrite","text":"hello","style":"formal"}`)
+	if res.Code != http.StatusAccepted {
+		t.Fatalf("expected status 202, got %d body=%s", res.Code, res.Body.String())
+	}
+	if job.ID == "" || res.Header().Get("Location") != "/api/jobs/"+job.ID {
+		t.Fatalf("expected job ID and Location header, got %+v location=%q", job, res.Header().Get("Location"))
+	}
+
+	job = waitForJob(t, router, job.ID)
+	if job.Status != "succeeded" || job.Result == nil || job.Result.Result == "" || job.FinishedAt == "" {
+		t.Fatalf("expected a succeeded job with a result, got %+v", job)
+	}
+	if job.Result.Metadata.RequestID != res.Header().Get("X-Request-Id") {
+		t.Fatalf("expected the submitting request ID, got %q", job.Result.Metadata.RequestID)
+	}
+
+	res, _ = serveJobRequest(t, router, http.MethodDelete, "/api/jobs/"+job.ID, "")
+	if res.Code != http.StatusConflict || !strings.Contains(res.Body.String(), "job_already_finished") {
+		t.Fatalf("expected job_already_finished, got %d body=%s", res.Code, res.Body.String())
+	}
+	res, _ = serveJobRequest(t, router, http.MethodGet, "/api/jobs/missing", "")
+	if res.Code != http.StatusNotFound || !strings.Contains(res.Body.String(), "job_not_found") {
+		t.Fatalf("expected job_not_found, got %d body=%s", res.Code, res.Body.String())
+	}
+}
+
+func TestJobsReportTaskErrors(t *testing.T) {
+	setProviderForTest(t, &stubProvider{name: "openai", err: fmt.Errorf("queue: %w", llm.ErrProviderSaturated)})
+	router := testRouter()
+
+	res, job := serveJobRequest(t, router, http.MethodPost, "/api/jobs", `{"task":"rewrite","text":"hello"}`)
+	if res.Code != http.StatusAccepted {
+		t.Fatalf("expected status 202, got %d body=%s", res.Code, res.Body.String())
+	}
+
+	job = waitForJob(t, router, job.ID)
+	if job.Status != "failed" || job.Error == nil || job.Error.Code != "provider_saturated" || job.Result != nil {
+		t.Fatalf("expected a provider_saturated failure, got %+v", job)
+	}
+}
+
+func TestJobsValidateRequests(t *testing.T) {
+	res, _ := serveJobRequest(t, testRouter(), http.MethodPost, "/api/jobs", `{"task":"summarize"}`)
+	if res.Code != http.StatusBadRequest || !strings.Contains(res.Body.String(), "missing_documents") {
+		t.Fatalf("expected missing_documents, got %d body=%s", res.Code, res.Body.String())
+	}
+}
+
+func TestJobsRefundQuotaWhenCanceledWhileQueued(t *testing.T) {
+	t.Setenv("JOBS_WORKERS", "1")
+	t.Setenv("QUOTA_DAILY_REQUESTS", "2")
+	t.Setenv("QUOTA_TENANTS", "")
+	provider := &gatedProvider{gate: make(chan struct{})}
+	setProviderForTest(t, provider)
+	router := testRouter()
+	defer close(provider.gate)
+
+	res, _ := serveJobRequest(t, router, http.MethodPost, "/api/jobs", `{"task":"rewrite","text":"first"}`)
+	if res.Code != http.StatusAccepted {
+		t.Fatalf("expected status 202, got %d body=%s", res.Code, res.Body.String())
+	}
+	for provider.calls.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	res, queued := serveJobRequest(t, router, http.MethodPost, "/api/jobs", `{"task":"rewrite","text":"second"}`)
+	if res.Code != http.StatusAccepted {
+		t.Fatalf("expected status 202, got %d body=%s", res.Code, res.Body.String())
+	}
+
+	if res, _ := serveJobRequest(t, router, http.MethodDelete, "/api/jobs/"+queued.ID, ""); res.Code >= 300 {
+		t.Fatalf("expected the queued job to be canceled, got %d body=%s", res.Code, res.Body.String())
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for dailyRequestsUsed(t, router) != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected the canceled job to be refunded, got %d requests used", dailyRequestsUsed(t, router))
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,105 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"unicode/utf8"
+
+	"github.com/alanmaizon/homer/backend/internal/domain"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultMaxBodyBytes        = 10 << 20
+	defaultMaxDocuments        = 50
+	defaultMaxDocumentChars    = 200000
+	defaultMaxTextChars        = 200000
+	defaultMaxInstructionChars = 8000
+	defaultMaxIDChars          = 256
+	defaultMaxTitleChars       = 512
+)
+
+// requestLimitsFromEnv reads REQUEST_MAX_BODY_BYTES, REQUEST_MAX_DOCUMENTS,
+// REQUEST_MAX_DOCUMENT_CHARS, REQUEST_MAX_TEXT_CHARS,
+// REQUEST_MAX_INSTRUCTION_CHARS, REQUEST_MAX_ID_CHARS,
+// REQUEST_MAX_TITLE_CHARS and BATCH_MAX_ITEMS.
+func requestLimitsFromEnv() domain.RequestLimits {
+	return domain.RequestLimits{
+		MaxBodyBytes:        positiveIntFromEnv("REQUEST_MAX_BODY_BYTES", defaultMaxBodyBytes),
+		MaxDocuments:        positiveIntFromEnv("REQUEST_MAX_DOCUMENTS", defaultMaxDocuments),
+		MaxDocumentChars:    positiveIntFromEnv("REQUEST_MAX_DOCUMENT_CHARS", defaultMaxDocumentChars),
+		MaxTextChars:        positiveIntFromEnv("REQUEST_MAX_TEXT_CHARS", defaultMaxTextChars),
+		MaxInstructionChars: positiveIntFromEnv("REQUEST_MAX_INSTRUCTION_CHARS", defaultMaxInstructionChars),
+		MaxIDChars:          positiveIntFromEnv("REQUEST_MAX_ID_CHARS", defaultMaxIDChars),
+		MaxTitleChars:       positiveIntFromEnv("REQUEST_MAX_TITLE_CHARS", defaultMaxTitleChars),
+		MaxBatchItems:       positiveIntFromEnv("BATCH_MAX_ITEMS", defaultBatchMaxItems),
+	}
+}
+
+// bindJSON decodes the request body into dst. Bodies over MaxBodyBytes are
+// refused with 413 request_too_large: before reading when Content-Length
+// declares the size, otherwise as soon as the limit is crossed. Other decode
+// failures are 400 invalid_payload with message.
+func bindJSON(c *gin.Context, limits domain.RequestLimits, dst any, message string) bool {
+	if c.Request.ContentLength > int64(limits.MaxBodyBytes) {
+		writeBodyTooLarge(c, limits)
+		return false
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, int64(limits.MaxBodyBytes))
+	if err := c.ShouldBindJSON(dst); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeBodyTooLarge(c, limits)
+			return false
+		}
+		writeError(c, http.StatusBadRequest, "invalid_payload", message)
+		return false
+	}
+	return true
+}
+
+func writeBodyTooLarge(c *gin.Context, limits domain.RequestLimits) {
+	writeError(c, http.StatusRequestEntityTooLarge, "request_too_large", fmt.Sprintf("request body exceeds %d bytes", limits.MaxBodyBytes))
+}
+
+// validateTaskLimits checks the parts of a task request whose size the
+// client controls.
+func validateTaskLimits(req domain.TaskRequest, limits domain.RequestLimits) *domain.APIError {
+	if len(req.Documents) > limits.MaxDocuments {
+		return &domain.APIError{Code: "too_many_documents", Message: fmt.Sprintf("a request may include at most %d documents", limits.MaxDocuments)}
+	}
+	for i, doc := range req.Documents {
+		if apiErr := validateIDLength(fmt.Sprintf("documents[%d].id", i), doc.ID, limits); apiErr != nil {
+			return apiErr
+		}
+		if utf8.RuneCountInString(doc.Title) > limits.MaxTitleChars {
+			return &domain.APIError{Code: "title_too_long", Message: fmt.Sprintf("documents[%d].title exceeds %d characters", i, limits.MaxTitleChars)}
+		}
+		if apiErr := validateDocumentLength(fmt.Sprintf("documents[%d].content", i), doc.Content, limits); apiErr != nil {
+			return apiErr
+		}
+	}
+	if utf8.RuneCountInString(req.Text) > limits.MaxTextChars {
+		return &domain.APIError{Code: "text_too_large", Message: fmt.Sprintf("text exceeds %d characters", limits.MaxTextChars)}
+	}
+	if utf8.RuneCountInString(req.Instructions) > limits.MaxInstructionChars {
+		return &domain.APIError{Code: "instructions_too_long", Message: fmt.Sprintf("instructions exceed %d characters", limits.MaxInstructionChars)}
+	}
+	return nil
+}
+
+func validateIDLength(field string, id string, limits domain.RequestLimits) *domain.APIError {
+	if utf8.RuneCountInString(id) > limits.MaxIDChars {
+		return &domain.APIError{Code: "id_too_long", Message: fmt.Sprintf("%s exceeds %d characters", field, limits.MaxIDChars)}
+	}
+	return nil
+}
+
+func validateDocumentLength(field string, content string, limits domain.RequestLimits) *domain.APIError {
+	if utf8.RuneCountInString(content) > limits.MaxDocumentChars {
+		return &domain.APIError{Code: "document_too_large", Message: fmt.Sprintf("%s exceeds %d characters", field, limits.MaxDocumentChars)}
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/alanmaizon/homer/backend/internal/domain"
+	"github.com/alanmaizon/homer/backend/internal/llm"
+)
+
+func setRequestLimitsForTest(t *testing.T) {
+	t.Helper()
+	t.Setenv("REQUEST_MAX_BODY_BYTES", "2048")
+	t.Setenv("REQUEST_MAX_DOCUMENTS", "2")
+	t.Setenv("REQUEST_MAX_DOCUMENT_CHARS", "20")
+	t.Setenv("REQUEST_MAX_TEXT_CHARS", "20")
+	t.Setenv("REQUEST_MAX_INSTRUCTION_CHARS", "10")
+	t.Setenv("REQUEST_MAX_ID_CHARS", "8")
+	t.Setenv("REQUEST_MAX_TITLE_CHARS", "12")
+	setProviderForTest(t, llm.NewMockProvider())
+}
+
+func decodeErrorCode(t *testing.T, res *httptest.ResponseRecorder) string {
+	t.Helper()
+	var payload errorEnvelope
+	if err := json.Unmarshal(res.Body.Bytes(), &payload); err != nil {
+		t.Fatalf("failed to decode error response: %v body=%s", err, res.Body.String())
+	}
+	return payload.Error.Code
+}
+
+func TestTaskRejectsOversizedBodyBeforeBinding(t *testing.T) {
+	setRequestLimitsForTest(t)
+	router := testRouter()
+	body := `{"task":"rewrite","text":"` + strings.Repeat("a", 4096) + `"}`
+
+	res := serveWithKey(t, router, http.MethodPost, "/api/task", body, "")
+	if res.Code != http.StatusRequestEntityTooLarge || decodeErrorCode(t, res) != "request_too_large" {
+		t.Fatalf("expected 413 request_too_large, got %d body=%s", res.Code, res.Body.String())
+	}
+
+	// Without Content-Length the body is cut off once it crosses the limit.
+	req := httptest.NewRequest(http.MethodPost, "/api/task", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.ContentLength = -1
+	res = httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	if res.Code != http.StatusRequestEntityTooLarge || decodeErrorCode(t, res) != "request_too_large" {
+		t.Fatalf("expected streamed body to be refused with 413, got %d body=%s", res.Code, res.Body.String())
+	}
+}
+
+func TestTaskRejectsRequestsOverShapeLimits(t *testing.T) {
+	setRequestLimitsForTest(t)
+	router := testRouter()
+
+	cases := []struct {
+		name string
+		body string
+		code string
+	}{
+		{
+			name: "too many documents",
+			body: `{"task":"summarize","documents":[{"id":"1","content":"a"},{"id":"2","content":"b"},{"id":"3","content":"c"}]}`,
+			code: "too_many_documents",
+		},
+		{
+			name: "document content",
+			body: `{"task":"summarize","documents":[{"id":"1","content":"` + strings.Repeat("é", 21) + `"}]}`,
+			code: "document_too_large",
+		},
+		{
+			name: "document id",
+			body: `{"task":"summarize","documents":[{"id":"123456789","content":"a"}]}`,
+			code: "id_too_long",
+		},
+		{
+			name: "document title",
+			body: `{"task":"summarize","documents":[{"id":"1","title":"a very long title","content":"a"}]}`,
+			code: "title_too_long",
+		},
+		{
+			name: "text",
+			body: `{"task":"rewrite","text":"` + strings.Repeat("a", 21) + `"}`,
+			code: "text_too_large",
+		},
+		{
+			name: "instructions",
+			body: `{"task":"rewrite","text":"hello","instructions":"be very concise"}`,
+			code: "instructions_too_long",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			res := serveWithKey(t, router, http.MethodPost, "/api/task", tc.body, "")
+			if res.Code != http.StatusBadRequest || decodeErrorCode(t, res) != tc.code {
+				t.Fatalf("expected 400 %s, got %d body=%s", tc.code, res.Code, res.Body.String())
+			}
+		})
+	}
+
+	// Limits count characters, not bytes.
+	body := `{"task":"summarize","documents":[{"id":"1","content":"` + strings.Repeat("é", 20) + `"}]}`
+	if res := serveWithKey(t, router, http.MethodPost, "/api/task", body, ""); res.Code != http.StatusOK {
+		t.Fatalf("expected a document at the limit to be accepted, got %d body=%s", res.Code, res.Body.String())
+	}
+}
+
+func TestBatchAppliesLimitsPerItem(t *testing.T) {
+	setRequestLimitsForTest(t)
+
+	res := serveBatch(t, `{"items":[{"id":"123456789","task":"rewrite","text":"hello"}]}`, "")
+	if res.Code != http.StatusBadRequest || decodeErrorCode(t, res) != "id_too_long" {
+		t.Fatalf("expected 400 id_too_long, got %d body=%s", res.Code, res.Body.String())
+	}
+
+	res = serveBatch(t, `{"items":[{"id":"a","task":"rewrite","text":"hello"},{"id":"b","task":"rewrite","text":"`+strings.Repeat("a", 21)+`"}]}`, "")
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d body=%s", res.Code, res.Body.String())
+	}
+	var payload domain.BatchTaskResponse
+	if err := json.Unmarshal(res.Body.Bytes(), &payload); err != nil {
+		t.Fatalf("failed to decode batch response: %v", err)
+	}
+	if payload.Items[0].Error != nil || payload.Items[1].Error == nil || payload.Items[1].Error.Code != "text_too_large" {
+		t.Fatalf("expected only the oversized item to fail, got %+v", payload.Items)
+	}
+}
+
+func TestConnectorExportRejectsOversizedContent(t *testing.T) {
+	setRequestLimitsForTest(t)
+	t.Setenv("CONNECTOR_PROVIDER", "none")
+
+	body := fmt.Sprintf(`{"documentId":"doc-1","content":%q}`, strings.Repeat("a", 21))
+	res := serveWithKey(t, testRouter(), http.MethodPost, "/api/connectors/export", body, "")
+	if res.Code != http.StatusBadRequest || decodeErrorCode(t, res) != "document_too_large" {
+		t.Fatalf("expected 400 document_too_large, got %d body=%s", res.Code, res.Body.String())
+	}
+}
+
+func TestCapabilitiesListRequestLimits(t *testing.T) {
+	setRequestLimitsForTest(t)
+	t.Setenv("BATCH_MAX_ITEMS", "")
+
+	res := serveWithKey(t, testRouter(), http.MethodGet, "/api/capabilities", "", "")
+	var payload domain.CapabilitiesResponse
+	if err := json.Unmarshal(res.Body.Bytes(), &payload); err != nil {
+		t.Fatalf("failed to decode capabilities: %v", err)
+	}
+	expected := domain.RequestLimits{
+		MaxBodyBytes:        2048,
+		MaxDocuments:        2,
+		MaxDocumentChars:    20,
+		MaxTextChars:        20,
+		MaxInstructionChars: 10,
+		MaxIDChars:          8,
+		MaxTitleChars:       12,
+		MaxBatchItems:       defaultBatchMaxItems,
+	}
+	if payload.Limits != expected {
+		t.Fatalf("expected limits %+v, got %+v", expected, payload.Limits)
+	}
+}
@@ -0,0 +1,158 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/alanmaizon/homer/backend/internal/agents"
+	"github.com/alanmaizon/homer/backend/internal/auth"
+	"github.com/alanmaizon/homer/backend/internal/domain"
+	"github.com/alanmaizon/homer/backend/internal/llm"
+	"github.com/alanmaizon/homer/backend/internal/metrics"
+	"github.com/alanmaizon/homer/backend/internal/middleware"
+	"github.com/alanmaizon/homer/backend/internal/quota"
+	"github.com/gin-gonic/gin"
+)
+
+func registerUsageRoutes(router *gin.Engine, authn authenticator, enforcer *quota.Enforcer) {
+	router.GET("/api/usage", authn.require(auth.ScopeTask), func(c *gin.Context) {
+		tenant := middleware.GetTenant(c)
+		windows, err := enforcer.Report(c.Request.Context(), tenant)
+		if err != nil {
+			writeError(c, http.StatusInternalServerError, "internal_error", err.Error())
+			return
+		}
+
+		response := domain.UsageResponse{Tenant: tenant}
+		for _, window := range windows {
+			usage := domain.UsageWindow{
+				Start:   window.Start.UTC().Format(time.RFC3339),
+				ResetAt: window.ResetAt.UTC().Format(time.RFC3339),
+				Used:    usageCounters(window.Used),
+				Limits:  usageCounters(window.Limits),
+			}
+			if window.Period == quota.PeriodMonth {
+				response.Monthly = usage
+			} else {
+				response.Daily = usage
+			}
+		}
+		c.JSON(http.StatusOK, response)
+	})
+}
+
+func usageCounters(usage quota.Usage) domain.UsageCounters {
+	return domain.UsageCounters{Requests: usage.Requests, InputChars: usage.InputChars, Tokens: usage.Tokens}
+}
+
+// taskCharge is what running req costs before its output is known: one
+// request, its input characters and estimated prompt tokens.
+func taskCharge(req domain.TaskRequest) quota.Usage {
+	chars := utf8.RuneCountInString(req.Text) + utf8.RuneCountInString(req.Instructions)
+	for _, doc := range req.Documents {
+		chars += utf8.RuneCountInString(doc.Title) + utf8.RuneCountInString(doc.Content)
+	}
+	return quota.Usage{
+		Requests:   1,
+		InputChars: int64(chars),
+		Tokens:     int64(agents.EstimateRequestTokens(req)),
+	}
+}
+
+// reserveQuota charges req to tenant before it runs and returns the
+// reservation, or the exhausted quota. Store failures are logged and the
+// request is allowed without a reservation.
+func reserveQuota(ctx context.Context, enforcer *quota.Enforcer, tenant string, req domain.TaskRequest) (*quota.Reservation, *quota.ExceededError) {
+	reservation, err := enforcer.Reserve(ctx, tenant, taskCharge(req))
+	if err == nil {
+		return reservation, nil
+	}
+	var exceeded *quota.ExceededError
+	if !errors.As(err, &exceeded) {
+		log.Printf("request_id=%s tenant=%s component=quota event=store_error error=%q", middleware.GetRequestIDFromContext(ctx), tenant, err.Error())
+		return nil, nil
+	}
+
+	metrics.RecordQuotaRejection(tenant, string(exceeded.Period), exceeded.Resource)
+	log.Printf(
+		"request_id=%s tenant=%s component=quota event=exceeded period=%s resource=%s limit=%d used=%d reset_at=%s",
+		middleware.GetRequestIDFromContext(ctx),
+		tenant,
+		exceeded.Period,
+		exceeded.Resource,
+		exceeded.Limit,
+		exceeded.Used,
+		exceeded.ResetAt.UTC().Format(time.RFC3339),
+	)
+	return nil, exceeded
+}
+
+// refundQuota gives back the charge of a task that never reached a
+// provider. Store failures are logged.
+func refundQuota(ctx context.Context, enforcer *quota.Enforcer, reservation *quota.Reservation) {
+	if reservation == nil {
+		return
+	}
+	requestID := middleware.GetRequestIDFromContext(ctx)
+	if err := enforcer.Refund(context.WithoutCancel(ctx), *reservation); err != nil {
+		log.Printf("request_id=%s tenant=%s component=quota event=store_error error=%q", requestID, reservation.Tenant, err.Error())
+		return
+	}
+	log.Printf("request_id=%s tenant=%s component=quota event=refunded requests=%d tokens=%d", requestID, reservation.Tenant, reservation.Charge.Requests, reservation.Charge.Tokens)
+}
+
+// executeReservedTask runs req and refunds its reservation when it fails
+// before any provider call was made, for example when input moderation
+// blocks it, provider capacity runs out or the context budget is exceeded.
+// Tokens spent by tool loop turns are charged to tenant whether or not the
+// task succeeds.
+func executeReservedTask(ctx context.Context, enforcer *quota.Enforcer, tenant string, reservation *quota.Reservation, req domain.TaskRequest) (domain.TaskResponse, error) {
+	ctx, callInfo := llm.WithCallInfo(ctx)
+	response, err := agents.ExecuteTask(ctx, req)
+	if err != nil && !callInfo.ProviderCalled() {
+		refundQuota(ctx, enforcer, reservation)
+	}
+	if tokens := callInfo.ToolLoopTokens(); tokens > 0 {
+		recordTokens(ctx, enforcer, tenant, tokens)
+	}
+	return response, err
+}
+
+// recordOutputTokens charges the estimated tokens of a completed response.
+func recordOutputTokens(ctx context.Context, enforcer *quota.Enforcer, tenant string, response domain.TaskResponse) {
+	recordTokens(ctx, enforcer, tenant, llm.EstimateTokens(response.Result))
+}
+
+func recordTokens(ctx context.Context, enforcer *quota.Enforcer, tenant string, tokens int) {
+	if err := enforcer.Record(context.WithoutCancel(ctx), tenant, quota.Usage{Tokens: int64(tokens)}); err != nil {
+		log.Printf("request_id=%s tenant=%s component=quota event=store_error error=%q", middleware.GetRequestIDFromContext(ctx), tenant, err.Error())
+	}
+}
+
+func quotaAPIError(exceeded *quota.ExceededError, requestID string) *domain.APIError {
+	return &domain.APIError{
+		Code:      "quota_exceeded",
+		Message:   exceeded.Error(),
+		RequestID: requestID,
+		ResetAt:   exceeded.ResetAt.UTC().Format(time.RFC3339),
+	}
+}
+
+// reserveTaskQuota calls reserveQuota for the request's tenant and writes a
+// 429 with Retry-After when a quota is used up.
+func reserveTaskQuota(c *gin.Context, enforcer *quota.Enforcer, req domain.TaskRequest) (*quota.Reservation, bool) {
+	reservation, exceeded := reserveQuota(c.Request.Context(), enforcer, middleware.GetTenant(c), req)
+	if exceeded == nil {
+		return reservation, true
+	}
+	retryAfter := int(math.Ceil(time.Until(exceeded.ResetAt).Seconds()))
+	c.Header("Retry-After", strconv.Itoa(max(retryAfter, 1)))
+	c.JSON(http.StatusTooManyRequests, domain.APIErrorResponse{Error: *quotaAPIError(exceeded, middleware.GetRequestID(c))})
+	return nil, false
+}
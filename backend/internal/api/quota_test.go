@@ -0,0 +1,134 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alanmaizon/homer/backend/internal/domain"
+	"github.com/alanmaizon/homer/backend/internal/llm"
+)
+
+func TestTaskQuotaExceededAndUsage(t *testing.T) {
+	t.Setenv("QUOTA_DAILY_REQUESTS", "1")
+	t.Setenv("QUOTA_TENANTS", "")
+	setProviderForTest(t, llm.NewMockProvider())
+	router := testRouter()
+
+	serveTask := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/task", strings.NewReader(`{"task":"rewrite","text":"hello world"}`))
+		req.Header.Set("Content-Type", "application/json")
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, req)
+		return res
+	}
+
+	if res := serveTask(); res.Code != http.StatusOK {
+		t.Fatalf("expected the first task to succeed, got %d body=%s", res.Code, res.Body.String())
+	}
+	res := serveTask()
+	if res.Code != http.StatusTooManyRequests || res.Header().Get("Retry-After") == "" {
+		t.Fatalf("expected 429 with Retry-After, got %d %v", res.Code, res.Header())
+	}
+	var envelope domain.APIErrorResponse
+	if err := json.Unmarshal(res.Body.Bytes(), &envelope); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if envelope.Error.Code != "quota_exceeded" || envelope.Error.ResetAt == "" {
+		t.Fatalf("unexpected error %+v", envelope.Error)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/usage", nil)
+	res = httptest.NewRecorder()
+	router.ServeHTTP(res, req)
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", res.Code)
+	}
+	var usage domain.UsageResponse
+	if err := json.Unmarshal(res.Body.Bytes(), &usage); err != nil {
+		t.Fatalf("failed to decode usage: %v", err)
+	}
+	if usage.Tenant != defaultTenant || usage.Daily.Used.Requests != 1 || usage.Daily.Used.InputChars != 11 || usage.Daily.Limits.Requests != 1 {
+		t.Fatalf("unexpected usage %+v", usage)
+	}
+	if usage.Daily.Used.Tokens == 0 || usage.Monthly.Used != usage.Daily.Used || usage.Daily.ResetAt != envelope.Error.ResetAt {
+		t.Fatalf("unexpected usage windows %+v", usage)
+	}
+}
+
+func TestTaskBatchReportsQuotaPerItem(t *testing.T) {
+	t.Setenv("QUOTA_DAILY_REQUESTS", "1")
+	t.Setenv("QUOTA_TENANTS", "")
+	t.Setenv("BATCH_CONCURRENCY", "1")
+	setProviderForTest(t, llm.NewMockProvider())
+
+	res := serveBatch(t, `{"items":[{"id":"a","task":"rewrite","text":"one"},{"id":"b","task":"rewrite","text":"two"}]}`, "")
+	var payload domain.BatchTaskResponse
+	if err := json.Unmarshal(res.Body.Bytes(), &payload); err != nil {
+		t.Fatalf("failed to decode response: %v", err)
+	}
+	if payload.Succeeded != 1 || payload.Failed != 1 {
+		t.Fatalf("unexpected summary %+v", payload)
+	}
+	for _, item := range payload.Items {
+		if item.Error != nil && (item.Status != http.StatusTooManyRequests || item.Error.Code != "quota_exceeded") {
+			t.Fatalf("unexpected failed item %+v", item)
+		}
+	}
+}
+
+func dailyRequestsUsed(t *testing.T, router http.Handler) int64 {
+	t.Helper()
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/api/usage", nil))
+	var usage domain.UsageResponse
+	if err := json.Unmarshal(res.Body.Bytes(), &usage); err != nil {
+		t.Fatalf("failed to decode usage: %v", err)
+	}
+	return usage.Daily.Used.Requests
+}
+
+func TestTaskQuotaRefundedWhenProviderIsNotReached(t *testing.T) {
+	t.Setenv("QUOTA_DAILY_REQUESTS", "1")
+	t.Setenv("QUOTA_TENANTS", "")
+	setProviderForTest(t, &stubProvider{name: "openai", err: fmt.Errorf("queue: %w", llm.ErrProviderSaturated)})
+	router := testRouter()
+
+	serveTask := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/task", strings.NewReader(`{"task":"rewrite","text":"hello"}`))
+		req.Header.Set("Content-Type", "application/json")
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, req)
+		return res
+	}
+
+	if res := serveTask(); res.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected provider_saturated, got %d body=%s", res.Code, res.Body.String())
+	}
+	if used := dailyRequestsUsed(t, router); used != 0 {
+		t.Fatalf("expected the saturated request to be refunded, got %d requests used", used)
+	}
+
+	// A failure from the provider itself stays charged.
+	path := filepath.Join(t.TempDir(), "fixtures.yaml")
+	if err := os.WriteFile(path, []byte("fixtures:\n  - match: {operation: rewrite}\n    error: {status: 500}\n"), 0o644); err != nil {
+		t.Fatalf("write fixtures: %v", err)
+	}
+	t.Setenv("MOCK_FIXTURES_FILE", path)
+	mock, err := llm.NewMockProviderFromEnv()
+	if err != nil {
+		t.Fatalf("NewMockProviderFromEnv returned error: %v", err)
+	}
+	setProviderForTest(t, mock)
+	if res := serveTask(); res.Code < http.StatusInternalServerError {
+		t.Fatalf("expected the provider error, got %d body=%s", res.Code, res.Body.String())
+	}
+	if used := dailyRequestsUsed(t, router); used != 1 {
+		t.Fatalf("expected the provider failure to stay charged, got %d requests used", used)
+	}
+}
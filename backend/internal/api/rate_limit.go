@@ -1,92 +1,134 @@
 package api
 
 import (
+	"log"
+	"math"
 	"net/http"
 	"os"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 
+	"github.com/alanmaizon/homer/backend/internal/metrics"
+	"github.com/alanmaizon/homer/backend/internal/middleware"
+	"github.com/alanmaizon/homer/backend/internal/ratelimit"
+	"github.com/alanmaizon/homer/backend/internal/sharedstate"
 	"github.com/gin-gonic/gin"
 )
 
 const defaultConnectorRateLimitPerMinute = 60
 
-type connectorRequestLimiter interface {
-	Allow() bool
+// rateLimitGroup throttles a set of routes with one token bucket per caller.
+type rateLimitGroup struct {
+	name    string
+	code    string
+	limiter ratelimit.Limiter
+	keyBy   string
 }
 
-type fixedWindowLimiter struct {
-	mu          sync.Mutex
-	limit       int
-	windowStart time.Time
-	count       int
-	now         func() time.Time
+func loadConnectorRateLimitPerMinuteFromEnv() int {
+	return loadRateLimitPerMinuteFromEnv("CONNECTOR_RATE_LIMIT_PER_MINUTE", defaultConnectorRateLimitPerMinute)
 }
 
-func newFixedWindowLimiter(limit int, now func() time.Time) *fixedWindowLimiter {
-	if now == nil {
-		now = time.Now
+func loadRateLimitPerMinuteFromEnv(key string, fallback int) int {
+	raw := strings.TrimSpace(os.Getenv(key))
+	if raw == "" {
+		return fallback
 	}
 
-	return &fixedWindowLimiter{
-		limit: limit,
-		now:   now,
+	parsed, err := strconv.Atoi(raw)
+	if err != nil || parsed < 0 {
+		return fallback
 	}
+
+	return parsed
 }
 
-func (l *fixedWindowLimiter) Allow() bool {
-	currentWindow := l.now().UTC().Truncate(time.Minute)
+// newTaskRateLimitFromEnv reads TASK_RATE_LIMIT_PER_MINUTE (default 0,
+// disabled) and TASK_RATE_LIMIT_BURST.
+func newTaskRateLimitFromEnv(shared sharedstate.Store) *rateLimitGroup {
+	perMinute := loadRateLimitPerMinuteFromEnv("TASK_RATE_LIMIT_PER_MINUTE", 0)
+	return newRateLimitGroup("task", "rate_limited", perMinute, positiveIntFromEnv("TASK_RATE_LIMIT_BURST", perMinute), shared)
+}
 
-	l.mu.Lock()
-	defer l.mu.Unlock()
+// newConnectorRateLimitFromEnv reads CONNECTOR_RATE_LIMIT_PER_MINUTE (default
+// 60) and CONNECTOR_RATE_LIMIT_BURST.
+func newConnectorRateLimitFromEnv(shared sharedstate.Store) *rateLimitGroup {
+	perMinute := loadConnectorRateLimitPerMinuteFromEnv()
+	return newRateLimitGroup("connector", "connector_rate_limited", perMinute, positiveIntFromEnv("CONNECTOR_RATE_LIMIT_BURST", perMinute), shared)
+}
 
-	if l.windowStart.IsZero() || !l.windowStart.Equal(currentWindow) {
-		l.windowStart = currentWindow
-		l.count = 0
+// newRateLimitGroup returns nil, which allows every request, when perMinute
+// is 0. Callers are keyed by RATE_LIMIT_KEY. Buckets live in shared when it
+// is set, so every instance enforces one limit, and in process memory
+// otherwise.
+func newRateLimitGroup(name string, code string, perMinute int, burst int, shared sharedstate.Store) *rateLimitGroup {
+	if perMinute == 0 {
+		return nil
 	}
-
-	if l.count >= l.limit {
-		return false
+	config := ratelimit.Config{RequestsPerMinute: perMinute, Burst: burst}
+	var limiter ratelimit.Limiter = ratelimit.NewMemoryLimiter(config)
+	if shared != nil {
+		limiter = ratelimit.NewSharedLimiter(shared, name, config)
+	}
+	return &rateLimitGroup{
+		name:    name,
+		code:    code,
+		limiter: limiter,
+		keyBy:   strings.ToLower(strings.TrimSpace(os.Getenv("RATE_LIMIT_KEY"))),
 	}
-
-	l.count++
-	return true
 }
 
-func loadConnectorRateLimitPerMinuteFromEnv() int {
-	raw := strings.TrimSpace(os.Getenv("CONNECTOR_RATE_LIMIT_PER_MINUTE"))
-	if raw == "" {
-		return defaultConnectorRateLimitPerMinute
+// clientKey identifies the caller by RATE_LIMIT_KEY: "tenant", "ip", or by
+// default "key", the authenticated API key or token subject, falling back to
+// the client IP for anonymous requests.
+func (g *rateLimitGroup) clientKey(c *gin.Context) string {
+	switch g.keyBy {
+	case "tenant":
+		return "tenant:" + middleware.GetTenant(c)
+	case "ip":
+		return "ip:" + c.ClientIP()
 	}
-
-	parsed, err := strconv.Atoi(raw)
-	if err != nil || parsed < 0 {
-		return defaultConnectorRateLimitPerMinute
+	if principal, ok := principalFromRequest(c); ok && principal.KeyID != "" {
+		return "key:" + principal.Tenant + "/" + principal.KeyID
 	}
+	return "ip:" + c.ClientIP()
+}
 
-	return parsed
+// enforce takes a token for the caller, sets RateLimit-Limit,
+// RateLimit-Remaining and RateLimit-Reset, and writes a 429 with
+// Retry-After when the bucket is empty. Limiter errors let the request
+// through.
+func (g *rateLimitGroup) enforce(c *gin.Context) bool {
+	return g.enforceN(c, 1)
 }
 
-func newConnectorRateLimiterFromEnv() connectorRequestLimiter {
-	limit := loadConnectorRateLimitPerMinuteFromEnv()
-	if limit == 0 {
-		return nil
+// enforceN is enforce for a request that counts as n, such as a batch of n
+// tasks. It takes nothing unless n tokens are left.
+func (g *rateLimitGroup) enforceN(c *gin.Context, n int) bool {
+	if g == nil {
+		return true
 	}
 
-	return newFixedWindowLimiter(limit, time.Now)
-}
-
-func enforceConnectorRateLimit(c *gin.Context, limiter connectorRequestLimiter) bool {
-	if limiter == nil {
+	decision, err := g.limiter.AllowN(c.Request.Context(), g.clientKey(c), n)
+	if err != nil {
+		log.Printf("request_id=%s component=rate_limit group=%s event=limiter_error error=%q", middleware.GetRequestID(c), g.name, err.Error())
 		return true
 	}
 
-	if limiter.Allow() {
+	c.Header("RateLimit-Limit", strconv.Itoa(decision.Limit))
+	c.Header("RateLimit-Remaining", strconv.Itoa(decision.Remaining))
+	c.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(decision.Reset)))
+	if decision.Allowed {
 		return true
 	}
 
-	writeError(c, http.StatusTooManyRequests, "connector_rate_limited", "connector rate limit exceeded")
+	metrics.RecordRateLimited(g.name)
+	c.Header("Retry-After", strconv.Itoa(max(ceilSeconds(decision.RetryAfter), 1)))
+	writeError(c, http.StatusTooManyRequests, g.code, g.name+" rate limit exceeded")
 	return false
 }
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
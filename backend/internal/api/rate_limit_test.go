@@ -1,8 +1,16 @@
 package api
 
 import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
 	"testing"
-	"time"
+
+	"github.com/alanmaizon/homer/backend/internal/connectors"
+	"github.com/alanmaizon/homer/backend/internal/llm"
+	"github.com/alicebob/miniredis/v2"
 )
 
 func TestLoadConnectorRateLimitPerMinuteFromEnvDefault(t *testing.T) {
@@ -32,22 +40,105 @@ func TestLoadConnectorRateLimitPerMinuteFromEnvDisable(t *testing.T) {
 	}
 }
 
-func TestFixedWindowLimiterAllow(t *testing.T) {
-	current := time.Date(2026, 2, 22, 12, 0, 30, 0, time.UTC)
-	limiter := newFixedWindowLimiter(2, func() time.Time { return current })
+func TestTaskRateLimitIsKeyedByAPIKey(t *testing.T) {
+	setAPIKeysForTest(t)
+	t.Setenv("TASK_RATE_LIMIT_PER_MINUTE", "60")
+	t.Setenv("TASK_RATE_LIMIT_BURST", "2")
+	t.Setenv("RATE_LIMIT_KEY", "")
+	setProviderForTest(t, llm.NewMockProvider())
+	router := testRouter()
+	body := `{"task":"rewrite","text":"hello"}`
+
+	for i := range 2 {
+		res := serveWithKey(t, router, http.MethodPost, "/api/task", body, "acme-key")
+		if res.Code != http.StatusOK {
+			t.Fatalf("request %d: expected status 200, got %d body=%s", i, res.Code, res.Body.String())
+		}
+		if res.Header().Get("RateLimit-Limit") != "2" || res.Header().Get("RateLimit-Remaining") != strconv.Itoa(1-i) {
+			t.Fatalf("request %d: unexpected headers %v", i, res.Header())
+		}
+	}
+
+	res := serveWithKey(t, router, http.MethodPost, "/api/task", body, "acme-key")
+	if res.Code != http.StatusTooManyRequests || !strings.Contains(res.Body.String(), `"rate_limited"`) {
+		t.Fatalf("expected 429 rate_limited, got %d body=%s", res.Code, res.Body.String())
+	}
+	if res.Header().Get("Retry-After") != "1" || res.Header().Get("RateLimit-Remaining") != "0" || res.Header().Get("RateLimit-Reset") != "2" {
+		t.Fatalf("unexpected headers %v", res.Header())
+	}
+
+	if res := serveWithKey(t, router, http.MethodPost, "/api/task", body, "globex-key"); res.Code != http.StatusOK {
+		t.Fatalf("expected another key to have its own bucket, got %d", res.Code)
+	}
+}
+
+func TestTaskBatchTakesOneTokenPerItem(t *testing.T) {
+	t.Setenv("TASK_RATE_LIMIT_PER_MINUTE", "60")
+	t.Setenv("TASK_RATE_LIMIT_BURST", "3")
+	t.Setenv("RATE_LIMIT_KEY", "")
+	setProviderForTest(t, llm.NewMockProvider())
+	router := testRouter()
+	batch := func(items int) *httptest.ResponseRecorder {
+		parts := make([]string, items)
+		for i := range parts {
+			parts[i] = fmt.Sprintf(`{"id":"item-%d","task":"rewrite","text":"hello"}`, i)
+		}
+		return serveWithKey(t, router, http.MethodPost, "/api/task/batch", `{"items":[`+strings.Join(parts, ",")+`]}`, "")
+	}
+
+	if res := batch(2); res.Code != http.StatusOK || res.Header().Get("RateLimit-Remaining") != "1" {
+		t.Fatalf("expected the batch to take two tokens, got %d headers=%v", res.Code, res.Header())
+	}
+	if res := batch(2); res.Code != http.StatusTooManyRequests || !strings.Contains(res.Body.String(), `"rate_limited"`) {
+		t.Fatalf("expected a batch larger than the tokens left to be refused, got %d body=%s", res.Code, res.Body.String())
+	}
+	if res := batch(1); res.Code != http.StatusOK {
+		t.Fatalf("expected the refused batch to take nothing, got %d body=%s", res.Code, res.Body.String())
+	}
+}
+
+func TestConnectorRateLimitUsesConnectorCode(t *testing.T) {
+	t.Setenv("CONNECTOR_RATE_LIMIT_PER_MINUTE", "1")
+	t.Setenv("CONNECTOR_RATE_LIMIT_BURST", "")
+	t.Setenv("CONNECTOR_API_KEY", "")
+	router := testRouter()
 
-	if !limiter.Allow() {
-		t.Fatalf("expected first request to be allowed")
+	serve := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/connectors/export", strings.NewReader(`{}`))
+		req.Header.Set("Content-Type", "application/json")
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, req)
+		return res
 	}
-	if !limiter.Allow() {
-		t.Fatalf("expected second request to be allowed")
+
+	if res := serve(); res.Code == http.StatusTooManyRequests {
+		t.Fatalf("expected the first request to pass the limiter, got %d", res.Code)
 	}
-	if limiter.Allow() {
-		t.Fatalf("expected third request to be blocked")
+	res := serve()
+	if res.Code != http.StatusTooManyRequests || !strings.Contains(res.Body.String(), "connector_rate_limited") || res.Header().Get("Retry-After") == "" {
+		t.Fatalf("expected 429 connector_rate_limited, got %d body=%s", res.Code, res.Body.String())
 	}
+}
 
-	current = current.Add(45 * time.Second)
-	if !limiter.Allow() {
-		t.Fatalf("expected new time window request to be allowed")
+func TestConnectorRateLimitIsSharedBetweenInstances(t *testing.T) {
+	server := miniredis.RunT(t)
+	t.Setenv("SHARED_STATE_STORE", "redis")
+	t.Setenv("REDIS_URL", "redis://"+server.Addr())
+	t.Setenv("OAUTH_TOKEN_ENCRYPTION_KEY", "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=")
+	t.Setenv("CONNECTOR_RATE_LIMIT_PER_MINUTE", "1")
+	t.Setenv("CONNECTOR_PROVIDER", "none")
+	t.Cleanup(connectors.SetOAuthStoreForTests(nil))
+	first, second := testRouter(), testRouter()
+	if _, ok := connectors.OAuthStore().(*connectors.SharedOAuthTokenStore); !ok {
+		t.Fatalf("expected OAuth sessions to use the shared store, got %T", connectors.OAuthStore())
+	}
+
+	body := `{"documentId":"doc-1"}`
+	if res := serveWithKey(t, first, http.MethodPost, "/api/connectors/import", body, ""); res.Code != http.StatusBadRequest {
+		t.Fatalf("expected first status 400, got %d body=%s", res.Code, res.Body.String())
+	}
+	res := serveWithKey(t, second, http.MethodPost, "/api/connectors/import", body, "")
+	if res.Code != http.StatusTooManyRequests || !strings.Contains(res.Body.String(), `"connector_rate_limited"`) {
+		t.Fatalf("expected the other instance to share the bucket, got %d body=%s", res.Code, res.Body.String())
 	}
 }
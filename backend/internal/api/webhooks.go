@@ -0,0 +1,73 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+
+	"github.com/alanmaizon/homer/backend/internal/domain"
+	"github.com/alanmaizon/homer/backend/internal/jobs"
+	"github.com/alanmaizon/homer/backend/internal/webhooks"
+)
+
+func validateCallbackURL(dispatcher *webhooks.Dispatcher, callbackURL string) *domain.APIError {
+	if strings.TrimSpace(callbackURL) == "" {
+		return nil
+	}
+	err := dispatcher.ValidateURL(strings.TrimSpace(callbackURL))
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, webhooks.ErrCallbacksDisabled):
+		return &domain.APIError{Code: "callbacks_disabled", Message: err.Error()}
+	default:
+		return &domain.APIError{Code: "invalid_callback_url", Message: err.Error()}
+	}
+}
+
+// sendTaskCallback posts the task response, or the error envelope when
+// apiErr is set, to callbackURL in the background.
+func sendTaskCallback(dispatcher *webhooks.Dispatcher, callbackURL string, jobID string, response *domain.TaskResponse, apiErr *domain.APIError) {
+	callbackURL = strings.TrimSpace(callbackURL)
+	if callbackURL == "" {
+		return
+	}
+
+	delivery := webhooks.Delivery{URL: callbackURL, JobID: jobID}
+	var (
+		body []byte
+		err  error
+	)
+	if apiErr != nil {
+		delivery.Event = webhooks.EventTaskFailed
+		delivery.RequestID = apiErr.RequestID
+		body, err = json.Marshal(domain.APIErrorResponse{Error: *apiErr})
+	} else {
+		delivery.Event = webhooks.EventTaskSucceeded
+		delivery.RequestID = response.Metadata.RequestID
+		body, err = json.Marshal(response)
+	}
+	if err != nil {
+		log.Printf("request_id=%s component=webhook event=encode_failed error=%q", delivery.RequestID, err.Error())
+		return
+	}
+	delivery.Body = body
+	dispatcher.Send(delivery)
+}
+
+// sendJobCallback reports a finished job to its request's callbackUrl.
+func sendJobCallback(dispatcher *webhooks.Dispatcher, job jobs.Job) {
+	switch job.Status {
+	case jobs.StatusSucceeded:
+		sendTaskCallback(dispatcher, job.Request.CallbackURL, job.ID, job.Result, nil)
+	case jobs.StatusFailed:
+		sendTaskCallback(dispatcher, job.Request.CallbackURL, job.ID, nil, job.Error)
+	case jobs.StatusCanceled:
+		sendTaskCallback(dispatcher, job.Request.CallbackURL, job.ID, nil, &domain.APIError{
+			Code:      "job_canceled",
+			Message:   "job was canceled",
+			RequestID: job.RequestID,
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alanmaizon/homer/backend/internal/domain"
+	"github.com/alanmaizon/homer/backend/internal/llm"
+	"github.com/alanmaizon/homer/backend/internal/webhooks"
+)
+
+type callback struct {
+	header http.Header
+	body   []byte
+}
+
+func newCallbackReceiver(t *testing.T) (*httptest.Server, <-chan callback) {
+	t.Helper()
+	received := make(chan callback, 4)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- callback{header: r.Header.Clone(), body: body}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(server.Close)
+	return server, received
+}
+
+func waitForCallback(t *testing.T, received <-chan callback) callback {
+	t.Helper()
+	select {
+	case got := <-received:
+		if err := webhooks.Verify([]byte("callback-secret"), got.header.Get(webhooks.SignatureHeader), got.body, time.Now(), time.Minute); err != nil {
+			t.Fatalf("callback signature did not verify: %v", err)
+		}
+		return got
+	case <-time.After(2 * time.Second):
+		t.Fatalf("callback was not delivered")
+		return callback{}
+	}
+}
+
+func TestTaskCallbackDeliversSignedResponse(t *testing.T) {
+	t.Setenv("WEBHOOK_SECRET", "callback-secret")
+	t.Setenv("WEBHOOK_ALLOW_PRIVATE_NETWORKS", "true")
+	setProviderForTest(t, llm.NewMockProvider())
+	server, received := newCallbackReceiver(t)
+
+	body := fmt.Sprintf(`{"task":"rewrite","text":"hello","callbackUrl":%q}`, server.URL)
+	req := httptest.NewRequest(http.MethodPost, "/api/task", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	res := httptest.NewRecorder()
+	testRouter().ServeHTTP(res, req)
+	if res.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d body=%s", res.Code, res.Body.String())
+	}
+
+	got := waitForCallback(t, received)
+	if got.header.Get(webhooks.EventHeader) != webhooks.EventTaskSucceeded {
+		t.Fatalf("expected %s event, got %q", webhooks.EventTaskSucceeded, got.header.Get(webhooks.EventHeader))
+	}
+	var response domain.TaskResponse
+	if err := json.Unmarshal(got.body, &response); err != nil {
+		t.Fatalf("failed to decode callback: %v", err)
+	}
+	if response.Result == "" || response.Metadata.RequestID != res.Header().Get("X-Request-Id") {
+		t.Fatalf("unexpected callback body %s", got.body)
+	}
+}
+
+func TestJobCallbackDeliversErrorEnvelope(t *testing.T) {
+	t.Setenv("WEBHOOK_SECRET", "callback-secret")
+	t.Setenv("WEBHOOK_ALLOW_PRIVATE_NETWORKS", "true")
+	setProviderForTest(t, &stubProvider{name: "openai", err: fmt.Errorf("queue: %w", llm.ErrProviderSaturated)})
+	server, received := newCallbackReceiver(t)
+
+	res, job := serveJobRequest(t, testRouter(), http.MethodPost, "/api/jobs", fmt.Sprintf(`{"task":"rewrite","text":"hello","callbackUrl":%q}`, server.URL))
+	if res.Code != http.StatusAccepted {
+		t.Fatalf("expected status 202, got %d body=%s", res.Code, res.Body.String())
+	}
+
+	got := waitForCallback(t, received)
+	if got.header.Get(webhooks.EventHeader) != webhooks.EventTaskFailed || got.header.Get(webhooks.JobIDHeader) != job.ID {
+		t.Fatalf("unexpected callback headers %v", got.header)
+	}
+	var payload errorEnvelope
+	if err := json.Unmarshal(got.body, &payload); err != nil {
+		t.Fatalf("failed to decode callback: %v", err)
+	}
+	if payload.Error.Code != "provider_saturated" {
+		t.Fatalf("expected provider_saturated, got %s", got.body)
+	}
+}
+
+func TestTaskCallbackRequiresSecret(t *testing.T) {
+	t.Setenv("WEBHOOK_SECRET", "")
+
+	req := httptest.NewRequest(http.MethodPost, "/api/task", strings.NewReader(`{"task":"rewrite","text":"hello","callbackUrl":"https://example.com/hook"}`))
+	req.Header.Set("Content-Type", "application/json")
+	res := httptest.NewRecorder()
+	testRouter().ServeHTTP(res, req)
+
+	if res.Code != http.StatusBadRequest || !strings.Contains(res.Body.String(), "callbacks_disabled") {
+		t.Fatalf("expected callbacks_disabled, got %d body=%s", res.Code, res.Body.String())
+	}
+}
@@ -0,0 +1,264 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/alanmaizon/homer/backend/internal/metrics"
+	"github.com/alanmaizon/homer/backend/internal/middleware"
+)
+
+// defaultJWKSMinRefresh limits how often a token with an unknown key ID can
+// force a JWKS fetch.
+const defaultJWKSMinRefresh = 10 * time.Second
+
+var ErrUnknownSigningKey = errors.New("unknown signing key")
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// parseJWKS returns the signing keys in a JWKS document by key ID. Keys of
+// unsupported types and encryption keys are skipped.
+func parseJWKS(raw []byte) (map[string]crypto.PublicKey, error) {
+	var document struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(raw, &document); err != nil {
+		return nil, fmt.Errorf("invalid JWKS: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(document.Keys))
+	for _, key := range document.Keys {
+		if key.Use != "" && key.Use != "sig" {
+			continue
+		}
+		switch key.Kty {
+		case "RSA":
+			n, errN := decodeBigInt(key.N)
+			e, errE := decodeBigInt(key.E)
+			if errN != nil || errE != nil || !e.IsInt64() || e.Int64() > 1<<31-1 {
+				return nil, fmt.Errorf("invalid JWKS: RSA key %q is malformed", key.Kid)
+			}
+			keys[key.Kid] = &rsa.PublicKey{N: n, E: int(e.Int64())}
+		case "EC":
+			curve := ecCurve(key.Crv)
+			x, errX := decodeBigInt(key.X)
+			y, errY := decodeBigInt(key.Y)
+			if curve == nil || errX != nil || errY != nil {
+				return nil, fmt.Errorf("invalid JWKS: EC key %q is malformed", key.Kid)
+			}
+			keys[key.Kid] = &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+		}
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("invalid JWKS: no usable signing keys")
+	}
+	return keys, nil
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || len(raw) == 0 {
+		return nil, fmt.Errorf("invalid base64url integer")
+	}
+	return new(big.Int).SetBytes(raw), nil
+}
+
+func ecCurve(name string) elliptic.Curve {
+	switch name {
+	case "P-256":
+		return elliptic.P256()
+	case "P-384":
+		return elliptic.P384()
+	case "P-521":
+		return elliptic.P521()
+	}
+	return nil
+}
+
+// keySource resolves a token's key ID to a public key. An empty kid matches
+// the only key of a single-key set.
+type keySource interface {
+	key(ctx context.Context, kid string) (crypto.PublicKey, error)
+}
+
+func lookupKey(keys map[string]crypto.PublicKey, kid string) (crypto.PublicKey, bool) {
+	if key, ok := keys[kid]; ok {
+		return key, true
+	}
+	if kid == "" && len(keys) == 1 {
+		for _, key := range keys {
+			return key, true
+		}
+	}
+	return nil, false
+}
+
+// staticKeys is a JWKS loaded once from a file.
+type staticKeys map[string]crypto.PublicKey
+
+func loadJWKSFile(path string) (staticKeys, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := parseJWKS(raw)
+	if err != nil {
+		return nil, err
+	}
+	return staticKeys(keys), nil
+}
+
+func (s staticKeys) key(_ context.Context, kid string) (crypto.PublicKey, error) {
+	if key, ok := lookupKey(s, kid); ok {
+		return key, nil
+	}
+	return nil, ErrUnknownSigningKey
+}
+
+// remoteKeys caches a JWKS fetched from a URL. The set is refetched once it
+// is older than ttl, or earlier when a token names an unknown key ID, so
+// rotated keys are picked up without a restart. Fetches run outside the lock,
+// one at a time, and at most every minRefresh: a stale set keeps serving its
+// keys while it is refreshed, and after a failed refresh until the next
+// attempt is due.
+type remoteKeys struct {
+	url        string
+	client     *http.Client
+	ttl        time.Duration
+	minRefresh time.Duration
+	now        func() time.Time
+
+	mu          sync.Mutex
+	keys        map[string]crypto.PublicKey
+	fetchedAt   time.Time
+	attemptedAt time.Time
+	lastErr     error
+	refreshing  chan struct{}
+}
+
+func newRemoteKeys(url string, client *http.Client, ttl time.Duration) *remoteKeys {
+	return &remoteKeys{
+		url:        url,
+		client:     client,
+		ttl:        ttl,
+		minRefresh: defaultJWKSMinRefresh,
+		now:        time.Now,
+	}
+}
+
+func (r *remoteKeys) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	r.mu.Lock()
+	now := r.now()
+	key, found := lookupKey(r.keys, kid)
+	stale := r.keys == nil || now.Sub(r.fetchedAt) >= r.ttl
+	if found && !stale {
+		r.mu.Unlock()
+		return key, nil
+	}
+	refreshed := r.refreshing
+	if refreshed == nil && now.Sub(r.attemptedAt) >= r.minRefresh {
+		refreshed = r.startRefreshLocked(ctx, now)
+	}
+	r.mu.Unlock()
+
+	if found {
+		return key, nil
+	}
+	if refreshed != nil {
+		select {
+		case <-refreshed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if key, found := lookupKey(r.keys, kid); found {
+		return key, nil
+	}
+	if r.keys == nil && r.lastErr != nil {
+		return nil, r.lastErr
+	}
+	return nil, ErrUnknownSigningKey
+}
+
+// startRefreshLocked fetches the set in the background and returns a channel
+// closed once the fetch finished. The fetch is detached from ctx so a caller
+// giving up does not fail it for the others waiting on it.
+func (r *remoteKeys) startRefreshLocked(ctx context.Context, now time.Time) chan struct{} {
+	done := make(chan struct{})
+	r.refreshing = done
+	r.attemptedAt = now
+	go r.refresh(context.WithoutCancel(ctx), done)
+	return done
+}
+
+func (r *remoteKeys) refresh(ctx context.Context, done chan struct{}) {
+	keys, err := r.fetch(ctx)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	defer close(done)
+	r.refreshing = nil
+	if err != nil {
+		r.lastErr = err
+		metrics.RecordJWKSRefresh("error")
+		log.Printf(
+			"request_id=%s component=auth event=jwks_refresh_failed url=%q error=%q",
+			middleware.GetRequestIDFromContext(ctx),
+			r.url,
+			err.Error(),
+		)
+		return
+	}
+	metrics.RecordJWKSRefresh("success")
+	r.keys = keys
+	r.fetchedAt = r.now()
+	r.lastErr = nil
+}
+
+func (r *remoteKeys) fetch(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	res, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("JWKS request returned status %d", res.StatusCode)
+	}
+	raw, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	return parseJWKS(raw)
+}
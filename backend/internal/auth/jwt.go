@@ -0,0 +1,303 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultTenantClaim  = "tenant"
+	defaultScopesClaim  = "scope"
+	defaultJWKSCacheTTL = 5 * time.Minute
+	defaultClockSkew    = time.Minute
+	jwksRequestTimeout  = 10 * time.Second
+)
+
+var ErrInvalidToken = errors.New("invalid bearer token")
+
+// TokenConfig describes the identity provider whose JWTs are accepted.
+type TokenConfig struct {
+	Issuer   string
+	Audience string
+	JWKSURL  string
+	JWKSFile string
+
+	// TenantClaim names the claim holding the tenant. ScopesClaim names a
+	// space separated string or string array of scopes; values that are not
+	// Homer scopes are ignored.
+	TenantClaim string
+	ScopesClaim string
+
+	CacheTTL  time.Duration
+	ClockSkew time.Duration
+}
+
+// TokenConfigFromEnv reads OIDC_ISSUER, OIDC_AUDIENCE, OIDC_JWKS_URL,
+// OIDC_JWKS_FILE, OIDC_TENANT_CLAIM, OIDC_SCOPES_CLAIM,
+// OIDC_JWKS_CACHE_TTL_MS and OIDC_CLOCK_SKEW_MS.
+func TokenConfigFromEnv() TokenConfig {
+	config := TokenConfig{
+		Issuer:      strings.TrimSpace(os.Getenv("OIDC_ISSUER")),
+		Audience:    strings.TrimSpace(os.Getenv("OIDC_AUDIENCE")),
+		JWKSURL:     strings.TrimSpace(os.Getenv("OIDC_JWKS_URL")),
+		JWKSFile:    strings.TrimSpace(os.Getenv("OIDC_JWKS_FILE")),
+		TenantClaim: strings.TrimSpace(os.Getenv("OIDC_TENANT_CLAIM")),
+		ScopesClaim: strings.TrimSpace(os.Getenv("OIDC_SCOPES_CLAIM")),
+		CacheTTL:    defaultJWKSCacheTTL,
+		ClockSkew:   defaultClockSkew,
+	}
+	if ms, err := strconv.Atoi(strings.TrimSpace(os.Getenv("OIDC_JWKS_CACHE_TTL_MS"))); err == nil && ms > 0 {
+		config.CacheTTL = time.Duration(ms) * time.Millisecond
+	}
+	if ms, err := strconv.Atoi(strings.TrimSpace(os.Getenv("OIDC_CLOCK_SKEW_MS"))); err == nil && ms >= 0 {
+		config.ClockSkew = time.Duration(ms) * time.Millisecond
+	}
+	return config
+}
+
+// TokenVerifier validates JWT bearer tokens and maps their claims to a
+// Principal.
+type TokenVerifier struct {
+	config TokenConfig
+	keys   keySource
+	now    func() time.Time
+}
+
+// NewTokenVerifier requires an issuer, an audience and exactly one of a JWKS
+// URL or file. A JWKS file is read immediately; a URL on first use.
+func NewTokenVerifier(config TokenConfig, client *http.Client) (*TokenVerifier, error) {
+	if config.Issuer == "" || config.Audience == "" {
+		return nil, fmt.Errorf("OIDC issuer and audience are required")
+	}
+	if (config.JWKSURL == "") == (config.JWKSFile == "") {
+		return nil, fmt.Errorf("exactly one of OIDC_JWKS_URL or OIDC_JWKS_FILE is required")
+	}
+	if config.TenantClaim == "" {
+		config.TenantClaim = defaultTenantClaim
+	}
+	if config.ScopesClaim == "" {
+		config.ScopesClaim = defaultScopesClaim
+	}
+	if config.CacheTTL <= 0 {
+		config.CacheTTL = defaultJWKSCacheTTL
+	}
+
+	verifier := &TokenVerifier{config: config, now: time.Now}
+	if config.JWKSFile != "" {
+		keys, err := loadJWKSFile(config.JWKSFile)
+		if err != nil {
+			return nil, fmt.Errorf("OIDC_JWKS_FILE: %w", err)
+		}
+		verifier.keys = keys
+		return verifier, nil
+	}
+	if client == nil {
+		client = &http.Client{Timeout: jwksRequestTimeout}
+	}
+	verifier.keys = newRemoteKeys(config.JWKSURL, client, config.CacheTTL)
+	return verifier, nil
+}
+
+// NewTokenVerifierFromEnv returns nil when OIDC_ISSUER is not set, which
+// leaves bearer token validation disabled.
+func NewTokenVerifierFromEnv() (*TokenVerifier, error) {
+	config := TokenConfigFromEnv()
+	if config.Issuer == "" {
+		return nil, nil
+	}
+	return NewTokenVerifier(config, nil)
+}
+
+// LooksLikeJWT reports whether credential has the three dot-separated parts
+// of a compact JWT, as opposed to a static API key.
+func LooksLikeJWT(credential string) bool {
+	return strings.Count(credential, ".") == 2
+}
+
+// Verify checks the token's signature, issuer, audience, expiry and
+// not-before time and returns the caller it identifies. Every failure wraps
+// ErrInvalidToken.
+func (v *TokenVerifier) Verify(ctx context.Context, token string) (Principal, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Principal{}, fmt.Errorf("%w: malformed token", ErrInvalidToken)
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return Principal{}, fmt.Errorf("%w: malformed header", ErrInvalidToken)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Principal{}, fmt.Errorf("%w: malformed signature", ErrInvalidToken)
+	}
+	key, err := v.keys.key(ctx, header.Kid)
+	if err != nil {
+		return Principal{}, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	if err := verifySignature(header.Alg, key, parts[0]+"."+parts[1], signature); err != nil {
+		return Principal{}, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	var claims map[string]any
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return Principal{}, fmt.Errorf("%w: malformed claims", ErrInvalidToken)
+	}
+	if err := v.validateClaims(claims); err != nil {
+		return Principal{}, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	tenant, _ := claims[v.config.TenantClaim].(string)
+	if strings.TrimSpace(tenant) == "" {
+		return Principal{}, fmt.Errorf("%w: missing %s claim", ErrInvalidToken, v.config.TenantClaim)
+	}
+	subject, _ := claims["sub"].(string)
+	return Principal{
+		KeyID:  subject,
+		Tenant: strings.TrimSpace(tenant),
+		Scopes: scopesFromClaim(claims[v.config.ScopesClaim]),
+	}, nil
+}
+
+func (v *TokenVerifier) validateClaims(claims map[string]any) error {
+	if issuer, _ := claims["iss"].(string); issuer != v.config.Issuer {
+		return fmt.Errorf("unexpected issuer")
+	}
+	if !audienceContains(claims["aud"], v.config.Audience) {
+		return fmt.Errorf("unexpected audience")
+	}
+
+	now := v.now()
+	expiry, ok := numericDate(claims["exp"])
+	if !ok {
+		return fmt.Errorf("missing exp claim")
+	}
+	if !now.Before(expiry.Add(v.config.ClockSkew)) {
+		return fmt.Errorf("token expired")
+	}
+	if notBefore, ok := numericDate(claims["nbf"]); ok && now.Add(v.config.ClockSkew).Before(notBefore) {
+		return fmt.Errorf("token not yet valid")
+	}
+	return nil
+}
+
+func decodeSegment(segment string, target any) error {
+	raw, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, target)
+}
+
+// esCurves names the curve each ES alg requires.
+var esCurves = map[string]string{
+	"ES256": "P-256",
+	"ES384": "P-384",
+	"ES512": "P-521",
+}
+
+func verifySignature(alg string, key crypto.PublicKey, signed string, signature []byte) error {
+	var hasher hash.Hash
+	var hashID crypto.Hash
+	switch alg {
+	case "RS256", "ES256":
+		hasher, hashID = sha256.New(), crypto.SHA256
+	case "RS384", "ES384":
+		hasher, hashID = sha512.New384(), crypto.SHA384
+	case "RS512", "ES512":
+		hasher, hashID = sha512.New(), crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported alg %q", alg)
+	}
+	hasher.Write([]byte(signed))
+	digest := hasher.Sum(nil)
+
+	switch key := key.(type) {
+	case *rsa.PublicKey:
+		if !strings.HasPrefix(alg, "RS") {
+			return fmt.Errorf("alg %q does not match an RSA key", alg)
+		}
+		if err := rsa.VerifyPKCS1v15(key, hashID, digest, signature); err != nil {
+			return fmt.Errorf("signature mismatch")
+		}
+	case *ecdsa.PublicKey:
+		// Each ES alg is bound to one curve, so a P-256 key cannot verify
+		// an ES384 or ES512 token.
+		size := (key.Curve.Params().BitSize + 7) / 8
+		if key.Curve != ecCurve(esCurves[alg]) || len(signature) != 2*size {
+			return fmt.Errorf("alg %q does not match an EC key on %s", alg, key.Curve.Params().Name)
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(key, digest, r, s) {
+			return fmt.Errorf("signature mismatch")
+		}
+	default:
+		return fmt.Errorf("unsupported key type")
+	}
+	return nil
+}
+
+func audienceContains(claim any, audience string) bool {
+	switch value := claim.(type) {
+	case string:
+		return value == audience
+	case []any:
+		for _, item := range value {
+			if item == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func numericDate(claim any) (time.Time, bool) {
+	seconds, ok := claim.(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(seconds), 0), true
+}
+
+func scopesFromClaim(claim any) []Scope {
+	var values []string
+	switch value := claim.(type) {
+	case string:
+		values = strings.Fields(value)
+	case []any:
+		for _, item := range value {
+			if text, ok := item.(string); ok {
+				values = append(values, text)
+			}
+		}
+	}
+
+	scopes := make([]Scope, 0, len(values))
+	for _, value := range values {
+		scope := Scope(value)
+		if slices.Contains(knownScopes, scope) && !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+	return scopes
+}
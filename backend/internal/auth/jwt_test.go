@@ -0,0 +1,452 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testSigner struct {
+	kid string
+	rsa *rsa.PrivateKey
+	ec  *ecdsa.PrivateKey
+}
+
+func newRSASigner(t *testing.T, kid string) testSigner {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate RSA key: %v", err)
+	}
+	return testSigner{kid: kid, rsa: key}
+}
+
+func newECSigner(t *testing.T, kid string) testSigner {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate EC key: %v", err)
+	}
+	return testSigner{kid: kid, ec: key}
+}
+
+func (s testSigner) jwk() map[string]string {
+	encode := func(n *big.Int, size int) string {
+		return base64.RawURLEncoding.EncodeToString(n.FillBytes(make([]byte, size)))
+	}
+	if s.rsa != nil {
+		return map[string]string{
+			"kty": "RSA",
+			"kid": s.kid,
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(s.rsa.N.Bytes()),
+			"e":   encode(big.NewInt(int64(s.rsa.E)), 3),
+		}
+	}
+	return map[string]string{
+		"kty": "EC",
+		"kid": s.kid,
+		"crv": "P-256",
+		"x":   encode(s.ec.X, 32),
+		"y":   encode(s.ec.Y, 32),
+	}
+}
+
+func (s testSigner) sign(t *testing.T, claims map[string]any) string {
+	t.Helper()
+	alg := "RS256"
+	if s.ec != nil {
+		alg = "ES256"
+	}
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": s.kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	var signature []byte
+	if s.rsa != nil {
+		var err error
+		signature, err = rsa.SignPKCS1v15(rand.Reader, s.rsa, crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatalf("failed to sign token: %v", err)
+		}
+	} else {
+		r, sv, err := ecdsa.Sign(rand.Reader, s.ec, digest[:])
+		if err != nil {
+			t.Fatalf("failed to sign token: %v", err)
+		}
+		signature = append(r.FillBytes(make([]byte, 32)), sv.FillBytes(make([]byte, 32))...)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func jwksDocument(signers ...testSigner) []byte {
+	keys := make([]map[string]string, 0, len(signers))
+	for _, signer := range signers {
+		keys = append(keys, signer.jwk())
+	}
+	raw, _ := json.Marshal(map[string]any{"keys": keys})
+	return raw
+}
+
+// jwksServer serves the current signers and counts fetches. A non-zero
+// status fails fetches, and a gate holds them until it is closed.
+type jwksServer struct {
+	*httptest.Server
+	mu      sync.Mutex
+	signers []testSigner
+	fetches int
+	status  int
+	gate    chan struct{}
+}
+
+func newJWKSServer(t *testing.T, signers ...testSigner) *jwksServer {
+	t.Helper()
+	server := &jwksServer{signers: signers}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		server.mu.Lock()
+		server.fetches++
+		status, gate, document := server.status, server.gate, jwksDocument(server.signers...)
+		server.mu.Unlock()
+		if gate != nil {
+			<-gate
+		}
+		if status != 0 {
+			w.WriteHeader(status)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(document)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func (s *jwksServer) rotate(signers ...testSigner) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.signers = signers
+}
+
+func (s *jwksServer) fetchCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.fetches
+}
+
+func validClaims() map[string]any {
+	return map[string]any{
+		"iss":    "https://idp.example.com",
+		"aud":    []string{"other", "homer"},
+		"sub":    "svc-reporting",
+		"tenant": "acme",
+		"scope":  "openid task connector:import",
+		"exp":    time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+func newTestVerifier(t *testing.T, url string) *TokenVerifier {
+	t.Helper()
+	verifier, err := NewTokenVerifier(TokenConfig{
+		Issuer:   "https://idp.example.com",
+		Audience: "homer",
+		JWKSURL:  url,
+	}, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return verifier
+}
+
+func TestTokenVerifierMapsClaimsToPrincipal(t *testing.T) {
+	rsaSigner := newRSASigner(t, "rsa-1")
+	ecSigner := newECSigner(t, "ec-1")
+	server := newJWKSServer(t, rsaSigner, ecSigner)
+	verifier := newTestVerifier(t, server.URL)
+
+	for _, signer := range []testSigner{rsaSigner, ecSigner} {
+		principal, err := verifier.Verify(context.Background(), signer.sign(t, validClaims()))
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", signer.kid, err)
+		}
+		if principal.Tenant != "acme" || principal.KeyID != "svc-reporting" {
+			t.Fatalf("%s: unexpected principal %+v", signer.kid, principal)
+		}
+		if !principal.HasScope(ScopeTask) || !principal.HasScope(ScopeConnectorImport) || principal.HasScope(ScopeAdmin) || len(principal.Scopes) != 2 {
+			t.Fatalf("%s: unexpected scopes %v", signer.kid, principal.Scopes)
+		}
+	}
+	if server.fetchCount() != 1 {
+		t.Fatalf("expected the JWKS to be fetched once, got %d", server.fetchCount())
+	}
+}
+
+func TestTokenVerifierRejectsInvalidTokens(t *testing.T) {
+	signer := newRSASigner(t, "rsa-1")
+	server := newJWKSServer(t, signer)
+	verifier := newTestVerifier(t, server.URL)
+
+	cases := map[string]func(map[string]any){
+		"wrong issuer":   func(c map[string]any) { c["iss"] = "https://evil.example.com" },
+		"wrong audience": func(c map[string]any) { c["aud"] = "someone-else" },
+		"expired":        func(c map[string]any) { c["exp"] = time.Now().Add(-2 * time.Minute).Unix() },
+		"missing exp":    func(c map[string]any) { delete(c, "exp") },
+		"not yet valid":  func(c map[string]any) { c["nbf"] = time.Now().Add(5 * time.Minute).Unix() },
+		"missing tenant": func(c map[string]any) { delete(c, "tenant") },
+	}
+	for name, mutate := range cases {
+		claims := validClaims()
+		mutate(claims)
+		if _, err := verifier.Verify(context.Background(), signer.sign(t, claims)); !errors.Is(err, ErrInvalidToken) {
+			t.Fatalf("%s: expected ErrInvalidToken, got %v", name, err)
+		}
+	}
+
+	token := signer.sign(t, validClaims())
+	parts := strings.Split(token, ".")
+	tampered := validClaims()
+	tampered["tenant"] = "globex"
+	payload, _ := json.Marshal(tampered)
+	forged := parts[0] + "." + base64.RawURLEncoding.EncodeToString(payload) + "." + parts[2]
+	if _, err := verifier.Verify(context.Background(), forged); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("expected a tampered payload to fail, got %v", err)
+	}
+
+	stranger := newRSASigner(t, "rsa-1")
+	if _, err := verifier.Verify(context.Background(), stranger.sign(t, validClaims())); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("expected a token from another key to fail, got %v", err)
+	}
+}
+
+func TestTokenVerifierPicksUpRotatedKeys(t *testing.T) {
+	oldSigner := newRSASigner(t, "old")
+	newSigner := newRSASigner(t, "new")
+	server := newJWKSServer(t, oldSigner)
+	verifier := newTestVerifier(t, server.URL)
+	keys := verifier.keys.(*remoteKeys)
+	keys.minRefresh = 0
+
+	if _, err := verifier.Verify(context.Background(), oldSigner.sign(t, validClaims())); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	server.rotate(newSigner)
+	if _, err := verifier.Verify(context.Background(), newSigner.sign(t, validClaims())); err != nil {
+		t.Fatalf("expected the rotated key to be fetched, got %v", err)
+	}
+	if server.fetchCount() != 2 {
+		t.Fatalf("expected an unknown kid to trigger one refetch, got %d fetches", server.fetchCount())
+	}
+
+	keys.minRefresh = time.Hour
+	stranger := newRSASigner(t, "unknown")
+	for range 3 {
+		if _, err := verifier.Verify(context.Background(), stranger.sign(t, validClaims())); !errors.Is(err, ErrInvalidToken) {
+			t.Fatalf("expected an unknown kid to fail, got %v", err)
+		}
+	}
+	if server.fetchCount() != 2 {
+		t.Fatalf("expected unknown kids not to refetch within minRefresh, got %d fetches", server.fetchCount())
+	}
+
+	current := time.Now()
+	keys.now = func() time.Time { return current.Add(defaultJWKSCacheTTL) }
+	server.Close()
+	if _, err := verifier.Verify(context.Background(), newSigner.sign(t, validClaims())); err != nil {
+		t.Fatalf("expected cached keys to be kept when a refresh fails, got %v", err)
+	}
+}
+
+func TestTokenVerifierKeepsStaleKeysAfterFailedRefresh(t *testing.T) {
+	signer := newRSASigner(t, "rsa-1")
+	server := newJWKSServer(t, signer)
+	verifier := newTestVerifier(t, server.URL)
+	keys := verifier.keys.(*remoteKeys)
+	keys.minRefresh = time.Minute
+
+	if _, err := verifier.Verify(context.Background(), signer.sign(t, validClaims())); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	server.mu.Lock()
+	server.status = http.StatusServiceUnavailable
+	server.mu.Unlock()
+	current := time.Now()
+	keys.now = func() time.Time { return current.Add(defaultJWKSCacheTTL) }
+	for range 3 {
+		if _, err := verifier.Verify(context.Background(), signer.sign(t, validClaims())); err != nil {
+			t.Fatalf("expected the stale keys to keep serving, got %v", err)
+		}
+		waitForRefresh(t, keys)
+	}
+	if server.fetchCount() != 2 {
+		t.Fatalf("expected one refresh attempt within minRefresh, got %d fetches", server.fetchCount())
+	}
+
+	keys.now = func() time.Time { return current.Add(defaultJWKSCacheTTL + time.Minute) }
+	server.mu.Lock()
+	server.status = 0
+	server.mu.Unlock()
+	if _, err := verifier.Verify(context.Background(), signer.sign(t, validClaims())); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	waitForRefresh(t, keys)
+	if server.fetchCount() != 3 {
+		t.Fatalf("expected a retry once minRefresh passed, got %d fetches", server.fetchCount())
+	}
+}
+
+func TestTokenVerifierDoesNotBlockOnSlowRefresh(t *testing.T) {
+	known := newRSASigner(t, "known")
+	rotated := newRSASigner(t, "rotated")
+	server := newJWKSServer(t, known)
+	verifier := newTestVerifier(t, server.URL)
+	keys := verifier.keys.(*remoteKeys)
+	keys.minRefresh = 0
+
+	if _, err := verifier.Verify(context.Background(), known.sign(t, validClaims())); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	gate := make(chan struct{})
+	server.mu.Lock()
+	server.gate = gate
+	server.signers = []testSigner{known, rotated}
+	server.mu.Unlock()
+
+	var wg sync.WaitGroup
+	errs := make([]error, 2)
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, errs[i] = verifier.Verify(context.Background(), rotated.sign(t, validClaims()))
+		}()
+	}
+	for server.fetchCount() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := verifier.Verify(context.Background(), known.sign(t, validClaims()))
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected a known key to verify while a refresh is in flight")
+	}
+
+	close(gate)
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Fatalf("expected the rotated key to be fetched, got %v", err)
+		}
+	}
+	if server.fetchCount() != 2 {
+		t.Fatalf("expected concurrent unknown kids to share one fetch, got %d fetches", server.fetchCount())
+	}
+}
+
+func TestVerifySignatureBindsECAlgToCurve(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate EC key: %v", err)
+	}
+	signed := "header.payload"
+	digest := sha512.Sum384([]byte(signed))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest[:])
+	if err != nil {
+		t.Fatalf("failed to sign: %v", err)
+	}
+	signature := append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+
+	if err := verifySignature("ES384", &key.PublicKey, signed, signature); err == nil {
+		t.Fatal("expected an ES384 signature from a P-256 key to be rejected")
+	}
+}
+
+// waitForRefresh waits until no JWKS refresh is in flight.
+func waitForRefresh(t *testing.T, keys *remoteKeys) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for {
+		keys.mu.Lock()
+		refreshing := keys.refreshing
+		keys.mu.Unlock()
+		if refreshing == nil {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the JWKS refresh")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestNewTokenVerifierFromEnvWithJWKSFile(t *testing.T) {
+	t.Setenv("OIDC_ISSUER", "")
+	verifier, err := NewTokenVerifierFromEnv()
+	if err != nil || verifier != nil {
+		t.Fatalf("expected no verifier without OIDC_ISSUER, got %v %v", verifier, err)
+	}
+
+	signer := newECSigner(t, "")
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, jwksDocument(signer), 0o600); err != nil {
+		t.Fatalf("failed to write JWKS file: %v", err)
+	}
+	t.Setenv("OIDC_ISSUER", "https://idp.example.com")
+	t.Setenv("OIDC_AUDIENCE", "homer")
+	t.Setenv("OIDC_JWKS_URL", "")
+	t.Setenv("OIDC_JWKS_FILE", path)
+	t.Setenv("OIDC_TENANT_CLAIM", "org")
+	t.Setenv("OIDC_SCOPES_CLAIM", "permissions")
+
+	verifier, err = NewTokenVerifierFromEnv()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	claims := validClaims()
+	claims["org"] = "globex"
+	claims["permissions"] = []string{"admin", "unknown"}
+	principal, err := verifier.Verify(context.Background(), signer.sign(t, claims))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if principal.Tenant != "globex" || len(principal.Scopes) != 1 || !principal.HasScope(ScopeAdmin) {
+		t.Fatalf("unexpected principal %+v", principal)
+	}
+
+	t.Setenv("OIDC_AUDIENCE", "")
+	if _, err := NewTokenVerifierFromEnv(); err == nil {
+		t.Fatal("expected a missing audience to fail")
+	}
+	t.Setenv("OIDC_AUDIENCE", "homer")
+	t.Setenv("OIDC_JWKS_URL", "https://idp.example.com/jwks")
+	if _, err := NewTokenVerifierFromEnv(); err == nil {
+		t.Fatal("expected both a JWKS URL and file to fail")
+	}
+}
@@ -0,0 +1,136 @@
+// Package auth authenticates API keys and maps them to tenants and scopes.
+package auth
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+type Scope string
+
+const (
+	ScopeTask            Scope = "task"
+	ScopeConnectorImport Scope = "connector:import"
+	ScopeConnectorExport Scope = "connector:export"
+	ScopeAdmin           Scope = "admin"
+)
+
+var knownScopes = []Scope{ScopeTask, ScopeConnectorImport, ScopeConnectorExport, ScopeAdmin}
+
+// KeyEntry describes one API key. Only the SHA-256 of the key is stored.
+type KeyEntry struct {
+	ID     string  `json:"id"`
+	Tenant string  `json:"tenant"`
+	Scopes []Scope `json:"scopes"`
+	SHA256 string  `json:"sha256"`
+}
+
+// Principal is the caller an API key authenticates.
+type Principal struct {
+	KeyID  string
+	Tenant string
+	Scopes []Scope
+}
+
+func (p Principal) HasScope(scope Scope) bool {
+	return slices.Contains(p.Scopes, scope)
+}
+
+// Keystore looks up API keys by hash.
+type Keystore struct {
+	byHash map[string]Principal
+}
+
+// NewKeystore validates entries: IDs must be unique, tenants set, scopes
+// known, and hashes 64 hex characters.
+func NewKeystore(entries []KeyEntry) (*Keystore, error) {
+	store := &Keystore{byHash: make(map[string]Principal, len(entries))}
+	ids := make(map[string]bool, len(entries))
+	for _, entry := range entries {
+		id := strings.TrimSpace(entry.ID)
+		if id == "" {
+			return nil, fmt.Errorf("api key entry requires an id")
+		}
+		if ids[id] {
+			return nil, fmt.Errorf("api key %q is defined more than once", id)
+		}
+		ids[id] = true
+
+		tenant := strings.TrimSpace(entry.Tenant)
+		if tenant == "" {
+			return nil, fmt.Errorf("api key %q requires a tenant", id)
+		}
+		if len(entry.Scopes) == 0 {
+			return nil, fmt.Errorf("api key %q requires at least one scope", id)
+		}
+		for _, scope := range entry.Scopes {
+			if !slices.Contains(knownScopes, scope) {
+				return nil, fmt.Errorf("api key %q has unknown scope %q", id, scope)
+			}
+		}
+		hash := strings.ToLower(strings.TrimSpace(entry.SHA256))
+		if decoded, err := hex.DecodeString(hash); err != nil || len(decoded) != sha256.Size {
+			return nil, fmt.Errorf("api key %q: sha256 must be 64 hex characters", id)
+		}
+		if _, exists := store.byHash[hash]; exists {
+			return nil, fmt.Errorf("api key %q has the same hash as another key", id)
+		}
+
+		store.byHash[hash] = Principal{KeyID: id, Tenant: tenant, Scopes: slices.Clone(entry.Scopes)}
+	}
+	return store, nil
+}
+
+// NewKeystoreFromEnv reads API_KEYS_FILE and API_KEYS, each a JSON array of
+// {"id", "tenant", "scopes", "sha256"} entries. It returns nil when neither
+// is set, which leaves API key authentication disabled.
+func NewKeystoreFromEnv() (*Keystore, error) {
+	entries := make([]KeyEntry, 0)
+	configured := false
+
+	if path := strings.TrimSpace(os.Getenv("API_KEYS_FILE")); path != "" {
+		configured = true
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("API_KEYS_FILE: %w", err)
+		}
+		var fileEntries []KeyEntry
+		if err := json.Unmarshal(raw, &fileEntries); err != nil {
+			return nil, fmt.Errorf("API_KEYS_FILE: %w", err)
+		}
+		entries = append(entries, fileEntries...)
+	}
+	if raw := strings.TrimSpace(os.Getenv("API_KEYS")); raw != "" {
+		configured = true
+		var envEntries []KeyEntry
+		if err := json.Unmarshal([]byte(raw), &envEntries); err != nil {
+			return nil, fmt.Errorf("API_KEYS: %w", err)
+		}
+		entries = append(entries, envEntries...)
+	}
+
+	if !configured {
+		return nil, nil
+	}
+	return NewKeystore(entries)
+}
+
+// Authenticate returns the principal for key.
+func (s *Keystore) Authenticate(key string) (Principal, bool) {
+	if key == "" {
+		return Principal{}, false
+	}
+	principal, ok := s.byHash[HashKey(key)]
+	return principal, ok
+}
+
+// HashKey returns the hex SHA-256 of key, as stored in the keystore.
+func HashKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestKeystoreAuthenticatesHashedKeys(t *testing.T) {
+	keys, err := NewKeystore([]KeyEntry{
+		{ID: "ci", Tenant: "acme", Scopes: []Scope{ScopeTask}, SHA256: strings.ToUpper(HashKey("secret"))},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	principal, ok := keys.Authenticate("secret")
+	if !ok || principal.KeyID != "ci" || principal.Tenant != "acme" {
+		t.Fatalf("unexpected principal %+v ok=%t", principal, ok)
+	}
+	if !principal.HasScope(ScopeTask) || principal.HasScope(ScopeAdmin) {
+		t.Fatalf("unexpected scopes %v", principal.Scopes)
+	}
+	if _, ok := keys.Authenticate("other"); ok {
+		t.Fatal("expected an unknown key to be rejected")
+	}
+	if _, ok := keys.Authenticate(""); ok {
+		t.Fatal("expected an empty key to be rejected")
+	}
+}
+
+func TestNewKeystoreValidatesEntries(t *testing.T) {
+	hash := HashKey("secret")
+	cases := map[string][]KeyEntry{
+		"missing id":     {{Tenant: "acme", Scopes: []Scope{ScopeTask}, SHA256: hash}},
+		"missing tenant": {{ID: "a", Scopes: []Scope{ScopeTask}, SHA256: hash}},
+		"no scopes":      {{ID: "a", Tenant: "acme", SHA256: hash}},
+		"unknown scope":  {{ID: "a", Tenant: "acme", Scopes: []Scope{"root"}, SHA256: hash}},
+		"bad hash":       {{ID: "a", Tenant: "acme", Scopes: []Scope{ScopeTask}, SHA256: "secret"}},
+		"duplicate id": {
+			{ID: "a", Tenant: "acme", Scopes: []Scope{ScopeTask}, SHA256: hash},
+			{ID: "a", Tenant: "acme", Scopes: []Scope{ScopeTask}, SHA256: HashKey("other")},
+		},
+		"duplicate hash": {
+			{ID: "a", Tenant: "acme", Scopes: []Scope{ScopeTask}, SHA256: hash},
+			{ID: "b", Tenant: "acme", Scopes: []Scope{ScopeAdmin}, SHA256: hash},
+		},
+	}
+	for name, entries := range cases {
+		if _, err := NewKeystore(entries); err == nil {
+			t.Fatalf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestNewKeystoreFromEnv(t *testing.T) {
+	t.Setenv("API_KEYS_FILE", "")
+	t.Setenv("API_KEYS", "")
+	keys, err := NewKeystoreFromEnv()
+	if err != nil || keys != nil {
+		t.Fatalf("expected no keystore without configuration, got %v %v", keys, err)
+	}
+
+	path := filepath.Join(t.TempDir(), "keys.json")
+	file := `[{"id":"file","tenant":"acme","scopes":["task"],"sha256":"` + HashKey("from-file") + `"}]`
+	if err := os.WriteFile(path, []byte(file), 0o600); err != nil {
+		t.Fatalf("failed to write keys file: %v", err)
+	}
+	t.Setenv("API_KEYS_FILE", path)
+	t.Setenv("API_KEYS", `[{"id":"env","tenant":"globex","scopes":["admin"],"sha256":"`+HashKey("from-env")+`"}]`)
+
+	keys, err = NewKeystoreFromEnv()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if principal, ok := keys.Authenticate("from-file"); !ok || principal.Tenant != "acme" {
+		t.Fatalf("expected the file key to authenticate, got %+v", principal)
+	}
+	if principal, ok := keys.Authenticate("from-env"); !ok || principal.Tenant != "globex" {
+		t.Fatalf("expected the env key to authenticate, got %+v", principal)
+	}
+
+	t.Setenv("API_KEYS", `{"id":"not-an-array"}`)
+	if _, err := NewKeystoreFromEnv(); err == nil {
+		t.Fatal("expected malformed API_KEYS to fail")
+	}
+}
@@ -0,0 +1,196 @@
+package connectors
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/alanmaizon/homer/backend/internal/sharedstate"
+	"golang.org/x/oauth2"
+)
+
+// sharedOAuthSessionTTL is how long a session's token is kept after it was
+// last saved; Google refresh tokens of unused sessions expire anyway.
+const sharedOAuthSessionTTL = 30 * 24 * time.Hour
+
+// SharedOAuthTokenStore keeps OAuth states and tokens in a sharedstate.Store
+// so the callback and later imports can be served by any instance. Values
+// are sealed with AES-GCM, bound to their key, so the store never holds a
+// usable Google token. The OAuthTokenStore methods cannot return errors, so
+// store and decryption failures are logged and read as a missing state or
+// token.
+type SharedOAuthTokenStore struct {
+	store sharedstate.Store
+	aead  cipher.AEAD
+}
+
+type sharedOAuthState struct {
+	SessionKey string    `json:"sessionKey"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+}
+
+// NewSharedOAuthTokenStore encrypts with key, which must be 32 bytes.
+func NewSharedOAuthTokenStore(store sharedstate.Store, key []byte) (*SharedOAuthTokenStore, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("OAuth token encryption key must be 32 bytes, got %d", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &SharedOAuthTokenStore{store: store, aead: aead}, nil
+}
+
+// NewSharedOAuthTokenStoreFromEnv reads OAUTH_TOKEN_ENCRYPTION_KEY, 32
+// base64-encoded bytes, which is required.
+func NewSharedOAuthTokenStoreFromEnv(store sharedstate.Store) (*SharedOAuthTokenStore, error) {
+	raw := strings.TrimSpace(os.Getenv("OAUTH_TOKEN_ENCRYPTION_KEY"))
+	if raw == "" {
+		return nil, errors.New("OAUTH_TOKEN_ENCRYPTION_KEY is required to keep OAuth sessions in shared state")
+	}
+	key, err := base64.StdEncoding.DecodeString(raw)
+	if err != nil {
+		return nil, fmt.Errorf("OAUTH_TOKEN_ENCRYPTION_KEY: %w", err)
+	}
+	shared, err := NewSharedOAuthTokenStore(store, key)
+	if err != nil {
+		return nil, fmt.Errorf("OAUTH_TOKEN_ENCRYPTION_KEY: %w", err)
+	}
+	return shared, nil
+}
+
+// seal returns nonce || ciphertext. key, the value's key in the store, is
+// authenticated too, so a value copied under another key does not open.
+func (s *SharedOAuthTokenStore) seal(key string, plaintext []byte) ([]byte, error) {
+	nonce := make([]byte, s.aead.NonceSize(), s.aead.NonceSize()+len(plaintext)+s.aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return s.aead.Seal(nonce, nonce, plaintext, []byte(key)), nil
+}
+
+func (s *SharedOAuthTokenStore) open(key string, sealed []byte) ([]byte, error) {
+	if len(sealed) < s.aead.NonceSize() {
+		return nil, errors.New("sealed value is too short")
+	}
+	nonce, ciphertext := sealed[:s.aead.NonceSize()], sealed[s.aead.NonceSize():]
+	return s.aead.Open(nil, nonce, ciphertext, []byte(key))
+}
+
+func (s *SharedOAuthTokenStore) SaveState(state string, sessionKey string, expiresAt time.Time) {
+	var ttl time.Duration
+	if !expiresAt.IsZero() {
+		ttl = time.Until(expiresAt)
+		if ttl <= 0 {
+			return
+		}
+	}
+
+	key := oauthStateKey(state)
+	encoded, err := json.Marshal(sharedOAuthState{SessionKey: sessionKey, ExpiresAt: expiresAt})
+	if err == nil {
+		encoded, err = s.seal(key, encoded)
+	}
+	if err == nil {
+		err = s.store.Set(context.Background(), key, encoded, ttl)
+	}
+	if err != nil {
+		log.Printf("component=oauth_store event=save_state_failed error=%q", err.Error())
+	}
+}
+
+func (s *SharedOAuthTokenStore) ConsumeState(state string, now time.Time) (string, bool) {
+	key := oauthStateKey(state)
+	sealed, found, err := s.store.Take(context.Background(), key)
+	if err != nil {
+		log.Printf("component=oauth_store event=consume_state_failed error=%q", err.Error())
+		return "", false
+	}
+	if !found {
+		return "", false
+	}
+	encoded, err := s.open(key, sealed)
+	if err != nil {
+		log.Printf("component=oauth_store event=decrypt_failed error=%q", err.Error())
+		return "", false
+	}
+
+	var entry sharedOAuthState
+	if err := json.Unmarshal(encoded, &entry); err != nil {
+		return "", false
+	}
+	if !entry.ExpiresAt.IsZero() && now.After(entry.ExpiresAt) {
+		return "", false
+	}
+	return entry.SessionKey, true
+}
+
+func (s *SharedOAuthTokenStore) SaveToken(sessionKey string, token *oauth2.Token) {
+	if token == nil {
+		return
+	}
+
+	key := oauthTokenKey(sessionKey)
+	_, err := s.store.Update(context.Background(), key, sharedOAuthSessionTTL, func(current []byte, found bool) ([]byte, error) {
+		copied := copyToken(token)
+		if found && copied.RefreshToken == "" {
+			// Google may omit refresh token on subsequent exchanges/refresh responses.
+			var existing oauth2.Token
+			if decoded, err := s.open(key, current); err == nil && json.Unmarshal(decoded, &existing) == nil {
+				copied.RefreshToken = existing.RefreshToken
+			}
+		}
+		encoded, err := json.Marshal(copied)
+		if err != nil {
+			return nil, err
+		}
+		return s.seal(key, encoded)
+	})
+	if err != nil {
+		log.Printf("component=oauth_store event=save_token_failed error=%q", err.Error())
+	}
+}
+
+func (s *SharedOAuthTokenStore) Token(sessionKey string) (*oauth2.Token, bool) {
+	key := oauthTokenKey(sessionKey)
+	sealed, found, err := s.store.Get(context.Background(), key)
+	if err != nil {
+		log.Printf("component=oauth_store event=load_token_failed error=%q", err.Error())
+		return nil, false
+	}
+	if !found {
+		return nil, false
+	}
+	encoded, err := s.open(key, sealed)
+	if err != nil {
+		log.Printf("component=oauth_store event=decrypt_failed error=%q", err.Error())
+		return nil, false
+	}
+
+	var token oauth2.Token
+	if err := json.Unmarshal(encoded, &token); err != nil {
+		return nil, false
+	}
+	return &token, true
+}
+
+func oauthStateKey(state string) string {
+	return "oauth:state:" + state
+}
+
+func oauthTokenKey(sessionKey string) string {
+	return "oauth:token:" + sessionKey
+}
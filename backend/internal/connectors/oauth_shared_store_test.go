@@ -0,0 +1,135 @@
+package connectors
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alanmaizon/homer/backend/internal/sharedstate"
+	"github.com/alicebob/miniredis/v2"
+	"golang.org/x/oauth2"
+)
+
+var testOAuthEncryptionKey = []byte("0123456789abcdef0123456789abcdef")
+
+func newTestSharedOAuthTokenStore(t *testing.T, server *miniredis.Miniredis) *SharedOAuthTokenStore {
+	t.Helper()
+	store, err := sharedstate.NewRedisStore(sharedstate.RedisConfig{URL: "redis://" + server.Addr()})
+	if err != nil {
+		t.Fatalf("NewRedisStore: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	shared, err := NewSharedOAuthTokenStore(store, testOAuthEncryptionKey)
+	if err != nil {
+		t.Fatalf("NewSharedOAuthTokenStore: %v", err)
+	}
+	return shared
+}
+
+func TestSharedOAuthTokenStoreConsumesStateOnAnotherInstance(t *testing.T) {
+	server := miniredis.RunT(t)
+	starting := newTestSharedOAuthTokenStore(t, server)
+	completing := newTestSharedOAuthTokenStore(t, server)
+	now := time.Now()
+
+	starting.SaveState("state-1", "session-1", now.Add(time.Minute))
+
+	sessionKey, ok := completing.ConsumeState("state-1", now)
+	if !ok || sessionKey != "session-1" {
+		t.Fatalf("expected session-1, got %q ok=%v", sessionKey, ok)
+	}
+	if _, ok := starting.ConsumeState("state-1", now); ok {
+		t.Fatalf("expected state to be one-time use across instances")
+	}
+}
+
+func TestSharedOAuthTokenStoreExpiresState(t *testing.T) {
+	server := miniredis.RunT(t)
+	store := newTestSharedOAuthTokenStore(t, server)
+	now := time.Now()
+
+	store.SaveState("state-1", "session-1", now.Add(time.Minute))
+	if ttl := server.TTL("homer:oauth:state:state-1"); ttl <= 0 || ttl > time.Minute {
+		t.Fatalf("expected state to expire with its deadline, got ttl=%s", ttl)
+	}
+	if _, ok := store.ConsumeState("state-1", now.Add(2*time.Minute)); ok {
+		t.Fatalf("expected expired state to fail")
+	}
+
+	store.SaveState("state-2", "session-2", now.Add(-time.Second))
+	if _, ok := store.ConsumeState("state-2", now); ok {
+		t.Fatalf("expected already expired state not to be stored")
+	}
+}
+
+func TestSharedOAuthTokenStorePreservesRefreshToken(t *testing.T) {
+	server := miniredis.RunT(t)
+	first := newTestSharedOAuthTokenStore(t, server)
+	second := newTestSharedOAuthTokenStore(t, server)
+	expiry := time.Now().Add(time.Hour).Truncate(time.Second)
+
+	first.SaveToken("session-1", &oauth2.Token{AccessToken: "access-1", RefreshToken: "refresh-1"})
+	second.SaveToken("session-1", &oauth2.Token{AccessToken: "access-2", TokenType: "Bearer", Expiry: expiry})
+
+	token, ok := first.Token("session-1")
+	if !ok {
+		t.Fatalf("expected token to be visible to every instance")
+	}
+	if token.AccessToken != "access-2" || token.RefreshToken != "refresh-1" || !token.Expiry.Equal(expiry) {
+		t.Fatalf("unexpected token %+v", token)
+	}
+	if _, ok := first.Token("session-2"); ok {
+		t.Fatalf("expected unknown session to be missing")
+	}
+}
+
+func TestSharedOAuthTokenStoreTreatsStoreErrorsAsMissing(t *testing.T) {
+	server := miniredis.RunT(t)
+	store := newTestSharedOAuthTokenStore(t, server)
+	server.Close()
+
+	store.SaveToken("session-1", &oauth2.Token{AccessToken: "access-1"})
+	if _, ok := store.Token("session-1"); ok {
+		t.Fatalf("expected an unreachable store to report no token")
+	}
+}
+
+func TestSharedOAuthTokenStoreEncryptsValues(t *testing.T) {
+	server := miniredis.RunT(t)
+	store := newTestSharedOAuthTokenStore(t, server)
+
+	store.SaveState("state-1", "session-1", time.Time{})
+	store.SaveToken("session-1", &oauth2.Token{AccessToken: "access-1", RefreshToken: "refresh-1"})
+	for _, key := range []string{"homer:oauth:state:state-1", "homer:oauth:token:session-1"} {
+		raw, err := server.Get(key)
+		if err != nil {
+			t.Fatalf("expected %s to be stored: %v", key, err)
+		}
+		if strings.Contains(raw, "session-1") || strings.Contains(raw, "access-1") || strings.Contains(raw, "refresh-1") {
+			t.Fatalf("expected %s to be encrypted, got %q", key, raw)
+		}
+	}
+
+	// A value moved under another session does not decrypt.
+	raw, _ := server.Get("homer:oauth:token:session-1")
+	_ = server.Set("homer:oauth:token:session-2", raw)
+	if _, ok := store.Token("session-2"); ok {
+		t.Fatalf("expected a token copied to another session to be refused")
+	}
+}
+
+func TestNewSharedOAuthTokenStoreFromEnvRequiresKey(t *testing.T) {
+	t.Setenv("OAUTH_TOKEN_ENCRYPTION_KEY", "")
+	if _, err := NewSharedOAuthTokenStoreFromEnv(nil); err == nil {
+		t.Fatalf("expected a missing key to be refused")
+	}
+	t.Setenv("OAUTH_TOKEN_ENCRYPTION_KEY", base64.StdEncoding.EncodeToString([]byte("short")))
+	if _, err := NewSharedOAuthTokenStoreFromEnv(nil); err == nil {
+		t.Fatalf("expected a short key to be refused")
+	}
+	t.Setenv("OAUTH_TOKEN_ENCRYPTION_KEY", base64.StdEncoding.EncodeToString(testOAuthEncryptionKey))
+	if _, err := NewSharedOAuthTokenStoreFromEnv(nil); err != nil {
+		t.Fatalf("NewSharedOAuthTokenStoreFromEnv returned error: %v", err)
+	}
+}
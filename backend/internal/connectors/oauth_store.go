@@ -102,6 +102,12 @@ func OAuthStore() OAuthTokenStore {
 	return oauthStore
 }
 
+// UseOAuthStore replaces the process-wide store, for example with a
+// SharedOAuthTokenStore when several instances serve the OAuth flow.
+func UseOAuthStore(store OAuthTokenStore) {
+	oauthStore = store
+}
+
 func SetOAuthStoreForTests(store OAuthTokenStore) func() {
 	previous := oauthStore
 	if store == nil {
@@ -1,5 +1,7 @@
 package domain
 
+import "encoding/json"
+
 type TaskType string
 type AgentRole string
 
@@ -10,12 +12,26 @@ const (
 	RolePlanner  AgentRole = "planner"
 	RoleExecutor AgentRole = "executor"
 	RoleCritic   AgentRole = "critic"
+	RoleTool     AgentRole = "tool"
 )
 
 type Document struct {
 	ID      string `json:"id"`
 	Title   string `json:"title"`
 	Content string `json:"content"`
+
+	// Priority orders documents when some must be dropped to fit the model's
+	// context window; lower priorities are dropped first.
+	Priority int `json:"priority,omitempty"`
+}
+
+// GenerationParams are optional sampling settings forwarded to providers.
+// Nil fields leave the provider default in place.
+type GenerationParams struct {
+	Temperature *float64 `json:"temperature,omitempty"`
+	MaxTokens   *int     `json:"maxTokens,omitempty"`
+	TopP        *float64 `json:"topP,omitempty"`
+	Stop        []string `json:"stop,omitempty"`
 }
 
 type TaskRequest struct {
@@ -26,12 +42,27 @@ type TaskRequest struct {
 	Instructions string     `json:"instructions"`
 	Style        string     `json:"style"`
 	EnableCritic bool       `json:"enableCritic"`
+
+	// EnableTools lets the model call tools, such as importing connector
+	// documents or searching the request documents, before it answers.
+	EnableTools bool `json:"enableTools,omitempty"`
+
+	// CallbackURL receives the TaskResponse or error envelope as a signed
+	// POST once the task finishes.
+	CallbackURL string `json:"callbackUrl,omitempty"`
+
+	Generation *GenerationParams `json:"generation,omitempty"`
 }
 
 type PlanStep struct {
 	ID     string    `json:"id"`
 	Role   AgentRole `json:"role"`
 	Action string    `json:"action"`
+
+	// Arguments and Error are set on tool steps: the arguments the model
+	// passed and, when the call failed, the error it was shown.
+	Arguments json.RawMessage `json:"arguments,omitempty"`
+	Error     string          `json:"error,omitempty"`
 }
 
 type TaskResponse struct {
@@ -40,16 +71,117 @@ type TaskResponse struct {
 	Metadata Metadata   `json:"metadata"`
 }
 
+// BatchTaskItem is a TaskRequest with a client-chosen ID, unique within its
+// batch.
+type BatchTaskItem struct {
+	ID string `json:"id"`
+	TaskRequest
+}
+
+type BatchTaskRequest struct {
+	Items []BatchTaskItem `json:"items"`
+}
+
+// BatchTaskResult is one item's outcome. Status is the HTTP status
+// /api/task would have returned; Result is set on success and Error
+// otherwise.
+type BatchTaskResult struct {
+	ID     string        `json:"id"`
+	Status int           `json:"status"`
+	Result *TaskResponse `json:"result,omitempty"`
+	Error  *APIError     `json:"error,omitempty"`
+}
+
+type BatchTaskResponse struct {
+	Items     []BatchTaskResult `json:"items"`
+	Succeeded int               `json:"succeeded"`
+	Failed    int               `json:"failed"`
+}
+
+// JobResponse reports an asynchronous task. Status is "queued", "running",
+// "succeeded", "failed" or "canceled"; Result is set on success and Error on
+// failure.
+type JobResponse struct {
+	ID         string        `json:"id"`
+	Status     string        `json:"status"`
+	CreatedAt  string        `json:"createdAt"`
+	StartedAt  string        `json:"startedAt,omitempty"`
+	FinishedAt string        `json:"finishedAt,omitempty"`
+	Result     *TaskResponse `json:"result,omitempty"`
+	Error      *APIError     `json:"error,omitempty"`
+}
+
 type Metadata struct {
 	Provider        string `json:"provider"`
 	ExecutionTimeMs int64  `json:"executionTimeMs"`
 	RequestID       string `json:"requestId,omitempty"`
+	PromptTemplate  string `json:"promptTemplate,omitempty"`
+	PromptVersion   string `json:"promptVersion,omitempty"`
+
+	Generation *GenerationParams  `json:"generation,omitempty"`
+	Retrieval  *RetrievalMetadata `json:"retrieval,omitempty"`
+
+	ContextBudget *ContextBudgetMetadata `json:"contextBudget,omitempty"`
+	Moderation    []ModerationDecision   `json:"moderation,omitempty"`
+}
+
+// ModerationDecision records content flagged by a moderator. Action is
+// "block", "warn" or "log"; Code is a stable identifier such as
+// "moderation_output_flagged".
+type ModerationDecision struct {
+	Stage      string   `json:"stage"`
+	Moderator  string   `json:"moderator"`
+	Action     string   `json:"action"`
+	Code       string   `json:"code"`
+	Categories []string `json:"categories"`
+}
+
+// ContextBudgetMetadata reports how the request was fitted to the model's
+// context window. Action is "none", "truncated" or "dropped".
+type ContextBudgetMetadata struct {
+	Model             string   `json:"model"`
+	ContextWindow     int      `json:"contextWindow"`
+	InputBudgetTokens int      `json:"inputBudgetTokens"`
+	EstimatedTokens   int      `json:"estimatedTokens"`
+	Strategy          string   `json:"strategy"`
+	Action            string   `json:"action"`
+	AffectedDocuments []string `json:"affectedDocuments,omitempty"`
+}
+
+// RetrievalMetadata is set when a large summarize request was narrowed to
+// the chunks most relevant to its instructions.
+type RetrievalMetadata struct {
+	EmbeddingModel string `json:"embeddingModel"`
+	TotalChunks    int    `json:"totalChunks"`
+	SelectedChunks int    `json:"selectedChunks"`
 }
 
 type APIError struct {
 	Code      string `json:"code"`
 	Message   string `json:"message"`
 	RequestID string `json:"requestId,omitempty"`
+	// ResetAt is set on quota_exceeded errors.
+	ResetAt string `json:"resetAt,omitempty"`
+}
+
+type UsageResponse struct {
+	Tenant  string      `json:"tenant"`
+	Daily   UsageWindow `json:"daily"`
+	Monthly UsageWindow `json:"monthly"`
+}
+
+// UsageWindow is one quota period; a zero limit is unlimited.
+type UsageWindow struct {
+	Start   string        `json:"start"`
+	ResetAt string        `json:"resetAt"`
+	Used    UsageCounters `json:"used"`
+	Limits  UsageCounters `json:"limits"`
+}
+
+type UsageCounters struct {
+	Requests   int64 `json:"requests"`
+	InputChars int64 `json:"inputChars"`
+	Tokens     int64 `json:"tokens"`
 }
 
 type APIErrorResponse struct {
@@ -59,6 +191,7 @@ type APIErrorResponse struct {
 type CapabilitiesResponse struct {
 	Runtime  RuntimeCapabilities `json:"runtime"`
 	Features FeatureFlags        `json:"features"`
+	Limits   RequestLimits       `json:"limits"`
 }
 
 type RuntimeCapabilities struct {
@@ -74,6 +207,20 @@ type FeatureFlags struct {
 	Critic          bool `json:"critic"`
 	ConnectorImport bool `json:"connectorImport"`
 	ConnectorExport bool `json:"connectorExport"`
+	ToolCalling     bool `json:"toolCalling"`
+}
+
+// RequestLimits bound the size and shape of request bodies. Lengths are in
+// characters (Unicode code points).
+type RequestLimits struct {
+	MaxBodyBytes        int `json:"maxBodyBytes"`
+	MaxDocuments        int `json:"maxDocuments"`
+	MaxDocumentChars    int `json:"maxDocumentChars"`
+	MaxTextChars        int `json:"maxTextChars"`
+	MaxInstructionChars int `json:"maxInstructionChars"`
+	MaxIDChars          int `json:"maxIdChars"`
+	MaxTitleChars       int `json:"maxTitleChars"`
+	MaxBatchItems       int `json:"maxBatchItems"`
 }
 
 type ConnectorImportRequest struct {
@@ -107,4 +254,6 @@ type ConnectorExportRequest struct {
 type ConnectorExportResponse struct {
 	Connector string `json:"connector"`
 	Exported  bool   `json:"exported"`
+
+	Moderation []ModerationDecision `json:"moderation,omitempty"`
 }
@@ -0,0 +1,179 @@
+// Package idempotency stores the first response to a request carrying an
+// Idempotency-Key so retries of the same request can be answered without
+// running it again.
+package idempotency
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	defaultTTL          = 24 * time.Hour
+	defaultLockTTL      = 10 * time.Minute
+	defaultPollInterval = 50 * time.Millisecond
+	defaultMaxKeys      = 10000
+	// defaultMaxResponseBytes keeps the in-memory store under about 640 MiB
+	// at defaultMaxKeys.
+	defaultMaxResponseBytes = 64 << 10
+)
+
+var (
+	// ErrConflict is returned when a key is reused for a different request.
+	ErrConflict = errors.New("idempotency key was used for a different request")
+	// ErrClaimLost is returned by Complete and Release when the claim
+	// expired and the key was claimed again or removed, leaving it untouched.
+	ErrClaimLost = errors.New("idempotency claim is no longer held")
+	// ErrResponseTooLarge is returned by Complete when the response exceeds
+	// MaxResponseBytes; the claim is released instead.
+	ErrResponseTooLarge = errors.New("response is too large to store for idempotency")
+)
+
+// Response is a stored HTTP response.
+type Response struct {
+	Status      int    `json:"status"`
+	ContentType string `json:"contentType"`
+	Body        []byte `json:"body"`
+}
+
+// Entry is what a key holds: the fingerprint of the request that claimed it
+// and, once that request finished, its response. Claim identifies the
+// request holding a pending entry.
+type Entry struct {
+	Fingerprint string   `json:"fingerprint"`
+	Pending     bool     `json:"pending"`
+	Claim       string   `json:"claim,omitempty"`
+	Response    Response `json:"response"`
+}
+
+// holds reports whether the entry is still pending under claim.
+func (e Entry) holds(claim string) bool {
+	return e.Pending && e.Claim == claim
+}
+
+// Config sets how long responses are kept (TTL) and how long a claim by a
+// request that has not finished blocks the key (LockTTL); LockTTL should
+// exceed the slowest request. Responses larger than MaxResponseBytes are not
+// stored, and the in-memory store keeps at most MaxKeys keys.
+type Config struct {
+	TTL              time.Duration
+	LockTTL          time.Duration
+	MaxKeys          int
+	MaxResponseBytes int
+}
+
+// ConfigFromEnv reads IDEMPOTENCY_TTL_MS (default 24h),
+// IDEMPOTENCY_LOCK_TTL_MS (default 10m), IDEMPOTENCY_MAX_KEYS (default
+// 10000) and IDEMPOTENCY_MAX_RESPONSE_BYTES (default 64 KiB).
+func ConfigFromEnv() Config {
+	config := Config{TTL: defaultTTL, LockTTL: defaultLockTTL, MaxKeys: defaultMaxKeys, MaxResponseBytes: defaultMaxResponseBytes}
+	if ms, err := strconv.Atoi(strings.TrimSpace(os.Getenv("IDEMPOTENCY_TTL_MS"))); err == nil && ms > 0 {
+		config.TTL = time.Duration(ms) * time.Millisecond
+	}
+	if ms, err := strconv.Atoi(strings.TrimSpace(os.Getenv("IDEMPOTENCY_LOCK_TTL_MS"))); err == nil && ms > 0 {
+		config.LockTTL = time.Duration(ms) * time.Millisecond
+	}
+	if n, err := strconv.Atoi(strings.TrimSpace(os.Getenv("IDEMPOTENCY_MAX_KEYS"))); err == nil && n > 0 {
+		config.MaxKeys = n
+	}
+	if n, err := strconv.Atoi(strings.TrimSpace(os.Getenv("IDEMPOTENCY_MAX_RESPONSE_BYTES"))); err == nil && n > 0 {
+		config.MaxResponseBytes = n
+	}
+	return config
+}
+
+// Fingerprint identifies a request by its method, route and exact body.
+func Fingerprint(method string, route string, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(method + " " + route + "\n"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// Manager coordinates requests sharing a key.
+type Manager struct {
+	store        Store
+	config       Config
+	pollInterval time.Duration
+}
+
+func NewManager(store Store, config Config) *Manager {
+	if config.TTL <= 0 {
+		config.TTL = defaultTTL
+	}
+	if config.LockTTL <= 0 {
+		config.LockTTL = defaultLockTTL
+	}
+	if config.MaxResponseBytes <= 0 {
+		config.MaxResponseBytes = defaultMaxResponseBytes
+	}
+	return &Manager{store: store, config: config, pollInterval: defaultPollInterval}
+}
+
+// Begin claims key for the request with fingerprint. It returns a claim
+// token when the caller claimed the key and must run the request, then pass
+// the token to Complete or Release; the stored response when an identical
+// request already finished; and ErrConflict when the key belongs to a
+// different request. While an identical request is still running, Begin
+// waits for it until ctx ends.
+func (m *Manager) Begin(ctx context.Context, key string, fingerprint string) (string, *Response, error) {
+	claim := uuid.NewString()
+	for {
+		claimed, err := m.store.Claim(ctx, key, Entry{Fingerprint: fingerprint, Pending: true, Claim: claim}, m.config.LockTTL)
+		if err != nil {
+			return "", nil, err
+		}
+		if claimed {
+			return claim, nil, nil
+		}
+
+		entry, found, err := m.store.Get(ctx, key)
+		if err != nil {
+			return "", nil, err
+		}
+		if found {
+			if entry.Fingerprint != fingerprint {
+				return "", nil, ErrConflict
+			}
+			if !entry.Pending {
+				return "", &entry.Response, nil
+			}
+		}
+
+		// The claim is held by a request still running, or was released or
+		// expired between Claim and Get; look again shortly.
+		timer := time.NewTimer(m.pollInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return "", nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// Complete stores the response of the request that claimed key. A response
+// over MaxResponseBytes is not stored and the claim is released instead.
+func (m *Manager) Complete(ctx context.Context, key string, claim string, fingerprint string, response Response) error {
+	if len(response.Body) > m.config.MaxResponseBytes {
+		if err := m.Release(ctx, key, claim); err != nil {
+			return err
+		}
+		return ErrResponseTooLarge
+	}
+	return m.store.Put(ctx, key, claim, Entry{Fingerprint: fingerprint, Response: response}, m.config.TTL)
+}
+
+// Release gives up a claim without storing a response, so a retry runs the
+// request again.
+func (m *Manager) Release(ctx context.Context, key string, claim string) error {
+	return m.store.Delete(ctx, key, claim)
+}
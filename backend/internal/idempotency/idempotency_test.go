@@ -0,0 +1,225 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alanmaizon/homer/backend/internal/sharedstate"
+	"github.com/alicebob/miniredis/v2"
+)
+
+func newTestManager(store Store) *Manager {
+	manager := NewManager(store, Config{TTL: time.Hour, LockTTL: time.Minute})
+	manager.pollInterval = time.Millisecond
+	return manager
+}
+
+func TestManagerReplaysCompletedResponse(t *testing.T) {
+	manager := newTestManager(NewMemoryStore(0))
+	ctx := context.Background()
+	fingerprint := Fingerprint("POST", "/api/task", []byte(`{"task":"rewrite"}`))
+
+	claim, response, err := manager.Begin(ctx, "acme:key-1", fingerprint)
+	if err != nil || response != nil || claim == "" {
+		t.Fatalf("expected the first request to claim the key, got %+v err=%v", response, err)
+	}
+	stored := Response{Status: 200, ContentType: "application/json", Body: []byte(`{"result":"ok"}`)}
+	if err := manager.Complete(ctx, "acme:key-1", claim, fingerprint, stored); err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+
+	_, response, err = manager.Begin(ctx, "acme:key-1", fingerprint)
+	if err != nil || response == nil || response.Status != 200 || string(response.Body) != `{"result":"ok"}` {
+		t.Fatalf("expected the stored response, got %+v err=%v", response, err)
+	}
+
+	other := Fingerprint("POST", "/api/task", []byte(`{"task":"summarize"}`))
+	if _, _, err := manager.Begin(ctx, "acme:key-1", other); !errors.Is(err, ErrConflict) {
+		t.Fatalf("expected a different body to conflict, got %v", err)
+	}
+}
+
+func TestManagerWaitsForInFlightDuplicate(t *testing.T) {
+	manager := newTestManager(NewMemoryStore(0))
+	ctx := context.Background()
+	fingerprint := Fingerprint("POST", "/api/task", []byte(`{}`))
+
+	claim, response, _ := manager.Begin(ctx, "key", fingerprint)
+	if response != nil {
+		t.Fatalf("expected the first request to claim the key")
+	}
+
+	done := make(chan *Response, 1)
+	go func() {
+		_, response, _ := manager.Begin(ctx, "key", fingerprint)
+		done <- response
+	}()
+
+	select {
+	case <-done:
+		t.Fatalf("expected the duplicate to wait while the first request runs")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	_ = manager.Complete(ctx, "key", claim, fingerprint, Response{Status: 201})
+	select {
+	case response := <-done:
+		if response == nil || response.Status != 201 {
+			t.Fatalf("expected the duplicate to receive the first response, got %+v", response)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("duplicate did not finish after the first request completed")
+	}
+}
+
+func TestManagerReleaseLetsRetryRun(t *testing.T) {
+	manager := newTestManager(NewMemoryStore(0))
+	ctx := context.Background()
+
+	claim, _, _ := manager.Begin(ctx, "key", "fp")
+	waitCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, _, err := manager.Begin(waitCtx, "key", "fp"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected waiting to end with the context, got %v", err)
+	}
+
+	if err := manager.Release(ctx, "key", claim); err != nil {
+		t.Fatalf("Release: %v", err)
+	}
+	if _, response, err := manager.Begin(ctx, "key", "fp"); err != nil || response != nil {
+		t.Fatalf("expected a retry to claim the released key, got %+v err=%v", response, err)
+	}
+}
+
+func TestMemoryStoreKeepsClaimTakenAfterExpiry(t *testing.T) {
+	store := NewMemoryStore(0)
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+	testClaimTakenAfterExpiry(t, store, func(d time.Duration) { now = now.Add(d) })
+}
+
+func TestSharedStoreKeepsClaimTakenAfterExpiry(t *testing.T) {
+	server := miniredis.RunT(t)
+	shared, err := sharedstate.NewRedisStore(sharedstate.RedisConfig{URL: "redis://" + server.Addr()})
+	if err != nil {
+		t.Fatalf("NewRedisStore: %v", err)
+	}
+	t.Cleanup(func() { shared.Close() })
+	testClaimTakenAfterExpiry(t, NewStore(shared, Config{}), server.FastForward)
+}
+
+// testClaimTakenAfterExpiry checks that a request whose claim expired
+// cannot complete or release the key once another request claimed it.
+func testClaimTakenAfterExpiry(t *testing.T, store Store, advance func(time.Duration)) {
+	t.Helper()
+	manager := newTestManager(store)
+	ctx := context.Background()
+
+	stale, _, _ := manager.Begin(ctx, "key", "fp")
+	advance(2 * time.Minute)
+	current, response, err := manager.Begin(ctx, "key", "fp")
+	if err != nil || response != nil || current == stale {
+		t.Fatalf("expected a retry to claim the expired key, got %+v err=%v", response, err)
+	}
+
+	if err := manager.Release(ctx, "key", stale); !errors.Is(err, ErrClaimLost) {
+		t.Fatalf("expected the stale Release to lose its claim, got %v", err)
+	}
+	if err := manager.Complete(ctx, "key", stale, "fp", Response{Status: 500}); !errors.Is(err, ErrClaimLost) {
+		t.Fatalf("expected the stale Complete to lose its claim, got %v", err)
+	}
+	if err := manager.Complete(ctx, "key", current, "fp", Response{Status: 200}); err != nil {
+		t.Fatalf("Complete: %v", err)
+	}
+	if _, response, err := manager.Begin(ctx, "key", "fp"); err != nil || response == nil || response.Status != 200 {
+		t.Fatalf("expected the current request's response, got %+v err=%v", response, err)
+	}
+}
+
+func TestMemoryStoreExpiresEntries(t *testing.T) {
+	store := NewMemoryStore(0)
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	store.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	_, _ = store.Claim(ctx, "key", Entry{Fingerprint: "fp", Pending: true}, time.Minute)
+	now = now.Add(time.Minute)
+	if _, found, _ := store.Get(ctx, "key"); found {
+		t.Fatalf("expected the entry to expire")
+	}
+	if claimed, _ := store.Claim(ctx, "key", Entry{Fingerprint: "other"}, time.Minute); !claimed {
+		t.Fatalf("expected an expired claim to be replaced")
+	}
+}
+
+func TestSharedStoreCoordinatesInstances(t *testing.T) {
+	server := miniredis.RunT(t)
+	newInstance := func() *Manager {
+		shared, err := sharedstate.NewRedisStore(sharedstate.RedisConfig{URL: "redis://" + server.Addr()})
+		if err != nil {
+			t.Fatalf("NewRedisStore: %v", err)
+		}
+		t.Cleanup(func() { shared.Close() })
+		return newTestManager(NewStore(shared, Config{}))
+	}
+	first, second := newInstance(), newInstance()
+	ctx := context.Background()
+
+	claim, response, err := first.Begin(ctx, "acme:key-1", "fp")
+	if err != nil || response != nil {
+		t.Fatalf("expected the first instance to claim the key, got %+v err=%v", response, err)
+	}
+	if ttl := server.TTL("homer:idempotency:acme:key-1"); ttl <= 0 || ttl > time.Minute {
+		t.Fatalf("expected the claim to expire with the lock TTL, got %s", ttl)
+	}
+	if _, _, err := second.Begin(ctx, "acme:key-1", "other"); !errors.Is(err, ErrConflict) {
+		t.Fatalf("expected a conflict on the other instance, got %v", err)
+	}
+
+	_ = first.Complete(ctx, "acme:key-1", claim, "fp", Response{Status: 200, Body: []byte("done")})
+	_, response, err = second.Begin(ctx, "acme:key-1", "fp")
+	if err != nil || response == nil || string(response.Body) != "done" {
+		t.Fatalf("expected the other instance to replay the response, got %+v err=%v", response, err)
+	}
+	if ttl := server.TTL("homer:idempotency:acme:key-1"); ttl <= time.Minute {
+		t.Fatalf("expected the stored response to be kept for the TTL, got %s", ttl)
+	}
+}
+
+func TestMemoryStoreEvictsLeastRecentlyUsedKey(t *testing.T) {
+	store := NewMemoryStore(2)
+	ctx := context.Background()
+
+	_, _ = store.Claim(ctx, "first", Entry{Fingerprint: "fp"}, time.Hour)
+	_, _ = store.Claim(ctx, "second", Entry{Fingerprint: "fp"}, time.Hour)
+	if _, found, _ := store.Get(ctx, "first"); !found {
+		t.Fatalf("expected the first key to be kept")
+	}
+	_, _ = store.Claim(ctx, "third", Entry{Fingerprint: "fp"}, time.Hour)
+
+	if store.Len() != 2 {
+		t.Fatalf("expected the store to stay at its cap, got %d keys", store.Len())
+	}
+	if _, found, _ := store.Get(ctx, "second"); found {
+		t.Fatalf("expected the least recently used key to be evicted")
+	}
+	if _, found, _ := store.Get(ctx, "first"); !found {
+		t.Fatalf("expected the recently read key to be kept")
+	}
+}
+
+func TestManagerDoesNotStoreOversizedResponse(t *testing.T) {
+	manager := NewManager(NewMemoryStore(0), Config{TTL: time.Hour, LockTTL: time.Minute, MaxResponseBytes: 4})
+	ctx := context.Background()
+
+	claim, _, _ := manager.Begin(ctx, "key", "fp")
+	err := manager.Complete(ctx, "key", claim, "fp", Response{Status: 200, Body: []byte("too long")})
+	if !errors.Is(err, ErrResponseTooLarge) {
+		t.Fatalf("expected ErrResponseTooLarge, got %v", err)
+	}
+	if _, response, err := manager.Begin(ctx, "key", "fp"); err != nil || response != nil {
+		t.Fatalf("expected a retry to run the request again, got %+v err=%v", response, err)
+	}
+}
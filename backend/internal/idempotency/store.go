@@ -0,0 +1,229 @@
+package idempotency
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/alanmaizon/homer/backend/internal/sharedstate"
+)
+
+const sweepInterval = time.Minute
+
+// Store holds entries until their TTL passes. Implementations must be safe
+// for concurrent use.
+type Store interface {
+	// Claim stores entry at key unless key holds a live entry, and reports
+	// whether it did.
+	Claim(ctx context.Context, key string, entry Entry, ttl time.Duration) (bool, error)
+	Get(ctx context.Context, key string) (Entry, bool, error)
+	// Put replaces the pending entry holding claim with entry. Delete
+	// removes it. Both return ErrClaimLost, changing nothing, when key no
+	// longer holds that claim.
+	Put(ctx context.Context, key string, claim string, entry Entry, ttl time.Duration) error
+	Delete(ctx context.Context, key string, claim string) error
+}
+
+// NewStore keeps entries in shared when it is set, so retries reaching
+// another instance are recognized, and in process memory otherwise.
+func NewStore(shared sharedstate.Store, config Config) Store {
+	if shared != nil {
+		return NewSharedStore(shared)
+	}
+	return NewMemoryStore(config.MaxKeys)
+}
+
+type memoryEntry struct {
+	key       string
+	entry     Entry
+	expiresAt time.Time
+}
+
+// MemoryStore keeps up to maxKeys entries in process memory, evicting the
+// least recently used one to make room. Expired entries are swept at most
+// once a minute.
+type MemoryStore struct {
+	now     func() time.Time
+	maxKeys int
+
+	mu        sync.Mutex
+	entries   map[string]*list.Element
+	recency   *list.List
+	lastSweep time.Time
+}
+
+// NewMemoryStore keeps at most maxKeys entries; zero means 10000.
+func NewMemoryStore(maxKeys int) *MemoryStore {
+	if maxKeys <= 0 {
+		maxKeys = defaultMaxKeys
+	}
+	return &MemoryStore{
+		now:     time.Now,
+		maxKeys: maxKeys,
+		entries: make(map[string]*list.Element),
+		recency: list.New(),
+	}
+}
+
+func (s *MemoryStore) Claim(_ context.Context, key string, entry Entry, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if now.Sub(s.lastSweep) >= sweepInterval {
+		s.sweepLocked(now)
+	}
+
+	if element, ok := s.entries[key]; ok {
+		if now.Before(element.Value.(*memoryEntry).expiresAt) {
+			s.recency.MoveToFront(element)
+			return false, nil
+		}
+		s.removeLocked(element)
+	}
+	if len(s.entries) >= s.maxKeys {
+		s.sweepLocked(now)
+		if len(s.entries) >= s.maxKeys {
+			s.removeLocked(s.recency.Back())
+		}
+	}
+	s.entries[key] = s.recency.PushFront(&memoryEntry{key: key, entry: entry, expiresAt: now.Add(ttl)})
+	return true, nil
+}
+
+func (s *MemoryStore) Get(_ context.Context, key string) (Entry, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	element, ok := s.liveLocked(key)
+	if !ok {
+		return Entry{}, false, nil
+	}
+	s.recency.MoveToFront(element)
+	return element.Value.(*memoryEntry).entry, true, nil
+}
+
+func (s *MemoryStore) Put(_ context.Context, key string, claim string, entry Entry, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	element, ok := s.liveLocked(key)
+	if !ok || !element.Value.(*memoryEntry).entry.holds(claim) {
+		return ErrClaimLost
+	}
+	existing := element.Value.(*memoryEntry)
+	existing.entry = entry
+	existing.expiresAt = s.now().Add(ttl)
+	s.recency.MoveToFront(element)
+	return nil
+}
+
+func (s *MemoryStore) Delete(_ context.Context, key string, claim string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	element, ok := s.liveLocked(key)
+	if !ok || !element.Value.(*memoryEntry).entry.holds(claim) {
+		return ErrClaimLost
+	}
+	s.removeLocked(element)
+	return nil
+}
+
+// Len reports how many entries are kept, including expired ones not yet
+// swept.
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.entries)
+}
+
+func (s *MemoryStore) liveLocked(key string) (*list.Element, bool) {
+	element, ok := s.entries[key]
+	if !ok || !s.now().Before(element.Value.(*memoryEntry).expiresAt) {
+		return nil, false
+	}
+	return element, true
+}
+
+// sweepLocked removes expired entries. Responses and claims expire after
+// different TTLs, so the whole list is scanned.
+func (s *MemoryStore) sweepLocked(now time.Time) {
+	s.lastSweep = now
+	for element := s.recency.Front(); element != nil; {
+		next := element.Next()
+		if !now.Before(element.Value.(*memoryEntry).expiresAt) {
+			s.removeLocked(element)
+		}
+		element = next
+	}
+}
+
+func (s *MemoryStore) removeLocked(element *list.Element) {
+	delete(s.entries, element.Value.(*memoryEntry).key)
+	s.recency.Remove(element)
+}
+
+// SharedStore keeps JSON-encoded entries in a sharedstate.Store.
+type SharedStore struct {
+	store sharedstate.Store
+}
+
+func NewSharedStore(store sharedstate.Store) *SharedStore {
+	return &SharedStore{store: store}
+}
+
+func (s *SharedStore) Claim(ctx context.Context, key string, entry Entry, ttl time.Duration) (bool, error) {
+	encoded, err := json.Marshal(entry)
+	if err != nil {
+		return false, err
+	}
+	return s.store.SetIfAbsent(ctx, sharedKey(key), encoded, ttl)
+}
+
+func (s *SharedStore) Get(ctx context.Context, key string) (Entry, bool, error) {
+	encoded, found, err := s.store.Get(ctx, sharedKey(key))
+	if err != nil || !found {
+		return Entry{}, false, err
+	}
+	var entry Entry
+	if err := json.Unmarshal(encoded, &entry); err != nil {
+		return Entry{}, false, err
+	}
+	return entry, true, nil
+}
+
+func (s *SharedStore) Put(ctx context.Context, key string, claim string, entry Entry, ttl time.Duration) error {
+	encoded, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	_, err = s.store.Update(ctx, sharedKey(key), ttl, func(current []byte, found bool) ([]byte, error) {
+		if !found || !sharedHolds(current, claim) {
+			return nil, ErrClaimLost
+		}
+		return encoded, nil
+	})
+	return err
+}
+
+func (s *SharedStore) Delete(ctx context.Context, key string, claim string) error {
+	deleted, err := s.store.DeleteIf(ctx, sharedKey(key), func(current []byte) bool {
+		return sharedHolds(current, claim)
+	})
+	if err == nil && !deleted {
+		return ErrClaimLost
+	}
+	return err
+}
+
+func sharedHolds(encoded []byte, claim string) bool {
+	var entry Entry
+	return json.Unmarshal(encoded, &entry) == nil && entry.holds(claim)
+}
+
+func sharedKey(key string) string {
+	return "idempotency:" + key
+}
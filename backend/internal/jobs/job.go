@@ -0,0 +1,49 @@
+// Package jobs runs task requests asynchronously on a bounded worker pool.
+package jobs
+
+import (
+	"time"
+
+	"github.com/alanmaizon/homer/backend/internal/domain"
+	"github.com/alanmaizon/homer/backend/internal/quota"
+)
+
+type Status string
+
+const (
+	StatusQueued    Status = "queued"
+	StatusRunning   Status = "running"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+	StatusCanceled  Status = "canceled"
+)
+
+// Finished reports whether the job has reached a terminal status.
+func (s Status) Finished() bool {
+	return s == StatusSucceeded || s == StatusFailed || s == StatusCanceled
+}
+
+// Job is a submitted task and its outcome. Result is set when the job
+// succeeded and Error when it failed.
+type Job struct {
+	ID        string             `json:"id"`
+	Status    Status             `json:"status"`
+	Request   domain.TaskRequest `json:"request"`
+	RequestID string             `json:"requestId"`
+	Tenant    string             `json:"tenant"`
+
+	// UseConnector attaches the configured connector to the task's tools,
+	// under ConnectorSession, as X-Connector-Key does for /api/task.
+	UseConnector     bool   `json:"useConnector,omitempty"`
+	ConnectorSession string `json:"connectorSession,omitempty"`
+	// Reservation is the quota charged at submission, refunded if the job
+	// never reaches a provider.
+	Reservation *quota.Reservation `json:"reservation,omitempty"`
+
+	Result *domain.TaskResponse `json:"result,omitempty"`
+	Error  *domain.APIError     `json:"error,omitempty"`
+
+	CreatedAt  time.Time `json:"createdAt"`
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt"`
+}
@@ -0,0 +1,367 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alanmaizon/homer/backend/internal/domain"
+	"github.com/alanmaizon/homer/backend/internal/metrics"
+	"github.com/alanmaizon/homer/backend/internal/middleware"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultWorkers     = 4
+	defaultQueueSize   = 100
+	defaultRetentionMs = 3600000
+	defaultTimeoutMs   = 600000
+
+	maxSweepInterval = time.Minute
+)
+
+var (
+	// ErrQueueFull is returned by Submit when JOBS_QUEUE_SIZE jobs are
+	// already waiting.
+	ErrQueueFull = errors.New("job queue is full")
+	// ErrJobFinished is returned by Cancel for jobs that already completed.
+	ErrJobFinished = errors.New("job already finished")
+	// ErrManagerClosed is returned by Submit after Close.
+	ErrManagerClosed = errors.New("job manager is closed")
+)
+
+// Runner executes a job's task. A nil error means the job succeeded.
+type Runner func(ctx context.Context, job Job) (domain.TaskResponse, *domain.APIError)
+
+type Config struct {
+	Workers   int
+	QueueSize int
+	// Retention is how long finished jobs stay readable.
+	Retention time.Duration
+	// Timeout bounds each job's run time.
+	Timeout time.Duration
+}
+
+// ConfigFromEnv reads JOBS_WORKERS, JOBS_QUEUE_SIZE, JOBS_RETENTION_MS and
+// JOBS_TIMEOUT_MS.
+func ConfigFromEnv() Config {
+	return Config{
+		Workers:   positiveIntFromEnv("JOBS_WORKERS", defaultWorkers),
+		QueueSize: positiveIntFromEnv("JOBS_QUEUE_SIZE", defaultQueueSize),
+		Retention: time.Duration(positiveIntFromEnv("JOBS_RETENTION_MS", defaultRetentionMs)) * time.Millisecond,
+		Timeout:   time.Duration(positiveIntFromEnv("JOBS_TIMEOUT_MS", defaultTimeoutMs)) * time.Millisecond,
+	}
+}
+
+// Manager queues jobs in submission order and runs them on a fixed pool of
+// workers. Workers start with the first submitted job.
+type Manager struct {
+	store  Store
+	run    Runner
+	config Config
+	now    func() time.Time
+
+	onFinish func(Job)
+
+	mu       sync.Mutex
+	ready    *sync.Cond
+	queue    []string
+	running  map[string]context.CancelFunc
+	canceled map[string]bool
+	closed   bool
+
+	start     sync.Once
+	base      context.Context
+	stop      context.CancelFunc
+	workers   sync.WaitGroup
+	callbacks sync.WaitGroup
+}
+
+func NewManager(store Store, run Runner, config Config) *Manager {
+	base, stop := context.WithCancel(context.Background())
+	m := &Manager{
+		store:    store,
+		run:      run,
+		config:   config,
+		now:      time.Now,
+		running:  make(map[string]context.CancelFunc),
+		canceled: make(map[string]bool),
+		base:     base,
+		stop:     stop,
+	}
+	m.ready = sync.NewCond(&m.mu)
+	return m
+}
+
+// OnFinish registers fn to be called, on its own goroutine, with each job
+// that reaches a terminal status; Close waits for these calls. It must be
+// set before the first Submit.
+func (m *Manager) OnFinish(fn func(Job)) {
+	m.onFinish = fn
+}
+
+// Submit stores job as queued and returns it with its ID and creation time.
+func (m *Manager) Submit(ctx context.Context, job Job) (Job, error) {
+	m.start.Do(m.startWorkers)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return Job{}, ErrManagerClosed
+	}
+	if len(m.queue) >= m.config.QueueSize {
+		metrics.RecordJobRejected()
+		return Job{}, ErrQueueFull
+	}
+
+	job.ID = uuid.NewString()
+	job.Status = StatusQueued
+	job.CreatedAt = m.now()
+	if err := m.store.Save(ctx, job); err != nil {
+		return Job{}, fmt.Errorf("save job: %w", err)
+	}
+	m.queue = append(m.queue, job.ID)
+	m.updateGaugesLocked()
+	m.ready.Signal()
+
+	log.Printf("request_id=%s tenant=%s component=jobs job_id=%s event=queued queue_depth=%d", job.RequestID, job.Tenant, job.ID, len(m.queue))
+	return job, nil
+}
+
+func (m *Manager) Get(ctx context.Context, id string) (Job, error) {
+	return m.store.Get(ctx, id)
+}
+
+// Cancel marks a queued or running job as canceled. A running job's context
+// is canceled; its worker is released once the task returns.
+func (m *Manager) Cancel(ctx context.Context, id string) (Job, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	job, err := m.store.Get(ctx, id)
+	if err != nil {
+		return Job{}, err
+	}
+	if job.Status.Finished() {
+		return job, ErrJobFinished
+	}
+
+	if cancel, ok := m.running[id]; ok {
+		m.canceled[id] = true
+		cancel()
+	} else {
+		m.removeQueuedLocked(id)
+	}
+	job.Status = StatusCanceled
+	job.FinishedAt = m.now()
+	if err := m.store.Save(ctx, job); err != nil {
+		return Job{}, fmt.Errorf("save job: %w", err)
+	}
+	m.updateGaugesLocked()
+	m.finishLocked(job)
+	return job, nil
+}
+
+// Close stops accepting jobs, cancels queued and running ones, and waits
+// for the workers and the OnFinish calls to return.
+func (m *Manager) Close() {
+	m.mu.Lock()
+	m.closed = true
+	m.stop()
+	for _, id := range m.queue {
+		m.cancelQueuedLocked(id)
+	}
+	m.queue = nil
+	m.updateGaugesLocked()
+	m.ready.Broadcast()
+	m.mu.Unlock()
+
+	m.workers.Wait()
+	m.callbacks.Wait()
+}
+
+func (m *Manager) cancelQueuedLocked(id string) {
+	// The base context is already canceled.
+	ctx := context.Background()
+	job, err := m.store.Get(ctx, id)
+	if err != nil {
+		log.Printf("component=jobs job_id=%s event=cancel_failed error=%q", id, err.Error())
+		return
+	}
+	job.Status = StatusCanceled
+	job.FinishedAt = m.now()
+	if err := m.store.Save(ctx, job); err != nil {
+		log.Printf("request_id=%s component=jobs job_id=%s event=save_failed error=%q", job.RequestID, job.ID, err.Error())
+	}
+	m.finishLocked(job)
+}
+
+func (m *Manager) startWorkers() {
+	for range max(m.config.Workers, 1) {
+		m.workers.Add(1)
+		go m.work()
+	}
+	go m.sweepEvery(min(m.config.Retention, maxSweepInterval))
+}
+
+func (m *Manager) work() {
+	defer m.workers.Done()
+	for {
+		job, ctx, ok := m.next()
+		if !ok {
+			return
+		}
+		response, apiErr := m.run(ctx, job)
+		m.complete(ctx, job, response, apiErr)
+	}
+}
+
+// next blocks until a queued job is available and marks it running.
+func (m *Manager) next() (Job, context.Context, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for {
+		for len(m.queue) == 0 && !m.closed {
+			m.ready.Wait()
+		}
+		if m.closed {
+			return Job{}, nil, false
+		}
+
+		id := m.queue[0]
+		m.queue = m.queue[1:]
+		job, err := m.store.Get(m.base, id)
+		if err != nil {
+			log.Printf("component=jobs job_id=%s event=dequeue_failed error=%q", id, err.Error())
+			m.updateGaugesLocked()
+			continue
+		}
+
+		job.Status = StatusRunning
+		job.StartedAt = m.now()
+		if err := m.store.Save(m.base, job); err != nil {
+			log.Printf("request_id=%s component=jobs job_id=%s event=save_failed error=%q", job.RequestID, job.ID, err.Error())
+		}
+		ctx := middleware.WithTenant(middleware.WithRequestID(m.base, job.RequestID), job.Tenant)
+		ctx, cancel := context.WithTimeout(ctx, m.config.Timeout)
+		m.running[id] = cancel
+		m.updateGaugesLocked()
+		return job, ctx, true
+	}
+}
+
+func (m *Manager) complete(ctx context.Context, job Job, response domain.TaskResponse, apiErr *domain.APIError) {
+	timedOut := errors.Is(ctx.Err(), context.DeadlineExceeded)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.running[job.ID]()
+	delete(m.running, job.ID)
+	m.updateGaugesLocked()
+	if m.canceled[job.ID] {
+		// Cancel already recorded the outcome.
+		delete(m.canceled, job.ID)
+		return
+	}
+
+	job.FinishedAt = m.now()
+	switch {
+	case timedOut:
+		job.Status = StatusFailed
+		job.Error = &domain.APIError{Code: "job_timeout", Message: fmt.Sprintf("job did not finish within %s", m.config.Timeout)}
+	case m.closed:
+		job.Status = StatusCanceled
+	case apiErr != nil:
+		job.Status = StatusFailed
+		job.Error = apiErr
+	default:
+		job.Status = StatusSucceeded
+		job.Result = &response
+	}
+	if err := m.store.Save(m.base, job); err != nil {
+		log.Printf("request_id=%s component=jobs job_id=%s event=save_failed error=%q", job.RequestID, job.ID, err.Error())
+	}
+	m.finishLocked(job)
+}
+
+func (m *Manager) finishLocked(job Job) {
+	age := job.FinishedAt.Sub(job.CreatedAt)
+	metrics.RecordJobOutcome(string(job.Status), age)
+
+	errorCode := "none"
+	if job.Error != nil {
+		errorCode = job.Error.Code
+	}
+	log.Printf(
+		"request_id=%s tenant=%s component=jobs job_id=%s status=%s error_code=%s age_ms=%d",
+		job.RequestID,
+		job.Tenant,
+		job.ID,
+		job.Status,
+		errorCode,
+		age.Milliseconds(),
+	)
+
+	if m.onFinish != nil {
+		m.callbacks.Add(1)
+		go func() {
+			defer m.callbacks.Done()
+			m.onFinish(job)
+		}()
+	}
+}
+
+func (m *Manager) removeQueuedLocked(id string) {
+	for i, queued := range m.queue {
+		if queued == id {
+			m.queue = append(m.queue[:i], m.queue[i+1:]...)
+			return
+		}
+	}
+}
+
+func (m *Manager) updateGaugesLocked() {
+	metrics.SetJobGauges(len(m.queue), len(m.running))
+}
+
+func (m *Manager) sweepEvery(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.base.Done():
+			return
+		case <-ticker.C:
+			m.sweep()
+		}
+	}
+}
+
+// sweep deletes jobs that finished more than Retention ago.
+func (m *Manager) sweep() {
+	removed, err := m.store.DeleteFinishedBefore(m.base, m.now().Add(-m.config.Retention))
+	if err != nil {
+		log.Printf("component=jobs event=sweep_failed error=%q", err.Error())
+		return
+	}
+	if removed > 0 {
+		log.Printf("component=jobs event=swept removed=%d", removed)
+	}
+}
+
+func positiveIntFromEnv(key string, fallback int) int {
+	value, err := strconv.Atoi(strings.TrimSpace(os.Getenv(key)))
+	if err != nil || value <= 0 {
+		return fallback
+	}
+	return value
+}
@@ -0,0 +1,228 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alanmaizon/homer/backend/internal/domain"
+	"github.com/alanmaizon/homer/backend/internal/middleware"
+)
+
+func newTestManager(t *testing.T, run Runner, config Config) *Manager {
+	t.Helper()
+	if config.Workers == 0 {
+		config.Workers = 1
+	}
+	if config.QueueSize == 0 {
+		config.QueueSize = 10
+	}
+	if config.Retention == 0 {
+		config.Retention = time.Hour
+	}
+	if config.Timeout == 0 {
+		config.Timeout = time.Minute
+	}
+	manager := NewManager(NewMemoryStore(), run, config)
+	t.Cleanup(manager.Close)
+	return manager
+}
+
+func waitForStatus(t *testing.T, manager *Manager, id string, want Status) Job {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		job, err := manager.Get(context.Background(), id)
+		if err != nil {
+			t.Fatalf("Get returned error: %v", err)
+		}
+		if job.Status == want {
+			return job
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job %s stayed %s, expected %s", id, job.Status, want)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestManagerRunsJobs(t *testing.T) {
+	manager := newTestManager(t, func(ctx context.Context, job Job) (domain.TaskResponse, *domain.APIError) {
+		if job.Request.Text == "fail" {
+			return domain.TaskResponse{}, &domain.APIError{Code: "internal_error", Message: "boom"}
+		}
+		return domain.TaskResponse{Result: job.Request.Text + " done", Metadata: domain.Metadata{RequestID: middleware.GetRequestIDFromContext(ctx)}}, nil
+	}, Config{})
+
+	ok, err := manager.Submit(context.Background(), Job{Request: domain.TaskRequest{Task: domain.TaskRewrite, Text: "draft"}, RequestID: "req-1"})
+	if err != nil {
+		t.Fatalf("Submit returned error: %v", err)
+	}
+	if ok.ID == "" || ok.CreatedAt.IsZero() {
+		t.Fatalf("expected ID and creation time, got %+v", ok)
+	}
+	failed, err := manager.Submit(context.Background(), Job{Request: domain.TaskRequest{Task: domain.TaskRewrite, Text: "fail"}})
+	if err != nil {
+		t.Fatalf("Submit returned error: %v", err)
+	}
+
+	job := waitForStatus(t, manager, ok.ID, StatusSucceeded)
+	if job.Result == nil || job.Result.Result != "draft done" || job.Result.Metadata.RequestID != "req-1" {
+		t.Fatalf("unexpected result %+v", job.Result)
+	}
+	if job.StartedAt.IsZero() || job.FinishedAt.IsZero() {
+		t.Fatalf("expected start and finish times, got %+v", job)
+	}
+
+	job = waitForStatus(t, manager, failed.ID, StatusFailed)
+	if job.Error == nil || job.Error.Code != "internal_error" || job.Result != nil {
+		t.Fatalf("unexpected failure %+v", job)
+	}
+}
+
+func TestManagerCancelsQueuedAndRunningJobs(t *testing.T) {
+	started := make(chan struct{})
+	returned := make(chan error, 1)
+	manager := newTestManager(t, func(ctx context.Context, _ Job) (domain.TaskResponse, *domain.APIError) {
+		close(started)
+		<-ctx.Done()
+		returned <- ctx.Err()
+		return domain.TaskResponse{}, &domain.APIError{Code: "internal_error", Message: ctx.Err().Error()}
+	}, Config{Workers: 1})
+
+	running, _ := manager.Submit(context.Background(), Job{})
+	<-started
+	queued, _ := manager.Submit(context.Background(), Job{})
+
+	job, err := manager.Cancel(context.Background(), queued.ID)
+	if err != nil || job.Status != StatusCanceled {
+		t.Fatalf("expected queued job to be canceled, got %+v err=%v", job, err)
+	}
+
+	job, err = manager.Cancel(context.Background(), running.ID)
+	if err != nil || job.Status != StatusCanceled {
+		t.Fatalf("expected running job to be canceled, got %+v err=%v", job, err)
+	}
+	if err := <-returned; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the task context to be canceled, got %v", err)
+	}
+
+	// The worker's completion must not overwrite the cancellation.
+	manager.mu.Lock()
+	idle := len(manager.running) == 0
+	manager.mu.Unlock()
+	for !idle {
+		time.Sleep(5 * time.Millisecond)
+		manager.mu.Lock()
+		idle = len(manager.running) == 0
+		manager.mu.Unlock()
+	}
+	if job, _ := manager.Get(context.Background(), running.ID); job.Status != StatusCanceled || job.Error != nil {
+		t.Fatalf("expected running job to stay canceled, got %+v", job)
+	}
+
+	if _, err := manager.Cancel(context.Background(), running.ID); !errors.Is(err, ErrJobFinished) {
+		t.Fatalf("expected ErrJobFinished, got %v", err)
+	}
+	if _, err := manager.Cancel(context.Background(), "missing"); !errors.Is(err, ErrJobNotFound) {
+		t.Fatalf("expected ErrJobNotFound, got %v", err)
+	}
+}
+
+func TestManagerCloseCancelsQueuedJobsAndWaitsForCallbacks(t *testing.T) {
+	started := make(chan struct{})
+	manager := NewManager(NewMemoryStore(), func(ctx context.Context, _ Job) (domain.TaskResponse, *domain.APIError) {
+		close(started)
+		<-ctx.Done()
+		return domain.TaskResponse{}, nil
+	}, Config{Workers: 1, QueueSize: 10, Retention: time.Hour, Timeout: time.Minute})
+	var (
+		mu       sync.Mutex
+		finished = make(map[string]Status)
+	)
+	manager.OnFinish(func(job Job) {
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		finished[job.ID] = job.Status
+		mu.Unlock()
+	})
+
+	running, _ := manager.Submit(context.Background(), Job{})
+	<-started
+	queued, _ := manager.Submit(context.Background(), Job{})
+	manager.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if finished[running.ID] != StatusCanceled || finished[queued.ID] != StatusCanceled {
+		t.Fatalf("expected Close to wait for both callbacks, got %v", finished)
+	}
+	if job, _ := manager.Get(context.Background(), queued.ID); job.Status != StatusCanceled || job.FinishedAt.IsZero() {
+		t.Fatalf("expected the queued job to be canceled, got %+v", job)
+	}
+}
+
+func TestManagerRejectsWhenQueueIsFull(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{}, 1)
+	manager := newTestManager(t, func(context.Context, Job) (domain.TaskResponse, *domain.APIError) {
+		started <- struct{}{}
+		<-release
+		return domain.TaskResponse{}, nil
+	}, Config{Workers: 1, QueueSize: 1})
+	defer close(release)
+
+	if _, err := manager.Submit(context.Background(), Job{}); err != nil {
+		t.Fatalf("Submit returned error: %v", err)
+	}
+	<-started
+	if _, err := manager.Submit(context.Background(), Job{}); err != nil {
+		t.Fatalf("Submit returned error: %v", err)
+	}
+	if _, err := manager.Submit(context.Background(), Job{}); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("expected ErrQueueFull, got %v", err)
+	}
+}
+
+func TestManagerTimesOutJobs(t *testing.T) {
+	manager := newTestManager(t, func(ctx context.Context, _ Job) (domain.TaskResponse, *domain.APIError) {
+		<-ctx.Done()
+		return domain.TaskResponse{}, &domain.APIError{Code: "internal_error", Message: ctx.Err().Error()}
+	}, Config{Timeout: 10 * time.Millisecond})
+
+	submitted, _ := manager.Submit(context.Background(), Job{})
+	job := waitForStatus(t, manager, submitted.ID, StatusFailed)
+	if job.Error == nil || job.Error.Code != "job_timeout" {
+		t.Fatalf("expected job_timeout, got %+v", job.Error)
+	}
+}
+
+func TestManagerSweepsExpiredJobs(t *testing.T) {
+	manager := newTestManager(t, func(context.Context, Job) (domain.TaskResponse, *domain.APIError) {
+		return domain.TaskResponse{}, nil
+	}, Config{Retention: time.Minute})
+
+	submitted, _ := manager.Submit(context.Background(), Job{})
+	job := waitForStatus(t, manager, submitted.ID, StatusSucceeded)
+
+	manager.now = func() time.Time { return job.FinishedAt.Add(30 * time.Second) }
+	manager.sweep()
+	if _, err := manager.Get(context.Background(), job.ID); err != nil {
+		t.Fatalf("expected job to be retained, got %v", err)
+	}
+
+	manager.now = func() time.Time { return job.FinishedAt.Add(2 * time.Minute) }
+	manager.sweep()
+	if _, err := manager.Get(context.Background(), job.ID); !errors.Is(err, ErrJobNotFound) {
+		t.Fatalf("expected job to be swept, got %v", err)
+	}
+}
+
+func TestNewStoreFromEnvRejectsUnknownBackends(t *testing.T) {
+	t.Setenv("JOBS_STORE", "postgres")
+	if _, err := NewStoreFromEnv(); err == nil {
+		t.Fatalf("expected an error for an unsupported store")
+	}
+}
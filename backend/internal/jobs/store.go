@@ -0,0 +1,74 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrJobNotFound is returned by stores for unknown or expired job IDs.
+var ErrJobNotFound = errors.New("job not found")
+
+// Store persists jobs. Implementations must be safe for concurrent use; the
+// Manager serializes state transitions itself.
+type Store interface {
+	Save(ctx context.Context, job Job) error
+	Get(ctx context.Context, id string) (Job, error)
+	// DeleteFinishedBefore removes finished jobs that completed before
+	// cutoff and reports how many were removed.
+	DeleteFinishedBefore(ctx context.Context, cutoff time.Time) (int, error)
+}
+
+// NewStoreFromEnv reads JOBS_STORE. Only "memory" (the default) is available.
+func NewStoreFromEnv() (Store, error) {
+	switch backend := strings.ToLower(strings.TrimSpace(os.Getenv("JOBS_STORE"))); backend {
+	case "", "memory":
+		return NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("unsupported JOBS_STORE %q", backend)
+	}
+}
+
+// MemoryStore keeps jobs in process memory; they are lost on restart.
+type MemoryStore struct {
+	mu   sync.RWMutex
+	jobs map[string]Job
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{jobs: make(map[string]Job)}
+}
+
+func (s *MemoryStore) Save(_ context.Context, job Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs[job.ID] = job
+	return nil
+}
+
+func (s *MemoryStore) Get(_ context.Context, id string) (Job, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	job, ok := s.jobs[id]
+	if !ok {
+		return Job{}, ErrJobNotFound
+	}
+	return job, nil
+}
+
+func (s *MemoryStore) DeleteFinishedBefore(_ context.Context, cutoff time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	removed := 0
+	for id, job := range s.jobs {
+		if job.Status.Finished() && job.FinishedAt.Before(cutoff) {
+			delete(s.jobs, id)
+			removed++
+		}
+	}
+	return removed, nil
+}
@@ -0,0 +1,132 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+const (
+	defaultAzureOpenAIAPIVersion = "2024-10-21"
+	defaultAzureAuthorityHost    = "https://login.microsoftonline.com"
+	azureCognitiveServicesScope  = "https://cognitiveservices.azure.com/.default"
+)
+
+// AzureOpenAIProvider routes chat completions to an Azure OpenAI deployment.
+// Request execution, retries and response parsing are shared with
+// OpenAIProvider; only the URL shape and authentication differ, and both are
+// settled when the provider is built.
+type AzureOpenAIProvider struct {
+	*OpenAIProvider
+}
+
+func NewAzureOpenAIProviderFromEnv() (*AzureOpenAIProvider, error) {
+	baseURL := strings.TrimSpace(os.Getenv("AZURE_OPENAI_ENDPOINT"))
+	if baseURL == "" {
+		if resource := strings.TrimSpace(os.Getenv("AZURE_OPENAI_RESOURCE")); resource != "" {
+			baseURL = "https://" + resource + ".openai.azure.com"
+		}
+	}
+	if baseURL == "" {
+		return nil, errors.New("AZURE_OPENAI_ENDPOINT (or AZURE_OPENAI_RESOURCE) is required")
+	}
+
+	deployment := strings.TrimSpace(os.Getenv("AZURE_OPENAI_DEPLOYMENT"))
+	if deployment == "" {
+		return nil, errors.New("AZURE_OPENAI_DEPLOYMENT is required")
+	}
+
+	apiVersion := strings.TrimSpace(os.Getenv("AZURE_OPENAI_API_VERSION"))
+	if apiVersion == "" {
+		apiVersion = defaultAzureOpenAIAPIVersion
+	}
+
+	endpoint, err := azureChatCompletionsEndpoint(baseURL, deployment, apiVersion)
+	if err != nil {
+		return nil, fmt.Errorf("AZURE_OPENAI_ENDPOINT is invalid: %w", err)
+	}
+
+	policy := loadRuntimePolicyFromEnv()
+	provider := &OpenAIProvider{
+		name:     "azure_openai",
+		endpoint: endpoint,
+		model:    deployment,
+		client:   http.DefaultClient,
+		timeout:  policy.timeout,
+		retry:    newRetryPolicy(policy),
+	}
+
+	if err := configureAzureAuthFromEnv(provider); err != nil {
+		return nil, err
+	}
+
+	return &AzureOpenAIProvider{OpenAIProvider: provider}, nil
+}
+
+func azureChatCompletionsEndpoint(baseURL string, deployment string, apiVersion string) (string, error) {
+	parsed, err := url.Parse(strings.TrimSpace(baseURL))
+	if err != nil {
+		return "", err
+	}
+	if parsed.Scheme != "https" && parsed.Scheme != "http" {
+		return "", fmt.Errorf("unsupported scheme %q", parsed.Scheme)
+	}
+	if parsed.Host == "" {
+		return "", errors.New("host is required")
+	}
+
+	parsed.Path = strings.TrimRight(parsed.Path, "/") + "/openai/deployments/" + url.PathEscape(deployment) + chatCompletionsPath
+	parsed.RawQuery = url.Values{"api-version": []string{apiVersion}}.Encode()
+
+	return parsed.String(), nil
+}
+
+// configureAzureAuthFromEnv selects api-key auth when AZURE_OPENAI_API_KEY is
+// set, otherwise a Microsoft Entra bearer token: either a pre-issued
+// AZURE_OPENAI_AD_TOKEN or client credentials for a service principal.
+func configureAzureAuthFromEnv(provider *OpenAIProvider) error {
+	if apiKey := strings.TrimSpace(os.Getenv("AZURE_OPENAI_API_KEY")); apiKey != "" {
+		provider.apiKey = apiKey
+		provider.authScheme = authSchemeHeader
+		provider.authHeader = "Api-Key"
+		return nil
+	}
+
+	if token := strings.TrimSpace(os.Getenv("AZURE_OPENAI_AD_TOKEN")); token != "" {
+		provider.authScheme = authSchemeOAuth
+		provider.tokenSource = oauth2.StaticTokenSource(&oauth2.Token{
+			AccessToken: token,
+			TokenType:   "Bearer",
+		})
+		return nil
+	}
+
+	tenantID := strings.TrimSpace(os.Getenv("AZURE_TENANT_ID"))
+	clientID := strings.TrimSpace(os.Getenv("AZURE_CLIENT_ID"))
+	clientSecret := strings.TrimSpace(os.Getenv("AZURE_CLIENT_SECRET"))
+	if tenantID == "" || clientID == "" || clientSecret == "" {
+		return errors.New("AZURE_OPENAI_API_KEY, AZURE_OPENAI_AD_TOKEN, or AZURE_TENANT_ID/AZURE_CLIENT_ID/AZURE_CLIENT_SECRET is required")
+	}
+
+	authorityHost := strings.TrimRight(strings.TrimSpace(os.Getenv("AZURE_AUTHORITY_HOST")), "/")
+	if authorityHost == "" {
+		authorityHost = defaultAzureAuthorityHost
+	}
+
+	config := &clientcredentials.Config{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		TokenURL:     authorityHost + "/" + url.PathEscape(tenantID) + "/oauth2/v2.0/token",
+		Scopes:       []string{azureCognitiveServicesScope},
+	}
+	provider.authScheme = authSchemeOAuth
+	provider.tokenSource = config.TokenSource(context.Background())
+	return nil
+}
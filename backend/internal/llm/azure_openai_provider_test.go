@@ -0,0 +1,165 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/alanmaizon/homer/backend/internal/domain"
+)
+
+func setAzureOpenAIEnvForTest(t *testing.T, endpoint string) {
+	t.Helper()
+	t.Setenv("AZURE_OPENAI_ENDPOINT", endpoint)
+	t.Setenv("AZURE_OPENAI_RESOURCE", "")
+	t.Setenv("AZURE_OPENAI_DEPLOYMENT", "gpt-4o-prod")
+	t.Setenv("AZURE_OPENAI_API_VERSION", "")
+	t.Setenv("AZURE_OPENAI_API_KEY", "")
+	t.Setenv("AZURE_OPENAI_AD_TOKEN", "")
+	t.Setenv("AZURE_TENANT_ID", "")
+	t.Setenv("AZURE_CLIENT_ID", "")
+	t.Setenv("AZURE_CLIENT_SECRET", "")
+	t.Setenv("AZURE_AUTHORITY_HOST", "")
+}
+
+func TestAzureOpenAIProviderAPIKeyRouting(t *testing.T) {
+	var gotPath, gotVersion, gotKey, gotAuth string
+	server := newFakeChatCompletionServer(t, func(w http.ResponseWriter, r *http.Request, _ fakeChatCompletionRequest) {
+		gotPath = r.URL.Path
+		gotVersion = r.URL.Query().Get("api-version")
+		gotKey = r.Header.Get("api-key")
+		gotAuth = r.Header.Get("Authorization")
+		writeFakeChatCompletion(w, "azure rewrite")
+	})
+	setAzureOpenAIEnvForTest(t, server.URL)
+	t.Setenv("AZURE_OPENAI_API_KEY", "azure-key")
+
+	provider, err := NewAzureOpenAIProviderFromEnv()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if provider.Name() != "azure_openai" {
+		t.Fatalf("unexpected provider name %q", provider.Name())
+	}
+
+	result, err := provider.Rewrite(context.Background(), "text", "simplify", "", domain.GenerationParams{})
+	if err != nil {
+		t.Fatalf("Rewrite returned error: %v", err)
+	}
+	if result != "azure rewrite" {
+		t.Fatalf("unexpected result %q", result)
+	}
+	if gotPath != "/openai/deployments/gpt-4o-prod/chat/completions" {
+		t.Fatalf("unexpected path %q", gotPath)
+	}
+	if gotVersion != defaultAzureOpenAIAPIVersion {
+		t.Fatalf("unexpected api-version %q", gotVersion)
+	}
+	if gotKey != "azure-key" || gotAuth != "" {
+		t.Fatalf("expected api-key auth only, got api-key=%q Authorization=%q", gotKey, gotAuth)
+	}
+}
+
+func TestAzureOpenAIProviderEntraClientCredentials(t *testing.T) {
+	tokenRequests := 0
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokenRequests++
+		if r.URL.Path != "/tenant-1/oauth2/v2.0/token" {
+			http.Error(w, "unexpected path", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"access_token": "entra-token",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+		})
+	}))
+	defer tokenServer.Close()
+
+	var gotAuth string
+	server := newFakeChatCompletionServer(t, func(w http.ResponseWriter, r *http.Request, _ fakeChatCompletionRequest) {
+		gotAuth = r.Header.Get("Authorization")
+		writeFakeChatCompletion(w, "ok")
+	})
+	setAzureOpenAIEnvForTest(t, server.URL)
+	t.Setenv("AZURE_TENANT_ID", "tenant-1")
+	t.Setenv("AZURE_CLIENT_ID", "client-1")
+	t.Setenv("AZURE_CLIENT_SECRET", "secret-1")
+	t.Setenv("AZURE_AUTHORITY_HOST", tokenServer.URL)
+
+	provider, err := NewAzureOpenAIProviderFromEnv()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := provider.Rewrite(context.Background(), "text", "simplify", "", domain.GenerationParams{}); err != nil {
+			t.Fatalf("Rewrite returned error: %v", err)
+		}
+	}
+	if gotAuth != "Bearer entra-token" {
+		t.Fatalf("unexpected Authorization header %q", gotAuth)
+	}
+	if tokenRequests != 1 {
+		t.Fatalf("expected cached token to be reused, got %d token requests", tokenRequests)
+	}
+}
+
+func TestAzureOpenAIProviderContentFilter(t *testing.T) {
+	testCases := []struct {
+		name   string
+		handle func(w http.ResponseWriter)
+	}{
+		{
+			name: "prompt_rejected",
+			handle: func(w http.ResponseWriter) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(`{"error":{"code":"content_filter","message":"The response was filtered"}}`))
+			},
+		},
+		{
+			name: "completion_filtered",
+			handle: func(w http.ResponseWriter) {
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = w.Write([]byte(`{"choices":[{"message":{"content":""},"finish_reason":"content_filter"}]}`))
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			server := newFakeChatCompletionServer(t, func(w http.ResponseWriter, _ *http.Request, _ fakeChatCompletionRequest) {
+				tc.handle(w)
+			})
+			setAzureOpenAIEnvForTest(t, server.URL)
+			t.Setenv("AZURE_OPENAI_AD_TOKEN", "static-token")
+
+			provider, err := NewAzureOpenAIProviderFromEnv()
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			_, err = provider.Rewrite(context.Background(), "text", "simplify", "", domain.GenerationParams{})
+			if !errors.Is(err, ErrContentFiltered) {
+				t.Fatalf("expected ErrContentFiltered, got %v", err)
+			}
+			if category := providerErrorCategory(err); category != "content_filtered" {
+				t.Fatalf("expected content_filtered category, got %q", category)
+			}
+		})
+	}
+}
+
+func TestNewAzureOpenAIProviderFromEnvRequiresAuth(t *testing.T) {
+	setAzureOpenAIEnvForTest(t, "")
+	t.Setenv("AZURE_OPENAI_RESOURCE", "contoso")
+
+	if _, err := NewAzureOpenAIProviderFromEnv(); err == nil {
+		t.Fatalf("expected missing credentials error")
+	}
+}
@@ -0,0 +1,117 @@
+package llm
+
+import (
+	"context"
+	"sync"
+)
+
+type callInfoContextToken struct{}
+
+// CallInfo collects details about how providers served a request so callers
+// can surface them in response metadata.
+type CallInfo struct {
+	mu             sync.Mutex
+	promptTemplate string
+	promptVersion  string
+	safetyRatings  []SafetyRating
+	providerCalled bool
+	toolLoopTokens int
+}
+
+// SafetyRating is a provider-reported harm rating for the prompt (stage
+// "input") or the generated text (stage "output").
+type SafetyRating struct {
+	Stage       string
+	Category    string
+	Probability string
+	Blocked     bool
+}
+
+// WithCallInfo attaches an empty CallInfo to ctx for providers to fill in.
+// When ctx already carries one it is returned instead, so a caller can read
+// what providers recorded for work it delegates.
+func WithCallInfo(ctx context.Context) (context.Context, *CallInfo) {
+	if info := callInfoFromContext(ctx); info != nil {
+		return ctx, info
+	}
+	info := &CallInfo{}
+	return context.WithValue(ctx, callInfoContextToken{}, info), info
+}
+
+func callInfoFromContext(ctx context.Context) *CallInfo {
+	if ctx == nil {
+		return nil
+	}
+	info, _ := ctx.Value(callInfoContextToken{}).(*CallInfo)
+	return info
+}
+
+func (i *CallInfo) setPrompt(template string, version string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.promptTemplate = template
+	i.promptVersion = version
+}
+
+// Prompt returns the template name and version of the last rendered prompt.
+func (i *CallInfo) Prompt() (template string, version string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	return i.promptTemplate, i.promptVersion
+}
+
+func (i *CallInfo) markProviderCalled() {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.providerCalled = true
+}
+
+// ProviderCalled reports whether any provider call was started, as opposed
+// to the request failing before one was made.
+func (i *CallInfo) ProviderCalled() bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	return i.providerCalled
+}
+
+// AddToolLoopTokens records estimated tokens spent by tool loop turns beyond
+// the request prompt and the final answer.
+func (i *CallInfo) AddToolLoopTokens(tokens int) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.toolLoopTokens += tokens
+}
+
+// ToolLoopTokens returns the tokens recorded with AddToolLoopTokens.
+func (i *CallInfo) ToolLoopTokens() int {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	return i.toolLoopTokens
+}
+
+// AddSafetyRatings records provider safety ratings for the current request.
+func (i *CallInfo) AddSafetyRatings(ratings ...SafetyRating) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.safetyRatings = append(i.safetyRatings, ratings...)
+}
+
+// SafetyRatingsFromContext returns the safety ratings providers recorded on
+// the CallInfo attached to ctx.
+func SafetyRatingsFromContext(ctx context.Context) []SafetyRating {
+	info := callInfoFromContext(ctx)
+	if info == nil {
+		return nil
+	}
+
+	info.mu.Lock()
+	defer info.mu.Unlock()
+	return append([]SafetyRating(nil), info.safetyRatings...)
+}
@@ -0,0 +1,424 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alanmaizon/homer/backend/internal/domain"
+	"github.com/alanmaizon/homer/backend/internal/metrics"
+	"github.com/alanmaizon/homer/backend/internal/middleware"
+)
+
+type ChaosFault string
+
+const (
+	ChaosFaultNone        ChaosFault = "none"
+	ChaosFaultLatency     ChaosFault = "latency"
+	ChaosFaultTimeout     ChaosFault = "timeout"
+	ChaosFaultRateLimit   ChaosFault = "rate_limit"
+	ChaosFaultServerError ChaosFault = "server_error"
+	ChaosFaultEmpty       ChaosFault = "empty"
+	ChaosFaultTruncate    ChaosFault = "truncate"
+)
+
+// chaosFaultOrder fixes the order probabilities are accumulated in, so a
+// seeded run always picks the same faults.
+var chaosFaultOrder = []ChaosFault{
+	ChaosFaultLatency,
+	ChaosFaultTimeout,
+	ChaosFaultRateLimit,
+	ChaosFaultServerError,
+	ChaosFaultEmpty,
+	ChaosFaultTruncate,
+}
+
+// ChaosConfig describes the faults injected per provider attempt. Rates are
+// probabilities in [0, 1] whose sum may not exceed 1. Schedule lists faults
+// to inject in order before falling back to the rates.
+type ChaosConfig struct {
+	Rates        map[ChaosFault]float64 `json:"rates,omitempty"`
+	Schedule     []ChaosFault           `json:"schedule,omitempty"`
+	LatencyMs    int                    `json:"latencyMs,omitempty"`
+	TimeoutMs    int                    `json:"timeoutMs,omitempty"`
+	RetryAfterMs int                    `json:"retryAfterMs,omitempty"`
+	Seed         uint64                 `json:"seed,omitempty"`
+}
+
+func (c ChaosConfig) Validate() error {
+	total := 0.0
+	for fault, rate := range c.Rates {
+		if !isChaosFault(fault) || fault == ChaosFaultNone {
+			return fmt.Errorf("unknown chaos fault %q", fault)
+		}
+		if rate < 0 || rate > 1 {
+			return fmt.Errorf("chaos rate for %s must be between 0 and 1", fault)
+		}
+		total += rate
+	}
+	if total > 1 {
+		return errors.New("chaos rates must sum to at most 1")
+	}
+	for _, fault := range c.Schedule {
+		if !isChaosFault(fault) {
+			return fmt.Errorf("unknown chaos fault %q in schedule", fault)
+		}
+	}
+	if c.LatencyMs < 0 || c.TimeoutMs < 0 || c.RetryAfterMs < 0 {
+		return errors.New("chaos durations must not be negative")
+	}
+	return nil
+}
+
+func isChaosFault(fault ChaosFault) bool {
+	return fault == ChaosFaultNone || containsChaosFault(chaosFaultOrder, fault)
+}
+
+func containsChaosFault(faults []ChaosFault, fault ChaosFault) bool {
+	for _, candidate := range faults {
+		if candidate == fault {
+			return true
+		}
+	}
+	return false
+}
+
+// loadChaosConfigFromEnv reads CHAOS_ENABLED and the CHAOS_* settings. It
+// reports false when chaos is not enabled.
+func loadChaosConfigFromEnv() (ChaosConfig, bool, error) {
+	enabled, _ := strconv.ParseBool(strings.TrimSpace(os.Getenv("CHAOS_ENABLED")))
+	if !enabled {
+		return ChaosConfig{}, false, nil
+	}
+
+	config := ChaosConfig{Rates: make(map[ChaosFault]float64)}
+	for _, fault := range chaosFaultOrder {
+		key := "CHAOS_" + strings.ToUpper(string(fault)) + "_RATE"
+		raw := strings.TrimSpace(os.Getenv(key))
+		if raw == "" {
+			continue
+		}
+		rate, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return ChaosConfig{}, true, fmt.Errorf("%s: %w", key, err)
+		}
+		config.Rates[fault] = rate
+	}
+	for _, raw := range strings.Split(os.Getenv("CHAOS_SCHEDULE"), ",") {
+		if fault := strings.TrimSpace(raw); fault != "" {
+			config.Schedule = append(config.Schedule, ChaosFault(fault))
+		}
+	}
+
+	for key, target := range map[string]*int{
+		"CHAOS_LATENCY_MS":     &config.LatencyMs,
+		"CHAOS_TIMEOUT_MS":     &config.TimeoutMs,
+		"CHAOS_RETRY_AFTER_MS": &config.RetryAfterMs,
+	} {
+		if raw := strings.TrimSpace(os.Getenv(key)); raw != "" {
+			value, err := strconv.Atoi(raw)
+			if err != nil {
+				return ChaosConfig{}, true, fmt.Errorf("%s: %w", key, err)
+			}
+			*target = value
+		}
+	}
+	if raw := strings.TrimSpace(os.Getenv("CHAOS_SEED")); raw != "" {
+		seed, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			return ChaosConfig{}, true, fmt.Errorf("CHAOS_SEED: %w", err)
+		}
+		config.Seed = seed
+	}
+
+	return config, true, config.Validate()
+}
+
+// withChaosFromEnv wraps provider with fault injection when CHAOS_ENABLED is
+// set. An invalid configuration is logged and ignored.
+func withChaosFromEnv(provider LLMProvider) LLMProvider {
+	config, enabled, err := loadChaosConfigFromEnv()
+	if !enabled {
+		return provider
+	}
+	if err != nil {
+		log.Printf("component=chaos event=disabled error=%q", err.Error())
+		return provider
+	}
+	return newChaosProvider(provider, config, realProviderClock{})
+}
+
+// ChaosProvider injects latency, timeouts, 429/5xx errors, empty responses
+// and truncated output in front of another provider. Injected errors go
+// through the shared retry policy and provider metrics exactly like real
+// upstream failures.
+type ChaosProvider struct {
+	LLMProvider
+	clock  providerClock
+	policy runtimePolicy
+
+	mu       sync.Mutex
+	config   ChaosConfig
+	random   *rand.Rand
+	position int
+}
+
+func newChaosProvider(provider LLMProvider, config ChaosConfig, clock providerClock) *ChaosProvider {
+	chaos := &ChaosProvider{
+		LLMProvider: provider,
+		clock:       clock,
+		policy:      loadRuntimePolicyFromEnv(),
+	}
+	chaos.configure(config)
+	return chaos
+}
+
+func (c *ChaosProvider) configure(config ChaosConfig) {
+	seed := config.Seed
+	if seed == 0 {
+		seed = rand.Uint64()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.config = config
+	c.random = rand.New(rand.NewPCG(seed, seed))
+	c.position = 0
+}
+
+// Config returns the active fault configuration.
+func (c *ChaosProvider) Config() ChaosConfig {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.config
+}
+
+// Unwrap returns the wrapped provider.
+func (c *ChaosProvider) Unwrap() LLMProvider {
+	return c.LLMProvider
+}
+
+func (c *ChaosProvider) Summarize(ctx context.Context, docs []domain.Document, style string, instructions string, params domain.GenerationParams) (string, error) {
+	return c.run(ctx, "summarize", func() (string, error) {
+		return c.LLMProvider.Summarize(ctx, docs, style, instructions, params)
+	})
+}
+
+func (c *ChaosProvider) Rewrite(ctx context.Context, text string, mode string, instructions string, params domain.GenerationParams) (string, error) {
+	return c.run(ctx, "rewrite", func() (string, error) {
+		return c.LLMProvider.Rewrite(ctx, text, mode, instructions, params)
+	})
+}
+
+func (c *ChaosProvider) Generate(ctx context.Context, messages []Message, params domain.GenerationParams) (string, error) {
+	return c.run(ctx, "generate", func() (string, error) {
+		return c.LLMProvider.Generate(ctx, messages, params)
+	})
+}
+
+func (c *ChaosProvider) supportsTools() bool {
+	return supportsTools(c.LLMProvider)
+}
+
+func (c *ChaosProvider) GenerateWithTools(ctx context.Context, messages []Message, tools []ToolDefinition, params domain.GenerationParams) (ToolTurn, error) {
+	caller, err := ToolCallerFor(c.LLMProvider)
+	if err != nil {
+		return ToolTurn{}, err
+	}
+	return runChaos(c, ctx, "generate_with_tools", func() (ToolTurn, error) {
+		return caller.GenerateWithTools(ctx, messages, tools, params)
+	}, func(turn ToolTurn, fault ChaosFault) ToolTurn {
+		switch fault {
+		case ChaosFaultEmpty:
+			return ToolTurn{}
+		case ChaosFaultTruncate:
+			turn.Text = truncateForChaos(turn.Text)
+		}
+		return turn
+	})
+}
+
+func (c *ChaosProvider) supportsEmbeddings() bool {
+	return supportsEmbeddings(c.LLMProvider)
+}
+
+func (c *ChaosProvider) EmbeddingModel() string {
+	return embeddingModelOf(c.LLMProvider)
+}
+
+func (c *ChaosProvider) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	embedder, err := EmbedderFor(c.LLMProvider)
+	if err != nil {
+		return nil, err
+	}
+	return runChaos(c, ctx, "embed", func() ([][]float32, error) {
+		return embedder.Embed(ctx, texts)
+	}, func(vectors [][]float32, fault ChaosFault) [][]float32 {
+		switch fault {
+		case ChaosFaultEmpty:
+			return nil
+		case ChaosFaultTruncate:
+			return vectors[:len(vectors)/2]
+		}
+		return vectors
+	})
+}
+
+func (c *ChaosProvider) run(ctx context.Context, operation string, call func() (string, error)) (string, error) {
+	return runChaos(c, ctx, operation, call, func(result string, fault ChaosFault) string {
+		switch fault {
+		case ChaosFaultEmpty:
+			return ""
+		case ChaosFaultTruncate:
+			return truncateForChaos(result)
+		}
+		return result
+	})
+}
+
+// runChaos injects the next fault around call. Error faults go through the
+// retry policy without reaching call; degrade applies the empty and truncate
+// faults to a successful result.
+func runChaos[T any](c *ChaosProvider, ctx context.Context, operation string, call func() (T, error), degrade func(T, ChaosFault) T) (T, error) {
+	var zero T
+	retry := c.retryPolicy().start(ctx, c.Name())
+	for {
+		fault, config := c.nextFault()
+		if fault != ChaosFaultNone {
+			metrics.RecordChaosFault(c.Name(), operation, string(fault))
+			log.Printf(
+				"request_id=%s component=chaos provider=%s operation=%s fault=%s",
+				middleware.GetRequestIDFromContext(ctx),
+				c.Name(),
+				operation,
+				fault,
+			)
+		}
+
+		switch fault {
+		case ChaosFaultTimeout, ChaosFaultRateLimit, ChaosFaultServerError:
+			_, err := observeProviderOperation(ctx, c.Name(), operation, func() (T, error) {
+				return zero, c.injectError(ctx, fault, config)
+			})
+			if err := retry.wait(ctx, err); err != nil {
+				return zero, err
+			}
+			continue
+		case ChaosFaultLatency:
+			if err := c.clock.Sleep(ctx, time.Duration(config.LatencyMs)*time.Millisecond); err != nil {
+				return zero, err
+			}
+		}
+
+		result, err := call()
+		if err != nil {
+			return zero, err
+		}
+		return degrade(result, fault), nil
+	}
+}
+
+func (c *ChaosProvider) injectError(ctx context.Context, fault ChaosFault, config ChaosConfig) error {
+	switch fault {
+	case ChaosFaultTimeout:
+		timeout := time.Duration(config.TimeoutMs) * time.Millisecond
+		if timeout <= 0 {
+			timeout = c.policy.timeout
+		}
+		if err := c.clock.Sleep(ctx, timeout); err != nil {
+			return err
+		}
+		return fmt.Errorf("chaos: %w", context.DeadlineExceeded)
+	case ChaosFaultRateLimit:
+		return &providerHTTPError{
+			provider:   c.Name(),
+			statusCode: 429,
+			message:    "chaos: injected rate limit",
+			retryAfter: time.Duration(config.RetryAfterMs) * time.Millisecond,
+		}
+	default:
+		return &providerHTTPError{provider: c.Name(), statusCode: 503, message: "chaos: injected server error"}
+	}
+}
+
+func (c *ChaosProvider) retryPolicy() retryPolicy {
+	policy := newRetryPolicy(c.policy)
+	policy.clock = c.clock
+	return policy
+}
+
+// nextFault takes the next scheduled fault, or rolls against the rates once
+// the schedule is used up.
+func (c *ChaosProvider) nextFault() (ChaosFault, ChaosConfig) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.position < len(c.config.Schedule) {
+		fault := c.config.Schedule[c.position]
+		c.position++
+		return fault, c.config
+	}
+
+	roll := c.random.Float64()
+	cumulative := 0.0
+	for _, fault := range chaosFaultOrder {
+		cumulative += c.config.Rates[fault]
+		if roll < cumulative {
+			return fault, c.config
+		}
+	}
+	return ChaosFaultNone, c.config
+}
+
+func truncateForChaos(result string) string {
+	runes := []rune(result)
+	return string(runes[:len(runes)/2])
+}
+
+// EnableChaos wraps the current provider with fault injection, or updates the
+// configuration when it is already wrapped.
+func EnableChaos(config ChaosConfig) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+
+	providerMu.Lock()
+	defer providerMu.Unlock()
+
+	if chaos, ok := currentProvider.(*ChaosProvider); ok {
+		chaos.configure(config)
+		return nil
+	}
+	currentProvider = newChaosProvider(currentProvider, config, realProviderClock{})
+	log.Printf("component=chaos event=enabled provider=%s", currentProvider.Name())
+	return nil
+}
+
+// DisableChaos removes fault injection from the current provider.
+func DisableChaos() {
+	providerMu.Lock()
+	defer providerMu.Unlock()
+
+	if chaos, ok := currentProvider.(*ChaosProvider); ok {
+		currentProvider = chaos.LLMProvider
+		log.Printf("component=chaos event=disabled provider=%s", currentProvider.Name())
+	}
+}
+
+// CurrentChaosConfig reports the active fault configuration, if any.
+func CurrentChaosConfig() (ChaosConfig, bool) {
+	providerMu.RLock()
+	defer providerMu.RUnlock()
+
+	if chaos, ok := currentProvider.(*ChaosProvider); ok {
+		return chaos.Config(), true
+	}
+	return ChaosConfig{}, false
+}
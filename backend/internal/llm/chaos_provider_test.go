@@ -0,0 +1,187 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alanmaizon/homer/backend/internal/domain"
+	"github.com/alanmaizon/homer/backend/internal/metrics"
+)
+
+func newChaosProviderForTest(t *testing.T, config ChaosConfig) (*ChaosProvider, *fakeClock) {
+	t.Helper()
+	t.Setenv("LLM_MAX_RETRIES", "2")
+	t.Setenv("LLM_TIMEOUT_MS", "1000")
+	t.Setenv("LLM_RETRY_BUDGET_MS", "")
+
+	clock := newFakeClock()
+	return newChaosProvider(NewMockProvider(), config, clock), clock
+}
+
+func TestChaosProviderScheduledFaultsFlowThroughRetries(t *testing.T) {
+	metrics.ResetForTests()
+	chaos, clock := newChaosProviderForTest(t, ChaosConfig{
+		Schedule:     []ChaosFault{ChaosFaultRateLimit, ChaosFaultServerError},
+		RetryAfterMs: 1500,
+	})
+
+	result, err := chaos.Rewrite(context.Background(), "hello", "simplify", "", domain.GenerationParams{})
+	if err != nil {
+		t.Fatalf("Rewrite returned error: %v", err)
+	}
+	if result != "[mock rewrite:simplify] hello" {
+		t.Fatalf("unexpected result %q", result)
+	}
+	if len(clock.sleeps) != 2 || clock.sleeps[0] < 1500*time.Millisecond {
+		t.Fatalf("expected two retry waits honoring Retry-After, got %v", clock.sleeps)
+	}
+
+	output := metrics.PrometheusText()
+	for _, want := range []string{
+		`homer_provider_requests_total{provider="mock",operation="rewrite",status="error",error_category="rate_limited"} 1`,
+		`homer_provider_requests_total{provider="mock",operation="rewrite",status="error",error_category="http_5xx"} 1`,
+		`homer_provider_requests_total{provider="mock",operation="rewrite",status="success",error_category="none"} 1`,
+		`homer_chaos_faults_total{provider="mock",operation="rewrite",fault="rate_limit"} 1`,
+	} {
+		if !strings.Contains(output, want) {
+			t.Fatalf("expected metrics to contain %q\n%s", want, output)
+		}
+	}
+}
+
+func TestChaosProviderExhaustsRetries(t *testing.T) {
+	chaos, _ := newChaosProviderForTest(t, ChaosConfig{Rates: map[ChaosFault]float64{ChaosFaultServerError: 1}})
+
+	_, err := chaos.Summarize(context.Background(), []domain.Document{{Content: "x"}}, "bullet", "", domain.GenerationParams{})
+	var httpErr *providerHTTPError
+	if !errors.As(err, &httpErr) || httpErr.statusCode != 503 {
+		t.Fatalf("expected injected 503 after retries, got %v", err)
+	}
+}
+
+func TestChaosProviderTimeoutAndOutputFaults(t *testing.T) {
+	chaos, clock := newChaosProviderForTest(t, ChaosConfig{
+		Schedule:  []ChaosFault{ChaosFaultTimeout, ChaosFaultNone, ChaosFaultEmpty, ChaosFaultTruncate, ChaosFaultLatency},
+		LatencyMs: 250,
+	})
+	ctx := context.Background()
+
+	if _, err := chaos.Rewrite(ctx, "abcd", "m", "", domain.GenerationParams{}); err != nil {
+		t.Fatalf("expected timeout to be retried, got %v", err)
+	}
+	if len(clock.sleeps) == 0 || clock.sleeps[0] != time.Second {
+		t.Fatalf("expected injected timeout to wait LLM_TIMEOUT_MS, got %v", clock.sleeps)
+	}
+
+	if result, _ := chaos.Rewrite(ctx, "abcd", "m", "", domain.GenerationParams{}); result != "" {
+		t.Fatalf("expected empty response, got %q", result)
+	}
+	if result, _ := chaos.Rewrite(ctx, "abcd", "m", "", domain.GenerationParams{}); result != "[mock rewr" {
+		t.Fatalf("expected truncated response, got %q", result)
+	}
+
+	sleeps := len(clock.sleeps)
+	if _, err := chaos.Rewrite(ctx, "abcd", "m", "", domain.GenerationParams{}); err != nil {
+		t.Fatalf("latency fault returned error: %v", err)
+	}
+	if len(clock.sleeps) != sleeps+1 || clock.sleeps[sleeps] != 250*time.Millisecond {
+		t.Fatalf("expected 250ms injected latency, got %v", clock.sleeps)
+	}
+}
+
+func TestChaosProviderSeededRatesAreDeterministic(t *testing.T) {
+	config := ChaosConfig{Rates: map[ChaosFault]float64{ChaosFaultEmpty: 0.5}, Seed: 42}
+	first, _ := newChaosProviderForTest(t, config)
+	second, _ := newChaosProviderForTest(t, config)
+
+	for i := 0; i < 20; i++ {
+		a, _ := first.nextFault()
+		b, _ := second.nextFault()
+		if a != b {
+			t.Fatalf("roll %d differs: %s vs %s", i, a, b)
+		}
+	}
+}
+
+func TestChaosConfigValidate(t *testing.T) {
+	testCases := []struct {
+		name   string
+		config ChaosConfig
+	}{
+		{name: "unknown_fault", config: ChaosConfig{Rates: map[ChaosFault]float64{"meteor": 0.1}}},
+		{name: "rate_out_of_range", config: ChaosConfig{Rates: map[ChaosFault]float64{ChaosFaultTimeout: 1.5}}},
+		{name: "rates_over_one", config: ChaosConfig{Rates: map[ChaosFault]float64{ChaosFaultTimeout: 0.6, ChaosFaultEmpty: 0.6}}},
+		{name: "bad_schedule", config: ChaosConfig{Schedule: []ChaosFault{"explode"}}},
+		{name: "negative_latency", config: ChaosConfig{LatencyMs: -1}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := tc.config.Validate(); err == nil {
+				t.Fatalf("expected validation error")
+			}
+		})
+	}
+}
+
+func TestLoadChaosConfigFromEnv(t *testing.T) {
+	t.Setenv("CHAOS_ENABLED", "true")
+	t.Setenv("CHAOS_RATE_LIMIT_RATE", "0.1")
+	t.Setenv("CHAOS_SERVER_ERROR_RATE", "0.05")
+	t.Setenv("CHAOS_SCHEDULE", "timeout, none")
+	t.Setenv("CHAOS_LATENCY_MS", "300")
+	t.Setenv("CHAOS_SEED", "7")
+
+	config, enabled, err := loadChaosConfigFromEnv()
+	if err != nil || !enabled {
+		t.Fatalf("expected enabled config, got enabled=%v err=%v", enabled, err)
+	}
+	if config.Rates[ChaosFaultRateLimit] != 0.1 || config.Rates[ChaosFaultServerError] != 0.05 {
+		t.Fatalf("unexpected rates %+v", config.Rates)
+	}
+	if len(config.Schedule) != 2 || config.Schedule[0] != ChaosFaultTimeout || config.LatencyMs != 300 || config.Seed != 7 {
+		t.Fatalf("unexpected config %+v", config)
+	}
+
+	t.Setenv("CHAOS_ENABLED", "")
+	if _, enabled, _ := loadChaosConfigFromEnv(); enabled {
+		t.Fatalf("expected chaos to be disabled")
+	}
+}
+
+func TestEnableAndDisableChaosWrapCurrentProvider(t *testing.T) {
+	previous := CurrentProvider()
+	t.Cleanup(func() { SetProvider(previous) })
+	SetProvider(NewMockProvider())
+
+	if err := EnableChaos(ChaosConfig{Rates: map[ChaosFault]float64{ChaosFaultEmpty: 2}}); err == nil {
+		t.Fatalf("expected invalid config to be rejected")
+	}
+	if err := EnableChaos(ChaosConfig{Schedule: []ChaosFault{ChaosFaultEmpty}}); err != nil {
+		t.Fatalf("EnableChaos returned error: %v", err)
+	}
+	if _, ok := CurrentProvider().(*ChaosProvider); !ok {
+		t.Fatalf("expected current provider to be wrapped, got %T", CurrentProvider())
+	}
+	if CurrentProvider().Name() != "mock" {
+		t.Fatalf("expected wrapper to keep provider name, got %q", CurrentProvider().Name())
+	}
+
+	if err := EnableChaos(ChaosConfig{LatencyMs: 10}); err != nil {
+		t.Fatalf("EnableChaos reconfigure returned error: %v", err)
+	}
+	if config, ok := CurrentChaosConfig(); !ok || config.LatencyMs != 10 {
+		t.Fatalf("expected reconfigured chaos, got %+v ok=%v", config, ok)
+	}
+	if _, ok := CurrentProvider().(*ChaosProvider).Unwrap().(*ChaosProvider); ok {
+		t.Fatalf("expected reconfiguration not to double wrap")
+	}
+
+	DisableChaos()
+	if _, ok := CurrentProvider().(*MockProvider); !ok {
+		t.Fatalf("expected mock provider after disabling chaos, got %T", CurrentProvider())
+	}
+}
@@ -0,0 +1,31 @@
+package llm
+
+import (
+	"context"
+	"time"
+)
+
+// providerClock abstracts time so retry backoff and outbound throttling can
+// be tested without sleeping.
+type providerClock interface {
+	Now() time.Time
+	Sleep(ctx context.Context, delay time.Duration) error
+}
+
+type realProviderClock struct{}
+
+func (realProviderClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realProviderClock) Sleep(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,192 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+
+	"google.golang.org/genai"
+)
+
+const (
+	openAIEmbeddingsURL          = "https://api.openai.com/v1/embeddings"
+	defaultOpenAIEmbeddingModel  = "text-embedding-3-small"
+	defaultGeminiEmbeddingModel  = "gemini-embedding-001"
+	mockEmbeddingDimensions      = 256
+	mockEmbeddingModel           = "mock-bow-256"
+	maxEmbeddingInputsPerRequest = 96
+)
+
+// ErrEmbeddingsUnsupported is returned by EmbedderFor when the provider, or
+// the provider behind its decorators, cannot produce embeddings.
+var ErrEmbeddingsUnsupported = errors.New("provider does not support embeddings")
+
+// Embedder turns texts into vectors. EmbeddingModel identifies the vector
+// space so vectors from different models are never compared.
+type Embedder interface {
+	EmbeddingModel() string
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+// providerWrapper is implemented by decorators such as LimitedProvider and
+// ChaosProvider so callers can reach capabilities of the wrapped provider.
+type providerWrapper interface {
+	Unwrap() LLMProvider
+}
+
+// embeddingSupport is implemented by decorators, which have Embed whether or
+// not the provider they wrap can produce embeddings.
+type embeddingSupport interface {
+	supportsEmbeddings() bool
+}
+
+// EmbedderFor returns provider as an Embedder. Decorators are returned
+// themselves, so embedding calls still pass through their limits, fault
+// injection and recording.
+func EmbedderFor(provider LLMProvider) (Embedder, error) {
+	embedder, ok := provider.(Embedder)
+	if !ok {
+		return nil, ErrEmbeddingsUnsupported
+	}
+	if support, ok := provider.(embeddingSupport); ok && !support.supportsEmbeddings() {
+		return nil, ErrEmbeddingsUnsupported
+	}
+	return embedder, nil
+}
+
+func supportsEmbeddings(provider LLMProvider) bool {
+	_, err := EmbedderFor(provider)
+	return err == nil
+}
+
+// embeddingModelOf names the embedding model behind provider, or "" when it
+// cannot produce embeddings.
+func embeddingModelOf(provider LLMProvider) string {
+	embedder, err := EmbedderFor(provider)
+	if err != nil {
+		return ""
+	}
+	return embedder.EmbeddingModel()
+}
+
+func (o *OpenAIProvider) EmbeddingModel() string {
+	return o.embeddingModel
+}
+
+func (o *OpenAIProvider) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	if o.embeddingEndpoint == "" {
+		return nil, fmt.Errorf("%s: %w", o.name, ErrEmbeddingsUnsupported)
+	}
+
+	return observeProviderOperation(ctx, o.Name(), "embed", func() ([][]float32, error) {
+		vectors := make([][]float32, 0, len(texts))
+		for start := 0; start < len(texts); start += maxEmbeddingInputsPerRequest {
+			batch := texts[start:min(start+maxEmbeddingInputsPerRequest, len(texts))]
+			body, err := json.Marshal(map[string]any{"model": o.embeddingModel, "input": batch})
+			if err != nil {
+				return nil, err
+			}
+
+			var parsed struct {
+				Data []struct {
+					Index     int       `json:"index"`
+					Embedding []float32 `json:"embedding"`
+				} `json:"data"`
+			}
+			if err := o.post(ctx, o.embeddingEndpoint, body, &parsed); err != nil {
+				return nil, err
+			}
+			if len(parsed.Data) != len(batch) {
+				return nil, fmt.Errorf("%s returned %d embeddings for %d inputs", o.name, len(parsed.Data), len(batch))
+			}
+			sort.Slice(parsed.Data, func(i, j int) bool { return parsed.Data[i].Index < parsed.Data[j].Index })
+			for _, item := range parsed.Data {
+				vectors = append(vectors, item.Embedding)
+			}
+		}
+		return vectors, nil
+	})
+}
+
+func (g *GeminiProvider) EmbeddingModel() string {
+	return g.embeddingModel
+}
+
+func (g *GeminiProvider) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	return observeProviderOperation(ctx, g.Name(), "embed", func() ([][]float32, error) {
+		contents := make([]*genai.Content, 0, len(texts))
+		for _, text := range texts {
+			contents = append(contents, genai.NewContentFromText(text, genai.RoleUser))
+		}
+
+		retry := g.retry.start(ctx, g.Name())
+		for {
+			attemptCtx, cancel := context.WithTimeout(ctx, g.timeout)
+			response, err := g.client.Models.EmbedContent(attemptCtx, g.embeddingModel, contents, nil)
+			cancel()
+			if err != nil {
+				if err := retry.wait(ctx, err); err != nil {
+					return nil, err
+				}
+				continue
+			}
+
+			if len(response.Embeddings) != len(texts) {
+				return nil, fmt.Errorf("gemini returned %d embeddings for %d inputs", len(response.Embeddings), len(texts))
+			}
+			vectors := make([][]float32, 0, len(texts))
+			for _, embedding := range response.Embeddings {
+				vectors = append(vectors, embedding.Values)
+			}
+			return vectors, nil
+		}
+	})
+}
+
+func (m *MockProvider) EmbeddingModel() string {
+	return mockEmbeddingModel
+}
+
+// Embed returns deterministic hashed bag-of-words vectors: each lower-cased
+// word increments one of 256 buckets, then the vector is L2-normalized.
+// Texts sharing words therefore score higher under cosine similarity.
+func (m *MockProvider) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	return observeProviderOperation(ctx, m.Name(), "embed", func() ([][]float32, error) {
+		vectors := make([][]float32, 0, len(texts))
+		for _, text := range texts {
+			vectors = append(vectors, hashedBagOfWords(text, mockEmbeddingDimensions))
+		}
+		return vectors, nil
+	})
+}
+
+func hashedBagOfWords(text string, dimensions int) []float32 {
+	vector := make([]float32, dimensions)
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	for _, word := range words {
+		hash := fnv.New32a()
+		_, _ = hash.Write([]byte(word))
+		vector[hash.Sum32()%uint32(dimensions)]++
+	}
+
+	var norm float64
+	for _, value := range vector {
+		norm += float64(value) * float64(value)
+	}
+	if norm == 0 {
+		return vector
+	}
+	scale := float32(1 / math.Sqrt(norm))
+	for i := range vector {
+		vector[i] *= scale
+	}
+	return vector
+}
@@ -0,0 +1,141 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/alanmaizon/homer/backend/internal/metrics"
+)
+
+func TestOpenAIProviderEmbedOrdersVectorsByIndex(t *testing.T) {
+	var gotPayload struct {
+		Model string   `json:"model"`
+		Input []string `json:"input"`
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/embeddings" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&gotPayload); err != nil {
+			t.Errorf("failed to decode payload: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"data":[{"index":1,"embedding":[0,1]},{"index":0,"embedding":[1,0]}]}`))
+	}))
+	t.Cleanup(server.Close)
+
+	provider := &OpenAIProvider{
+		name:              "openai",
+		embeddingEndpoint: server.URL + "/v1/embeddings",
+		embeddingModel:    "text-embedding-3-small",
+		apiKey:            "key",
+		authScheme:        authSchemeBearer,
+		client:            server.Client(),
+		timeout:           defaultLLMTimeout,
+	}
+
+	vectors, err := provider.Embed(context.Background(), []string{"first", "second"})
+	if err != nil {
+		t.Fatalf("Embed returned error: %v", err)
+	}
+	if gotPayload.Model != "text-embedding-3-small" || len(gotPayload.Input) != 2 {
+		t.Fatalf("unexpected payload %+v", gotPayload)
+	}
+	if len(vectors) != 2 || vectors[0][0] != 1 || vectors[1][1] != 1 {
+		t.Fatalf("expected vectors ordered by index, got %v", vectors)
+	}
+}
+
+func TestMockProviderEmbedIsDeterministicAndSimilarityAware(t *testing.T) {
+	provider := NewMockProvider()
+
+	vectors, err := provider.Embed(context.Background(), []string{
+		"Quarterly revenue grew in Europe",
+		"quarterly REVENUE grew in europe!",
+		"The hiring plan adds two engineers",
+	})
+	if err != nil {
+		t.Fatalf("Embed returned error: %v", err)
+	}
+	if len(vectors[0]) != mockEmbeddingDimensions {
+		t.Fatalf("expected %d dimensions, got %d", mockEmbeddingDimensions, len(vectors[0]))
+	}
+
+	same, different := dot(vectors[0], vectors[1]), dot(vectors[0], vectors[2])
+	if same < 0.999 {
+		t.Fatalf("expected case and punctuation to be ignored, got similarity %f", same)
+	}
+	if different >= same {
+		t.Fatalf("expected unrelated text to score lower: same=%f different=%f", same, different)
+	}
+}
+
+func TestEmbedderForKeepsDecorators(t *testing.T) {
+	metrics.ResetForTests()
+	limited := newLimitedProvider(NewMockProvider(), limiterConfig{maxInFlight: 1}, realProviderClock{})
+	chaos := newChaosProvider(limited, ChaosConfig{}, realProviderClock{})
+
+	embedder, err := EmbedderFor(chaos)
+	if err != nil {
+		t.Fatalf("EmbedderFor returned error: %v", err)
+	}
+	if embedder != Embedder(chaos) || embedder.EmbeddingModel() != mockEmbeddingModel {
+		t.Fatalf("expected the chaos decorator with the mock model, got %T %s", embedder, embedder.EmbeddingModel())
+	}
+	if _, err := embedder.Embed(context.Background(), []string{"launch plan"}); err != nil {
+		t.Fatalf("Embed returned error: %v", err)
+	}
+	want := `homer_provider_queue_wait_seconds_count{outcome="admitted",provider="mock"} 1`
+	if output := metrics.PrometheusText(); !strings.Contains(output, want) {
+		t.Fatalf("expected the embedding call to pass the limiter, missing %q:\n%s", want, output)
+	}
+
+	if _, err := EmbedderFor(&scriptedProvider{name: "scripted"}); !errors.Is(err, ErrEmbeddingsUnsupported) {
+		t.Fatalf("expected ErrEmbeddingsUnsupported, got %v", err)
+	}
+	wrapped := newLimitedProvider(&scriptedProvider{name: "scripted"}, limiterConfig{maxInFlight: 1}, realProviderClock{})
+	if _, err := EmbedderFor(wrapped); !errors.Is(err, ErrEmbeddingsUnsupported) {
+		t.Fatalf("expected ErrEmbeddingsUnsupported through decorators, got %v", err)
+	}
+}
+
+func TestReplayProviderRecordsAndReplaysEmbeddings(t *testing.T) {
+	dir := t.TempDir()
+	recorder, err := newRecordingProvider(dir, NewMockProvider())
+	if err != nil {
+		t.Fatalf("newRecordingProvider returned error: %v", err)
+	}
+	if recorder.EmbeddingModel() != mockEmbeddingModel {
+		t.Fatalf("expected the recorded model, got %s", recorder.EmbeddingModel())
+	}
+	recorded, err := recorder.Embed(context.Background(), []string{"launch plan"})
+	if err != nil {
+		t.Fatalf("record Embed returned error: %v", err)
+	}
+
+	replayer, err := newReplayProvider(dir)
+	if err != nil {
+		t.Fatalf("newReplayProvider returned error: %v", err)
+	}
+	embedder, err := EmbedderFor(replayer)
+	if err != nil {
+		t.Fatalf("EmbedderFor returned error: %v", err)
+	}
+	replayed, err := embedder.Embed(context.Background(), []string{"launch  plan"})
+	if err != nil || len(replayed) != 1 || dot(replayed[0], recorded[0]) < 0.999 {
+		t.Fatalf("expected the recorded vector, got %v err=%v", replayed, err)
+	}
+}
+
+func dot(a, b []float32) float64 {
+	total := 0.0
+	for i := range a {
+		total += float64(a[i]) * float64(b[i])
+	}
+	return total
+}
@@ -2,6 +2,7 @@ package llm
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
@@ -13,10 +14,11 @@ import (
 )
 
 type GeminiProvider struct {
-	model      string
-	client     *genai.Client
-	timeout    time.Duration
-	maxRetries int
+	model          string
+	embeddingModel string
+	client         *genai.Client
+	timeout        time.Duration
+	retry          retryPolicy
 }
 
 func NewGeminiProviderFromEnv() (*GeminiProvider, error) {
@@ -33,6 +35,11 @@ func NewGeminiProviderFromEnv() (*GeminiProvider, error) {
 		model = "gemini-2.5-flash"
 	}
 
+	embeddingModel := strings.TrimSpace(os.Getenv("GEMINI_EMBEDDING_MODEL"))
+	if embeddingModel == "" {
+		embeddingModel = defaultGeminiEmbeddingModel
+	}
+
 	client, err := genai.NewClient(context.Background(), &genai.ClientConfig{
 		APIKey:  apiKey,
 		Backend: genai.BackendGeminiAPI,
@@ -44,10 +51,11 @@ func NewGeminiProviderFromEnv() (*GeminiProvider, error) {
 	policy := loadRuntimePolicyFromEnv()
 
 	return &GeminiProvider{
-		model:      model,
-		client:     client,
-		timeout:    policy.timeout,
-		maxRetries: policy.maxRetries,
+		model:          model,
+		embeddingModel: embeddingModel,
+		client:         client,
+		timeout:        policy.timeout,
+		retry:          newRetryPolicy(policy),
 	}, nil
 }
 
@@ -55,58 +63,237 @@ func (g *GeminiProvider) Name() string {
 	return "gemini"
 }
 
-func (g *GeminiProvider) Summarize(ctx context.Context, docs []domain.Document, style string, instructions string) (string, error) {
+func (g *GeminiProvider) Model() string {
+	return g.model
+}
+
+func (g *GeminiProvider) Summarize(ctx context.Context, docs []domain.Document, style string, instructions string, params domain.GenerationParams) (string, error) {
 	return observeProviderOperation(ctx, g.Name(), "summarize", func() (string, error) {
-		var builder strings.Builder
-		builder.WriteString("Summarize the provided documents for the end user.\n")
-		if style != "" {
-			builder.WriteString("Style: " + style + "\n")
-		}
-		if instructions != "" {
-			builder.WriteString("Instructions: " + instructions + "\n")
-		}
-		for _, doc := range docs {
-			builder.WriteString("\n# " + doc.Title + "\n")
-			builder.WriteString(doc.Content + "\n")
+		messages, err := renderPrompt(ctx, g.Name(), g.model, "summarize", summarizePromptData{
+			Style:        style,
+			Instructions: instructions,
+			Documents:    docs,
+		})
+		if err != nil {
+			return "", err
 		}
-		return g.call(ctx, builder.String())
+		return g.call(ctx, messages, params)
 	})
 }
 
-func (g *GeminiProvider) Rewrite(ctx context.Context, text string, mode string, instructions string) (string, error) {
+func (g *GeminiProvider) Rewrite(ctx context.Context, text string, mode string, instructions string, params domain.GenerationParams) (string, error) {
 	return observeProviderOperation(ctx, g.Name(), "rewrite", func() (string, error) {
-		prompt := fmt.Sprintf("Rewrite this text in %s mode.\nInstructions: %s\n\n%s", mode, instructions, text)
-		return g.call(ctx, prompt)
+		messages, err := renderPrompt(ctx, g.Name(), g.model, "rewrite", rewritePromptData{
+			Mode:         mode,
+			Instructions: instructions,
+			Text:         text,
+		})
+		if err != nil {
+			return "", err
+		}
+		return g.call(ctx, messages, params)
+	})
+}
+
+func (g *GeminiProvider) Generate(ctx context.Context, messages []Message, params domain.GenerationParams) (string, error) {
+	return observeProviderOperation(ctx, g.Name(), "generate", func() (string, error) {
+		return g.call(ctx, messages, params)
 	})
 }
 
-func (g *GeminiProvider) call(ctx context.Context, prompt string) (string, error) {
-	totalAttempts := g.maxRetries + 1
-	for attempt := 0; attempt < totalAttempts; attempt++ {
+func (g *GeminiProvider) call(ctx context.Context, messages []Message, params domain.GenerationParams) (string, error) {
+	contents, config := geminiRequest(messages, params)
+	response, err := g.generateContent(ctx, contents, config)
+	if err != nil {
+		return "", err
+	}
+
+	text := strings.TrimSpace(response.Text())
+	if text == "" {
+		return "", errors.New("gemini returned no text")
+	}
+	return text, nil
+}
+
+// generateContent sends one request under the retry policy, records safety
+// ratings, and fails when the prompt was blocked.
+func (g *GeminiProvider) generateContent(ctx context.Context, contents []*genai.Content, config *genai.GenerateContentConfig) (*genai.GenerateContentResponse, error) {
+	retry := g.retry.start(ctx, g.Name())
+	for {
 		attemptCtx, cancel := context.WithTimeout(ctx, g.timeout)
 		response, err := g.client.Models.GenerateContent(
 			attemptCtx,
 			g.model,
-			genai.Text(prompt),
-			nil,
+			contents,
+			config,
 		)
 		cancel()
 		if err != nil {
-			if shouldRetryError(err) && attempt < totalAttempts-1 {
-				if waitErr := waitForBackoff(ctx, attempt); waitErr != nil {
-					return "", waitErr
+			if err := retry.wait(ctx, err); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		recordGeminiSafetyRatings(ctx, response)
+		if feedback := response.PromptFeedback; feedback != nil && feedback.BlockReason != "" {
+			return nil, fmt.Errorf("gemini blocked the prompt (%s): %w", feedback.BlockReason, ErrContentFiltered)
+		}
+		return response, nil
+	}
+}
+
+func (g *GeminiProvider) GenerateWithTools(ctx context.Context, messages []Message, tools []ToolDefinition, params domain.GenerationParams) (ToolTurn, error) {
+	return observeProviderOperation(ctx, g.Name(), "generate_with_tools", func() (ToolTurn, error) {
+		contents, config := geminiRequest(messages, params)
+		if len(tools) > 0 {
+			declarations := make([]*genai.FunctionDeclaration, 0, len(tools))
+			for _, tool := range tools {
+				declarations = append(declarations, &genai.FunctionDeclaration{
+					Name:                 tool.Name,
+					Description:          tool.Description,
+					ParametersJsonSchema: tool.Parameters,
+				})
+			}
+			config.Tools = []*genai.Tool{{FunctionDeclarations: declarations}}
+		}
+
+		response, err := g.generateContent(ctx, contents, config)
+		if err != nil {
+			return ToolTurn{}, err
+		}
+
+		turn := ToolTurn{}
+		if len(response.Candidates) == 0 || response.Candidates[0].Content == nil {
+			return turn, errors.New("gemini returned no candidates")
+		}
+		for _, part := range response.Candidates[0].Content.Parts {
+			switch {
+			case part == nil || part.Thought:
+			case part.FunctionCall != nil:
+				arguments, err := json.Marshal(part.FunctionCall.Args)
+				if err != nil {
+					return ToolTurn{}, err
 				}
+				turn.Calls = append(turn.Calls, ToolCall{
+					ID:               part.FunctionCall.ID,
+					Name:             part.FunctionCall.Name,
+					Arguments:        arguments,
+					thoughtSignature: part.ThoughtSignature,
+				})
+			default:
+				turn.Text += part.Text
+			}
+		}
+		turn.Text = strings.TrimSpace(turn.Text)
+		return turn, nil
+	})
+}
+
+// geminiModelContent maps an assistant message, including any tool calls it
+// made, to a model turn.
+func geminiModelContent(message Message) *genai.Content {
+	if len(message.ToolCalls) == 0 {
+		return genai.NewContentFromText(message.Content, genai.RoleModel)
+	}
+
+	parts := make([]*genai.Part, 0, len(message.ToolCalls)+1)
+	if message.Content != "" {
+		parts = append(parts, genai.NewPartFromText(message.Content))
+	}
+	for _, call := range message.ToolCalls {
+		var args map[string]any
+		if err := json.Unmarshal(call.Arguments, &args); err != nil {
+			args = map[string]any{}
+		}
+		parts = append(parts, &genai.Part{
+			FunctionCall:     &genai.FunctionCall{ID: call.ID, Name: call.Name, Args: args},
+			ThoughtSignature: call.thoughtSignature,
+		})
+	}
+	return genai.NewContentFromParts(parts, genai.RoleModel)
+}
+
+// recordGeminiSafetyRatings copies prompt and candidate safety ratings onto
+// the request's CallInfo for output moderation.
+func recordGeminiSafetyRatings(ctx context.Context, response *genai.GenerateContentResponse) {
+	info := callInfoFromContext(ctx)
+	if info == nil {
+		return
+	}
+
+	ratings := make([]SafetyRating, 0)
+	appendRatings := func(stage string, source []*genai.SafetyRating) {
+		for _, rating := range source {
+			if rating == nil {
 				continue
 			}
-			return "", err
+			ratings = append(ratings, SafetyRating{
+				Stage:       stage,
+				Category:    string(rating.Category),
+				Probability: string(rating.Probability),
+				Blocked:     rating.Blocked,
+			})
 		}
+	}
+	if response.PromptFeedback != nil {
+		appendRatings("input", response.PromptFeedback.SafetyRatings)
+	}
+	if len(response.Candidates) > 0 && response.Candidates[0] != nil {
+		appendRatings("output", response.Candidates[0].SafetyRatings)
+	}
+	info.AddSafetyRatings(ratings...)
+}
 
-		text := strings.TrimSpace(response.Text())
-		if text == "" {
-			return "", errors.New("gemini returned no text")
+// geminiRequest maps system messages to SystemInstruction and the remaining
+// turns to user/model contents.
+func geminiRequest(messages []Message, params domain.GenerationParams) ([]*genai.Content, *genai.GenerateContentConfig) {
+	config := &genai.GenerateContentConfig{}
+	contents := make([]*genai.Content, 0, len(messages))
+	systemParts := make([]*genai.Part, 0, 1)
+
+	for i, message := range messages {
+		switch message.Role {
+		case MessageRoleSystem:
+			systemParts = append(systemParts, genai.NewPartFromText(message.Content))
+		case MessageRoleAssistant:
+			contents = append(contents, geminiModelContent(message))
+		case MessageRoleTool:
+			// Results of one turn's calls go back together in a single
+			// user turn.
+			response := &genai.Part{FunctionResponse: &genai.FunctionResponse{
+				ID:       message.ToolCallID,
+				Name:     message.ToolName,
+				Response: map[string]any{"output": message.Content},
+			}}
+			if i > 0 && messages[i-1].Role == MessageRoleTool {
+				last := contents[len(contents)-1]
+				last.Parts = append(last.Parts, response)
+				continue
+			}
+			contents = append(contents, genai.NewContentFromParts([]*genai.Part{response}, genai.RoleUser))
+		default:
+			contents = append(contents, genai.NewContentFromText(message.Content, genai.RoleUser))
 		}
-		return text, nil
+	}
+	if len(systemParts) > 0 {
+		config.SystemInstruction = &genai.Content{Parts: systemParts}
+	}
+
+	if params.Temperature != nil {
+		temperature := float32(*params.Temperature)
+		config.Temperature = &temperature
+	}
+	if params.TopP != nil {
+		topP := float32(*params.TopP)
+		config.TopP = &topP
+	}
+	if params.MaxTokens != nil {
+		config.MaxOutputTokens = int32(*params.MaxTokens)
+	}
+	if len(params.Stop) > 0 {
+		config.StopSequences = params.Stop
 	}
 
-	return "", errors.New("gemini request failed after retries")
+	return contents, config
 }
@@ -0,0 +1,88 @@
+package llm
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alanmaizon/homer/backend/internal/domain"
+	"google.golang.org/genai"
+)
+
+func TestGeminiRequestMapsSystemMessagesToSystemInstruction(t *testing.T) {
+	contents, config := geminiRequest([]Message{
+		{Role: MessageRoleSystem, Content: "You rewrite text."},
+		{Role: MessageRoleUser, Content: "first draft"},
+		{Role: MessageRoleAssistant, Content: "rewritten draft"},
+		{Role: MessageRoleUser, Content: "shorter please"},
+	}, domain.GenerationParams{})
+
+	if config.SystemInstruction == nil || len(config.SystemInstruction.Parts) != 1 || config.SystemInstruction.Parts[0].Text != "You rewrite text." {
+		t.Fatalf("unexpected system instruction: %+v", config.SystemInstruction)
+	}
+	if len(contents) != 3 {
+		t.Fatalf("expected 3 contents, got %d", len(contents))
+	}
+
+	wantRoles := []string{genai.RoleUser, genai.RoleModel, genai.RoleUser}
+	for i, content := range contents {
+		if content.Role != wantRoles[i] {
+			t.Fatalf("content %d: expected role %q, got %q", i, wantRoles[i], content.Role)
+		}
+	}
+	if contents[2].Parts[0].Text != "shorter please" {
+		t.Fatalf("unexpected last content: %+v", contents[2].Parts[0])
+	}
+}
+
+func TestGeminiRequestWithoutSystemMessage(t *testing.T) {
+	_, config := geminiRequest([]Message{{Role: MessageRoleUser, Content: "hi"}}, domain.GenerationParams{})
+	if config.SystemInstruction != nil {
+		t.Fatalf("expected no system instruction, got %+v", config.SystemInstruction)
+	}
+}
+
+func TestGeminiRequestMapsGenerationParams(t *testing.T) {
+	temperature, topP, maxTokens := 0.2, 0.8, 512
+	_, config := geminiRequest([]Message{{Role: MessageRoleUser, Content: "hi"}}, domain.GenerationParams{
+		Temperature: &temperature,
+		MaxTokens:   &maxTokens,
+		TopP:        &topP,
+		Stop:        []string{"###"},
+	})
+
+	if config.Temperature == nil || *config.Temperature != float32(0.2) {
+		t.Fatalf("unexpected temperature %v", config.Temperature)
+	}
+	if config.TopP == nil || *config.TopP != float32(0.8) {
+		t.Fatalf("unexpected topP %v", config.TopP)
+	}
+	if config.MaxOutputTokens != 512 {
+		t.Fatalf("unexpected max output tokens %d", config.MaxOutputTokens)
+	}
+	if len(config.StopSequences) != 1 || config.StopSequences[0] != "###" {
+		t.Fatalf("unexpected stop sequences %v", config.StopSequences)
+	}
+}
+
+func TestRecordGeminiSafetyRatings(t *testing.T) {
+	ctx, _ := WithCallInfo(context.Background())
+	recordGeminiSafetyRatings(ctx, &genai.GenerateContentResponse{
+		PromptFeedback: &genai.GenerateContentResponsePromptFeedback{
+			SafetyRatings: []*genai.SafetyRating{{Category: genai.HarmCategoryHarassment, Probability: genai.HarmProbabilityLow}},
+		},
+		Candidates: []*genai.Candidate{{
+			SafetyRatings: []*genai.SafetyRating{{Category: genai.HarmCategoryHateSpeech, Probability: genai.HarmProbabilityHigh, Blocked: true}},
+		}},
+	})
+
+	ratings := SafetyRatingsFromContext(ctx)
+	if len(ratings) != 2 {
+		t.Fatalf("expected 2 ratings, got %+v", ratings)
+	}
+	if ratings[0].Stage != "input" || ratings[0].Category != "HARM_CATEGORY_HARASSMENT" {
+		t.Fatalf("unexpected prompt rating %+v", ratings[0])
+	}
+	if ratings[1].Stage != "output" || ratings[1].Probability != "HIGH" || !ratings[1].Blocked {
+		t.Fatalf("unexpected candidate rating %+v", ratings[1])
+	}
+}
@@ -0,0 +1,273 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alanmaizon/homer/backend/internal/domain"
+	"github.com/alanmaizon/homer/backend/internal/metrics"
+	"github.com/alanmaizon/homer/backend/internal/middleware"
+)
+
+const defaultHedgeMinSamples = 20
+
+// errHedgeLost is the cancellation cause of the call that lost a hedge race,
+// so its cancellation is not counted as a provider error.
+var errHedgeLost = errors.New("hedge race lost")
+
+type hedgeConfig struct {
+	delay      time.Duration
+	percentile float64
+	minSamples int
+	provider   string
+}
+
+func (c hedgeConfig) enabled() bool {
+	return c.delay > 0 || c.percentile > 0
+}
+
+// loadHedgeConfigFromEnv reads LLM_HEDGE_DELAY_MS, LLM_HEDGE_PERCENTILE,
+// LLM_HEDGE_MIN_SAMPLES and LLM_HEDGE_PROVIDER. Hedging is off unless a delay
+// or a percentile is set.
+func loadHedgeConfigFromEnv() hedgeConfig {
+	config := hedgeConfig{
+		delay:      durationMsFromEnv("LLM_HEDGE_DELAY_MS", 0),
+		minSamples: defaultHedgeMinSamples,
+		provider:   strings.TrimSpace(os.Getenv("LLM_HEDGE_PROVIDER")),
+	}
+	if raw := strings.TrimSpace(os.Getenv("LLM_HEDGE_PERCENTILE")); raw != "" {
+		if parsed, err := strconv.ParseFloat(raw, 64); err == nil && parsed > 0 && parsed < 100 {
+			config.percentile = parsed
+		}
+	}
+	if raw := strings.TrimSpace(os.Getenv("LLM_HEDGE_MIN_SAMPLES")); raw != "" {
+		if parsed, err := strconv.Atoi(raw); err == nil && parsed >= 0 {
+			config.minSamples = parsed
+		}
+	}
+	return config
+}
+
+// withHedgingFromEnv wraps provider with a hedging policy when one is
+// configured. The hedge goes to LLM_HEDGE_PROVIDER when set, otherwise to
+// the same provider.
+func withHedgingFromEnv(provider LLMProvider) LLMProvider {
+	config := loadHedgeConfigFromEnv()
+	if !config.enabled() {
+		return provider
+	}
+
+	hedge := provider
+	if config.provider != "" && config.provider != provider.Name() {
+		alternate, err := NewNamedProviderFromEnv(config.provider)
+		if err != nil {
+			log.Printf("component=hedge event=alternate_unavailable provider=%s error=%q", config.provider, err.Error())
+		} else {
+			hedge = alternate
+		}
+	}
+	return newHedgedProvider(provider, hedge, config, realProviderClock{})
+}
+
+// HedgedProvider issues a second, identical request when the first has not
+// returned within the hedge delay. The delay is the configured percentile of
+// recent successful latencies once enough samples exist, otherwise the fixed
+// delay. The first successful response wins and the other call is
+// cancelled.
+type HedgedProvider struct {
+	LLMProvider
+	hedge  LLMProvider
+	config hedgeConfig
+	clock  providerClock
+}
+
+type hedgeResult[T any] struct {
+	value  T
+	err    error
+	hedged bool
+}
+
+func newHedgedProvider(primary LLMProvider, hedge LLMProvider, config hedgeConfig, clock providerClock) *HedgedProvider {
+	return &HedgedProvider{LLMProvider: primary, hedge: hedge, config: config, clock: clock}
+}
+
+// Unwrap returns the primary provider.
+func (h *HedgedProvider) Unwrap() LLMProvider {
+	return h.LLMProvider
+}
+
+func (h *HedgedProvider) Summarize(ctx context.Context, docs []domain.Document, style string, instructions string, params domain.GenerationParams) (string, error) {
+	return h.run(ctx, "summarize", func(ctx context.Context, provider LLMProvider) (string, error) {
+		return provider.Summarize(ctx, docs, style, instructions, params)
+	})
+}
+
+func (h *HedgedProvider) Rewrite(ctx context.Context, text string, mode string, instructions string, params domain.GenerationParams) (string, error) {
+	return h.run(ctx, "rewrite", func(ctx context.Context, provider LLMProvider) (string, error) {
+		return provider.Rewrite(ctx, text, mode, instructions, params)
+	})
+}
+
+func (h *HedgedProvider) Generate(ctx context.Context, messages []Message, params domain.GenerationParams) (string, error) {
+	return h.run(ctx, "generate", func(ctx context.Context, provider LLMProvider) (string, error) {
+		return provider.Generate(ctx, messages, params)
+	})
+}
+
+func (h *HedgedProvider) supportsTools() bool {
+	return supportsTools(h.LLMProvider)
+}
+
+// GenerateWithTools hedges only to the same provider: the next turn of the
+// conversation goes to the primary, which may not accept tool calls made by
+// another provider.
+func (h *HedgedProvider) GenerateWithTools(ctx context.Context, messages []Message, tools []ToolDefinition, params domain.GenerationParams) (ToolTurn, error) {
+	if _, err := ToolCallerFor(h.LLMProvider); err != nil {
+		return ToolTurn{}, err
+	}
+	var hedge LLMProvider
+	if h.hedge.Name() == h.Name() && supportsTools(h.hedge) {
+		hedge = h.hedge
+	}
+	return runHedged(h, ctx, "generate_with_tools", hedge, func(ctx context.Context, provider LLMProvider) (ToolTurn, error) {
+		caller, err := ToolCallerFor(provider)
+		if err != nil {
+			return ToolTurn{}, err
+		}
+		return caller.GenerateWithTools(ctx, messages, tools, params)
+	})
+}
+
+func (h *HedgedProvider) supportsEmbeddings() bool {
+	return supportsEmbeddings(h.LLMProvider)
+}
+
+func (h *HedgedProvider) EmbeddingModel() string {
+	return embeddingModelOf(h.LLMProvider)
+}
+
+// Embed hedges only to a provider with the same embedding model, since
+// vectors from different models cannot be compared.
+func (h *HedgedProvider) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	model := h.EmbeddingModel()
+	if model == "" {
+		return nil, ErrEmbeddingsUnsupported
+	}
+	var hedge LLMProvider
+	if embeddingModelOf(h.hedge) == model {
+		hedge = h.hedge
+	}
+	return runHedged(h, ctx, "embed", hedge, func(ctx context.Context, provider LLMProvider) ([][]float32, error) {
+		embedder, err := EmbedderFor(provider)
+		if err != nil {
+			return nil, err
+		}
+		return embedder.Embed(ctx, texts)
+	})
+}
+
+func (h *HedgedProvider) run(ctx context.Context, operation string, call func(context.Context, LLMProvider) (string, error)) (string, error) {
+	return runHedged(h, ctx, operation, h.hedge, call)
+}
+
+// runHedged runs call against the primary and, once the hedge delay passes,
+// against hedge as well. A nil hedge disables hedging for the call.
+func runHedged[T any](h *HedgedProvider, ctx context.Context, operation string, hedge LLMProvider, call func(context.Context, LLMProvider) (T, error)) (T, error) {
+	var zero T
+	delay, ok := h.hedgeDelay(operation)
+	if !ok || hedge == nil {
+		return call(ctx, h.LLMProvider)
+	}
+
+	primaryCtx, cancelPrimary := context.WithCancelCause(ctx)
+	defer cancelPrimary(errHedgeLost)
+	results := make(chan hedgeResult[T], 2)
+	go func() {
+		value, err := call(primaryCtx, h.LLMProvider)
+		results <- hedgeResult[T]{value: value, err: err}
+	}()
+
+	timerCtx, stopTimer := context.WithCancel(ctx)
+	defer stopTimer()
+	fire := make(chan struct{})
+	go func() {
+		if h.clock.Sleep(timerCtx, delay) == nil {
+			close(fire)
+		}
+	}()
+
+	select {
+	case result := <-results:
+		return result.value, result.err
+	case <-fire:
+	}
+
+	log.Printf(
+		"request_id=%s component=hedge provider=%s operation=%s hedge_provider=%s delay_ms=%d event=hedged",
+		middleware.GetRequestIDFromContext(ctx),
+		h.Name(),
+		operation,
+		hedge.Name(),
+		delay.Milliseconds(),
+	)
+	hedgeCtx, cancelHedge := context.WithCancelCause(ctx)
+	defer cancelHedge(errHedgeLost)
+	go func() {
+		value, err := call(hedgeCtx, hedge)
+		results <- hedgeResult[T]{value: value, err: err, hedged: true}
+	}()
+
+	var primaryErr, hedgeErr error
+	for pending := 2; pending > 0; pending-- {
+		result := <-results
+		if result.err == nil {
+			outcome := "primary_won"
+			if result.hedged {
+				outcome = "hedge_won"
+				cancelPrimary(errHedgeLost)
+			} else {
+				cancelHedge(errHedgeLost)
+			}
+			h.recordOutcome(ctx, operation, outcome)
+			return result.value, nil
+		}
+		if result.hedged {
+			hedgeErr = result.err
+		} else {
+			primaryErr = result.err
+		}
+	}
+
+	h.recordOutcome(ctx, operation, "failed")
+	if primaryErr != nil {
+		return zero, primaryErr
+	}
+	return zero, hedgeErr
+}
+
+func (h *HedgedProvider) hedgeDelay(operation string) (time.Duration, bool) {
+	if h.config.percentile > 0 {
+		observed, samples := metrics.ProviderLatencyQuantile(h.Name(), operation, h.config.percentile/100)
+		if observed > 0 && samples >= uint64(h.config.minSamples) {
+			return observed, true
+		}
+	}
+	return h.config.delay, h.config.delay > 0
+}
+
+func (h *HedgedProvider) recordOutcome(ctx context.Context, operation string, outcome string) {
+	metrics.RecordHedge(h.Name(), operation, h.hedge.Name(), outcome)
+	log.Printf(
+		"request_id=%s component=hedge provider=%s operation=%s hedge_provider=%s outcome=%s",
+		middleware.GetRequestIDFromContext(ctx),
+		h.Name(),
+		operation,
+		h.hedge.Name(),
+		outcome,
+	)
+}
@@ -0,0 +1,245 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alanmaizon/homer/backend/internal/domain"
+	"github.com/alanmaizon/homer/backend/internal/metrics"
+)
+
+// triggerClock blocks Sleep until the test fires it, so hedges start exactly
+// when the test decides.
+type triggerClock struct {
+	fire chan struct{}
+}
+
+func (c *triggerClock) Now() time.Time {
+	return time.Now()
+}
+
+func (c *triggerClock) Sleep(ctx context.Context, _ time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-c.fire:
+		return nil
+	}
+}
+
+// stallingProvider answers Rewrite once released, or returns the context
+// error when cancelled first.
+type stallingProvider struct {
+	name      string
+	reply     string
+	err       error
+	started   chan struct{}
+	release   chan struct{}
+	cancelled chan struct{}
+}
+
+func newStallingProvider(name string, reply string, err error) *stallingProvider {
+	return &stallingProvider{
+		name:      name,
+		reply:     reply,
+		err:       err,
+		started:   make(chan struct{}, 1),
+		release:   make(chan struct{}),
+		cancelled: make(chan struct{}, 1),
+	}
+}
+
+func (s *stallingProvider) Name() string {
+	return s.name
+}
+
+func (s *stallingProvider) Summarize(_ context.Context, _ []domain.Document, _ string, _ string, _ domain.GenerationParams) (string, error) {
+	return "", errors.New("not implemented")
+}
+
+func (s *stallingProvider) Rewrite(ctx context.Context, _ string, _ string, _ string, _ domain.GenerationParams) (string, error) {
+	return observeProviderOperation(ctx, s.name, "rewrite", func() (string, error) {
+		s.started <- struct{}{}
+		select {
+		case <-ctx.Done():
+			s.cancelled <- struct{}{}
+			return "", ctx.Err()
+		case <-s.release:
+			return s.reply, s.err
+		}
+	})
+}
+
+func (s *stallingProvider) Generate(_ context.Context, _ []Message, _ domain.GenerationParams) (string, error) {
+	return "", errors.New("not implemented")
+}
+
+func rewriteAsync(provider LLMProvider) chan hedgeResult[string] {
+	done := make(chan hedgeResult[string], 1)
+	go func() {
+		value, err := provider.Rewrite(context.Background(), "text", "simplify", "", domain.GenerationParams{})
+		done <- hedgeResult[string]{value: value, err: err}
+	}()
+	return done
+}
+
+func TestHedgedProviderHedgeWinsAndCancelsPrimary(t *testing.T) {
+	metrics.ResetForTests()
+
+	primary := newStallingProvider("openai", "slow", nil)
+	alternate := newStallingProvider("gemini", "fast", nil)
+	clock := &triggerClock{fire: make(chan struct{})}
+	provider := newHedgedProvider(primary, alternate, hedgeConfig{delay: time.Second}, clock)
+
+	done := rewriteAsync(provider)
+	<-primary.started
+	close(clock.fire)
+	<-alternate.started
+	close(alternate.release)
+
+	result := <-done
+	if result.err != nil || result.value != "fast" {
+		t.Fatalf("expected hedge result, got %q err=%v", result.value, result.err)
+	}
+	select {
+	case <-primary.cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("expected the losing primary call to be cancelled")
+	}
+
+	output := metrics.PrometheusText()
+	want := `homer_provider_hedges_total{provider="openai",operation="rewrite",hedge_provider="gemini",outcome="hedge_won"} 1`
+	if !strings.Contains(output, want) {
+		t.Fatalf("expected %q in metrics output:\n%s", want, output)
+	}
+	// The cancelled primary may still be finishing; wait for its metrics.
+	time.Sleep(10 * time.Millisecond)
+	if output := metrics.PrometheusText(); strings.Contains(output, `provider="openai",operation="rewrite",status="error"`) {
+		t.Fatalf("expected the cancelled primary not to count as a provider error:\n%s", output)
+	}
+}
+
+func TestHedgedProviderSkipsHedgeWhenPrimaryIsFast(t *testing.T) {
+	metrics.ResetForTests()
+
+	primary := newStallingProvider("openai", "quick", nil)
+	alternate := newStallingProvider("gemini", "unused", nil)
+	close(primary.release)
+	provider := newHedgedProvider(primary, alternate, hedgeConfig{delay: time.Second}, &triggerClock{fire: make(chan struct{})})
+
+	result := <-rewriteAsync(provider)
+	if result.err != nil || result.value != "quick" {
+		t.Fatalf("expected primary result, got %q err=%v", result.value, result.err)
+	}
+	select {
+	case <-alternate.started:
+		t.Fatal("expected no hedge for a fast primary")
+	default:
+	}
+	if strings.Contains(metrics.PrometheusText(), "homer_provider_hedges_total{") {
+		t.Fatal("expected no hedge metrics")
+	}
+}
+
+func TestHedgedProviderFailureHandling(t *testing.T) {
+	metrics.ResetForTests()
+
+	primaryErr := &providerHTTPError{provider: "openai", statusCode: 503, message: "unavailable"}
+
+	// A failed primary waits for the hedge.
+	primary := newStallingProvider("openai", "", primaryErr)
+	alternate := newStallingProvider("openai", "recovered", nil)
+	clock := &triggerClock{fire: make(chan struct{})}
+	done := rewriteAsync(newHedgedProvider(primary, alternate, hedgeConfig{delay: time.Second}, clock))
+	<-primary.started
+	close(clock.fire)
+	<-alternate.started
+	close(primary.release)
+	close(alternate.release)
+	if result := <-done; result.err != nil || result.value != "recovered" {
+		t.Fatalf("expected hedge to recover, got %q err=%v", result.value, result.err)
+	}
+
+	// When both fail the primary error is surfaced.
+	primary = newStallingProvider("openai", "", primaryErr)
+	alternate = newStallingProvider("openai", "", errors.New("hedge failed"))
+	clock = &triggerClock{fire: make(chan struct{})}
+	done = rewriteAsync(newHedgedProvider(primary, alternate, hedgeConfig{delay: time.Second}, clock))
+	<-primary.started
+	close(clock.fire)
+	<-alternate.started
+	close(alternate.release)
+	close(primary.release)
+	if result := <-done; !errors.Is(result.err, primaryErr) {
+		t.Fatalf("expected primary error, got %v", result.err)
+	}
+
+	output := metrics.PrometheusText()
+	for _, want := range []string{
+		`homer_provider_hedges_total{provider="openai",operation="rewrite",hedge_provider="openai",outcome="hedge_won"} 1`,
+		`homer_provider_hedges_total{provider="openai",operation="rewrite",hedge_provider="openai",outcome="failed"} 1`,
+	} {
+		if !strings.Contains(output, want) {
+			t.Fatalf("expected %q in metrics output:\n%s", want, output)
+		}
+	}
+}
+
+func TestHedgedProviderDelayFromObservedPercentile(t *testing.T) {
+	metrics.ResetForTests()
+
+	provider := newHedgedProvider(NewMockProvider(), NewMockProvider(), hedgeConfig{
+		delay:      750 * time.Millisecond,
+		percentile: 90,
+		minSamples: 10,
+	}, realProviderClock{})
+
+	if delay, ok := provider.hedgeDelay("summarize"); !ok || delay != 750*time.Millisecond {
+		t.Fatalf("expected fixed delay before enough samples, got %s ok=%v", delay, ok)
+	}
+
+	for i := 0; i < 10; i++ {
+		metrics.RecordProviderCall("mock", "summarize", "success", "none", 40*time.Millisecond)
+	}
+	delay, ok := provider.hedgeDelay("summarize")
+	if !ok || delay < 25*time.Millisecond || delay > 50*time.Millisecond {
+		t.Fatalf("expected p90 from the 25-50ms bucket, got %s ok=%v", delay, ok)
+	}
+
+	disabled := newHedgedProvider(NewMockProvider(), NewMockProvider(), hedgeConfig{percentile: 99, minSamples: 100}, realProviderClock{})
+	if _, ok := disabled.hedgeDelay("summarize"); ok {
+		t.Fatal("expected no hedge without samples or a fixed delay")
+	}
+}
+
+func TestWithHedgingFromEnv(t *testing.T) {
+	t.Setenv("LLM_HEDGE_DELAY_MS", "")
+	t.Setenv("LLM_HEDGE_PERCENTILE", "")
+	t.Setenv("LLM_HEDGE_PROVIDER", "")
+	if _, ok := withHedgingFromEnv(NewMockProvider()).(*HedgedProvider); ok {
+		t.Fatal("expected hedging to be off by default")
+	}
+
+	t.Setenv("LLM_HEDGE_PERCENTILE", "95")
+	t.Setenv("LLM_HEDGE_MIN_SAMPLES", "5")
+	t.Setenv("LLM_HEDGE_PROVIDER", "mock")
+	t.Setenv("OPENAI_API_KEY", "test-key")
+	primary, err := NewNamedProviderFromEnv("openai")
+	if err != nil {
+		t.Fatalf("NewNamedProviderFromEnv returned error: %v", err)
+	}
+
+	hedged, ok := withHedgingFromEnv(primary).(*HedgedProvider)
+	if !ok {
+		t.Fatal("expected a hedged provider")
+	}
+	if hedged.hedge.Name() != "mock" || hedged.config.percentile != 95 || hedged.config.minSamples != 5 {
+		t.Fatalf("unexpected hedge setup: hedge=%s config=%+v", hedged.hedge.Name(), hedged.config)
+	}
+	if _, err := EmbedderFor(hedged); err != nil {
+		t.Fatalf("expected embeddings to pass through the hedge wrapper: %v", err)
+	}
+}
@@ -0,0 +1,355 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alanmaizon/homer/backend/internal/domain"
+	"github.com/alanmaizon/homer/backend/internal/metrics"
+	"github.com/alanmaizon/homer/backend/internal/middleware"
+)
+
+// ErrProviderSaturated is matched by errors returned when outbound capacity
+// for a provider cannot be obtained before the caller's deadline.
+var ErrProviderSaturated = errors.New("provider capacity unavailable")
+
+type providerSaturatedError struct {
+	provider string
+	reason   string
+}
+
+func (e *providerSaturatedError) Error() string {
+	return fmt.Sprintf("%s capacity unavailable: %s", e.provider, e.reason)
+}
+
+func (e *providerSaturatedError) Unwrap() error {
+	return ErrProviderSaturated
+}
+
+type limiterConfig struct {
+	maxInFlight       int
+	requestsPerMinute int
+	tokensPerMinute   int
+}
+
+func (c limiterConfig) enabled() bool {
+	return c.maxInFlight > 0 || c.requestsPerMinute > 0 || c.tokensPerMinute > 0
+}
+
+// loadLimiterConfigFromEnv reads LLM_MAX_IN_FLIGHT, LLM_REQUESTS_PER_MINUTE
+// and LLM_TOKENS_PER_MINUTE, each overridable per provider with the
+// provider's env prefix (e.g. OPENAI_REQUESTS_PER_MINUTE). Zero disables a
+// limit.
+func loadLimiterConfigFromEnv(provider string) limiterConfig {
+	prefix := providerEnvPrefix(provider)
+	read := func(suffix string) int {
+		for _, key := range []string{prefix + "_" + suffix, "LLM_" + suffix} {
+			raw := strings.TrimSpace(os.Getenv(key))
+			if raw == "" {
+				continue
+			}
+			if parsed, err := strconv.Atoi(raw); err == nil && parsed >= 0 {
+				return parsed
+			}
+		}
+		return 0
+	}
+
+	return limiterConfig{
+		maxInFlight:       read("MAX_IN_FLIGHT"),
+		requestsPerMinute: read("REQUESTS_PER_MINUTE"),
+		tokensPerMinute:   read("TOKENS_PER_MINUTE"),
+	}
+}
+
+// providerEnvPrefix maps a provider name to the prefix of its env settings.
+func providerEnvPrefix(provider string) string {
+	switch {
+	case provider == openAICompatibleProviderName:
+		return strings.ToUpper(defaultOpenAICompatibleInstance)
+	case strings.HasPrefix(provider, openAICompatibleProviderName+":"):
+		provider = strings.TrimPrefix(provider, openAICompatibleProviderName+":")
+	}
+	return strings.ToUpper(promptNameUnsafeChars.ReplaceAllString(strings.ReplaceAll(provider, "-", "_"), "_"))
+}
+
+// LimitedProvider bounds the outbound calls made to a provider: at most
+// maxInFlight concurrent calls, plus request and token budgets per minute.
+// Callers queue until capacity frees up; a call whose rate limit wait would
+// outlast its context deadline fails fast with ErrProviderSaturated, and one
+// whose context ends while queued returns the context's error.
+type LimitedProvider struct {
+	LLMProvider
+	limiter *providerLimiter
+}
+
+func newLimitedProvider(provider LLMProvider, config limiterConfig, clock providerClock) *LimitedProvider {
+	return &LimitedProvider{
+		LLMProvider: provider,
+		limiter:     newProviderLimiter(provider.Name(), config, clock),
+	}
+}
+
+// withLimitsFromEnv wraps provider when any outbound limit is configured.
+func withLimitsFromEnv(provider LLMProvider) LLMProvider {
+	config := loadLimiterConfigFromEnv(provider.Name())
+	if !config.enabled() {
+		return provider
+	}
+	return newLimitedProvider(provider, config, realProviderClock{})
+}
+
+// Unwrap returns the wrapped provider.
+func (l *LimitedProvider) Unwrap() LLMProvider {
+	return l.LLMProvider
+}
+
+func (l *LimitedProvider) Summarize(ctx context.Context, docs []domain.Document, style string, instructions string, params domain.GenerationParams) (string, error) {
+	parts := make([]string, 0, len(docs)+1)
+	parts = append(parts, instructions)
+	for _, doc := range docs {
+		parts = append(parts, doc.Title, doc.Content)
+	}
+
+	release, err := l.limiter.acquire(ctx, requestTokenCost(params, parts...))
+	if err != nil {
+		return "", err
+	}
+	defer release()
+	return l.LLMProvider.Summarize(ctx, docs, style, instructions, params)
+}
+
+func (l *LimitedProvider) Rewrite(ctx context.Context, text string, mode string, instructions string, params domain.GenerationParams) (string, error) {
+	release, err := l.limiter.acquire(ctx, requestTokenCost(params, text, instructions))
+	if err != nil {
+		return "", err
+	}
+	defer release()
+	return l.LLMProvider.Rewrite(ctx, text, mode, instructions, params)
+}
+
+func (l *LimitedProvider) Generate(ctx context.Context, messages []Message, params domain.GenerationParams) (string, error) {
+	release, err := l.limiter.acquire(ctx, requestTokenCost(params, messageParts(messages)...))
+	if err != nil {
+		return "", err
+	}
+	defer release()
+	return l.LLMProvider.Generate(ctx, messages, params)
+}
+
+func (l *LimitedProvider) supportsTools() bool {
+	return supportsTools(l.LLMProvider)
+}
+
+func (l *LimitedProvider) GenerateWithTools(ctx context.Context, messages []Message, tools []ToolDefinition, params domain.GenerationParams) (ToolTurn, error) {
+	caller, err := ToolCallerFor(l.LLMProvider)
+	if err != nil {
+		return ToolTurn{}, err
+	}
+
+	release, err := l.limiter.acquire(ctx, requestTokenCost(params, messageParts(messages)...))
+	if err != nil {
+		return ToolTurn{}, err
+	}
+	defer release()
+	return caller.GenerateWithTools(ctx, messages, tools, params)
+}
+
+func (l *LimitedProvider) supportsEmbeddings() bool {
+	return supportsEmbeddings(l.LLMProvider)
+}
+
+func (l *LimitedProvider) EmbeddingModel() string {
+	return embeddingModelOf(l.LLMProvider)
+}
+
+func (l *LimitedProvider) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	embedder, err := EmbedderFor(l.LLMProvider)
+	if err != nil {
+		return nil, err
+	}
+
+	release, err := l.limiter.acquire(ctx, requestTokenCost(domain.GenerationParams{}, texts...))
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+	return embedder.Embed(ctx, texts)
+}
+
+// messageParts lists the text a conversation sends, including the arguments
+// of earlier tool calls.
+func messageParts(messages []Message) []string {
+	parts := make([]string, 0, len(messages))
+	for _, message := range messages {
+		parts = append(parts, message.Content)
+		for _, call := range message.ToolCalls {
+			parts = append(parts, string(call.Arguments))
+		}
+	}
+	return parts
+}
+
+// requestTokenCost estimates prompt tokens at roughly four characters per
+// token and adds the requested completion budget.
+func requestTokenCost(params domain.GenerationParams, parts ...string) int {
+	characters := 0
+	for _, part := range parts {
+		characters += len(part)
+	}
+
+	cost := (characters + 3) / 4
+	if params.MaxTokens != nil {
+		cost += *params.MaxTokens
+	}
+	return cost
+}
+
+type providerLimiter struct {
+	provider string
+	clock    providerClock
+	slots    chan struct{}
+	requests *tokenBucket
+	tokens   *tokenBucket
+}
+
+func newProviderLimiter(provider string, config limiterConfig, clock providerClock) *providerLimiter {
+	limiter := &providerLimiter{provider: provider, clock: clock}
+	if config.maxInFlight > 0 {
+		limiter.slots = make(chan struct{}, config.maxInFlight)
+	}
+	now := clock.Now()
+	if config.requestsPerMinute > 0 {
+		limiter.requests = newTokenBucket(config.requestsPerMinute, time.Minute, now)
+	}
+	if config.tokensPerMinute > 0 {
+		limiter.tokens = newTokenBucket(config.tokensPerMinute, time.Minute, now)
+	}
+	return limiter
+}
+
+// acquire reserves rate budget, waits for it to become available, then takes
+// a concurrency slot. The returned release func frees the slot.
+func (l *providerLimiter) acquire(ctx context.Context, tokenCost int) (func(), error) {
+	started := l.clock.Now()
+	metrics.AddProviderQueueDepth(l.provider, 1)
+	defer metrics.AddProviderQueueDepth(l.provider, -1)
+
+	reject := func(reason string) (func(), error) {
+		metrics.ObserveProviderQueueWait(l.provider, "rejected", l.clock.Now().Sub(started))
+		log.Printf(
+			"request_id=%s component=llm_limiter provider=%s event=rejected reason=%s",
+			middleware.GetRequestIDFromContext(ctx),
+			l.provider,
+			reason,
+		)
+		return nil, &providerSaturatedError{provider: l.provider, reason: reason}
+	}
+	canceled := func() (func(), error) {
+		metrics.ObserveProviderQueueWait(l.provider, "canceled", l.clock.Now().Sub(started))
+		return nil, ctx.Err()
+	}
+
+	wait, cancelReservation := l.reserve(started, tokenCost)
+	if deadline, ok := ctx.Deadline(); ok && wait > 0 && !started.Add(wait).Before(deadline) {
+		cancelReservation()
+		return reject("rate limit would exceed deadline")
+	}
+	if wait > 0 {
+		if err := l.clock.Sleep(ctx, wait); err != nil {
+			cancelReservation()
+			return canceled()
+		}
+	}
+
+	if l.slots != nil {
+		select {
+		case l.slots <- struct{}{}:
+		case <-ctx.Done():
+			cancelReservation()
+			return canceled()
+		}
+	}
+
+	metrics.ObserveProviderQueueWait(l.provider, "admitted", l.clock.Now().Sub(started))
+	return func() {
+		if l.slots != nil {
+			<-l.slots
+		}
+	}, nil
+}
+
+func (l *providerLimiter) reserve(now time.Time, tokenCost int) (time.Duration, func()) {
+	var wait time.Duration
+	var undo []func()
+
+	if l.requests != nil {
+		delay, cancel := l.requests.reserve(now, 1)
+		wait = max(wait, delay)
+		undo = append(undo, cancel)
+	}
+	if l.tokens != nil && tokenCost > 0 {
+		delay, cancel := l.tokens.reserve(now, tokenCost)
+		wait = max(wait, delay)
+		undo = append(undo, cancel)
+	}
+
+	return wait, func() {
+		for _, cancel := range undo {
+			cancel()
+		}
+	}
+}
+
+// tokenBucket refills continuously up to capacity. Reservations may drive the
+// balance negative; the deficit is the time the caller must wait.
+type tokenBucket struct {
+	mu       sync.Mutex
+	capacity float64
+	perSec   float64
+	balance  float64
+	updated  time.Time
+}
+
+func newTokenBucket(limit int, per time.Duration, now time.Time) *tokenBucket {
+	return &tokenBucket{
+		capacity: float64(limit),
+		perSec:   float64(limit) / per.Seconds(),
+		balance:  float64(limit),
+		updated:  now,
+	}
+}
+
+func (b *tokenBucket) reserve(now time.Time, amount int) (time.Duration, func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if elapsed := now.Sub(b.updated); elapsed > 0 {
+		b.balance = math.Min(b.capacity, b.balance+elapsed.Seconds()*b.perSec)
+		b.updated = now
+	}
+
+	// A single request larger than the bucket could never be admitted, so it
+	// is charged the full capacity instead.
+	cost := math.Min(float64(amount), b.capacity)
+	b.balance -= cost
+
+	var wait time.Duration
+	if b.balance < 0 {
+		wait = time.Duration(-b.balance / b.perSec * float64(time.Second))
+	}
+
+	return wait, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		b.balance = math.Min(b.capacity, b.balance+cost)
+	}
+}
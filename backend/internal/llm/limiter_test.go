@@ -0,0 +1,186 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alanmaizon/homer/backend/internal/domain"
+	"github.com/alanmaizon/homer/backend/internal/metrics"
+)
+
+type blockingProvider struct {
+	MockProvider
+	started chan struct{}
+	unblock chan struct{}
+}
+
+func (b *blockingProvider) Name() string {
+	return "blocking"
+}
+
+func (b *blockingProvider) Rewrite(ctx context.Context, text string, mode string, instructions string, params domain.GenerationParams) (string, error) {
+	b.started <- struct{}{}
+	<-b.unblock
+	return b.MockProvider.Rewrite(ctx, text, mode, instructions, params)
+}
+
+func TestLimitedProviderReturnsContextErrorWhenInFlightWaitEnds(t *testing.T) {
+	metrics.ResetForTests()
+
+	inner := &blockingProvider{started: make(chan struct{}), unblock: make(chan struct{})}
+	provider := newLimitedProvider(inner, limiterConfig{maxInFlight: 1}, realProviderClock{})
+
+	firstDone := make(chan error, 1)
+	go func() {
+		_, err := provider.Rewrite(context.Background(), "first", "simplify", "", domain.GenerationParams{})
+		firstDone <- err
+	}()
+	<-inner.started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := provider.Rewrite(ctx, "second", "simplify", "", domain.GenerationParams{})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+	}
+
+	close(inner.unblock)
+	if err := <-firstDone; err != nil {
+		t.Fatalf("first call returned error: %v", err)
+	}
+
+	output := metrics.PrometheusText()
+	for _, want := range []string{
+		`homer_provider_queue_depth{provider="blocking"} 0`,
+		`homer_provider_queue_wait_seconds_count{outcome="admitted",provider="blocking"} 1`,
+		`homer_provider_queue_wait_seconds_count{outcome="canceled",provider="blocking"} 1`,
+	} {
+		if !strings.Contains(output, want) {
+			t.Fatalf("expected metrics to contain %q\n%s", want, output)
+		}
+	}
+}
+
+func TestProviderLimiterQueuesForRequestBudget(t *testing.T) {
+	clock := newFakeClock()
+	limiter := newProviderLimiter("openai", limiterConfig{requestsPerMinute: 2}, clock)
+
+	for i := 0; i < 2; i++ {
+		release, err := limiter.acquire(context.Background(), 0)
+		if err != nil {
+			t.Fatalf("acquire %d returned error: %v", i, err)
+		}
+		release()
+	}
+	if len(clock.sleeps) != 0 {
+		t.Fatalf("expected burst within budget to be admitted immediately, got %v", clock.sleeps)
+	}
+
+	release, err := limiter.acquire(context.Background(), 0)
+	if err != nil {
+		t.Fatalf("third acquire returned error: %v", err)
+	}
+	release()
+	if len(clock.sleeps) != 1 || clock.sleeps[0] != 30*time.Second {
+		t.Fatalf("expected a 30s wait for the next request slot, got %v", clock.sleeps)
+	}
+}
+
+func TestProviderLimiterRejectsWaitBeyondDeadline(t *testing.T) {
+	clock := newFakeClock()
+	limiter := newProviderLimiter("openai", limiterConfig{tokensPerMinute: 1000}, clock)
+
+	release, err := limiter.acquire(context.Background(), 800)
+	if err != nil {
+		t.Fatalf("first acquire returned error: %v", err)
+	}
+	release()
+
+	ctx, cancel := context.WithDeadline(context.Background(), clock.now.Add(10*time.Second))
+	defer cancel()
+	if _, err := limiter.acquire(ctx, 800); !errors.Is(err, ErrProviderSaturated) {
+		t.Fatalf("expected ErrProviderSaturated, got %v", err)
+	}
+	if len(clock.sleeps) != 0 {
+		t.Fatalf("expected fail-fast without waiting, got %v", clock.sleeps)
+	}
+
+	// The rejected reservation is returned, so a caller with enough time
+	// waits only for its own deficit: 600 tokens at 1000/min is 36s.
+	release, err = limiter.acquire(context.Background(), 800)
+	if err != nil {
+		t.Fatalf("third acquire returned error: %v", err)
+	}
+	release()
+	if len(clock.sleeps) != 1 || clock.sleeps[0] != 36*time.Second {
+		t.Fatalf("expected a 36s wait, got %v", clock.sleeps)
+	}
+}
+
+func TestProviderLimiterReturnsReservationWhenSlotWaitIsCancelled(t *testing.T) {
+	clock := newFakeClock()
+	limiter := newProviderLimiter("openai", limiterConfig{maxInFlight: 1, requestsPerMinute: 2}, clock)
+
+	holder, err := limiter.acquire(context.Background(), 0)
+	if err != nil {
+		t.Fatalf("first acquire returned error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := limiter.acquire(ctx, 0); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	holder()
+
+	// The cancelled call gave its request back, so the budget of 2 still
+	// has room for one more without waiting.
+	release, err := limiter.acquire(context.Background(), 0)
+	if err != nil {
+		t.Fatalf("third acquire returned error: %v", err)
+	}
+	release()
+	if len(clock.sleeps) != 0 {
+		t.Fatalf("expected no wait for the returned reservation, got %v", clock.sleeps)
+	}
+}
+
+func TestLoadLimiterConfigFromEnvProviderOverrides(t *testing.T) {
+	t.Setenv("LLM_MAX_IN_FLIGHT", "8")
+	t.Setenv("LLM_REQUESTS_PER_MINUTE", "600")
+	t.Setenv("LLM_TOKENS_PER_MINUTE", "")
+	t.Setenv("OPENAI_MAX_IN_FLIGHT", "")
+	t.Setenv("OPENAI_REQUESTS_PER_MINUTE", "60")
+	t.Setenv("OPENAI_TOKENS_PER_MINUTE", "90000")
+	t.Setenv("GATEWAY_MAX_IN_FLIGHT", "2")
+
+	openai := loadLimiterConfigFromEnv("openai")
+	if openai != (limiterConfig{maxInFlight: 8, requestsPerMinute: 60, tokensPerMinute: 90000}) {
+		t.Fatalf("unexpected openai limits: %+v", openai)
+	}
+
+	gateway := loadLimiterConfigFromEnv("openai_compatible:gateway")
+	if gateway.maxInFlight != 2 || gateway.requestsPerMinute != 600 {
+		t.Fatalf("unexpected gateway limits: %+v", gateway)
+	}
+}
+
+func TestWithLimitsFromEnvSkipsUnconfiguredProviders(t *testing.T) {
+	for _, key := range []string{"LLM_MAX_IN_FLIGHT", "LLM_REQUESTS_PER_MINUTE", "LLM_TOKENS_PER_MINUTE", "MOCK_MAX_IN_FLIGHT", "MOCK_REQUESTS_PER_MINUTE", "MOCK_TOKENS_PER_MINUTE"} {
+		t.Setenv(key, "")
+	}
+
+	provider := NewMockProvider()
+	if wrapped := withLimitsFromEnv(provider); wrapped != LLMProvider(provider) {
+		t.Fatalf("expected provider to be returned unwrapped, got %T", wrapped)
+	}
+
+	t.Setenv("MOCK_MAX_IN_FLIGHT", "1")
+	limited, ok := withLimitsFromEnv(provider).(*LimitedProvider)
+	if !ok || limited.Unwrap() != LLMProvider(provider) || limited.Name() != "mock" {
+		t.Fatalf("expected limited wrapper around mock, got %T", limited)
+	}
+}
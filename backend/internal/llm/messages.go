@@ -0,0 +1,40 @@
+package llm
+
+type MessageRole string
+
+const (
+	MessageRoleSystem    MessageRole = "system"
+	MessageRoleUser      MessageRole = "user"
+	MessageRoleAssistant MessageRole = "assistant"
+	MessageRoleTool      MessageRole = "tool"
+)
+
+// Message is one turn of a provider conversation. System messages carry
+// instructions; user messages carry the task input, including untrusted
+// document content. Assistant messages may carry the tool calls the model
+// made, and tool messages carry a call's result, untrusted like documents.
+type Message struct {
+	Role    MessageRole `json:"role"`
+	Content string      `json:"content"`
+
+	ToolCalls  []ToolCall `json:"toolCalls,omitempty"`
+	ToolCallID string     `json:"toolCallId,omitempty"`
+	ToolName   string     `json:"toolName,omitempty"`
+}
+
+func systemAndUserMessages(system string, user string) []Message {
+	messages := make([]Message, 0, 2)
+	if system != "" {
+		messages = append(messages, Message{Role: MessageRoleSystem, Content: system})
+	}
+	return append(messages, Message{Role: MessageRoleUser, Content: user})
+}
+
+func lastUserMessage(messages []Message) string {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == MessageRoleUser {
+			return messages[i].Content
+		}
+	}
+	return ""
+}
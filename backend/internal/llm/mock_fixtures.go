@@ -0,0 +1,332 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/alanmaizon/homer/backend/internal/middleware"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	mockFixtureErrorTimeout         = "timeout"
+	mockFixtureErrorContentFiltered = "content_filtered"
+)
+
+// ErrMockFixturesUnavailable is matched by errors returned when fixtures are
+// reloaded but the current provider is not a mock loaded from a file.
+var ErrMockFixturesUnavailable = errors.New("mock fixtures are not configured")
+
+// mockFixtureFile is the YAML or JSON document named by MOCK_FIXTURES_FILE.
+type mockFixtureFile struct {
+	Fixtures []mockFixtureSpec `yaml:"fixtures"`
+}
+
+// mockFixtureSpec maps requests matching Match to a canned outcome. When
+// Sequence is set its steps are served in order and the last one repeats;
+// otherwise the inline step is served on every match.
+type mockFixtureSpec struct {
+	Name            string           `yaml:"name"`
+	Match           mockFixtureMatch `yaml:"match"`
+	mockFixtureStep `yaml:",inline"`
+	Sequence        []mockFixtureStep `yaml:"sequence"`
+}
+
+// mockFixtureMatch fields are all optional. Operation, Style and Mode are
+// compared case-insensitively; Content and Instructions are regular
+// expressions.
+type mockFixtureMatch struct {
+	Operation    string `yaml:"operation"`
+	Style        string `yaml:"style"`
+	Mode         string `yaml:"mode"`
+	Content      string `yaml:"content"`
+	Instructions string `yaml:"instructions"`
+}
+
+type mockFixtureStep struct {
+	Response  string            `yaml:"response"`
+	LatencyMs int               `yaml:"latencyMs"`
+	Error     *mockFixtureError `yaml:"error"`
+}
+
+// mockFixtureError is an upstream HTTP failure with Status, or a timeout or
+// content_filtered failure when Kind is set.
+type mockFixtureError struct {
+	Kind         string `yaml:"kind"`
+	Status       int    `yaml:"status"`
+	Message      string `yaml:"message"`
+	RetryAfterMs int    `yaml:"retryAfterMs"`
+}
+
+type mockFixture struct {
+	name         string
+	operation    string
+	style        string
+	mode         string
+	content      *regexp.Regexp
+	instructions *regexp.Regexp
+	steps        []mockFixtureStep
+	calls        int
+}
+
+// mockRequest is the part of a provider call fixtures can match on. Content
+// is the joined document text, the text to rewrite or the last user message.
+type mockRequest struct {
+	operation    string
+	style        string
+	mode         string
+	content      string
+	instructions string
+}
+
+// MockFixturesStatus describes the fixtures loaded by the mock provider.
+type MockFixturesStatus struct {
+	Path     string `json:"path"`
+	Fixtures int    `json:"fixtures"`
+}
+
+func loadMockFixtures(path string) ([]*mockFixture, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// JSON is valid YAML, so one decoder handles both formats.
+	var file mockFixtureFile
+	decoder := yaml.NewDecoder(bytes.NewReader(raw))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&file); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	fixtures := make([]*mockFixture, 0, len(file.Fixtures))
+	for i, spec := range file.Fixtures {
+		name := strings.TrimSpace(spec.Name)
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+		fixture, err := compileMockFixture(name, spec)
+		if err != nil {
+			return nil, fmt.Errorf("fixture %s: %w", name, err)
+		}
+		fixtures = append(fixtures, fixture)
+	}
+	return fixtures, nil
+}
+
+func compileMockFixture(name string, spec mockFixtureSpec) (*mockFixture, error) {
+	fixture := &mockFixture{
+		name:      name,
+		operation: strings.ToLower(strings.TrimSpace(spec.Match.Operation)),
+		style:     strings.TrimSpace(spec.Match.Style),
+		mode:      strings.TrimSpace(spec.Match.Mode),
+		steps:     spec.Sequence,
+	}
+	switch fixture.operation {
+	case "", "summarize", "rewrite", "generate":
+	default:
+		return nil, fmt.Errorf("unknown operation %q", spec.Match.Operation)
+	}
+
+	var err error
+	if fixture.content, err = compileMockPattern(spec.Match.Content); err != nil {
+		return nil, fmt.Errorf("content: %w", err)
+	}
+	if fixture.instructions, err = compileMockPattern(spec.Match.Instructions); err != nil {
+		return nil, fmt.Errorf("instructions: %w", err)
+	}
+
+	if len(fixture.steps) == 0 {
+		fixture.steps = []mockFixtureStep{spec.mockFixtureStep}
+	} else if spec.Response != "" || spec.Error != nil || spec.LatencyMs != 0 {
+		return nil, errors.New("set either sequence or response, error and latencyMs")
+	}
+	for i, step := range fixture.steps {
+		if err := step.validate(); err != nil {
+			return nil, fmt.Errorf("step %d: %w", i+1, err)
+		}
+	}
+	return fixture, nil
+}
+
+func compileMockPattern(pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	return regexp.Compile(pattern)
+}
+
+func (s mockFixtureStep) validate() error {
+	if s.LatencyMs < 0 {
+		return errors.New("latencyMs must not be negative")
+	}
+	if s.Error == nil {
+		if s.Response == "" {
+			return errors.New("response or error is required")
+		}
+		return nil
+	}
+
+	switch s.Error.Kind {
+	case "":
+		if s.Error.Status < 400 || s.Error.Status > 599 {
+			return fmt.Errorf("error status must be between 400 and 599, got %d", s.Error.Status)
+		}
+	case mockFixtureErrorTimeout, mockFixtureErrorContentFiltered:
+	default:
+		return fmt.Errorf("unknown error kind %q", s.Error.Kind)
+	}
+	if s.Error.RetryAfterMs < 0 {
+		return errors.New("error retryAfterMs must not be negative")
+	}
+	return nil
+}
+
+func (f *mockFixture) matches(req mockRequest) bool {
+	return (f.operation == "" || f.operation == req.operation) &&
+		(f.style == "" || strings.EqualFold(f.style, req.style)) &&
+		(f.mode == "" || strings.EqualFold(f.mode, req.mode)) &&
+		(f.content == nil || f.content.MatchString(req.content)) &&
+		(f.instructions == nil || f.instructions.MatchString(req.instructions))
+}
+
+// nextStep advances the fixture's sequence. Callers hold the provider lock.
+func (f *mockFixture) nextStep() mockFixtureStep {
+	step := f.steps[min(f.calls, len(f.steps)-1)]
+	f.calls++
+	return step
+}
+
+// scripted serves the first fixture matching req. ok is false when no
+// fixture matches and the caller should fall back to echoing.
+func (m *MockProvider) scripted(ctx context.Context, req mockRequest) (response string, ok bool, err error) {
+	m.mu.Lock()
+	var (
+		fixture *mockFixture
+		step    mockFixtureStep
+	)
+	for _, candidate := range m.fixtures {
+		if candidate.matches(req) {
+			fixture = candidate
+			step = candidate.nextStep()
+			break
+		}
+	}
+	m.mu.Unlock()
+	if fixture == nil {
+		return "", false, nil
+	}
+
+	log.Printf(
+		"request_id=%s component=mock_fixtures operation=%s fixture=%s latency_ms=%d error=%t",
+		middleware.GetRequestIDFromContext(ctx),
+		req.operation,
+		fixture.name,
+		step.LatencyMs,
+		step.Error != nil,
+	)
+
+	if step.LatencyMs > 0 {
+		if err := m.clock.Sleep(ctx, time.Duration(step.LatencyMs)*time.Millisecond); err != nil {
+			return "", true, err
+		}
+	}
+	if step.Error != nil {
+		return "", true, step.Error.err(m.Name(), fixture.name)
+	}
+	return step.Response, true, nil
+}
+
+func (e *mockFixtureError) err(provider string, fixture string) error {
+	message := e.Message
+	if message == "" {
+		message = "mock fixture " + fixture
+	}
+	switch e.Kind {
+	case mockFixtureErrorTimeout:
+		return fmt.Errorf("%s: %w", message, context.DeadlineExceeded)
+	case mockFixtureErrorContentFiltered:
+		return &providerContentFilterError{provider: provider, message: message}
+	default:
+		return &providerHTTPError{
+			provider:   provider,
+			statusCode: e.Status,
+			message:    message,
+			retryAfter: time.Duration(e.RetryAfterMs) * time.Millisecond,
+		}
+	}
+}
+
+// ReloadFixtures re-reads the fixtures file and resets every sequence. The
+// previous fixtures stay active when the file cannot be loaded.
+func (m *MockProvider) ReloadFixtures() (MockFixturesStatus, error) {
+	if m.fixturesPath == "" {
+		return MockFixturesStatus{}, ErrMockFixturesUnavailable
+	}
+	fixtures, err := loadMockFixtures(m.fixturesPath)
+	if err != nil {
+		log.Printf("component=mock_fixtures event=reload_failed path=%s error=%q", m.fixturesPath, err.Error())
+		return MockFixturesStatus{}, fmt.Errorf("%s: %w", m.fixturesPath, err)
+	}
+
+	m.mu.Lock()
+	m.fixtures = fixtures
+	m.mu.Unlock()
+	log.Printf("component=mock_fixtures event=loaded path=%s fixtures=%d", m.fixturesPath, len(fixtures))
+	return MockFixturesStatus{Path: m.fixturesPath, Fixtures: len(fixtures)}, nil
+}
+
+// FixturesStatus reports the loaded fixtures. ok is false when the provider
+// was not loaded from a fixtures file.
+func (m *MockProvider) FixturesStatus() (MockFixturesStatus, bool) {
+	if m.fixturesPath == "" {
+		return MockFixturesStatus{}, false
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return MockFixturesStatus{Path: m.fixturesPath, Fixtures: len(m.fixtures)}, true
+}
+
+// currentMockProvider finds the mock provider behind any decorators.
+func currentMockProvider() (*MockProvider, bool) {
+	provider := CurrentProvider()
+	for provider != nil {
+		if mock, ok := provider.(*MockProvider); ok {
+			return mock, true
+		}
+		wrapper, ok := provider.(providerWrapper)
+		if !ok {
+			break
+		}
+		provider = wrapper.Unwrap()
+	}
+	return nil, false
+}
+
+// ReloadMockFixtures reloads the fixtures file of the current mock provider.
+// It is triggered by SIGHUP and the admin API.
+func ReloadMockFixtures() (MockFixturesStatus, error) {
+	mock, ok := currentMockProvider()
+	if !ok {
+		return MockFixturesStatus{}, ErrMockFixturesUnavailable
+	}
+	return mock.ReloadFixtures()
+}
+
+// CurrentMockFixtures reports the fixtures of the current mock provider, if
+// it was loaded from a file.
+func CurrentMockFixtures() (MockFixturesStatus, bool) {
+	mock, ok := currentMockProvider()
+	if !ok {
+		return MockFixturesStatus{}, false
+	}
+	return mock.FixturesStatus()
+}
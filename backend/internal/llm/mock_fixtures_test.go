@@ -0,0 +1,162 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alanmaizon/homer/backend/internal/domain"
+)
+
+const testMockFixturesYAML = `
+fixtures:
+  - name: release-notes
+    match:
+      operation: summarize
+      style: bullet
+      content: "(?i)release notes"
+    response: |
+      - Faster imports
+      - New export connector
+    latencyMs: 250
+  - name: flaky-formal-rewrite
+    match:
+      operation: rewrite
+      mode: formal
+    sequence:
+      - error:
+          status: 429
+          message: slow down
+          retryAfterMs: 1500
+      - response: Dear team, the release has shipped.
+  - name: unsafe
+    match:
+      content: forbidden
+    error:
+      kind: content_filtered
+`
+
+func writeMockFixtures(t *testing.T, name string, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(body), 0o644); err != nil {
+		t.Fatalf("write fixtures: %v", err)
+	}
+	return path
+}
+
+func TestMockProviderServesMatchingFixtures(t *testing.T) {
+	clock := newFakeClock()
+	mock, err := newMockProviderWithFixtures(writeMockFixtures(t, "fixtures.yaml", testMockFixturesYAML), clock)
+	if err != nil {
+		t.Fatalf("load fixtures: %v", err)
+	}
+	ctx := context.Background()
+	docs := []domain.Document{{ID: "doc-1", Content: "Release notes for v2"}}
+
+	summary, err := mock.Summarize(ctx, docs, "bullet", "", domain.GenerationParams{})
+	if err != nil {
+		t.Fatalf("Summarize returned error: %v", err)
+	}
+	if summary != "- Faster imports\n- New export connector\n" {
+		t.Fatalf("unexpected fixture response %q", summary)
+	}
+	if len(clock.sleeps) != 1 || clock.sleeps[0] != 250*time.Millisecond {
+		t.Fatalf("expected scripted latency of 250ms, got %v", clock.sleeps)
+	}
+
+	summary, err = mock.Summarize(ctx, docs, "brief", "", domain.GenerationParams{})
+	if err != nil || !strings.HasPrefix(summary, "[mock summary:brief]") {
+		t.Fatalf("expected unmatched style to echo, got %q err=%v", summary, err)
+	}
+
+	_, err = mock.Rewrite(ctx, "we shipped", "formal", "", domain.GenerationParams{})
+	var httpErr *providerHTTPError
+	if !errors.As(err, &httpErr) || httpErr.statusCode != 429 || httpErr.retryAfter != 1500*time.Millisecond {
+		t.Fatalf("expected scripted 429, got %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		rewritten, err := mock.Rewrite(ctx, "we shipped", "formal", "", domain.GenerationParams{})
+		if err != nil || rewritten != "Dear team, the release has shipped." {
+			t.Fatalf("expected last sequence step to repeat, got %q err=%v", rewritten, err)
+		}
+	}
+
+	if _, err := mock.Generate(ctx, []Message{{Role: "user", Content: "something forbidden"}}, domain.GenerationParams{}); !errors.Is(err, ErrContentFiltered) {
+		t.Fatalf("expected scripted content filter, got %v", err)
+	}
+	generated, err := mock.Generate(ctx, []Message{{Role: "user", Content: "hello"}}, domain.GenerationParams{})
+	if err != nil || generated != "[mock generate] hello" {
+		t.Fatalf("expected unmatched generate to echo, got %q err=%v", generated, err)
+	}
+}
+
+func TestMockProviderLoadsJSONFixtures(t *testing.T) {
+	path := writeMockFixtures(t, "fixtures.json", `{"fixtures":[{"match":{"operation":"generate"},"error":{"kind":"timeout"}}]}`)
+	mock, err := newMockProviderWithFixtures(path, newFakeClock())
+	if err != nil {
+		t.Fatalf("load fixtures: %v", err)
+	}
+	if _, err := mock.Generate(context.Background(), []Message{{Role: "user", Content: "hi"}}, domain.GenerationParams{}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected scripted timeout, got %v", err)
+	}
+}
+
+func TestMockFixturesRejectInvalidFiles(t *testing.T) {
+	cases := map[string]string{
+		"unknown field":     "fixtures:\n  - respnse: typo\n",
+		"bad regex":         "fixtures:\n  - match: {content: \"(\"}\n    response: x\n",
+		"unknown operation": "fixtures:\n  - match: {operation: translate}\n    response: x\n",
+		"no outcome":        "fixtures:\n  - match: {operation: generate}\n",
+		"bad status":        "fixtures:\n  - error: {status: 200}\n",
+		"mixed sequence":    "fixtures:\n  - response: x\n    sequence:\n      - response: y\n",
+	}
+	for name, body := range cases {
+		t.Run(name, func(t *testing.T) {
+			if _, err := newMockProviderWithFixtures(writeMockFixtures(t, "fixtures.yaml", body), newFakeClock()); err == nil {
+				t.Fatalf("expected fixtures to be rejected")
+			}
+		})
+	}
+}
+
+func TestReloadMockFixturesKeepsPreviousFixturesOnError(t *testing.T) {
+	path := writeMockFixtures(t, "fixtures.yaml", "fixtures:\n  - response: first\n")
+	mock, err := newMockProviderWithFixtures(path, newFakeClock())
+	if err != nil {
+		t.Fatalf("load fixtures: %v", err)
+	}
+	previous := CurrentProvider()
+	t.Cleanup(func() { SetProvider(previous) })
+	SetProvider(newChaosProvider(mock, ChaosConfig{}, newFakeClock()))
+
+	if err := os.WriteFile(path, []byte("fixtures:\n  - response: second\n  - response: third\n"), 0o644); err != nil {
+		t.Fatalf("rewrite fixtures: %v", err)
+	}
+	status, err := ReloadMockFixtures()
+	if err != nil || status.Fixtures != 2 {
+		t.Fatalf("expected 2 fixtures after reload, got %+v err=%v", status, err)
+	}
+	if got, _ := mock.Generate(context.Background(), nil, domain.GenerationParams{}); got != "second" {
+		t.Fatalf("expected reloaded response, got %q", got)
+	}
+
+	if err := os.WriteFile(path, []byte("fixtures: ["), 0o644); err != nil {
+		t.Fatalf("rewrite fixtures: %v", err)
+	}
+	if _, err := ReloadMockFixtures(); err == nil {
+		t.Fatalf("expected invalid fixtures to fail reload")
+	}
+	if status, ok := CurrentMockFixtures(); !ok || status.Fixtures != 2 {
+		t.Fatalf("expected previous fixtures to stay active, got %+v ok=%v", status, ok)
+	}
+
+	SetProvider(NewMockProvider())
+	if _, err := ReloadMockFixtures(); !errors.Is(err, ErrMockFixturesUnavailable) {
+		t.Fatalf("expected ErrMockFixturesUnavailable without a fixtures file, got %v", err)
+	}
+}
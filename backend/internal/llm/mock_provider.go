@@ -3,27 +3,65 @@ package llm
 import (
 	"context"
 	"fmt"
+	"os"
 	"strings"
+	"sync"
 
 	"github.com/alanmaizon/homer/backend/internal/domain"
 )
 
-type MockProvider struct{}
+// MockProvider echoes its input. When loaded from a fixtures file it first
+// serves the canned responses, latencies and errors scripted there and echoes
+// only requests no fixture matches.
+type MockProvider struct {
+	clock        providerClock
+	fixturesPath string
+
+	mu       sync.Mutex
+	fixtures []*mockFixture
+}
 
 func NewMockProvider() *MockProvider {
-	return &MockProvider{}
+	return &MockProvider{clock: realProviderClock{}}
+}
+
+// NewMockProviderFromEnv reads MOCK_FIXTURES_FILE, a YAML or JSON fixtures
+// file. Without it the provider only echoes.
+func NewMockProviderFromEnv() (*MockProvider, error) {
+	path := strings.TrimSpace(os.Getenv("MOCK_FIXTURES_FILE"))
+	if path == "" {
+		return NewMockProvider(), nil
+	}
+	return newMockProviderWithFixtures(path, realProviderClock{})
+}
+
+func newMockProviderWithFixtures(path string, clock providerClock) (*MockProvider, error) {
+	mock := &MockProvider{clock: clock, fixturesPath: path}
+	if _, err := mock.ReloadFixtures(); err != nil {
+		return nil, fmt.Errorf("MOCK_FIXTURES_FILE: %w", err)
+	}
+	return mock, nil
 }
 
 func (m *MockProvider) Name() string {
 	return "mock"
 }
 
-func (m *MockProvider) Summarize(ctx context.Context, docs []domain.Document, style string, instructions string) (string, error) {
+func (m *MockProvider) Model() string {
+	return "mock"
+}
+
+func (m *MockProvider) Summarize(ctx context.Context, docs []domain.Document, style string, instructions string, params domain.GenerationParams) (string, error) {
 	return observeProviderOperation(ctx, m.Name(), "summarize", func() (string, error) {
 		parts := make([]string, 0, len(docs))
 		for _, doc := range docs {
 			parts = append(parts, strings.TrimSpace(doc.Content))
 		}
+		request := mockRequest{operation: "summarize", style: style, content: strings.Join(parts, "\n\n"), instructions: instructions}
+		if response, ok, err := m.scripted(ctx, request); ok {
+			return response, err
+		}
+
 		body := strings.TrimSpace(strings.Join(parts, " "))
 		if body == "" {
 			body = "No document content provided."
@@ -35,8 +73,13 @@ func (m *MockProvider) Summarize(ctx context.Context, docs []domain.Document, st
 	})
 }
 
-func (m *MockProvider) Rewrite(ctx context.Context, text string, mode string, instructions string) (string, error) {
+func (m *MockProvider) Rewrite(ctx context.Context, text string, mode string, instructions string, params domain.GenerationParams) (string, error) {
 	return observeProviderOperation(ctx, m.Name(), "rewrite", func() (string, error) {
+		request := mockRequest{operation: "rewrite", mode: mode, content: text, instructions: instructions}
+		if response, ok, err := m.scripted(ctx, request); ok {
+			return response, err
+		}
+
 		rewritten := strings.TrimSpace(text)
 		if rewritten == "" {
 			rewritten = "No text provided."
@@ -47,3 +90,17 @@ func (m *MockProvider) Rewrite(ctx context.Context, text string, mode string, in
 		return fmt.Sprintf("[mock rewrite:%s] %s", mode, rewritten), nil
 	})
 }
+
+func (m *MockProvider) Generate(ctx context.Context, messages []Message, _ domain.GenerationParams) (string, error) {
+	return observeProviderOperation(ctx, m.Name(), "generate", func() (string, error) {
+		if response, ok, err := m.scripted(ctx, mockRequest{operation: "generate", content: lastUserMessage(messages)}); ok {
+			return response, err
+		}
+
+		content := strings.TrimSpace(lastUserMessage(messages))
+		if content == "" {
+			content = "No message provided."
+		}
+		return fmt.Sprintf("[mock generate] %s", content), nil
+	})
+}
@@ -0,0 +1,126 @@
+package llm
+
+import (
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	defaultContextWindowTokens = 8192
+	defaultModelOutputTokens   = 4096
+)
+
+// ModelInfo describes the token limits of a model.
+type ModelInfo struct {
+	Name            string `json:"name"`
+	ContextWindow   int    `json:"contextWindow"`
+	MaxOutputTokens int    `json:"maxOutputTokens"`
+}
+
+// modelCatalog lists known models by name prefix. Longer prefixes win, so
+// "gpt-4o-mini" is matched before "gpt-4o".
+var modelCatalog = []ModelInfo{
+	{Name: "gpt-4o-mini", ContextWindow: 128000, MaxOutputTokens: 16384},
+	{Name: "gpt-4o", ContextWindow: 128000, MaxOutputTokens: 16384},
+	{Name: "gpt-4.1", ContextWindow: 1047576, MaxOutputTokens: 32768},
+	{Name: "gpt-4-turbo", ContextWindow: 128000, MaxOutputTokens: 4096},
+	{Name: "gpt-3.5-turbo", ContextWindow: 16385, MaxOutputTokens: 4096},
+	{Name: "o1", ContextWindow: 200000, MaxOutputTokens: 100000},
+	{Name: "o3", ContextWindow: 200000, MaxOutputTokens: 100000},
+	{Name: "o4-mini", ContextWindow: 200000, MaxOutputTokens: 100000},
+	{Name: "gemini-2.5-pro", ContextWindow: 1048576, MaxOutputTokens: 65536},
+	{Name: "gemini-2.5-flash", ContextWindow: 1048576, MaxOutputTokens: 65536},
+	{Name: "gemini-2.0-flash", ContextWindow: 1048576, MaxOutputTokens: 8192},
+	{Name: "gemini-1.5-pro", ContextWindow: 2097152, MaxOutputTokens: 8192},
+	{Name: "gemini-1.5-flash", ContextWindow: 1048576, MaxOutputTokens: 8192},
+	{Name: "mock", ContextWindow: 32768, MaxOutputTokens: 4096},
+}
+
+// LookupModel returns the catalog entry for model. Unknown models get a
+// conservative default. LLM_CONTEXT_WINDOW_TOKENS and
+// LLM_MODEL_MAX_OUTPUT_TOKENS override the catalog, which is useful for
+// Azure deployments and local models whose names are not in it.
+func LookupModel(model string) ModelInfo {
+	info := ModelInfo{Name: model, ContextWindow: defaultContextWindowTokens, MaxOutputTokens: defaultModelOutputTokens}
+	normalized := strings.ToLower(strings.TrimSpace(model))
+	matched := 0
+	for _, candidate := range modelCatalog {
+		if strings.HasPrefix(normalized, candidate.Name) && len(candidate.Name) > matched {
+			matched = len(candidate.Name)
+			info.ContextWindow = candidate.ContextWindow
+			info.MaxOutputTokens = candidate.MaxOutputTokens
+		}
+	}
+
+	if value := positiveIntFromEnv("LLM_CONTEXT_WINDOW_TOKENS"); value > 0 {
+		info.ContextWindow = value
+	}
+	if value := positiveIntFromEnv("LLM_MODEL_MAX_OUTPUT_TOKENS"); value > 0 {
+		info.MaxOutputTokens = value
+	}
+	return info
+}
+
+// ModelFor returns the catalog entry for the model behind provider, looking
+// through decorators. Providers without a model, such as replay, get the
+// default entry under the provider name.
+func ModelFor(provider LLMProvider) ModelInfo {
+	name := ""
+	for current := provider; current != nil; {
+		if named, ok := current.(interface{ Model() string }); ok {
+			return LookupModel(named.Model())
+		}
+		if name == "" {
+			name = current.Name()
+		}
+		wrapper, ok := current.(providerWrapper)
+		if !ok {
+			break
+		}
+		current = wrapper.Unwrap()
+	}
+	return LookupModel(name)
+}
+
+func positiveIntFromEnv(key string) int {
+	parsed, err := strconv.Atoi(strings.TrimSpace(os.Getenv(key)))
+	if err != nil || parsed <= 0 {
+		return 0
+	}
+	return parsed
+}
+
+// EstimateTokens approximates the token count of text without a tokenizer.
+// Latin words count one token per four characters (at least one), while
+// punctuation and non-Latin characters such as CJK count one token each,
+// matching BPE tokenizers closely enough to budget prompts with a margin.
+func EstimateTokens(text string) int {
+	tokens := 0
+	wordLength := 0
+	flush := func() {
+		if wordLength > 0 {
+			tokens += int(math.Ceil(float64(wordLength) / 4))
+			wordLength = 0
+		}
+	}
+
+	for len(text) > 0 {
+		r, size := utf8.DecodeRuneInString(text)
+		text = text[size:]
+		switch {
+		case unicode.IsSpace(r):
+			flush()
+		case r < utf8.RuneSelf && (unicode.IsLetter(r) || unicode.IsDigit(r)):
+			wordLength++
+		default:
+			flush()
+			tokens++
+		}
+	}
+	flush()
+	return tokens
+}
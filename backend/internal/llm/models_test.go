@@ -0,0 +1,73 @@
+package llm
+
+import "testing"
+
+func TestLookupModelMatchesLongestPrefix(t *testing.T) {
+	t.Setenv("LLM_CONTEXT_WINDOW_TOKENS", "")
+	t.Setenv("LLM_MODEL_MAX_OUTPUT_TOKENS", "")
+
+	testCases := []struct {
+		model         string
+		contextWindow int
+		maxOutput     int
+	}{
+		{model: "gpt-4o-mini-2024-07-18", contextWindow: 128000, maxOutput: 16384},
+		{model: "gpt-3.5-turbo", contextWindow: 16385, maxOutput: 4096},
+		{model: "Gemini-2.0-Flash", contextWindow: 1048576, maxOutput: 8192},
+		{model: "llama3.1:8b", contextWindow: defaultContextWindowTokens, maxOutput: defaultModelOutputTokens},
+	}
+
+	for _, tc := range testCases {
+		info := LookupModel(tc.model)
+		if info.Name != tc.model || info.ContextWindow != tc.contextWindow || info.MaxOutputTokens != tc.maxOutput {
+			t.Fatalf("LookupModel(%q) = %+v", tc.model, info)
+		}
+	}
+}
+
+func TestLookupModelEnvOverrides(t *testing.T) {
+	t.Setenv("LLM_CONTEXT_WINDOW_TOKENS", "32000")
+	t.Setenv("LLM_MODEL_MAX_OUTPUT_TOKENS", "2000")
+
+	info := LookupModel("my-azure-deployment")
+	if info.ContextWindow != 32000 || info.MaxOutputTokens != 2000 {
+		t.Fatalf("expected env overrides, got %+v", info)
+	}
+}
+
+func TestModelForLooksThroughDecorators(t *testing.T) {
+	t.Setenv("LLM_CONTEXT_WINDOW_TOKENS", "")
+
+	openai := &OpenAIProvider{name: "openai", model: "gpt-4o"}
+	wrapped := newChaosProvider(newLimitedProvider(openai, limiterConfig{maxInFlight: 1}, realProviderClock{}), ChaosConfig{}, realProviderClock{})
+	if info := ModelFor(wrapped); info.Name != "gpt-4o" || info.ContextWindow != 128000 {
+		t.Fatalf("unexpected model for wrapped provider: %+v", info)
+	}
+
+	replayer, err := newReplayProvider(t.TempDir())
+	if err != nil {
+		t.Fatalf("newReplayProvider returned error: %v", err)
+	}
+	if info := ModelFor(replayer); info.Name != "replay" || info.ContextWindow != defaultContextWindowTokens {
+		t.Fatalf("expected default entry for replay, got %+v", info)
+	}
+}
+
+func TestEstimateTokens(t *testing.T) {
+	testCases := []struct {
+		text string
+		want int
+	}{
+		{text: "", want: 0},
+		{text: "hello world", want: 4},
+		{text: "Hi, there!", want: 5},
+		{text: "internationalization", want: 5},
+		{text: "東京都", want: 3},
+	}
+
+	for _, tc := range testCases {
+		if got := EstimateTokens(tc.text); got != tc.want {
+			t.Fatalf("EstimateTokens(%q) = %d, want %d", tc.text, got, tc.want)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package llm
 
 import (
 	"context"
+	"errors"
 	"log"
 	"time"
 
@@ -9,19 +10,36 @@ import (
 	"github.com/alanmaizon/homer/backend/internal/middleware"
 )
 
-func observeProviderOperation(ctx context.Context, provider string, operation string, call func() (string, error)) (string, error) {
+func observeProviderOperation[T any](ctx context.Context, provider string, operation string, call func() (T, error)) (T, error) {
 	started := time.Now()
 	requestID := middleware.GetRequestIDFromContext(ctx)
+	tenant := middleware.GetTenantFromContext(ctx)
 
 	log.Printf(
-		"request_id=%s component=provider provider=%s operation=%s event=start",
+		"request_id=%s tenant=%s component=provider provider=%s operation=%s event=start",
 		requestID,
+		tenant,
 		provider,
 		operation,
 	)
 
+	if info := callInfoFromContext(ctx); info != nil {
+		info.markProviderCalled()
+	}
 	result, err := call()
 
+	if err != nil && errors.Is(context.Cause(ctx), errHedgeLost) {
+		log.Printf(
+			"request_id=%s tenant=%s component=provider provider=%s operation=%s status=canceled reason=hedge_lost duration_ms=%d",
+			requestID,
+			tenant,
+			provider,
+			operation,
+			time.Since(started).Milliseconds(),
+		)
+		return result, err
+	}
+
 	status := "success"
 	errorCategory := "none"
 	if err != nil {
@@ -32,8 +50,9 @@ func observeProviderOperation(ctx context.Context, provider string, operation st
 	duration := time.Since(started)
 	metrics.RecordProviderCall(provider, operation, status, errorCategory, duration)
 	log.Printf(
-		"request_id=%s component=provider provider=%s operation=%s status=%s error_category=%s duration_ms=%d",
+		"request_id=%s tenant=%s component=provider provider=%s operation=%s status=%s error_category=%s duration_ms=%d",
 		requestID,
+		tenant,
 		provider,
 		operation,
 		status,
@@ -0,0 +1,162 @@
+package llm
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+)
+
+const (
+	openAICompatibleProviderName     = "openai_compatible"
+	defaultOpenAICompatibleInstance  = "local_llm"
+	chatCompletionsPath              = "/chat/completions"
+	defaultOpenAICompatibleKeyHeader = "api-key"
+)
+
+var openAICompatibleInstancePattern = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_]*$`)
+
+// NewOpenAICompatibleProviderFromEnv builds a Chat Completions provider for a
+// self-hosted or gateway endpoint. Settings are read from variables prefixed
+// with the upper-cased instance name, e.g. LOCAL_LLM_BASE_URL for "local_llm".
+// An empty instance selects the default "local_llm" instance.
+func NewOpenAICompatibleProviderFromEnv(instance string) (*OpenAIProvider, error) {
+	name := openAICompatibleProviderName
+	instance = strings.TrimSpace(instance)
+	if instance == "" {
+		instance = defaultOpenAICompatibleInstance
+	} else {
+		name += ":" + instance
+	}
+	if !openAICompatibleInstancePattern.MatchString(instance) {
+		return nil, fmt.Errorf("invalid openai_compatible instance name %q", instance)
+	}
+
+	prefix := strings.ToUpper(instance) + "_"
+
+	baseURL := strings.TrimSpace(os.Getenv(prefix + "BASE_URL"))
+	if baseURL == "" {
+		return nil, fmt.Errorf("%sBASE_URL is required", prefix)
+	}
+	endpoint, err := chatCompletionsEndpoint(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("%sBASE_URL is invalid: %w", prefix, err)
+	}
+
+	model := strings.TrimSpace(os.Getenv(prefix + "MODEL"))
+	if model == "" {
+		return nil, fmt.Errorf("%sMODEL is required", prefix)
+	}
+
+	apiKey := strings.TrimSpace(os.Getenv(prefix + "API_KEY"))
+	authScheme, authHeader, err := parseAuthScheme(
+		os.Getenv(prefix+"AUTH_SCHEME"),
+		os.Getenv(prefix+"AUTH_HEADER"),
+		apiKey,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%sAUTH_SCHEME: %w", prefix, err)
+	}
+
+	headers, err := parseHeaderList(os.Getenv(prefix + "HEADERS"))
+	if err != nil {
+		return nil, fmt.Errorf("%sHEADERS: %w", prefix, err)
+	}
+
+	policy := loadRuntimePolicyFromEnv()
+
+	return &OpenAIProvider{
+		name:       name,
+		endpoint:   endpoint,
+		apiKey:     apiKey,
+		authScheme: authScheme,
+		authHeader: authHeader,
+		headers:    headers,
+		model:      model,
+		client:     http.DefaultClient,
+		timeout:    policy.timeout,
+		retry:      newRetryPolicy(policy),
+	}, nil
+}
+
+// chatCompletionsEndpoint accepts either an API root such as
+// http://localhost:11434/v1 or a full chat completions URL.
+func chatCompletionsEndpoint(baseURL string) (string, error) {
+	parsed, err := url.Parse(strings.TrimSpace(baseURL))
+	if err != nil {
+		return "", err
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return "", fmt.Errorf("unsupported scheme %q", parsed.Scheme)
+	}
+	if parsed.Host == "" {
+		return "", fmt.Errorf("host is required")
+	}
+
+	path := strings.TrimRight(parsed.Path, "/")
+	if !strings.HasSuffix(path, chatCompletionsPath) {
+		path += chatCompletionsPath
+	}
+	parsed.Path = path
+
+	return parsed.String(), nil
+}
+
+func parseAuthScheme(rawScheme string, rawHeader string, apiKey string) (scheme string, header string, err error) {
+	scheme = strings.ToLower(strings.TrimSpace(rawScheme))
+	header = strings.TrimSpace(rawHeader)
+
+	if scheme == "" {
+		if apiKey == "" {
+			return authSchemeNone, "", nil
+		}
+		scheme = authSchemeBearer
+	}
+
+	switch scheme {
+	case authSchemeNone:
+		return authSchemeNone, "", nil
+	case authSchemeBearer:
+		if apiKey == "" {
+			return "", "", fmt.Errorf("an API key is required for %s auth", scheme)
+		}
+		return authSchemeBearer, "", nil
+	case authSchemeHeader:
+		if apiKey == "" {
+			return "", "", fmt.Errorf("an API key is required for %s auth", scheme)
+		}
+		if header == "" {
+			header = defaultOpenAICompatibleKeyHeader
+		}
+		return authSchemeHeader, http.CanonicalHeaderKey(header), nil
+	default:
+		return "", "", fmt.Errorf("unsupported auth scheme %q", scheme)
+	}
+}
+
+// parseHeaderList parses "Name: value" pairs separated by commas or newlines.
+func parseHeaderList(raw string) (map[string]string, error) {
+	headers := make(map[string]string)
+	for _, entry := range strings.FieldsFunc(raw, func(r rune) bool {
+		return r == ',' || r == '\n'
+	}) {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		name, value, ok := strings.Cut(entry, ":")
+		if !ok {
+			name, value, ok = strings.Cut(entry, "=")
+		}
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid header entry %q", entry)
+		}
+		headers[http.CanonicalHeaderKey(name)] = strings.TrimSpace(value)
+	}
+
+	return headers, nil
+}
@@ -0,0 +1,216 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/alanmaizon/homer/backend/internal/domain"
+)
+
+type fakeChatCompletionRequest struct {
+	Model    string `json:"model"`
+	Messages []struct {
+		Role    string `json:"role"`
+		Content string `json:"content"`
+	} `json:"messages"`
+	Temperature *float64 `json:"temperature"`
+	MaxTokens   *int     `json:"max_tokens"`
+	TopP        *float64 `json:"top_p"`
+	Stop        []string `json:"stop"`
+}
+
+func newFakeChatCompletionServer(t *testing.T, handle func(w http.ResponseWriter, r *http.Request, payload fakeChatCompletionRequest)) *httptest.Server {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload fakeChatCompletionRequest
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			http.Error(w, "bad json", http.StatusBadRequest)
+			return
+		}
+		handle(w, r, payload)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func writeFakeChatCompletion(w http.ResponseWriter, content string) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"choices": []map[string]any{
+			{"message": map[string]string{"role": "assistant", "content": content}},
+		},
+	})
+}
+
+func TestOpenAICompatibleProviderEndToEnd(t *testing.T) {
+	var gotPath, gotAuth, gotTenant string
+	var gotPayload fakeChatCompletionRequest
+	server := newFakeChatCompletionServer(t, func(w http.ResponseWriter, r *http.Request, payload fakeChatCompletionRequest) {
+		gotPath = r.URL.Path
+		gotAuth = r.Header.Get("Authorization")
+		gotTenant = r.Header.Get("X-Tenant")
+		gotPayload = payload
+		writeFakeChatCompletion(w, "  local summary  ")
+	})
+
+	t.Setenv("LOCAL_LLM_BASE_URL", server.URL+"/v1")
+	t.Setenv("LOCAL_LLM_MODEL", "llama3.1:8b")
+	t.Setenv("LOCAL_LLM_API_KEY", "local-key")
+	t.Setenv("LOCAL_LLM_AUTH_SCHEME", "")
+	t.Setenv("LOCAL_LLM_HEADERS", "X-Tenant: homer")
+
+	provider, err := NewOpenAICompatibleProviderFromEnv("local_llm")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if provider.Name() != "openai_compatible:local_llm" {
+		t.Fatalf("unexpected provider name %q", provider.Name())
+	}
+
+	result, err := provider.Summarize(context.Background(), []domain.Document{
+		{ID: "d1", Title: "Doc", Content: "Hello world"},
+	}, "bullet", "", domain.GenerationParams{})
+	if err != nil {
+		t.Fatalf("Summarize returned error: %v", err)
+	}
+	if result != "local summary" {
+		t.Fatalf("unexpected result %q", result)
+	}
+	if gotPath != "/v1/chat/completions" {
+		t.Fatalf("unexpected request path %q", gotPath)
+	}
+	if gotAuth != "Bearer local-key" {
+		t.Fatalf("unexpected Authorization header %q", gotAuth)
+	}
+	if gotTenant != "homer" {
+		t.Fatalf("expected custom header to be forwarded, got %q", gotTenant)
+	}
+	if gotPayload.Model != "llama3.1:8b" {
+		t.Fatalf("unexpected model %q", gotPayload.Model)
+	}
+	if len(gotPayload.Messages) == 0 || !strings.Contains(gotPayload.Messages[len(gotPayload.Messages)-1].Content, "Hello world") {
+		t.Fatalf("expected document content in messages: %+v", gotPayload.Messages)
+	}
+}
+
+func TestOpenAICompatibleProviderHeaderAuthAndHTTPError(t *testing.T) {
+	var gotKey, gotAuth string
+	server := newFakeChatCompletionServer(t, func(w http.ResponseWriter, r *http.Request, _ fakeChatCompletionRequest) {
+		gotKey = r.Header.Get("X-Gateway-Key")
+		gotAuth = r.Header.Get("Authorization")
+		http.Error(w, "model not loaded", http.StatusNotFound)
+	})
+
+	t.Setenv("GATEWAY_BASE_URL", server.URL+"/v1/chat/completions")
+	t.Setenv("GATEWAY_MODEL", "internal-model")
+	t.Setenv("GATEWAY_API_KEY", "gateway-key")
+	t.Setenv("GATEWAY_AUTH_SCHEME", "header")
+	t.Setenv("GATEWAY_AUTH_HEADER", "X-Gateway-Key")
+	t.Setenv("GATEWAY_HEADERS", "")
+
+	provider, err := NewOpenAICompatibleProviderFromEnv("gateway")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, err = provider.Rewrite(context.Background(), "text", "simplify", "", domain.GenerationParams{})
+	var httpErr *providerHTTPError
+	if !errors.As(err, &httpErr) {
+		t.Fatalf("expected providerHTTPError, got %v", err)
+	}
+	if httpErr.statusCode != http.StatusNotFound || httpErr.provider != "openai_compatible:gateway" {
+		t.Fatalf("unexpected provider error: %+v", httpErr)
+	}
+	if gotKey != "gateway-key" || gotAuth != "" {
+		t.Fatalf("expected key in custom header only, got key=%q auth=%q", gotKey, gotAuth)
+	}
+}
+
+func TestOpenAICompatibleProviderNoAuth(t *testing.T) {
+	var gotAuth string
+	server := newFakeChatCompletionServer(t, func(w http.ResponseWriter, r *http.Request, _ fakeChatCompletionRequest) {
+		gotAuth = r.Header.Get("Authorization")
+		writeFakeChatCompletion(w, "ok")
+	})
+
+	t.Setenv("LOCAL_LLM_BASE_URL", server.URL)
+	t.Setenv("LOCAL_LLM_MODEL", "mistral")
+	t.Setenv("LOCAL_LLM_API_KEY", "")
+	t.Setenv("LOCAL_LLM_AUTH_SCHEME", "")
+	t.Setenv("LOCAL_LLM_HEADERS", "")
+
+	provider, err := NewOpenAICompatibleProviderFromEnv("")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if provider.Name() != "openai_compatible" {
+		t.Fatalf("unexpected provider name %q", provider.Name())
+	}
+	if _, err := provider.Rewrite(context.Background(), "text", "simplify", "", domain.GenerationParams{}); err != nil {
+		t.Fatalf("Rewrite returned error: %v", err)
+	}
+	if gotAuth != "" {
+		t.Fatalf("expected no Authorization header, got %q", gotAuth)
+	}
+}
+
+func TestNewOpenAICompatibleProviderFromEnvValidation(t *testing.T) {
+	testCases := []struct {
+		name    string
+		env     map[string]string
+		wantErr string
+	}{
+		{
+			name:    "missing_base_url",
+			env:     map[string]string{"LOCAL_LLM_BASE_URL": "", "LOCAL_LLM_MODEL": "m"},
+			wantErr: "LOCAL_LLM_BASE_URL is required",
+		},
+		{
+			name:    "missing_model",
+			env:     map[string]string{"LOCAL_LLM_BASE_URL": "http://localhost:11434/v1", "LOCAL_LLM_MODEL": ""},
+			wantErr: "LOCAL_LLM_MODEL is required",
+		},
+		{
+			name:    "bad_scheme",
+			env:     map[string]string{"LOCAL_LLM_BASE_URL": "ftp://localhost", "LOCAL_LLM_MODEL": "m"},
+			wantErr: "LOCAL_LLM_BASE_URL is invalid",
+		},
+		{
+			name: "bearer_without_key",
+			env: map[string]string{
+				"LOCAL_LLM_BASE_URL":    "http://localhost:11434/v1",
+				"LOCAL_LLM_MODEL":       "m",
+				"LOCAL_LLM_AUTH_SCHEME": "bearer",
+			},
+			wantErr: "LOCAL_LLM_AUTH_SCHEME",
+		},
+		{
+			name: "bad_headers",
+			env: map[string]string{
+				"LOCAL_LLM_BASE_URL": "http://localhost:11434/v1",
+				"LOCAL_LLM_MODEL":    "m",
+				"LOCAL_LLM_HEADERS":  "no-separator",
+			},
+			wantErr: "LOCAL_LLM_HEADERS",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, key := range []string{"LOCAL_LLM_BASE_URL", "LOCAL_LLM_MODEL", "LOCAL_LLM_API_KEY", "LOCAL_LLM_AUTH_SCHEME", "LOCAL_LLM_HEADERS"} {
+				t.Setenv(key, tc.env[key])
+			}
+
+			_, err := NewOpenAICompatibleProviderFromEnv("local_llm")
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
@@ -13,16 +13,34 @@ import (
 	"time"
 
 	"github.com/alanmaizon/homer/backend/internal/domain"
+	"golang.org/x/oauth2"
 )
 
 const openAIURL = "https://api.openai.com/v1/chat/completions"
 
+const (
+	authSchemeBearer = "bearer"
+	authSchemeHeader = "header"
+	authSchemeNone   = "none"
+	authSchemeOAuth  = "oauth"
+)
+
 type OpenAIProvider struct {
-	apiKey     string
-	model      string
-	client     *http.Client
-	timeout    time.Duration
-	maxRetries int
+	name     string
+	endpoint string
+
+	embeddingEndpoint string
+	embeddingModel    string
+
+	apiKey      string
+	authScheme  string
+	authHeader  string
+	headers     map[string]string
+	tokenSource oauth2.TokenSource
+	model       string
+	client      *http.Client
+	timeout     time.Duration
+	retry       retryPolicy
 }
 
 func NewOpenAIProviderFromEnv() (*OpenAIProvider, error) {
@@ -35,125 +53,229 @@ func NewOpenAIProviderFromEnv() (*OpenAIProvider, error) {
 		model = "gpt-4o-mini"
 	}
 
+	embeddingModel := strings.TrimSpace(os.Getenv("OPENAI_EMBEDDING_MODEL"))
+	if embeddingModel == "" {
+		embeddingModel = defaultOpenAIEmbeddingModel
+	}
+
 	policy := loadRuntimePolicyFromEnv()
 
 	return &OpenAIProvider{
-		apiKey:     apiKey,
-		model:      model,
-		client:     http.DefaultClient,
-		timeout:    policy.timeout,
-		maxRetries: policy.maxRetries,
+		name:              "openai",
+		endpoint:          openAIURL,
+		embeddingEndpoint: openAIEmbeddingsURL,
+		embeddingModel:    embeddingModel,
+		apiKey:            apiKey,
+		authScheme:        authSchemeBearer,
+		model:             model,
+		client:            http.DefaultClient,
+		timeout:           policy.timeout,
+		retry:             newRetryPolicy(policy),
 	}, nil
 }
 
 func (o *OpenAIProvider) Name() string {
-	return "openai"
+	return o.name
+}
+
+func (o *OpenAIProvider) Model() string {
+	return o.model
 }
 
-func (o *OpenAIProvider) Summarize(ctx context.Context, docs []domain.Document, style string, instructions string) (string, error) {
+func (o *OpenAIProvider) Summarize(ctx context.Context, docs []domain.Document, style string, instructions string, params domain.GenerationParams) (string, error) {
 	return observeProviderOperation(ctx, o.Name(), "summarize", func() (string, error) {
-		var builder strings.Builder
-		builder.WriteString("Summarize the provided documents for the end user.\n")
-		if style != "" {
-			builder.WriteString("Style: " + style + "\n")
-		}
-		if instructions != "" {
-			builder.WriteString("Instructions: " + instructions + "\n")
-		}
-		for _, doc := range docs {
-			builder.WriteString("\n# " + doc.Title + "\n")
-			builder.WriteString(doc.Content + "\n")
+		messages, err := renderPrompt(ctx, o.Name(), o.model, "summarize", summarizePromptData{
+			Style:        style,
+			Instructions: instructions,
+			Documents:    docs,
+		})
+		if err != nil {
+			return "", err
 		}
-		return o.call(ctx, builder.String())
+		return o.call(ctx, messages, params)
 	})
 }
 
-func (o *OpenAIProvider) Rewrite(ctx context.Context, text string, mode string, instructions string) (string, error) {
+func (o *OpenAIProvider) Rewrite(ctx context.Context, text string, mode string, instructions string, params domain.GenerationParams) (string, error) {
 	return observeProviderOperation(ctx, o.Name(), "rewrite", func() (string, error) {
-		prompt := fmt.Sprintf("Rewrite this text in %s mode.\nInstructions: %s\n\n%s", mode, instructions, text)
-		return o.call(ctx, prompt)
+		messages, err := renderPrompt(ctx, o.Name(), o.model, "rewrite", rewritePromptData{
+			Mode:         mode,
+			Instructions: instructions,
+			Text:         text,
+		})
+		if err != nil {
+			return "", err
+		}
+		return o.call(ctx, messages, params)
 	})
 }
 
-func (o *OpenAIProvider) call(ctx context.Context, prompt string) (string, error) {
-	payload := map[string]any{
-		"model": o.model,
-		"messages": []map[string]string{
-			{"role": "user", "content": prompt},
-		},
-	}
-	body, err := json.Marshal(payload)
+func (o *OpenAIProvider) Generate(ctx context.Context, messages []Message, params domain.GenerationParams) (string, error) {
+	return observeProviderOperation(ctx, o.Name(), "generate", func() (string, error) {
+		return o.call(ctx, messages, params)
+	})
+}
+
+func (o *OpenAIProvider) call(ctx context.Context, messages []Message, params domain.GenerationParams) (string, error) {
+	body, err := json.Marshal(o.chatCompletionPayload(messages, params))
 	if err != nil {
 		return "", err
 	}
 
-	totalAttempts := o.maxRetries + 1
-	for attempt := 0; attempt < totalAttempts; attempt++ {
-		attemptCtx, cancel := context.WithTimeout(ctx, o.timeout)
+	var parsed struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+			FinishReason string `json:"finish_reason"`
+		} `json:"choices"`
+	}
+	if err := o.post(ctx, o.endpoint, body, &parsed); err != nil {
+		return "", err
+	}
+	if len(parsed.Choices) == 0 {
+		return "", fmt.Errorf("%s returned no choices", o.name)
+	}
+	if parsed.Choices[0].FinishReason == "content_filter" {
+		return "", &providerContentFilterError{provider: o.name, message: "completion was filtered"}
+	}
+	return strings.TrimSpace(parsed.Choices[0].Message.Content), nil
+}
 
-		request, err := http.NewRequestWithContext(attemptCtx, http.MethodPost, openAIURL, bytes.NewReader(body))
-		if err != nil {
-			cancel()
-			return "", err
+// post sends body to endpoint under the retry policy and decodes the JSON
+// response into out.
+func (o *OpenAIProvider) post(ctx context.Context, endpoint string, body []byte, out any) error {
+	retry := o.retry.start(ctx, o.name)
+	for {
+		err := o.postOnce(ctx, endpoint, body, out)
+		if err == nil {
+			return nil
 		}
-		request.Header.Set("Content-Type", "application/json")
-		request.Header.Set("Authorization", "Bearer "+o.apiKey)
-
-		response, err := o.client.Do(request)
-		if err != nil {
-			cancel()
-			if shouldRetryError(err) && attempt < totalAttempts-1 {
-				if waitErr := waitForBackoff(ctx, attempt); waitErr != nil {
-					return "", waitErr
-				}
-				continue
-			}
-			return "", err
+		if err := retry.wait(ctx, err); err != nil {
+			return err
 		}
+	}
+}
 
-		if response.StatusCode >= http.StatusBadRequest {
-			responseBytes, _ := io.ReadAll(io.LimitReader(response.Body, 4096))
-			_ = response.Body.Close()
-			cancel()
+func (o *OpenAIProvider) postOnce(ctx context.Context, endpoint string, body []byte, out any) error {
+	attemptCtx, cancel := context.WithTimeout(ctx, o.timeout)
+	defer cancel()
 
-			httpErr := &providerHTTPError{
-				provider:   "openai",
-				statusCode: response.StatusCode,
-				message:    strings.TrimSpace(string(responseBytes)),
-			}
-			if shouldRetryHTTPStatus(response.StatusCode) && attempt < totalAttempts-1 {
-				if waitErr := waitForBackoff(ctx, attempt); waitErr != nil {
-					return "", waitErr
-				}
-				continue
-			}
-			return "", httpErr
+	request, err := http.NewRequestWithContext(attemptCtx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	if err := o.authorize(request); err != nil {
+		return err
+	}
+
+	response, err := o.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode >= http.StatusBadRequest {
+		responseBytes, _ := io.ReadAll(io.LimitReader(response.Body, 4096))
+		if filterErr := contentFilterErrorFromBody(o.name, responseBytes); filterErr != nil {
+			return filterErr
+		}
+		return &providerHTTPError{
+			provider:   o.name,
+			statusCode: response.StatusCode,
+			message:    strings.TrimSpace(string(responseBytes)),
+			retryAfter: parseRetryAfter(response.Header, time.Now()),
 		}
+	}
+
+	if err := json.NewDecoder(response.Body).Decode(out); err != nil {
+		return &providerDecodeError{provider: o.name, err: err}
+	}
+	return nil
+}
 
-		var parsed struct {
-			Choices []struct {
-				Message struct {
-					Content string `json:"content"`
-				} `json:"message"`
-			} `json:"choices"`
+func (o *OpenAIProvider) chatCompletionPayload(messages []Message, params domain.GenerationParams) map[string]any {
+	chatMessages := make([]map[string]any, 0, len(messages))
+	for _, message := range messages {
+		chatMessage := map[string]any{
+			"role":    string(message.Role),
+			"content": message.Content,
 		}
-		decodeErr := json.NewDecoder(response.Body).Decode(&parsed)
-		_ = response.Body.Close()
-		cancel()
-		if decodeErr != nil {
-			if shouldRetryError(decodeErr) && attempt < totalAttempts-1 {
-				if waitErr := waitForBackoff(ctx, attempt); waitErr != nil {
-					return "", waitErr
-				}
-				continue
+		if len(message.ToolCalls) > 0 {
+			calls := make([]map[string]any, 0, len(message.ToolCalls))
+			for _, call := range message.ToolCalls {
+				calls = append(calls, map[string]any{
+					"id":   call.ID,
+					"type": "function",
+					"function": map[string]string{
+						"name":      call.Name,
+						"arguments": string(call.Arguments),
+					},
+				})
 			}
-			return "", decodeErr
+			chatMessage["tool_calls"] = calls
 		}
-		if len(parsed.Choices) == 0 {
-			return "", errors.New("openai returned no choices")
+		if message.Role == MessageRoleTool {
+			chatMessage["tool_call_id"] = message.ToolCallID
+		}
+		chatMessages = append(chatMessages, chatMessage)
+	}
+
+	payload := map[string]any{
+		"model":    o.model,
+		"messages": chatMessages,
+	}
+	if params.Temperature != nil {
+		payload["temperature"] = *params.Temperature
+	}
+	if params.MaxTokens != nil {
+		payload["max_tokens"] = *params.MaxTokens
+	}
+	if params.TopP != nil {
+		payload["top_p"] = *params.TopP
+	}
+	if len(params.Stop) > 0 {
+		payload["stop"] = params.Stop
+	}
+	return payload
+}
+
+func (o *OpenAIProvider) authorize(request *http.Request) error {
+	request.Header.Set("Content-Type", "application/json")
+	for key, value := range o.headers {
+		request.Header.Set(key, value)
+	}
+
+	switch o.authScheme {
+	case authSchemeBearer:
+		request.Header.Set("Authorization", "Bearer "+o.apiKey)
+	case authSchemeHeader:
+		request.Header.Set(o.authHeader, o.apiKey)
+	case authSchemeOAuth:
+		token, err := o.tokenSource.Token()
+		if err != nil {
+			return fmt.Errorf("%s token acquisition failed: %w", o.name, err)
 		}
-		return strings.TrimSpace(parsed.Choices[0].Message.Content), nil
+		token.SetAuthHeader(request)
 	}
+	return nil
+}
 
-	return "", errors.New("openai request failed after retries")
+// contentFilterErrorFromBody detects the error envelope returned when a
+// prompt is rejected by the upstream content filter (Azure OpenAI uses
+// code "content_filter").
+func contentFilterErrorFromBody(provider string, body []byte) error {
+	var envelope struct {
+		Error struct {
+			Code    string `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return nil
+	}
+	if envelope.Error.Code != "content_filter" {
+		return nil
+	}
+	return &providerContentFilterError{provider: provider, message: envelope.Error.Message}
 }
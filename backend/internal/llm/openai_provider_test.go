@@ -0,0 +1,127 @@
+package llm
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/alanmaizon/homer/backend/internal/domain"
+)
+
+func TestOpenAIProviderGenerateSendsTypedMessages(t *testing.T) {
+	var gotPayload fakeChatCompletionRequest
+	server := newFakeChatCompletionServer(t, func(w http.ResponseWriter, _ *http.Request, payload fakeChatCompletionRequest) {
+		gotPayload = payload
+		writeFakeChatCompletion(w, "answer")
+	})
+
+	provider := &OpenAIProvider{
+		name:       "openai",
+		endpoint:   server.URL + "/v1/chat/completions",
+		apiKey:     "key",
+		authScheme: authSchemeBearer,
+		model:      "gpt-4o-mini",
+		client:     server.Client(),
+		timeout:    defaultLLMTimeout,
+	}
+
+	result, err := provider.Generate(context.Background(), []Message{
+		{Role: MessageRoleSystem, Content: "Be brief."},
+		{Role: MessageRoleUser, Content: "Hi"},
+		{Role: MessageRoleAssistant, Content: "Hello"},
+		{Role: MessageRoleUser, Content: "Summarize our chat"},
+	}, domain.GenerationParams{})
+	if err != nil {
+		t.Fatalf("Generate returned error: %v", err)
+	}
+	if result != "answer" {
+		t.Fatalf("unexpected result %q", result)
+	}
+
+	wantRoles := []string{"system", "user", "assistant", "user"}
+	if len(gotPayload.Messages) != len(wantRoles) {
+		t.Fatalf("expected %d messages, got %+v", len(wantRoles), gotPayload.Messages)
+	}
+	for i, message := range gotPayload.Messages {
+		if message.Role != wantRoles[i] {
+			t.Fatalf("message %d: expected role %q, got %q", i, wantRoles[i], message.Role)
+		}
+	}
+}
+
+func TestOpenAIProviderSummarizeSeparatesSystemAndDocuments(t *testing.T) {
+	var gotPayload fakeChatCompletionRequest
+	server := newFakeChatCompletionServer(t, func(w http.ResponseWriter, _ *http.Request, payload fakeChatCompletionRequest) {
+		gotPayload = payload
+		writeFakeChatCompletion(w, "summary")
+	})
+
+	provider := &OpenAIProvider{
+		name:       "openai",
+		endpoint:   server.URL,
+		authScheme: authSchemeNone,
+		model:      "gpt-4o-mini",
+		client:     server.Client(),
+		timeout:    defaultLLMTimeout,
+	}
+
+	if _, err := provider.Summarize(context.Background(), []domain.Document{{Title: "Doc", Content: "Body"}}, "bullet", "Focus", domain.GenerationParams{}); err != nil {
+		t.Fatalf("Summarize returned error: %v", err)
+	}
+	if len(gotPayload.Messages) != 2 || gotPayload.Messages[0].Role != "system" || gotPayload.Messages[1].Role != "user" {
+		t.Fatalf("expected system + user messages, got %+v", gotPayload.Messages)
+	}
+}
+
+func TestOpenAIProviderForwardsGenerationParams(t *testing.T) {
+	var gotPayload fakeChatCompletionRequest
+	server := newFakeChatCompletionServer(t, func(w http.ResponseWriter, _ *http.Request, payload fakeChatCompletionRequest) {
+		gotPayload = payload
+		writeFakeChatCompletion(w, "ok")
+	})
+
+	provider := &OpenAIProvider{
+		name:       "openai",
+		endpoint:   server.URL,
+		apiKey:     "key",
+		authScheme: authSchemeBearer,
+		model:      "gpt-4o-mini",
+		client:     server.Client(),
+		timeout:    defaultLLMTimeout,
+	}
+
+	temperature, topP, maxTokens := 0.3, 0.9, 256
+	_, err := provider.Rewrite(context.Background(), "text", "simplify", "", domain.GenerationParams{
+		Temperature: &temperature,
+		MaxTokens:   &maxTokens,
+		TopP:        &topP,
+		Stop:        []string{"END"},
+	})
+	if err != nil {
+		t.Fatalf("Rewrite returned error: %v", err)
+	}
+
+	if gotPayload.Temperature == nil || *gotPayload.Temperature != 0.3 {
+		t.Fatalf("unexpected temperature %v", gotPayload.Temperature)
+	}
+	if gotPayload.MaxTokens == nil || *gotPayload.MaxTokens != 256 {
+		t.Fatalf("unexpected max_tokens %v", gotPayload.MaxTokens)
+	}
+	if gotPayload.TopP == nil || *gotPayload.TopP != 0.9 {
+		t.Fatalf("unexpected top_p %v", gotPayload.TopP)
+	}
+	if len(gotPayload.Stop) != 1 || gotPayload.Stop[0] != "END" {
+		t.Fatalf("unexpected stop %v", gotPayload.Stop)
+	}
+}
+
+func TestOpenAIProviderOmitsUnsetGenerationParams(t *testing.T) {
+	provider := &OpenAIProvider{model: "gpt-4o-mini"}
+
+	payload := provider.chatCompletionPayload([]Message{{Role: MessageRoleUser, Content: "hi"}}, domain.GenerationParams{})
+	for _, key := range []string{"temperature", "max_tokens", "top_p", "stop"} {
+		if _, ok := payload[key]; ok {
+			t.Fatalf("expected %s to be omitted, got %v", key, payload[key])
+		}
+	}
+}
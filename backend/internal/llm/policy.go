@@ -9,24 +9,33 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	"google.golang.org/genai"
 )
 
 const (
 	defaultLLMTimeout    = 15 * time.Second
 	defaultLLMMaxRetries = 2
 	maxLLMMaxRetries     = 5
-	retryBaseDelay       = 200 * time.Millisecond
+
+	defaultRetryBaseDelay = 200 * time.Millisecond
+	defaultRetryMaxDelay  = 10 * time.Second
+	defaultRetryBudget    = 30 * time.Second
 )
 
 type runtimePolicy struct {
-	timeout    time.Duration
-	maxRetries int
+	timeout        time.Duration
+	maxRetries     int
+	retryBaseDelay time.Duration
+	retryMaxDelay  time.Duration
+	retryBudget    time.Duration
 }
 
 type providerHTTPError struct {
 	provider   string
 	statusCode int
 	message    string
+	retryAfter time.Duration
 }
 
 func (e *providerHTTPError) Error() string {
@@ -36,6 +45,42 @@ func (e *providerHTTPError) Error() string {
 	return fmt.Sprintf("%s request failed with status %d: %s", e.provider, e.statusCode, e.message)
 }
 
+// providerDecodeError reports a successful response whose body could not be
+// decoded. It is not retried: the provider already answered, and repeating
+// the call would be billed again for the same malformed reply.
+type providerDecodeError struct {
+	provider string
+	err      error
+}
+
+func (e *providerDecodeError) Error() string {
+	return fmt.Sprintf("%s returned an invalid response: %v", e.provider, e.err)
+}
+
+func (e *providerDecodeError) Unwrap() error {
+	return e.err
+}
+
+// ErrContentFiltered is matched by errors raised when the upstream provider
+// refuses a prompt or completion on content-safety grounds.
+var ErrContentFiltered = errors.New("provider content filter triggered")
+
+type providerContentFilterError struct {
+	provider string
+	message  string
+}
+
+func (e *providerContentFilterError) Error() string {
+	if strings.TrimSpace(e.message) == "" {
+		return fmt.Sprintf("%s content filter triggered", e.provider)
+	}
+	return fmt.Sprintf("%s content filter triggered: %s", e.provider, e.message)
+}
+
+func (e *providerContentFilterError) Unwrap() error {
+	return ErrContentFiltered
+}
+
 func loadRuntimePolicyFromEnv() runtimePolicy {
 	timeout := defaultLLMTimeout
 	maxRetries := defaultLLMMaxRetries
@@ -57,9 +102,25 @@ func loadRuntimePolicyFromEnv() runtimePolicy {
 	}
 
 	return runtimePolicy{
-		timeout:    timeout,
-		maxRetries: maxRetries,
+		timeout:        timeout,
+		maxRetries:     maxRetries,
+		retryBaseDelay: durationMsFromEnv("LLM_RETRY_BASE_DELAY_MS", defaultRetryBaseDelay),
+		retryMaxDelay:  durationMsFromEnv("LLM_RETRY_MAX_DELAY_MS", defaultRetryMaxDelay),
+		retryBudget:    durationMsFromEnv("LLM_RETRY_BUDGET_MS", defaultRetryBudget),
+	}
+}
+
+func durationMsFromEnv(key string, fallback time.Duration) time.Duration {
+	raw := strings.TrimSpace(os.Getenv(key))
+	if raw == "" {
+		return fallback
+	}
+
+	parsed, err := strconv.Atoi(raw)
+	if err != nil || parsed <= 0 {
+		return fallback
 	}
+	return time.Duration(parsed) * time.Millisecond
 }
 
 func shouldRetryHTTPStatus(statusCode int) bool {
@@ -71,6 +132,10 @@ func shouldRetryError(err error) bool {
 		return false
 	}
 
+	if errors.Is(err, ErrContentFiltered) {
+		return false
+	}
+
 	if errors.Is(err, context.DeadlineExceeded) {
 		return true
 	}
@@ -90,6 +155,11 @@ func shouldRetryError(err error) bool {
 		}
 	}
 
+	var decodeErr *providerDecodeError
+	if errors.As(err, &decodeErr) {
+		return false
+	}
+
 	message := strings.ToLower(err.Error())
 	retryableTokens := []string{
 		"timeout",
@@ -113,19 +183,6 @@ func shouldRetryError(err error) bool {
 	return false
 }
 
-func waitForBackoff(ctx context.Context, attempt int) error {
-	delay := retryBaseDelay << attempt
-	timer := time.NewTimer(delay)
-	defer timer.Stop()
-
-	select {
-	case <-ctx.Done():
-		return ctx.Err()
-	case <-timer.C:
-		return nil
-	}
-}
-
 func providerErrorCategory(err error) string {
 	if err == nil {
 		return "none"
@@ -135,6 +192,15 @@ func providerErrorCategory(err error) string {
 		return "timeout"
 	}
 
+	if errors.Is(err, ErrContentFiltered) {
+		return "content_filtered"
+	}
+
+	var decodeErr *providerDecodeError
+	if errors.As(err, &decodeErr) {
+		return "invalid_response"
+	}
+
 	var httpErr *providerHTTPError
 	if errors.As(err, &httpErr) {
 		switch {
@@ -147,6 +213,18 @@ func providerErrorCategory(err error) string {
 		}
 	}
 
+	var apiErr genai.APIError
+	if errors.As(err, &apiErr) {
+		switch {
+		case apiErr.Code == 429:
+			return "rate_limited"
+		case apiErr.Code >= 500:
+			return "http_5xx"
+		case apiErr.Code >= 400:
+			return "http_4xx"
+		}
+	}
+
 	var netErr net.Error
 	if errors.As(err, &netErr) {
 		if netErr.Timeout() {
@@ -11,6 +11,9 @@ import (
 func TestLoadRuntimePolicyFromEnvDefaults(t *testing.T) {
 	t.Setenv("LLM_TIMEOUT_MS", "")
 	t.Setenv("LLM_MAX_RETRIES", "")
+	t.Setenv("LLM_RETRY_BASE_DELAY_MS", "")
+	t.Setenv("LLM_RETRY_MAX_DELAY_MS", "")
+	t.Setenv("LLM_RETRY_BUDGET_MS", "")
 
 	policy := loadRuntimePolicyFromEnv()
 	if policy.timeout != defaultLLMTimeout {
@@ -19,11 +22,17 @@ func TestLoadRuntimePolicyFromEnvDefaults(t *testing.T) {
 	if policy.maxRetries != defaultLLMMaxRetries {
 		t.Fatalf("expected default maxRetries %d, got %d", defaultLLMMaxRetries, policy.maxRetries)
 	}
+	if policy.retryBaseDelay != defaultRetryBaseDelay || policy.retryMaxDelay != defaultRetryMaxDelay || policy.retryBudget != defaultRetryBudget {
+		t.Fatalf("unexpected retry defaults: %+v", policy)
+	}
 }
 
 func TestLoadRuntimePolicyFromEnvOverridesAndBounds(t *testing.T) {
 	t.Setenv("LLM_TIMEOUT_MS", "8000")
 	t.Setenv("LLM_MAX_RETRIES", "99")
+	t.Setenv("LLM_RETRY_BASE_DELAY_MS", "50")
+	t.Setenv("LLM_RETRY_MAX_DELAY_MS", "2000")
+	t.Setenv("LLM_RETRY_BUDGET_MS", "-1")
 
 	policy := loadRuntimePolicyFromEnv()
 	if policy.timeout != 8*time.Second {
@@ -32,6 +41,12 @@ func TestLoadRuntimePolicyFromEnvOverridesAndBounds(t *testing.T) {
 	if policy.maxRetries != maxLLMMaxRetries {
 		t.Fatalf("expected maxRetries capped at %d, got %d", maxLLMMaxRetries, policy.maxRetries)
 	}
+	if policy.retryBaseDelay != 50*time.Millisecond || policy.retryMaxDelay != 2*time.Second {
+		t.Fatalf("unexpected retry delays: base=%s max=%s", policy.retryBaseDelay, policy.retryMaxDelay)
+	}
+	if policy.retryBudget != defaultRetryBudget {
+		t.Fatalf("expected invalid budget to fall back to default, got %s", policy.retryBudget)
+	}
 }
 
 func TestShouldRetryHTTPStatus(t *testing.T) {
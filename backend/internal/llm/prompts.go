@@ -0,0 +1,245 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/alanmaizon/homer/backend/internal/domain"
+	"github.com/alanmaizon/homer/backend/internal/middleware"
+)
+
+const (
+	defaultPromptVersion = "v2"
+	promptTemplateExt    = ".tmpl"
+)
+
+//go:embed prompts
+var embeddedPrompts embed.FS
+
+var promptNameUnsafeChars = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+type summarizePromptData struct {
+	Style        string
+	Instructions string
+	Documents    []domain.Document
+}
+
+type rewritePromptData struct {
+	Mode         string
+	Instructions string
+	Text         string
+}
+
+type renderedPrompt struct {
+	messages []Message
+	template string
+	version  string
+	source   string
+}
+
+// promptLibrary holds one version of the prompt templates. Templates are
+// named "<operation>[.<provider>[.<model>]]" so a provider or model can
+// override the generic prompt for an operation. The template body becomes the
+// user message; an optional {{define "system"}} block becomes the system
+// message.
+type promptLibrary struct {
+	version   string
+	templates map[string]*template.Template
+	sources   map[string]string
+}
+
+var (
+	promptsMu      sync.RWMutex
+	currentPrompts = mustLoadEmbeddedPrompts(defaultPromptVersion)
+)
+
+// LoadPromptTemplatesFromEnv selects the prompt version named by
+// PROMPT_TEMPLATE_VERSION and layers templates from PROMPT_TEMPLATE_DIR
+// (laid out as <dir>/<version>/<name>.tmpl) over the embedded defaults.
+func LoadPromptTemplatesFromEnv() error {
+	version := strings.TrimSpace(os.Getenv("PROMPT_TEMPLATE_VERSION"))
+	if version == "" {
+		version = defaultPromptVersion
+	}
+
+	var overrides fs.FS
+	if dir := strings.TrimSpace(os.Getenv("PROMPT_TEMPLATE_DIR")); dir != "" {
+		info, err := os.Stat(dir)
+		if err != nil {
+			return fmt.Errorf("PROMPT_TEMPLATE_DIR: %w", err)
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("PROMPT_TEMPLATE_DIR: %s is not a directory", dir)
+		}
+		overrides = os.DirFS(dir)
+	}
+
+	library, err := loadPromptLibrary(version, overrides)
+	if err != nil {
+		return err
+	}
+
+	promptsMu.Lock()
+	currentPrompts = library
+	promptsMu.Unlock()
+
+	log.Printf("component=prompt event=loaded version=%s templates=%d", library.version, len(library.templates))
+	return nil
+}
+
+func mustLoadEmbeddedPrompts(version string) *promptLibrary {
+	library, err := loadPromptLibrary(version, nil)
+	if err != nil {
+		panic(err)
+	}
+	return library
+}
+
+func loadPromptLibrary(version string, overrides fs.FS) (*promptLibrary, error) {
+	library := &promptLibrary{
+		version:   version,
+		templates: make(map[string]*template.Template),
+		sources:   make(map[string]string),
+	}
+
+	embeddedRoot, err := fs.Sub(embeddedPrompts, "prompts")
+	if err != nil {
+		return nil, err
+	}
+	if err := library.addFrom(embeddedRoot, "embedded"); err != nil {
+		return nil, err
+	}
+	if overrides != nil {
+		if err := library.addFrom(overrides, "override"); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, operation := range []string{"summarize", "rewrite"} {
+		if _, ok := library.templates[operation]; !ok {
+			return nil, fmt.Errorf("prompt version %q is missing the %s template", version, operation)
+		}
+	}
+
+	return library, nil
+}
+
+func (l *promptLibrary) addFrom(root fs.FS, source string) error {
+	entries, err := fs.ReadDir(root, l.version)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("prompt version %q: %w", l.version, err)
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), promptTemplateExt) {
+			continue
+		}
+
+		name := strings.TrimSuffix(entry.Name(), promptTemplateExt)
+		raw, err := fs.ReadFile(root, path.Join(l.version, entry.Name()))
+		if err != nil {
+			return fmt.Errorf("prompt template %s/%s: %w", l.version, entry.Name(), err)
+		}
+
+		parsed, err := template.New(name).Option("missingkey=error").Parse(string(raw))
+		if err != nil {
+			return fmt.Errorf("prompt template %s/%s: %w", l.version, entry.Name(), err)
+		}
+
+		l.templates[name] = parsed
+		l.sources[name] = source
+	}
+
+	return nil
+}
+
+// lookup resolves the most specific template for the operation, preferring
+// "<op>.<provider>.<model>", then "<op>.<provider>", then "<op>".
+func (l *promptLibrary) lookup(operation string, provider string, model string) (string, *template.Template) {
+	provider = promptNameUnsafeChars.ReplaceAllString(provider, "_")
+	model = promptNameUnsafeChars.ReplaceAllString(model, "_")
+
+	candidates := make([]string, 0, 3)
+	if provider != "" && model != "" {
+		candidates = append(candidates, operation+"."+provider+"."+model)
+	}
+	if provider != "" {
+		candidates = append(candidates, operation+"."+provider)
+	}
+	candidates = append(candidates, operation)
+
+	for _, name := range candidates {
+		if tmpl, ok := l.templates[name]; ok {
+			return name, tmpl
+		}
+	}
+	return "", nil
+}
+
+func (l *promptLibrary) render(operation string, provider string, model string, data any) (renderedPrompt, error) {
+	name, tmpl := l.lookup(operation, provider, model)
+	if tmpl == nil {
+		return renderedPrompt{}, fmt.Errorf("no prompt template for %s", operation)
+	}
+
+	var user bytes.Buffer
+	if err := tmpl.Execute(&user, data); err != nil {
+		return renderedPrompt{}, fmt.Errorf("render prompt template %s/%s: %w", l.version, name, err)
+	}
+
+	var system bytes.Buffer
+	if systemTmpl := tmpl.Lookup("system"); systemTmpl != nil {
+		if err := systemTmpl.Execute(&system, data); err != nil {
+			return renderedPrompt{}, fmt.Errorf("render prompt template %s/%s system: %w", l.version, name, err)
+		}
+	}
+
+	return renderedPrompt{
+		messages: systemAndUserMessages(strings.TrimSpace(system.String()), strings.TrimSpace(user.String())),
+		template: name,
+		version:  l.version,
+		source:   l.sources[name],
+	}, nil
+}
+
+// renderPrompt renders the messages for an operation, logs which template
+// version was used, and records it on the request's CallInfo.
+func renderPrompt(ctx context.Context, provider string, model string, operation string, data any) ([]Message, error) {
+	promptsMu.RLock()
+	library := currentPrompts
+	promptsMu.RUnlock()
+
+	rendered, err := library.render(operation, provider, model, data)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf(
+		"request_id=%s component=prompt provider=%s operation=%s template=%s version=%s source=%s",
+		middleware.GetRequestIDFromContext(ctx),
+		provider,
+		operation,
+		rendered.template,
+		rendered.version,
+		rendered.source,
+	)
+	if info := callInfoFromContext(ctx); info != nil {
+		info.setPrompt(rendered.template, rendered.version)
+	}
+
+	return rendered.messages, nil
+}
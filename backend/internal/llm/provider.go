@@ -2,39 +2,92 @@ package llm
 
 import (
 	"context"
+	"fmt"
+	"log"
 	"os"
+	"strings"
+	"sync"
 
 	"github.com/alanmaizon/homer/backend/internal/domain"
 )
 
 type LLMProvider interface {
 	Name() string
-	Summarize(ctx context.Context, docs []domain.Document, style string, instructions string) (string, error)
-	Rewrite(ctx context.Context, text string, mode string, instructions string) (string, error)
+	Summarize(ctx context.Context, docs []domain.Document, style string, instructions string, params domain.GenerationParams) (string, error)
+	Rewrite(ctx context.Context, text string, mode string, instructions string, params domain.GenerationParams) (string, error)
+	Generate(ctx context.Context, messages []Message, params domain.GenerationParams) (string, error)
 }
 
-var currentProvider LLMProvider = NewProviderFromEnv()
+var (
+	providerMu      sync.RWMutex
+	currentProvider LLMProvider = NewProviderFromEnv()
+)
 
 func NewProviderFromEnv() LLMProvider {
-	switch os.Getenv("LLM_PROVIDER") {
-	case "openai":
-		if provider, err := NewOpenAIProviderFromEnv(); err == nil {
-			return provider
-		}
-	case "gemini":
-		if provider, err := NewGeminiProviderFromEnv(); err == nil {
-			return provider
-		}
+	provider, err := NewNamedProviderFromEnv(os.Getenv("LLM_PROVIDER"))
+	if err != nil {
+		log.Printf("component=llm event=provider_fallback provider=mock error=%q", err.Error())
+		provider = NewMockProvider()
+	}
+	return withChaosFromEnv(withHedgingFromEnv(provider))
+}
+
+// NewNamedProviderFromEnv builds the provider selected by name, e.g. "openai",
+// "gemini", "azure_openai" or "openai_compatible:<instance>". Remote providers
+// are wrapped with the outbound limits configured for them; the mock and
+// replay providers never leave the process.
+func NewNamedProviderFromEnv(name string) (LLMProvider, error) {
+	provider, err := newBaseProviderFromEnv(name)
+	if err != nil {
+		return nil, err
+	}
+	switch provider.(type) {
+	case *MockProvider, *ReplayProvider:
+		return provider, nil
+	}
+	return withLimitsFromEnv(provider), nil
+}
+
+func newBaseProviderFromEnv(name string) (LLMProvider, error) {
+	name = strings.TrimSpace(name)
+	switch {
+	case name == "openai":
+		return asProvider(NewOpenAIProviderFromEnv())
+	case name == "gemini":
+		return asProvider(NewGeminiProviderFromEnv())
+	case name == "azure_openai":
+		return asProvider(NewAzureOpenAIProviderFromEnv())
+	case name == openAICompatibleProviderName:
+		return asProvider(NewOpenAICompatibleProviderFromEnv(""))
+	case strings.HasPrefix(name, openAICompatibleProviderName+":"):
+		return asProvider(NewOpenAICompatibleProviderFromEnv(strings.TrimPrefix(name, openAICompatibleProviderName+":")))
+	case name == replayProviderName:
+		return asProvider(NewReplayProviderFromEnv())
+	case name == "" || name == "mock":
+		return asProvider(NewMockProviderFromEnv())
+	default:
+		return nil, fmt.Errorf("unsupported LLM provider %q", name)
+	}
+}
+
+// asProvider avoids returning a typed nil pointer inside a non-nil interface.
+func asProvider[P LLMProvider](provider P, err error) (LLMProvider, error) {
+	if err != nil {
+		return nil, err
 	}
-	return NewMockProvider()
+	return provider, nil
 }
 
 func CurrentProvider() LLMProvider {
+	providerMu.RLock()
+	defer providerMu.RUnlock()
 	return currentProvider
 }
 
 func SetProvider(provider LLMProvider) {
 	if provider != nil {
+		providerMu.Lock()
 		currentProvider = provider
+		providerMu.Unlock()
 	}
 }
@@ -46,3 +46,24 @@ func TestNewProviderFromEnvGeminiMissingKeyFallsBackToMock(t *testing.T) {
 		t.Fatalf("expected fallback mock provider, got %q", provider.Name())
 	}
 }
+
+func TestNewProviderFromEnvSelectsNamedOpenAICompatible(t *testing.T) {
+	t.Setenv("LLM_PROVIDER", "openai_compatible:vllm")
+	t.Setenv("VLLM_BASE_URL", "http://vllm.internal:8000/v1")
+	t.Setenv("VLLM_MODEL", "meta-llama/Llama-3.1-8B-Instruct")
+
+	provider := NewProviderFromEnv()
+	if provider.Name() != "openai_compatible:vllm" {
+		t.Fatalf("expected openai_compatible:vllm provider, got %q", provider.Name())
+	}
+}
+
+func TestNewProviderFromEnvOpenAICompatibleMissingBaseURLFallsBackToMock(t *testing.T) {
+	t.Setenv("LLM_PROVIDER", "openai_compatible")
+	t.Setenv("LOCAL_LLM_BASE_URL", "")
+
+	provider := NewProviderFromEnv()
+	if provider.Name() != "mock" {
+		t.Fatalf("expected fallback mock provider, got %q", provider.Name())
+	}
+}
@@ -0,0 +1,362 @@
+package llm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/alanmaizon/homer/backend/internal/domain"
+	"github.com/alanmaizon/homer/backend/internal/middleware"
+)
+
+const (
+	replayProviderName = "replay"
+
+	replayModeReplay = "replay"
+	replayModeRecord = "record"
+
+	cassetteExt = ".json"
+)
+
+// ErrCassetteMiss is matched by errors returned in replay mode when no
+// cassette was recorded for a request.
+var ErrCassetteMiss = errors.New("no cassette recorded for request")
+
+// cassetteRequest is the normalized form of a provider call. Its hash names
+// the cassette, so requests that differ only in whitespace replay the same
+// response. Generation parameters are recorded but do not affect matching.
+type cassetteRequest struct {
+	Operation    string            `json:"operation"`
+	Style        string            `json:"style,omitempty"`
+	Mode         string            `json:"mode,omitempty"`
+	Instructions string            `json:"instructions,omitempty"`
+	Text         string            `json:"text,omitempty"`
+	Documents    []domain.Document `json:"documents,omitempty"`
+	Messages     []Message         `json:"messages,omitempty"`
+	Tools        []ToolDefinition  `json:"tools,omitempty"`
+	Texts        []string          `json:"texts,omitempty"`
+}
+
+type cassette struct {
+	Key          string                  `json:"key"`
+	Request      cassetteRequest         `json:"request"`
+	Generation   domain.GenerationParams `json:"generation"`
+	Response     string                  `json:"response"`
+	Turn         *ToolTurn               `json:"turn,omitempty"`
+	Vectors      [][]float32             `json:"vectors,omitempty"`
+	RecordedFrom string                  `json:"recordedFrom"`
+	RecordedAt   string                  `json:"recordedAt"`
+}
+
+// ReplayProvider serves provider responses from cassette files. In record
+// mode it forwards calls to a real provider and writes each request/response
+// pair to the cassette directory; in replay mode it answers only from those
+// cassettes and fails on any request that was not recorded.
+type ReplayProvider struct {
+	mode   string
+	dir    string
+	target LLMProvider
+
+	mu        sync.RWMutex
+	cassettes map[string]cassette
+}
+
+// NewReplayProviderFromEnv reads REPLAY_MODE (replay or record),
+// REPLAY_CASSETTE_DIR and, in record mode, REPLAY_TARGET_PROVIDER.
+func NewReplayProviderFromEnv() (*ReplayProvider, error) {
+	dir := strings.TrimSpace(os.Getenv("REPLAY_CASSETTE_DIR"))
+	if dir == "" {
+		return nil, errors.New("REPLAY_CASSETTE_DIR is required")
+	}
+
+	mode := strings.ToLower(strings.TrimSpace(os.Getenv("REPLAY_MODE")))
+	switch mode {
+	case "", replayModeReplay:
+		return newReplayProvider(dir)
+	case replayModeRecord:
+		targetName := strings.TrimSpace(os.Getenv("REPLAY_TARGET_PROVIDER"))
+		if targetName == "" || targetName == replayProviderName {
+			return nil, errors.New("REPLAY_TARGET_PROVIDER must name a real provider in record mode")
+		}
+		target, err := NewNamedProviderFromEnv(targetName)
+		if err != nil {
+			return nil, fmt.Errorf("REPLAY_TARGET_PROVIDER: %w", err)
+		}
+		return newRecordingProvider(dir, target)
+	default:
+		return nil, fmt.Errorf("REPLAY_MODE must be %q or %q", replayModeReplay, replayModeRecord)
+	}
+}
+
+func newReplayProvider(dir string) (*ReplayProvider, error) {
+	cassettes, err := loadCassettes(dir)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("component=replay event=loaded mode=replay dir=%s cassettes=%d", dir, len(cassettes))
+	return &ReplayProvider{mode: replayModeReplay, dir: dir, cassettes: cassettes}, nil
+}
+
+func newRecordingProvider(dir string, target LLMProvider) (*ReplayProvider, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("REPLAY_CASSETTE_DIR: %w", err)
+	}
+	log.Printf("component=replay event=loaded mode=record dir=%s target=%s", dir, target.Name())
+	return &ReplayProvider{mode: replayModeRecord, dir: dir, target: target, cassettes: make(map[string]cassette)}, nil
+}
+
+func (r *ReplayProvider) Name() string {
+	return replayProviderName
+}
+
+// Unwrap returns the recorded provider, or nil in replay mode.
+func (r *ReplayProvider) Unwrap() LLMProvider {
+	return r.target
+}
+
+func (r *ReplayProvider) Summarize(ctx context.Context, docs []domain.Document, style string, instructions string, params domain.GenerationParams) (string, error) {
+	request := cassetteRequest{Operation: "summarize", Style: style, Instructions: instructions, Documents: docs}
+	return r.serve(ctx, request, params, func() (string, error) {
+		return r.target.Summarize(ctx, docs, style, instructions, params)
+	})
+}
+
+func (r *ReplayProvider) Rewrite(ctx context.Context, text string, mode string, instructions string, params domain.GenerationParams) (string, error) {
+	request := cassetteRequest{Operation: "rewrite", Mode: mode, Instructions: instructions, Text: text}
+	return r.serve(ctx, request, params, func() (string, error) {
+		return r.target.Rewrite(ctx, text, mode, instructions, params)
+	})
+}
+
+func (r *ReplayProvider) Generate(ctx context.Context, messages []Message, params domain.GenerationParams) (string, error) {
+	request := cassetteRequest{Operation: "generate", Messages: messages}
+	return r.serve(ctx, request, params, func() (string, error) {
+		return r.target.Generate(ctx, messages, params)
+	})
+}
+
+// supportsTools reports true in replay mode, where tool turns are answered
+// from cassettes like any other call.
+func (r *ReplayProvider) supportsTools() bool {
+	return r.mode == replayModeReplay || supportsTools(r.target)
+}
+
+func (r *ReplayProvider) GenerateWithTools(ctx context.Context, messages []Message, tools []ToolDefinition, params domain.GenerationParams) (ToolTurn, error) {
+	request := cassetteRequest{Operation: "generate_with_tools", Messages: messages, Tools: tools}
+	return serveReplay(r, ctx, request, params, func() (ToolTurn, error) {
+		caller, err := ToolCallerFor(r.target)
+		if err != nil {
+			return ToolTurn{}, err
+		}
+		return caller.GenerateWithTools(ctx, messages, tools, params)
+	}, func(entry *cassette, turn ToolTurn) {
+		entry.Turn = &turn
+	}, func(entry cassette) ToolTurn {
+		if entry.Turn == nil {
+			return ToolTurn{}
+		}
+		return *entry.Turn
+	})
+}
+
+// supportsEmbeddings reports true in replay mode, where embeddings are
+// answered from cassettes like any other call.
+func (r *ReplayProvider) supportsEmbeddings() bool {
+	return r.mode == replayModeReplay || supportsEmbeddings(r.target)
+}
+
+// EmbeddingModel names the recorded provider's model in record mode. Replayed
+// vectors all come from the model they were recorded with, named "replay".
+func (r *ReplayProvider) EmbeddingModel() string {
+	if r.mode == replayModeReplay {
+		return replayProviderName
+	}
+	return embeddingModelOf(r.target)
+}
+
+func (r *ReplayProvider) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	request := cassetteRequest{Operation: "embed", Texts: texts}
+	return serveReplay(r, ctx, request, domain.GenerationParams{}, func() ([][]float32, error) {
+		embedder, err := EmbedderFor(r.target)
+		if err != nil {
+			return nil, err
+		}
+		return embedder.Embed(ctx, texts)
+	}, func(entry *cassette, vectors [][]float32) {
+		entry.Vectors = vectors
+	}, func(entry cassette) [][]float32 {
+		return entry.Vectors
+	})
+}
+
+func (r *ReplayProvider) serve(ctx context.Context, request cassetteRequest, params domain.GenerationParams, live func() (string, error)) (string, error) {
+	return serveReplay(r, ctx, request, params, live, func(entry *cassette, response string) {
+		entry.Response = response
+	}, func(entry cassette) string {
+		return entry.Response
+	})
+}
+
+// serveReplay calls live and records its result in record mode, and answers
+// from the recorded cassette in replay mode. store and load move the result
+// in and out of a cassette.
+func serveReplay[T any](r *ReplayProvider, ctx context.Context, request cassetteRequest, params domain.GenerationParams, live func() (T, error), store func(*cassette, T), load func(cassette) T) (T, error) {
+	var zero T
+	request = request.normalized()
+	key, err := request.key()
+	if err != nil {
+		return zero, err
+	}
+
+	if r.mode == replayModeRecord {
+		response, err := live()
+		if err != nil {
+			return zero, err
+		}
+		entry := cassette{
+			Key:          key,
+			Request:      request,
+			Generation:   params,
+			RecordedFrom: r.target.Name(),
+			RecordedAt:   time.Now().UTC().Format(time.RFC3339),
+		}
+		store(&entry, response)
+		if err := r.record(entry); err != nil {
+			return zero, err
+		}
+		log.Printf(
+			"request_id=%s component=replay event=recorded operation=%s key=%s",
+			middleware.GetRequestIDFromContext(ctx),
+			request.Operation,
+			key,
+		)
+		return response, nil
+	}
+
+	return observeProviderOperation(ctx, r.Name(), request.Operation, func() (T, error) {
+		r.mu.RLock()
+		recorded, ok := r.cassettes[key]
+		r.mu.RUnlock()
+		if !ok {
+			log.Printf(
+				"request_id=%s component=replay event=miss operation=%s key=%s dir=%s",
+				middleware.GetRequestIDFromContext(ctx),
+				request.Operation,
+				key,
+				r.dir,
+			)
+			return zero, fmt.Errorf("%w: operation=%s key=%s in %s (record it with REPLAY_MODE=record)", ErrCassetteMiss, request.Operation, key, r.dir)
+		}
+		return load(recorded), nil
+	})
+}
+
+func (r *ReplayProvider) record(entry cassette) error {
+	encoded, err := json.MarshalIndent(entry, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	path := filepath.Join(r.dir, entry.Request.Operation+"-"+entry.Key+cassetteExt)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(encoded, '\n'), 0o644); err != nil {
+		return fmt.Errorf("write cassette: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("write cassette: %w", err)
+	}
+	r.cassettes[entry.Key] = entry
+	return nil
+}
+
+func loadCassettes(dir string) (map[string]cassette, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("REPLAY_CASSETTE_DIR: %w", err)
+	}
+
+	cassettes := make(map[string]cassette)
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != cassetteExt {
+			continue
+		}
+
+		raw, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("cassette %s: %w", entry.Name(), err)
+		}
+		var loaded cassette
+		if err := json.Unmarshal(raw, &loaded); err != nil {
+			return nil, fmt.Errorf("cassette %s: %w", entry.Name(), err)
+		}
+
+		// Re-derive the key so hand-edited requests still match.
+		key, err := loaded.Request.normalized().key()
+		if err != nil {
+			return nil, fmt.Errorf("cassette %s: %w", entry.Name(), err)
+		}
+		cassettes[key] = loaded
+	}
+	return cassettes, nil
+}
+
+func (c cassetteRequest) normalized() cassetteRequest {
+	c.Style = normalizePromptText(c.Style)
+	c.Mode = normalizePromptText(c.Mode)
+	c.Instructions = normalizePromptText(c.Instructions)
+	c.Text = normalizePromptText(c.Text)
+
+	if len(c.Documents) > 0 {
+		documents := make([]domain.Document, len(c.Documents))
+		for i, doc := range c.Documents {
+			documents[i] = domain.Document{
+				ID:      strings.TrimSpace(doc.ID),
+				Title:   normalizePromptText(doc.Title),
+				Content: normalizePromptText(doc.Content),
+			}
+		}
+		c.Documents = documents
+	}
+	if len(c.Texts) > 0 {
+		texts := make([]string, len(c.Texts))
+		for i, text := range c.Texts {
+			texts[i] = normalizePromptText(text)
+		}
+		c.Texts = texts
+	}
+	if len(c.Messages) > 0 {
+		messages := make([]Message, len(c.Messages))
+		for i, message := range c.Messages {
+			message.Content = normalizePromptText(message.Content)
+			messages[i] = message
+		}
+		c.Messages = messages
+	}
+	return c
+}
+
+func (c cassetteRequest) key() (string, error) {
+	encoded, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:8]), nil
+}
+
+// normalizePromptText trims and collapses runs of whitespace.
+func normalizePromptText(value string) string {
+	return strings.Join(strings.Fields(value), " ")
+}
@@ -0,0 +1,173 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alanmaizon/homer/backend/internal/domain"
+)
+
+type scriptedProvider struct {
+	name    string
+	replies map[string]string
+	calls   int
+}
+
+func (s *scriptedProvider) Name() string {
+	return s.name
+}
+
+func (s *scriptedProvider) Summarize(_ context.Context, _ []domain.Document, _ string, _ string, _ domain.GenerationParams) (string, error) {
+	s.calls++
+	return s.replies["summarize"], nil
+}
+
+func (s *scriptedProvider) Rewrite(_ context.Context, _ string, _ string, _ string, _ domain.GenerationParams) (string, error) {
+	s.calls++
+	return s.replies["rewrite"], nil
+}
+
+func (s *scriptedProvider) Generate(_ context.Context, _ []Message, _ domain.GenerationParams) (string, error) {
+	s.calls++
+	return s.replies["generate"], nil
+}
+
+func TestReplayProviderRecordThenReplay(t *testing.T) {
+	dir := t.TempDir()
+	target := &scriptedProvider{name: "openai", replies: map[string]string{
+		"summarize": "- Launch is planned for Q1.",
+		"rewrite":   "Please send the report.",
+		"generate":  "Hello there.",
+	}}
+
+	recorder, err := newRecordingProvider(dir, target)
+	if err != nil {
+		t.Fatalf("newRecordingProvider returned error: %v", err)
+	}
+
+	ctx := context.Background()
+	docs := []domain.Document{{ID: "d1", Title: "Plan", Content: "We launch in Q1.\n\nHiring follows."}}
+	if _, err := recorder.Summarize(ctx, docs, "bullet", "Focus on dates", domain.GenerationParams{}); err != nil {
+		t.Fatalf("record Summarize returned error: %v", err)
+	}
+	if _, err := recorder.Rewrite(ctx, "send report pls", "professional", "", domain.GenerationParams{}); err != nil {
+		t.Fatalf("record Rewrite returned error: %v", err)
+	}
+	if _, err := recorder.Generate(ctx, []Message{{Role: MessageRoleUser, Content: "hi"}}, domain.GenerationParams{}); err != nil {
+		t.Fatalf("record Generate returned error: %v", err)
+	}
+	if target.calls != 3 {
+		t.Fatalf("expected 3 live calls while recording, got %d", target.calls)
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*"+cassetteExt))
+	if len(files) != 3 {
+		t.Fatalf("expected 3 cassette files, got %v", files)
+	}
+
+	replayer, err := newReplayProvider(dir)
+	if err != nil {
+		t.Fatalf("newReplayProvider returned error: %v", err)
+	}
+
+	// Whitespace differences normalize to the recorded request.
+	reformatted := []domain.Document{{ID: "d1", Title: " Plan ", Content: "We launch in Q1. Hiring   follows."}}
+	summary, err := replayer.Summarize(ctx, reformatted, "bullet", "Focus  on dates\n", domain.GenerationParams{})
+	if err != nil {
+		t.Fatalf("replay Summarize returned error: %v", err)
+	}
+	if summary != "- Launch is planned for Q1." {
+		t.Fatalf("unexpected replayed summary %q", summary)
+	}
+
+	rewrite, err := replayer.Rewrite(ctx, "send report pls", "professional", "", domain.GenerationParams{})
+	if err != nil || rewrite != "Please send the report." {
+		t.Fatalf("unexpected replayed rewrite %q err=%v", rewrite, err)
+	}
+	if target.calls != 3 {
+		t.Fatalf("expected replay to make no live calls, got %d", target.calls)
+	}
+}
+
+func TestReplayProviderFailsOnMiss(t *testing.T) {
+	replayer, err := newReplayProvider(t.TempDir())
+	if err != nil {
+		t.Fatalf("newReplayProvider returned error: %v", err)
+	}
+
+	_, err = replayer.Rewrite(context.Background(), "never recorded", "simplify", "", domain.GenerationParams{})
+	if !errors.Is(err, ErrCassetteMiss) {
+		t.Fatalf("expected ErrCassetteMiss, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "operation=rewrite") {
+		t.Fatalf("expected miss to name the operation, got %v", err)
+	}
+}
+
+func TestReplayProviderRejectsCorruptCassette(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "rewrite-bad.json"), []byte("{"), 0o644); err != nil {
+		t.Fatalf("failed to write cassette: %v", err)
+	}
+
+	if _, err := newReplayProvider(dir); err == nil || !strings.Contains(err.Error(), "rewrite-bad.json") {
+		t.Fatalf("expected corrupt cassette error, got %v", err)
+	}
+}
+
+func TestNewReplayProviderFromEnvValidation(t *testing.T) {
+	testCases := []struct {
+		name    string
+		env     map[string]string
+		wantErr string
+	}{
+		{
+			name:    "missing_dir",
+			env:     map[string]string{},
+			wantErr: "REPLAY_CASSETTE_DIR is required",
+		},
+		{
+			name:    "unknown_mode",
+			env:     map[string]string{"REPLAY_CASSETTE_DIR": t.TempDir(), "REPLAY_MODE": "rewind"},
+			wantErr: "REPLAY_MODE",
+		},
+		{
+			name:    "record_without_target",
+			env:     map[string]string{"REPLAY_CASSETTE_DIR": t.TempDir(), "REPLAY_MODE": "record"},
+			wantErr: "REPLAY_TARGET_PROVIDER",
+		},
+		{
+			name:    "replay_missing_dir",
+			env:     map[string]string{"REPLAY_CASSETTE_DIR": filepath.Join(t.TempDir(), "missing")},
+			wantErr: "REPLAY_CASSETTE_DIR",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, key := range []string{"REPLAY_CASSETTE_DIR", "REPLAY_MODE", "REPLAY_TARGET_PROVIDER"} {
+				t.Setenv(key, tc.env[key])
+			}
+
+			_, err := NewReplayProviderFromEnv()
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tc.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestNewProviderFromEnvSelectsReplay(t *testing.T) {
+	t.Setenv("LLM_PROVIDER", "replay")
+	t.Setenv("REPLAY_MODE", "")
+	t.Setenv("REPLAY_CASSETTE_DIR", t.TempDir())
+
+	provider := NewProviderFromEnv()
+	if provider.Name() != "replay" {
+		t.Fatalf("expected replay provider, got %q", provider.Name())
+	}
+}
@@ -0,0 +1,200 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alanmaizon/homer/backend/internal/middleware"
+	"google.golang.org/genai"
+)
+
+// retryPolicy is shared by every provider. Delays use full jitter (a random
+// wait between zero and the capped exponential delay) so concurrent callers
+// do not retry in lockstep; a longer Retry-After hint from the provider wins,
+// up to maxDelay.
+// All attempts of one call must fit within budget and the caller's deadline.
+type retryPolicy struct {
+	maxRetries int
+	baseDelay  time.Duration
+	maxDelay   time.Duration
+	budget     time.Duration
+	clock      providerClock
+	jitter     func(limit time.Duration) time.Duration
+}
+
+func newRetryPolicy(policy runtimePolicy) retryPolicy {
+	return retryPolicy{
+		maxRetries: policy.maxRetries,
+		baseDelay:  policy.retryBaseDelay,
+		maxDelay:   policy.retryMaxDelay,
+		budget:     policy.retryBudget,
+	}
+}
+
+// retryCall tracks the attempts of one logical provider call.
+type retryCall struct {
+	policy   retryPolicy
+	provider string
+	deadline time.Time
+	attempt  int
+}
+
+func (p retryPolicy) start(ctx context.Context, provider string) *retryCall {
+	if p.clock == nil {
+		p.clock = realProviderClock{}
+	}
+	if p.jitter == nil {
+		p.jitter = fullJitter
+	}
+
+	call := &retryCall{policy: p, provider: provider}
+	if p.budget > 0 {
+		call.deadline = p.clock.Now().Add(p.budget)
+	}
+	if deadline, ok := ctx.Deadline(); ok && (call.deadline.IsZero() || deadline.Before(call.deadline)) {
+		call.deadline = deadline
+	}
+	return call
+}
+
+// wait returns nil once the backoff for err has elapsed and the caller should
+// try again. Otherwise it returns the error to surface: err itself when it is
+// not retryable or the retries or time budget are spent, or the context error
+// if the caller gives up while waiting.
+func (c *retryCall) wait(ctx context.Context, err error) error {
+	if !shouldRetryError(err) || c.attempt >= c.policy.maxRetries {
+		return err
+	}
+
+	delay := c.delay(err)
+	if !c.deadline.IsZero() && !c.policy.clock.Now().Add(delay).Before(c.deadline) {
+		log.Printf(
+			"request_id=%s component=llm_retry provider=%s event=budget_exhausted attempt=%d delay_ms=%d error_category=%s",
+			middleware.GetRequestIDFromContext(ctx),
+			c.provider,
+			c.attempt+1,
+			delay.Milliseconds(),
+			providerErrorCategory(err),
+		)
+		return err
+	}
+
+	log.Printf(
+		"request_id=%s component=llm_retry provider=%s event=retry attempt=%d delay_ms=%d error_category=%s",
+		middleware.GetRequestIDFromContext(ctx),
+		c.provider,
+		c.attempt+1,
+		delay.Milliseconds(),
+		providerErrorCategory(err),
+	)
+	c.attempt++
+	return c.policy.clock.Sleep(ctx, delay)
+}
+
+func (c *retryCall) delay(err error) time.Duration {
+	ceiling := c.policy.maxDelay
+	if exponential := c.policy.baseDelay << c.attempt; exponential > 0 && (ceiling <= 0 || exponential < ceiling) {
+		ceiling = exponential
+	}
+
+	delay := c.policy.jitter(ceiling)
+	if hint := retryAfterFromError(err); hint > delay {
+		delay = hint
+		if c.policy.maxDelay > 0 {
+			delay = min(delay, c.policy.maxDelay)
+		}
+	}
+	return delay
+}
+
+func fullJitter(limit time.Duration) time.Duration {
+	if limit <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int64N(int64(limit) + 1))
+}
+
+// retryAfterFromError extracts the provider's requested wait, if any.
+func retryAfterFromError(err error) time.Duration {
+	var httpErr *providerHTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr.retryAfter
+	}
+
+	var apiErr genai.APIError
+	if errors.As(err, &apiErr) {
+		return geminiRetryDelay(apiErr)
+	}
+	return 0
+}
+
+// parseRetryAfter reads Retry-After (delta seconds or an HTTP date),
+// retry-after-ms, and the x-ratelimit-reset family of headers. Reset headers
+// may be Go-style durations ("6m0s", "20ms"), delta seconds, or a Unix
+// timestamp. The longest hint wins.
+func parseRetryAfter(header http.Header, now time.Time) time.Duration {
+	var longest time.Duration
+	consider := func(delay time.Duration) {
+		if delay > longest {
+			longest = delay
+		}
+	}
+
+	if raw := strings.TrimSpace(header.Get("Retry-After")); raw != "" {
+		if seconds, err := strconv.ParseFloat(raw, 64); err == nil {
+			consider(time.Duration(seconds * float64(time.Second)))
+		} else if at, err := http.ParseTime(raw); err == nil {
+			consider(at.Sub(now))
+		}
+	}
+	if raw := strings.TrimSpace(header.Get("Retry-After-Ms")); raw != "" {
+		if millis, err := strconv.ParseFloat(raw, 64); err == nil {
+			consider(time.Duration(millis * float64(time.Millisecond)))
+		}
+	}
+	for _, key := range []string{"X-Ratelimit-Reset", "X-Ratelimit-Reset-Requests", "X-Ratelimit-Reset-Tokens"} {
+		consider(parseRateLimitReset(header.Get(key), now))
+	}
+
+	return longest
+}
+
+func parseRateLimitReset(raw string, now time.Time) time.Duration {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return 0
+	}
+	if delay, err := time.ParseDuration(raw); err == nil {
+		return delay
+	}
+
+	value, err := strconv.ParseFloat(raw, 64)
+	if err != nil {
+		return 0
+	}
+	// Values this large are epoch timestamps rather than deltas.
+	if value > 1e9 {
+		return time.Unix(int64(value), 0).Sub(now)
+	}
+	return time.Duration(value * float64(time.Second))
+}
+
+// geminiRetryDelay reads google.rpc.RetryInfo from a Gemini error.
+func geminiRetryDelay(apiErr genai.APIError) time.Duration {
+	for _, detail := range apiErr.Details {
+		if kind, _ := detail["@type"].(string); !strings.HasSuffix(kind, "google.rpc.RetryInfo") {
+			continue
+		}
+		raw, _ := detail["retryDelay"].(string)
+		if delay, err := time.ParseDuration(raw); err == nil {
+			return delay
+		}
+	}
+	return 0
+}
@@ -0,0 +1,313 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/alanmaizon/homer/backend/internal/domain"
+	"github.com/alanmaizon/homer/backend/internal/metrics"
+	"google.golang.org/genai"
+)
+
+type fakeClock struct {
+	now    time.Time
+	sleeps []time.Duration
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Now()}
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Sleep(ctx context.Context, delay time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.sleeps = append(c.sleeps, delay)
+	c.now = c.now.Add(delay)
+	return nil
+}
+
+func maxJitter(limit time.Duration) time.Duration {
+	return limit
+}
+
+func TestRetryPolicyCapsExponentialDelay(t *testing.T) {
+	clock := newFakeClock()
+	policy := retryPolicy{
+		maxRetries: 4,
+		baseDelay:  time.Second,
+		maxDelay:   3 * time.Second,
+		budget:     time.Minute,
+		clock:      clock,
+		jitter:     maxJitter,
+	}
+
+	retry := policy.start(context.Background(), "openai")
+	upstreamErr := &providerHTTPError{provider: "openai", statusCode: 503}
+	for i := 0; i < 4; i++ {
+		if err := retry.wait(context.Background(), upstreamErr); err != nil {
+			t.Fatalf("wait %d returned error: %v", i, err)
+		}
+	}
+	if err := retry.wait(context.Background(), upstreamErr); !errors.Is(err, upstreamErr) {
+		t.Fatalf("expected upstream error once retries are spent, got %v", err)
+	}
+
+	want := []time.Duration{time.Second, 2 * time.Second, 3 * time.Second, 3 * time.Second}
+	if len(clock.sleeps) != len(want) {
+		t.Fatalf("expected sleeps %v, got %v", want, clock.sleeps)
+	}
+	for i := range want {
+		if clock.sleeps[i] != want[i] {
+			t.Fatalf("expected sleeps %v, got %v", want, clock.sleeps)
+		}
+	}
+}
+
+func TestRetryPolicyFullJitterStaysWithinCeiling(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		if delay := fullJitter(time.Second); delay < 0 || delay > time.Second {
+			t.Fatalf("jittered delay %s outside [0, 1s]", delay)
+		}
+	}
+	if delay := fullJitter(0); delay != 0 {
+		t.Fatalf("expected zero delay for zero ceiling, got %s", delay)
+	}
+}
+
+func TestRetryPolicyHonorsRetryAfter(t *testing.T) {
+	clock := newFakeClock()
+	policy := retryPolicy{
+		maxRetries: 2,
+		baseDelay:  100 * time.Millisecond,
+		maxDelay:   10 * time.Second,
+		budget:     time.Minute,
+		clock:      clock,
+		jitter:     maxJitter,
+	}
+
+	retry := policy.start(context.Background(), "openai")
+	err := &providerHTTPError{provider: "openai", statusCode: 429, retryAfter: 7 * time.Second}
+	if waitErr := retry.wait(context.Background(), err); waitErr != nil {
+		t.Fatalf("wait returned error: %v", waitErr)
+	}
+	if len(clock.sleeps) != 1 || clock.sleeps[0] != 7*time.Second {
+		t.Fatalf("expected Retry-After to override jitter, got %v", clock.sleeps)
+	}
+}
+
+func TestRetryPolicyClampsRetryAfterToMaxDelay(t *testing.T) {
+	clock := newFakeClock()
+	policy := retryPolicy{
+		maxRetries: 2,
+		baseDelay:  100 * time.Millisecond,
+		maxDelay:   10 * time.Second,
+		clock:      clock,
+		jitter:     maxJitter,
+	}
+
+	retry := policy.start(context.Background(), "openai")
+	err := &providerHTTPError{provider: "openai", statusCode: 429, retryAfter: time.Hour}
+	if waitErr := retry.wait(context.Background(), err); waitErr != nil {
+		t.Fatalf("wait returned error: %v", waitErr)
+	}
+	if len(clock.sleeps) != 1 || clock.sleeps[0] != 10*time.Second {
+		t.Fatalf("expected Retry-After to be capped at maxDelay, got %v", clock.sleeps)
+	}
+}
+
+func TestRetryPolicyStopsWhenBudgetWouldBeExceeded(t *testing.T) {
+	clock := newFakeClock()
+	policy := retryPolicy{
+		maxRetries: 5,
+		baseDelay:  time.Second,
+		maxDelay:   time.Minute,
+		budget:     5 * time.Second,
+		clock:      clock,
+		jitter:     maxJitter,
+	}
+
+	retry := policy.start(context.Background(), "openai")
+	err := &providerHTTPError{provider: "openai", statusCode: 429, retryAfter: 10 * time.Second}
+	if waitErr := retry.wait(context.Background(), err); !errors.Is(waitErr, err) {
+		t.Fatalf("expected original error when Retry-After exceeds budget, got %v", waitErr)
+	}
+	if len(clock.sleeps) != 0 {
+		t.Fatalf("expected no sleep, got %v", clock.sleeps)
+	}
+}
+
+func TestRetryPolicyBoundedByContextDeadline(t *testing.T) {
+	clock := newFakeClock()
+	policy := retryPolicy{
+		maxRetries: 5,
+		baseDelay:  time.Second,
+		maxDelay:   time.Second,
+		budget:     time.Minute,
+		clock:      clock,
+		jitter:     maxJitter,
+	}
+
+	ctx, cancel := context.WithDeadline(context.Background(), clock.now.Add(2500*time.Millisecond))
+	defer cancel()
+
+	retry := policy.start(ctx, "gemini")
+	upstreamErr := &providerHTTPError{provider: "gemini", statusCode: 500}
+	for i := 0; i < 2; i++ {
+		if err := retry.wait(ctx, upstreamErr); err != nil {
+			t.Fatalf("wait %d returned error: %v", i, err)
+		}
+	}
+	if err := retry.wait(ctx, upstreamErr); !errors.Is(err, upstreamErr) {
+		t.Fatalf("expected deadline to stop retries, got %v", err)
+	}
+	if len(clock.sleeps) != 2 {
+		t.Fatalf("expected 2 sleeps before deadline, got %v", clock.sleeps)
+	}
+}
+
+func TestRetryPolicySkipsNonRetryableErrors(t *testing.T) {
+	clock := newFakeClock()
+	retry := retryPolicy{maxRetries: 3, clock: clock}.start(context.Background(), "openai")
+
+	badRequest := &providerHTTPError{provider: "openai", statusCode: 400}
+	if err := retry.wait(context.Background(), badRequest); !errors.Is(err, badRequest) {
+		t.Fatalf("expected non-retryable error to be returned, got %v", err)
+	}
+	if len(clock.sleeps) != 0 {
+		t.Fatalf("expected no sleep, got %v", clock.sleeps)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		name   string
+		header http.Header
+		want   time.Duration
+	}{
+		{name: "none", header: http.Header{}, want: 0},
+		{name: "seconds", header: http.Header{"Retry-After": {"3"}}, want: 3 * time.Second},
+		{name: "http_date", header: http.Header{"Retry-After": {now.Add(90 * time.Second).Format(http.TimeFormat)}}, want: 90 * time.Second},
+		{name: "milliseconds", header: http.Header{"Retry-After-Ms": {"250"}}, want: 250 * time.Millisecond},
+		{name: "reset_duration", header: http.Header{"X-Ratelimit-Reset-Requests": {"1m30s"}}, want: 90 * time.Second},
+		{name: "reset_epoch", header: http.Header{"X-Ratelimit-Reset": {"1767268860"}}, want: time.Minute},
+		{name: "longest_wins", header: http.Header{"Retry-After": {"1"}, "X-Ratelimit-Reset-Tokens": {"6s"}}, want: 6 * time.Second},
+		{name: "garbage", header: http.Header{"Retry-After": {"soon"}}, want: 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := parseRetryAfter(tc.header, now); got != tc.want {
+				t.Fatalf("expected %s, got %s", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestGeminiRetryDelayFromRetryInfo(t *testing.T) {
+	err := genai.APIError{
+		Code: 429,
+		Details: []map[string]any{
+			{"@type": "type.googleapis.com/google.rpc.QuotaFailure"},
+			{"@type": "type.googleapis.com/google.rpc.RetryInfo", "retryDelay": "12s"},
+		},
+	}
+
+	if got := retryAfterFromError(err); got != 12*time.Second {
+		t.Fatalf("expected 12s retry delay, got %s", got)
+	}
+	if category := providerErrorCategory(err); category != "rate_limited" {
+		t.Fatalf("expected rate_limited category, got %q", category)
+	}
+}
+
+func TestOpenAIProviderRetriesAfterRetryAfterHeader(t *testing.T) {
+	var calls atomic.Int32
+	server := newFakeChatCompletionServer(t, func(w http.ResponseWriter, _ *http.Request, _ fakeChatCompletionRequest) {
+		if calls.Add(1) == 1 {
+			w.Header().Set("Retry-After", "4")
+			http.Error(w, "slow down", http.StatusTooManyRequests)
+			return
+		}
+		writeFakeChatCompletion(w, "ok")
+	})
+
+	clock := newFakeClock()
+	provider := &OpenAIProvider{
+		name:       "openai",
+		endpoint:   server.URL,
+		apiKey:     "key",
+		authScheme: authSchemeBearer,
+		model:      "gpt-4o-mini",
+		client:     server.Client(),
+		timeout:    defaultLLMTimeout,
+		retry: retryPolicy{
+			maxRetries: 2,
+			baseDelay:  10 * time.Millisecond,
+			maxDelay:   10 * time.Second,
+			budget:     time.Minute,
+			clock:      clock,
+			jitter:     maxJitter,
+		},
+	}
+
+	result, err := provider.Generate(context.Background(), []Message{{Role: MessageRoleUser, Content: "hi"}}, domain.GenerationParams{})
+	if err != nil {
+		t.Fatalf("Generate returned error: %v", err)
+	}
+	if result != "ok" || calls.Load() != 2 {
+		t.Fatalf("expected success on second attempt, got result=%q calls=%d", result, calls.Load())
+	}
+	if len(clock.sleeps) != 1 || clock.sleeps[0] != 4*time.Second {
+		t.Fatalf("expected a single 4s wait from Retry-After, got %v", clock.sleeps)
+	}
+}
+
+func TestOpenAIProviderDoesNotRetryUndecodableResponse(t *testing.T) {
+	metrics.ResetForTests()
+	var calls atomic.Int32
+	server := newFakeChatCompletionServer(t, func(w http.ResponseWriter, _ *http.Request, _ fakeChatCompletionRequest) {
+		calls.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"choices":[{"message":`))
+	})
+
+	provider := &OpenAIProvider{
+		name:       "openai",
+		endpoint:   server.URL,
+		apiKey:     "key",
+		authScheme: authSchemeBearer,
+		model:      "gpt-4o-mini",
+		client:     server.Client(),
+		timeout:    defaultLLMTimeout,
+		retry: retryPolicy{
+			maxRetries: 2,
+			baseDelay:  10 * time.Millisecond,
+			maxDelay:   time.Second,
+			budget:     time.Minute,
+			clock:      newFakeClock(),
+			jitter:     maxJitter,
+		},
+	}
+
+	_, err := provider.Generate(context.Background(), []Message{{Role: MessageRoleUser, Content: "hi"}}, domain.GenerationParams{})
+	var decodeErr *providerDecodeError
+	if !errors.As(err, &decodeErr) || calls.Load() != 1 {
+		t.Fatalf("expected one attempt failing with a decode error, got calls=%d err=%v", calls.Load(), err)
+	}
+	want := `homer_provider_requests_total{provider="openai",operation="generate",status="error",error_category="invalid_response"} 1`
+	if output := metrics.PrometheusText(); !strings.Contains(output, want) {
+		t.Fatalf("expected %q in metrics output:\n%s", want, output)
+	}
+}
@@ -0,0 +1,155 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/alanmaizon/homer/backend/internal/domain"
+)
+
+// ErrToolsUnsupported is returned by ToolCallerFor when the provider, or the
+// provider behind its decorators, does not support function calling.
+var ErrToolsUnsupported = errors.New("provider does not support tool calling")
+
+// ToolDefinition describes a function the model may call. Parameters is a
+// JSON Schema object describing the arguments.
+type ToolDefinition struct {
+	Name        string
+	Description string
+	Parameters  map[string]any
+}
+
+// ToolCall is a model request to run a tool. Arguments is a JSON object.
+type ToolCall struct {
+	ID        string          `json:"id"`
+	Name      string          `json:"name"`
+	Arguments json.RawMessage `json:"arguments"`
+
+	// thoughtSignature is Gemini's opaque reasoning state for the call, which
+	// must be sent back with it on the next turn.
+	thoughtSignature []byte
+}
+
+// ToolTurn is one model reply: tool calls to run, or the final text when
+// Calls is empty.
+type ToolTurn struct {
+	Text  string     `json:"text"`
+	Calls []ToolCall `json:"calls,omitempty"`
+}
+
+// ToolCaller is implemented by providers that support function calling.
+// Assistant messages carry the calls of earlier turns in ToolCalls and tool
+// messages carry their results, matched by ToolCallID.
+type ToolCaller interface {
+	LLMProvider
+	GenerateWithTools(ctx context.Context, messages []Message, tools []ToolDefinition, params domain.GenerationParams) (ToolTurn, error)
+}
+
+// toolSupport is implemented by decorators, which have GenerateWithTools
+// whether or not the provider they wrap supports function calling.
+type toolSupport interface {
+	supportsTools() bool
+}
+
+// ToolCallerFor returns provider as a ToolCaller. Decorators are returned
+// themselves, so tool turns still pass through their limits, fault injection,
+// hedging and recording.
+func ToolCallerFor(provider LLMProvider) (ToolCaller, error) {
+	caller, ok := provider.(ToolCaller)
+	if !ok {
+		return nil, ErrToolsUnsupported
+	}
+	if support, ok := provider.(toolSupport); ok && !support.supportsTools() {
+		return nil, ErrToolsUnsupported
+	}
+	return caller, nil
+}
+
+func supportsTools(provider LLMProvider) bool {
+	_, err := ToolCallerFor(provider)
+	return err == nil
+}
+
+// TaskPrompt renders the messages provider would send for a summarize or
+// rewrite request, so callers can extend the conversation with tool turns.
+func TaskPrompt(ctx context.Context, provider LLMProvider, req domain.TaskRequest) ([]Message, error) {
+	model := ModelFor(provider).Name
+	switch req.Task {
+	case domain.TaskSummarize:
+		return renderPrompt(ctx, provider.Name(), model, "summarize", summarizePromptData{
+			Style:        req.Style,
+			Instructions: req.Instructions,
+			Documents:    req.Documents,
+		})
+	case domain.TaskRewrite:
+		return renderPrompt(ctx, provider.Name(), model, "rewrite", rewritePromptData{
+			Mode:         req.Mode,
+			Instructions: req.Instructions,
+			Text:         req.Text,
+		})
+	default:
+		return nil, fmt.Errorf("unsupported task: %s", req.Task)
+	}
+}
+
+func (o *OpenAIProvider) GenerateWithTools(ctx context.Context, messages []Message, tools []ToolDefinition, params domain.GenerationParams) (ToolTurn, error) {
+	return observeProviderOperation(ctx, o.Name(), "generate_with_tools", func() (ToolTurn, error) {
+		payload := o.chatCompletionPayload(messages, params)
+		if len(tools) > 0 {
+			functions := make([]map[string]any, 0, len(tools))
+			for _, tool := range tools {
+				functions = append(functions, map[string]any{
+					"type": "function",
+					"function": map[string]any{
+						"name":        tool.Name,
+						"description": tool.Description,
+						"parameters":  tool.Parameters,
+					},
+				})
+			}
+			payload["tools"] = functions
+		}
+		body, err := json.Marshal(payload)
+		if err != nil {
+			return ToolTurn{}, err
+		}
+
+		var parsed struct {
+			Choices []struct {
+				Message struct {
+					Content   string `json:"content"`
+					ToolCalls []struct {
+						ID       string `json:"id"`
+						Function struct {
+							Name      string `json:"name"`
+							Arguments string `json:"arguments"`
+						} `json:"function"`
+					} `json:"tool_calls"`
+				} `json:"message"`
+				FinishReason string `json:"finish_reason"`
+			} `json:"choices"`
+		}
+		if err := o.post(ctx, o.endpoint, body, &parsed); err != nil {
+			return ToolTurn{}, err
+		}
+		if len(parsed.Choices) == 0 {
+			return ToolTurn{}, fmt.Errorf("%s returned no choices", o.name)
+		}
+		choice := parsed.Choices[0]
+		if choice.FinishReason == "content_filter" {
+			return ToolTurn{}, &providerContentFilterError{provider: o.name, message: "completion was filtered"}
+		}
+
+		turn := ToolTurn{Text: choice.Message.Content}
+		for _, call := range choice.Message.ToolCalls {
+			arguments := json.RawMessage(call.Function.Arguments)
+			if !json.Valid(arguments) {
+				arguments = json.RawMessage("{}")
+			}
+			turn.Calls = append(turn.Calls, ToolCall{ID: call.ID, Name: call.Function.Name, Arguments: arguments})
+		}
+		return turn, nil
+	})
+}
@@ -0,0 +1,228 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/alanmaizon/homer/backend/internal/domain"
+	"github.com/alanmaizon/homer/backend/internal/metrics"
+	"google.golang.org/genai"
+)
+
+var testSearchTool = ToolDefinition{
+	Name:        "search_documents",
+	Description: "Search the documents.",
+	Parameters: map[string]any{
+		"type":       "object",
+		"properties": map[string]any{"query": map[string]any{"type": "string"}},
+	},
+}
+
+func TestOpenAIProviderGenerateWithToolsRoundTrip(t *testing.T) {
+	var payloads []map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			http.Error(w, "bad json", http.StatusBadRequest)
+			return
+		}
+		payloads = append(payloads, payload)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"choices":[{"finish_reason":"tool_calls","message":{"role":"assistant","content":null,"tool_calls":[
+			{"id":"call_1","type":"function","function":{"name":"search_documents","arguments":"{\"query\":\"launch\"}"}}]}}]}`))
+	}))
+	t.Cleanup(server.Close)
+
+	provider := &OpenAIProvider{
+		name:       "openai",
+		endpoint:   server.URL,
+		authScheme: authSchemeNone,
+		model:      "gpt-4o-mini",
+		client:     server.Client(),
+		timeout:    defaultLLMTimeout,
+	}
+
+	turn, err := provider.GenerateWithTools(context.Background(), []Message{{Role: MessageRoleUser, Content: "When is the launch?"}}, []ToolDefinition{testSearchTool}, domain.GenerationParams{})
+	if err != nil {
+		t.Fatalf("GenerateWithTools returned error: %v", err)
+	}
+	if len(turn.Calls) != 1 || turn.Calls[0].ID != "call_1" || turn.Calls[0].Name != "search_documents" || string(turn.Calls[0].Arguments) != `{"query":"launch"}` {
+		t.Fatalf("unexpected tool calls %+v", turn.Calls)
+	}
+	tools, _ := payloads[0]["tools"].([]any)
+	if len(tools) != 1 || tools[0].(map[string]any)["function"].(map[string]any)["name"] != "search_documents" {
+		t.Fatalf("expected tool declarations in payload, got %v", payloads[0]["tools"])
+	}
+
+	_, err = provider.GenerateWithTools(context.Background(), []Message{
+		{Role: MessageRoleUser, Content: "When is the launch?"},
+		{Role: MessageRoleAssistant, ToolCalls: turn.Calls},
+		{Role: MessageRoleTool, Content: "[doc-1] Plan\nLaunch is in May.", ToolCallID: "call_1", ToolName: "search_documents"},
+	}, []ToolDefinition{testSearchTool}, domain.GenerationParams{})
+	if err != nil {
+		t.Fatalf("GenerateWithTools returned error: %v", err)
+	}
+	messages := payloads[1]["messages"].([]any)
+	assistant := messages[1].(map[string]any)
+	calls, _ := assistant["tool_calls"].([]any)
+	if len(calls) != 1 || calls[0].(map[string]any)["function"].(map[string]any)["arguments"] != `{"query":"launch"}` {
+		t.Fatalf("expected assistant tool calls to be replayed, got %v", assistant)
+	}
+	if tool := messages[2].(map[string]any); tool["role"] != "tool" || tool["tool_call_id"] != "call_1" {
+		t.Fatalf("expected tool result message, got %v", tool)
+	}
+}
+
+func TestGeminiRequestMapsToolTurns(t *testing.T) {
+	contents, _ := geminiRequest([]Message{
+		{Role: MessageRoleUser, Content: "Compare the docs"},
+		{Role: MessageRoleAssistant, ToolCalls: []ToolCall{
+			{ID: "a", Name: "import_document", Arguments: json.RawMessage(`{"documentId":"doc-1"}`), thoughtSignature: []byte("sig")},
+			{ID: "b", Name: "import_document", Arguments: json.RawMessage(`{"documentId":"doc-2"}`)},
+		}},
+		{Role: MessageRoleTool, Content: "first", ToolCallID: "a", ToolName: "import_document"},
+		{Role: MessageRoleTool, Content: "second", ToolCallID: "b", ToolName: "import_document"},
+	}, domain.GenerationParams{})
+
+	if len(contents) != 3 {
+		t.Fatalf("expected user, model and merged tool contents, got %d", len(contents))
+	}
+	model := contents[1]
+	if model.Role != genai.RoleModel || len(model.Parts) != 2 || model.Parts[0].FunctionCall.Args["documentId"] != "doc-1" || string(model.Parts[0].ThoughtSignature) != "sig" {
+		t.Fatalf("unexpected model content %+v", model.Parts)
+	}
+	results := contents[2]
+	if results.Role != genai.RoleUser || len(results.Parts) != 2 || results.Parts[1].FunctionResponse.ID != "b" || results.Parts[1].FunctionResponse.Response["output"] != "second" {
+		t.Fatalf("unexpected tool result content %+v", results.Parts)
+	}
+}
+
+// toolScriptProvider calls search_documents once, then answers. inCall runs
+// during each turn so tests can inspect the decorators around it.
+type toolScriptProvider struct {
+	MockProvider
+	turns  int
+	inCall func()
+}
+
+func (p *toolScriptProvider) Name() string {
+	return "tool-script"
+}
+
+func (p *toolScriptProvider) GenerateWithTools(_ context.Context, messages []Message, _ []ToolDefinition, _ domain.GenerationParams) (ToolTurn, error) {
+	p.turns++
+	if p.inCall != nil {
+		p.inCall()
+	}
+	if messages[len(messages)-1].Role != MessageRoleTool {
+		return ToolTurn{Calls: []ToolCall{{ID: "call-1", Name: "search_documents", Arguments: json.RawMessage(`{"query":"launch"}`)}}}, nil
+	}
+	return ToolTurn{Text: "Launch is in Q1."}, nil
+}
+
+// runToolLoop drives caller the way the agents tool loop does.
+func runToolLoop(t *testing.T, caller ToolCaller) string {
+	t.Helper()
+	messages := []Message{{Role: MessageRoleUser, Content: "When is the launch?"}}
+	for turn := 0; turn < 5; turn++ {
+		reply, err := caller.GenerateWithTools(context.Background(), messages, []ToolDefinition{testSearchTool}, domain.GenerationParams{})
+		if err != nil {
+			t.Fatalf("GenerateWithTools returned error: %v", err)
+		}
+		if len(reply.Calls) == 0 {
+			return reply.Text
+		}
+		messages = append(messages, Message{Role: MessageRoleAssistant, Content: reply.Text, ToolCalls: reply.Calls})
+		for _, call := range reply.Calls {
+			messages = append(messages, Message{Role: MessageRoleTool, Content: "Q1 launch", ToolCallID: call.ID, ToolName: call.Name})
+		}
+	}
+	t.Fatalf("tool loop did not finish")
+	return ""
+}
+
+func TestToolCallerForKeepsDecorators(t *testing.T) {
+	openAI := &OpenAIProvider{name: "openai"}
+	chaos := newChaosProvider(openAI, ChaosConfig{}, newFakeClock())
+	caller, err := ToolCallerFor(chaos)
+	if err != nil || caller != chaos {
+		t.Fatalf("expected the chaos decorator itself, got %v err=%v", caller, err)
+	}
+	if _, err := ToolCallerFor(NewMockProvider()); !errors.Is(err, ErrToolsUnsupported) {
+		t.Fatalf("expected ErrToolsUnsupported for mock, got %v", err)
+	}
+	limitedMock := newLimitedProvider(NewMockProvider(), limiterConfig{maxInFlight: 1}, realProviderClock{})
+	if _, err := ToolCallerFor(newChaosProvider(limitedMock, ChaosConfig{}, newFakeClock())); !errors.Is(err, ErrToolsUnsupported) {
+		t.Fatalf("expected ErrToolsUnsupported through decorators, got %v", err)
+	}
+}
+
+func TestToolLoopThroughLimitedProviderAcquiresLimiter(t *testing.T) {
+	metrics.ResetForTests()
+
+	base := &toolScriptProvider{}
+	limited := newLimitedProvider(base, limiterConfig{maxInFlight: 1, requestsPerMinute: 10}, newFakeClock())
+	base.inCall = func() {
+		if len(limited.limiter.slots) != 1 {
+			t.Errorf("expected the turn to hold an in-flight slot, got %d", len(limited.limiter.slots))
+		}
+	}
+
+	caller, err := ToolCallerFor(limited)
+	if err != nil {
+		t.Fatalf("ToolCallerFor returned error: %v", err)
+	}
+	if answer := runToolLoop(t, caller); answer != "Launch is in Q1." {
+		t.Fatalf("unexpected answer %q", answer)
+	}
+	if base.turns != 2 || len(limited.limiter.slots) != 0 {
+		t.Fatalf("expected 2 turns with slots released, got turns=%d slots=%d", base.turns, len(limited.limiter.slots))
+	}
+	want := `homer_provider_queue_wait_seconds_count{outcome="admitted",provider="tool-script"} 2`
+	if output := metrics.PrometheusText(); !strings.Contains(output, want) {
+		t.Fatalf("expected %q in metrics output:\n%s", want, output)
+	}
+}
+
+func TestChaosProviderInjectsFaultsIntoToolTurns(t *testing.T) {
+	chaos, clock := newChaosProviderForTest(t, ChaosConfig{Schedule: []ChaosFault{ChaosFaultServerError, ChaosFaultTruncate}})
+	chaos.LLMProvider = &toolScriptProvider{}
+
+	turn, err := chaos.GenerateWithTools(context.Background(), []Message{{Role: MessageRoleTool, Content: "Q1"}}, nil, domain.GenerationParams{})
+	if err != nil {
+		t.Fatalf("GenerateWithTools returned error: %v", err)
+	}
+	if turn.Text != "Launch i" || len(clock.sleeps) != 1 {
+		t.Fatalf("expected a retried, truncated turn, got %q sleeps=%v", turn.Text, clock.sleeps)
+	}
+}
+
+func TestReplayProviderRecordsAndReplaysToolTurns(t *testing.T) {
+	dir := t.TempDir()
+	recorder, err := newRecordingProvider(dir, &toolScriptProvider{})
+	if err != nil {
+		t.Fatalf("newRecordingProvider returned error: %v", err)
+	}
+	recorderCaller, err := ToolCallerFor(recorder)
+	if err != nil {
+		t.Fatalf("ToolCallerFor(recorder) returned error: %v", err)
+	}
+	recorded := runToolLoop(t, recorderCaller)
+
+	replayer, err := newReplayProvider(dir)
+	if err != nil {
+		t.Fatalf("newReplayProvider returned error: %v", err)
+	}
+	replayerCaller, err := ToolCallerFor(replayer)
+	if err != nil {
+		t.Fatalf("ToolCallerFor(replayer) returned error: %v", err)
+	}
+	if replayed := runToolLoop(t, replayerCaller); replayed != recorded {
+		t.Fatalf("expected replayed answer %q, got %q", recorded, replayed)
+	}
+}
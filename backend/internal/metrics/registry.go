@@ -3,6 +3,7 @@ package metrics
 import (
 	"fmt"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -10,6 +11,10 @@ import (
 
 var defaultDurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
 
+// jobAgeBuckets cover asynchronous jobs, which may wait in the queue and run
+// for minutes.
+var jobAgeBuckets = []float64{0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600, 1800}
+
 type providerKey struct {
 	Provider      string
 	Operation     string
@@ -24,6 +29,48 @@ type connectorKey struct {
 	ErrorCode string
 }
 
+type chaosFaultKey struct {
+	Provider  string
+	Operation string
+	Fault     string
+}
+
+type hedgeKey struct {
+	Provider      string
+	Operation     string
+	HedgeProvider string
+	Outcome       string
+}
+
+type moderationKey struct {
+	Stage     string
+	Moderator string
+	Action    string
+}
+
+type toolCallKey struct {
+	Tool   string
+	Status string
+}
+
+type httpRequestKey struct {
+	Tenant string
+	Method string
+	Route  string
+	Status string
+}
+
+type quotaRejectionKey struct {
+	Tenant   string
+	Period   string
+	Resource string
+}
+
+type queueWaitKey struct {
+	Provider string
+	Outcome  string
+}
+
 type histogram struct {
 	buckets []float64
 	counts  []uint64
@@ -57,14 +104,59 @@ type registry struct {
 
 	connectorRequests map[connectorKey]uint64
 	connectorLatency  map[connectorKey]*histogram
+
+	providerQueueDepth map[string]int64
+	providerQueueWait  map[queueWaitKey]*histogram
+
+	chaosFaults map[chaosFaultKey]uint64
+
+	hedges map[hedgeKey]uint64
+
+	moderationDecisions map[moderationKey]uint64
+	toolCalls           map[toolCallKey]uint64
+
+	jobsQueued   int64
+	jobsRunning  int64
+	jobsRejected uint64
+	jobAge       map[string]*histogram
+
+	webhookDeliveries map[string]uint64
+
+	httpRequests map[httpRequestKey]uint64
+	authFailures map[string]uint64
+
+	jwksRefreshes map[string]uint64
+
+	quotaRejections map[quotaRejectionKey]uint64
+
+	rateLimited map[string]uint64
+
+	sharedStateErrors map[string]uint64
+
+	idempotentRequests map[string]uint64
 }
 
 func newRegistry() *registry {
 	return &registry{
-		providerRequests:  make(map[providerKey]uint64),
-		providerLatency:   make(map[providerKey]*histogram),
-		connectorRequests: make(map[connectorKey]uint64),
-		connectorLatency:  make(map[connectorKey]*histogram),
+		providerRequests:    make(map[providerKey]uint64),
+		providerLatency:     make(map[providerKey]*histogram),
+		connectorRequests:   make(map[connectorKey]uint64),
+		connectorLatency:    make(map[connectorKey]*histogram),
+		providerQueueDepth:  make(map[string]int64),
+		providerQueueWait:   make(map[queueWaitKey]*histogram),
+		chaosFaults:         make(map[chaosFaultKey]uint64),
+		hedges:              make(map[hedgeKey]uint64),
+		moderationDecisions: make(map[moderationKey]uint64),
+		toolCalls:           make(map[toolCallKey]uint64),
+		jobAge:              make(map[string]*histogram),
+		webhookDeliveries:   make(map[string]uint64),
+		httpRequests:        make(map[httpRequestKey]uint64),
+		authFailures:        make(map[string]uint64),
+		jwksRefreshes:       make(map[string]uint64),
+		quotaRejections:     make(map[quotaRejectionKey]uint64),
+		rateLimited:         make(map[string]uint64),
+		sharedStateErrors:   make(map[string]uint64),
+		idempotentRequests:  make(map[string]uint64),
 	}
 }
 
@@ -88,6 +180,110 @@ func RecordConnectorCall(connector string, operation string, status string, erro
 	}, duration)
 }
 
+// AddProviderQueueDepth adjusts the number of calls waiting for outbound
+// capacity on a provider.
+func AddProviderQueueDepth(provider string, delta int) {
+	globalRegistry.addProviderQueueDepth(provider, delta)
+}
+
+// ObserveProviderQueueWait records how long a call waited for outbound
+// capacity and whether it was admitted or rejected.
+func ObserveProviderQueueWait(provider string, outcome string, wait time.Duration) {
+	globalRegistry.observeProviderQueueWait(queueWaitKey{Provider: provider, Outcome: outcome}, wait)
+}
+
+// RecordChaosFault counts a fault injected by the chaos provider wrapper.
+func RecordChaosFault(provider string, operation string, fault string) {
+	globalRegistry.recordChaosFault(chaosFaultKey{Provider: provider, Operation: operation, Fault: fault})
+}
+
+// RecordHedge counts a hedged provider call. Outcome is primary_won,
+// hedge_won or failed.
+func RecordHedge(provider string, operation string, hedgeProvider string, outcome string) {
+	globalRegistry.recordHedge(hedgeKey{Provider: provider, Operation: operation, HedgeProvider: hedgeProvider, Outcome: outcome})
+}
+
+// RecordModerationDecision counts content flagged by a moderator and the
+// action applied to it.
+func RecordModerationDecision(stage string, moderator string, action string) {
+	globalRegistry.recordModerationDecision(moderationKey{Stage: stage, Moderator: moderator, Action: action})
+}
+
+// RecordToolCall counts agent tool invocations by tool and status (success
+// or error).
+func RecordToolCall(tool string, status string) {
+	globalRegistry.recordToolCall(toolCallKey{Tool: tool, Status: status})
+}
+
+// SetJobGauges reports how many asynchronous jobs are queued and running.
+func SetJobGauges(queued int, running int) {
+	globalRegistry.setJobGauges(queued, running)
+}
+
+// RecordJobOutcome records a finished job's outcome (succeeded, failed or
+// canceled) and its age from submission to completion.
+func RecordJobOutcome(outcome string, age time.Duration) {
+	globalRegistry.recordJobOutcome(outcome, age)
+}
+
+// RecordJobRejected counts a job refused because the queue was full.
+func RecordJobRejected() {
+	globalRegistry.recordJobRejected()
+}
+
+// RecordWebhookDelivery counts a finished callback delivery by outcome
+// (delivered or dead_lettered).
+func RecordWebhookDelivery(outcome string) {
+	globalRegistry.recordWebhookDelivery(outcome)
+}
+
+// RecordHTTPRequest counts a served request under the tenant that made it.
+func RecordHTTPRequest(tenant string, method string, route string, status int) {
+	globalRegistry.recordHTTPRequest(httpRequestKey{Tenant: tenant, Method: method, Route: route, Status: strconv.Itoa(status)})
+}
+
+// RecordAuthFailure counts a rejected request by reason (missing_key,
+// invalid_key, invalid_token or insufficient_scope).
+func RecordAuthFailure(reason string) {
+	globalRegistry.recordAuthFailure(reason)
+}
+
+// RecordQuotaRejection counts a request refused because the tenant's period
+// quota for resource is used up.
+func RecordQuotaRejection(tenant string, period string, resource string) {
+	globalRegistry.recordQuotaRejection(quotaRejectionKey{Tenant: tenant, Period: period, Resource: resource})
+}
+
+// RecordRateLimited counts a request refused by the route group's rate
+// limiter (task or connector).
+func RecordRateLimited(group string) {
+	globalRegistry.recordRateLimited(group)
+}
+
+// RecordSharedStateError counts a failed shared state operation (get, set,
+// delete, take or update).
+func RecordSharedStateError(operation string) {
+	globalRegistry.recordSharedStateError(operation)
+}
+
+// RecordIdempotentRequest counts a request carrying an Idempotency-Key by
+// outcome (stored, not_stored, replayed or conflict).
+func RecordIdempotentRequest(outcome string) {
+	globalRegistry.recordIdempotentRequest(outcome)
+}
+
+// RecordJWKSRefresh counts a JWKS fetch by outcome (success or error).
+func RecordJWKSRefresh(outcome string) {
+	globalRegistry.recordJWKSRefresh(outcome)
+}
+
+// ProviderLatencyQuantile estimates a latency quantile for successful calls
+// from the provider duration histograms, interpolating within the matching
+// bucket. It also returns the number of samples the estimate is based on.
+func ProviderLatencyQuantile(provider string, operation string, quantile float64) (time.Duration, uint64) {
+	return globalRegistry.providerLatencyQuantile(provider, operation, quantile)
+}
+
 func PrometheusText() string {
 	return globalRegistry.renderPrometheus()
 }
@@ -122,6 +318,171 @@ func (r *registry) recordConnectorCall(key connectorKey, duration time.Duration)
 	h.Observe(duration.Seconds())
 }
 
+func (r *registry) addProviderQueueDepth(provider string, delta int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.providerQueueDepth[provider] += int64(delta)
+}
+
+func (r *registry) observeProviderQueueWait(key queueWaitKey, wait time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	h, ok := r.providerQueueWait[key]
+	if !ok {
+		h = newHistogram(defaultDurationBuckets)
+		r.providerQueueWait[key] = h
+	}
+	h.Observe(wait.Seconds())
+}
+
+func (r *registry) recordChaosFault(key chaosFaultKey) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.chaosFaults[key]++
+}
+
+func (r *registry) recordHedge(key hedgeKey) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.hedges[key]++
+}
+
+func (r *registry) recordModerationDecision(key moderationKey) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.moderationDecisions[key]++
+}
+
+func (r *registry) recordToolCall(key toolCallKey) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.toolCalls[key]++
+}
+
+func (r *registry) setJobGauges(queued int, running int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.jobsQueued = int64(queued)
+	r.jobsRunning = int64(running)
+}
+
+func (r *registry) recordJobOutcome(outcome string, age time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	h, ok := r.jobAge[outcome]
+	if !ok {
+		h = newHistogram(jobAgeBuckets)
+		r.jobAge[outcome] = h
+	}
+	h.Observe(age.Seconds())
+}
+
+func (r *registry) recordJobRejected() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.jobsRejected++
+}
+
+func (r *registry) recordWebhookDelivery(outcome string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.webhookDeliveries[outcome]++
+}
+
+func (r *registry) recordHTTPRequest(key httpRequestKey) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.httpRequests[key]++
+}
+
+func (r *registry) recordAuthFailure(reason string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.authFailures[reason]++
+}
+
+func (r *registry) recordQuotaRejection(key quotaRejectionKey) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.quotaRejections[key]++
+}
+
+func (r *registry) recordRateLimited(group string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.rateLimited[group]++
+}
+
+func (r *registry) recordSharedStateError(operation string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.sharedStateErrors[operation]++
+}
+
+func (r *registry) recordIdempotentRequest(outcome string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.idempotentRequests[outcome]++
+}
+
+func (r *registry) recordJWKSRefresh(outcome string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.jwksRefreshes[outcome]++
+}
+
+func (r *registry) providerLatencyQuantile(provider string, operation string, quantile float64) (time.Duration, uint64) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	merged := newHistogram(defaultDurationBuckets)
+	for key, h := range r.providerLatency {
+		if key.Provider != provider || key.Operation != operation || key.Status != "success" {
+			continue
+		}
+		merged.count += h.count
+		merged.sum += h.sum
+		for i := range merged.counts {
+			merged.counts[i] += h.counts[i]
+		}
+	}
+	if merged.count == 0 {
+		return 0, 0
+	}
+
+	rank := quantile * float64(merged.count)
+	lower, below := 0.0, uint64(0)
+	for i, upper := range merged.buckets {
+		if float64(merged.counts[i]) >= rank {
+			inBucket := merged.counts[i] - below
+			seconds := upper
+			if inBucket > 0 {
+				seconds = lower + (upper-lower)*(rank-float64(below))/float64(inBucket)
+			}
+			return time.Duration(seconds * float64(time.Second)), merged.count
+		}
+		lower, below = upper, merged.counts[i]
+	}
+	return time.Duration(lower * float64(time.Second)), merged.count
+}
+
 func (r *registry) renderPrometheus() string {
 	r.mu.Lock()
 	defer r.mu.Unlock()
@@ -206,6 +567,224 @@ func (r *registry) renderPrometheus() string {
 		)
 	}
 
+	builder.WriteString("# HELP homer_provider_queue_depth Calls waiting for outbound provider capacity.\n")
+	builder.WriteString("# TYPE homer_provider_queue_depth gauge\n")
+	queueProviders := make([]string, 0, len(r.providerQueueDepth))
+	for provider := range r.providerQueueDepth {
+		queueProviders = append(queueProviders, provider)
+	}
+	sort.Strings(queueProviders)
+	for _, provider := range queueProviders {
+		builder.WriteString(fmt.Sprintf(
+			"homer_provider_queue_depth{provider=%q} %d\n",
+			provider, r.providerQueueDepth[provider],
+		))
+	}
+
+	builder.WriteString("# HELP homer_provider_queue_wait_seconds Time spent waiting for outbound provider capacity.\n")
+	builder.WriteString("# TYPE homer_provider_queue_wait_seconds histogram\n")
+	queueWaitKeys := make([]queueWaitKey, 0, len(r.providerQueueWait))
+	for key := range r.providerQueueWait {
+		queueWaitKeys = append(queueWaitKeys, key)
+	}
+	sort.Slice(queueWaitKeys, func(i, j int) bool {
+		return queueWaitKeys[i].String() < queueWaitKeys[j].String()
+	})
+	for _, key := range queueWaitKeys {
+		writeHistogram(
+			&builder,
+			"homer_provider_queue_wait_seconds",
+			map[string]string{
+				"provider": key.Provider,
+				"outcome":  key.Outcome,
+			},
+			r.providerQueueWait[key],
+		)
+	}
+
+	builder.WriteString("# HELP homer_chaos_faults_total Faults injected by the chaos provider wrapper.\n")
+	builder.WriteString("# TYPE homer_chaos_faults_total counter\n")
+	chaosKeys := make([]chaosFaultKey, 0, len(r.chaosFaults))
+	for key := range r.chaosFaults {
+		chaosKeys = append(chaosKeys, key)
+	}
+	sort.Slice(chaosKeys, func(i, j int) bool {
+		return chaosKeys[i].String() < chaosKeys[j].String()
+	})
+	for _, key := range chaosKeys {
+		builder.WriteString(fmt.Sprintf(
+			"homer_chaos_faults_total{provider=%q,operation=%q,fault=%q} %d\n",
+			key.Provider, key.Operation, key.Fault, r.chaosFaults[key],
+		))
+	}
+
+	builder.WriteString("# HELP homer_provider_hedges_total Hedged provider calls by which request won.\n")
+	builder.WriteString("# TYPE homer_provider_hedges_total counter\n")
+	hedgeKeys := make([]hedgeKey, 0, len(r.hedges))
+	for key := range r.hedges {
+		hedgeKeys = append(hedgeKeys, key)
+	}
+	sort.Slice(hedgeKeys, func(i, j int) bool {
+		return hedgeKeys[i].String() < hedgeKeys[j].String()
+	})
+	for _, key := range hedgeKeys {
+		builder.WriteString(fmt.Sprintf(
+			"homer_provider_hedges_total{provider=%q,operation=%q,hedge_provider=%q,outcome=%q} %d\n",
+			key.Provider, key.Operation, key.HedgeProvider, key.Outcome, r.hedges[key],
+		))
+	}
+
+	builder.WriteString("# HELP homer_moderation_decisions_total Content flagged by moderation.\n")
+	builder.WriteString("# TYPE homer_moderation_decisions_total counter\n")
+	moderationKeys := make([]moderationKey, 0, len(r.moderationDecisions))
+	for key := range r.moderationDecisions {
+		moderationKeys = append(moderationKeys, key)
+	}
+	sort.Slice(moderationKeys, func(i, j int) bool {
+		return moderationKeys[i].String() < moderationKeys[j].String()
+	})
+	for _, key := range moderationKeys {
+		builder.WriteString(fmt.Sprintf(
+			"homer_moderation_decisions_total{stage=%q,moderator=%q,action=%q} %d\n",
+			key.Stage, key.Moderator, key.Action, r.moderationDecisions[key],
+		))
+	}
+
+	builder.WriteString("# HELP homer_agent_tool_calls_total Tool calls made by the agent loop.\n")
+	builder.WriteString("# TYPE homer_agent_tool_calls_total counter\n")
+	toolCallKeys := make([]toolCallKey, 0, len(r.toolCalls))
+	for key := range r.toolCalls {
+		toolCallKeys = append(toolCallKeys, key)
+	}
+	sort.Slice(toolCallKeys, func(i, j int) bool {
+		return toolCallKeys[i].String() < toolCallKeys[j].String()
+	})
+	for _, key := range toolCallKeys {
+		builder.WriteString(fmt.Sprintf(
+			"homer_agent_tool_calls_total{tool=%q,status=%q} %d\n",
+			key.Tool, key.Status, r.toolCalls[key],
+		))
+	}
+
+	builder.WriteString("# HELP homer_jobs_queue_depth Asynchronous jobs waiting for a worker.\n")
+	builder.WriteString("# TYPE homer_jobs_queue_depth gauge\n")
+	builder.WriteString(fmt.Sprintf("homer_jobs_queue_depth %d\n", r.jobsQueued))
+	builder.WriteString("# HELP homer_jobs_running Asynchronous jobs being executed.\n")
+	builder.WriteString("# TYPE homer_jobs_running gauge\n")
+	builder.WriteString(fmt.Sprintf("homer_jobs_running %d\n", r.jobsRunning))
+	builder.WriteString("# HELP homer_jobs_rejected_total Asynchronous jobs refused because the queue was full.\n")
+	builder.WriteString("# TYPE homer_jobs_rejected_total counter\n")
+	builder.WriteString(fmt.Sprintf("homer_jobs_rejected_total %d\n", r.jobsRejected))
+
+	builder.WriteString("# HELP homer_job_age_seconds Time from job submission to completion, by outcome.\n")
+	builder.WriteString("# TYPE homer_job_age_seconds histogram\n")
+	jobOutcomes := make([]string, 0, len(r.jobAge))
+	for outcome := range r.jobAge {
+		jobOutcomes = append(jobOutcomes, outcome)
+	}
+	sort.Strings(jobOutcomes)
+	for _, outcome := range jobOutcomes {
+		writeHistogram(&builder, "homer_job_age_seconds", map[string]string{"outcome": outcome}, r.jobAge[outcome])
+	}
+
+	builder.WriteString("# HELP homer_webhook_deliveries_total Task callbacks delivered or given up on.\n")
+	builder.WriteString("# TYPE homer_webhook_deliveries_total counter\n")
+	webhookOutcomes := make([]string, 0, len(r.webhookDeliveries))
+	for outcome := range r.webhookDeliveries {
+		webhookOutcomes = append(webhookOutcomes, outcome)
+	}
+	sort.Strings(webhookOutcomes)
+	for _, outcome := range webhookOutcomes {
+		builder.WriteString(fmt.Sprintf("homer_webhook_deliveries_total{outcome=%q} %d\n", outcome, r.webhookDeliveries[outcome]))
+	}
+
+	builder.WriteString("# HELP homer_http_requests_total HTTP requests served, by tenant.\n")
+	builder.WriteString("# TYPE homer_http_requests_total counter\n")
+	httpKeys := make([]httpRequestKey, 0, len(r.httpRequests))
+	for key := range r.httpRequests {
+		httpKeys = append(httpKeys, key)
+	}
+	sort.Slice(httpKeys, func(i, j int) bool {
+		return httpKeys[i].String() < httpKeys[j].String()
+	})
+	for _, key := range httpKeys {
+		builder.WriteString(fmt.Sprintf(
+			"homer_http_requests_total{tenant=%q,method=%q,route=%q,status=%q} %d\n",
+			key.Tenant, key.Method, key.Route, key.Status, r.httpRequests[key],
+		))
+	}
+
+	builder.WriteString("# HELP homer_auth_failures_total Requests rejected by API key or bearer token authentication.\n")
+	builder.WriteString("# TYPE homer_auth_failures_total counter\n")
+	authReasons := make([]string, 0, len(r.authFailures))
+	for reason := range r.authFailures {
+		authReasons = append(authReasons, reason)
+	}
+	sort.Strings(authReasons)
+	for _, reason := range authReasons {
+		builder.WriteString(fmt.Sprintf("homer_auth_failures_total{reason=%q} %d\n", reason, r.authFailures[reason]))
+	}
+
+	builder.WriteString("# HELP homer_jwks_refreshes_total Fetches of the OIDC signing keys.\n")
+	builder.WriteString("# TYPE homer_jwks_refreshes_total counter\n")
+	refreshOutcomes := make([]string, 0, len(r.jwksRefreshes))
+	for outcome := range r.jwksRefreshes {
+		refreshOutcomes = append(refreshOutcomes, outcome)
+	}
+	sort.Strings(refreshOutcomes)
+	for _, outcome := range refreshOutcomes {
+		builder.WriteString(fmt.Sprintf("homer_jwks_refreshes_total{outcome=%q} %d\n", outcome, r.jwksRefreshes[outcome]))
+	}
+
+	builder.WriteString("# HELP homer_quota_rejections_total Requests refused because a tenant quota is used up.\n")
+	builder.WriteString("# TYPE homer_quota_rejections_total counter\n")
+	quotaKeys := make([]quotaRejectionKey, 0, len(r.quotaRejections))
+	for key := range r.quotaRejections {
+		quotaKeys = append(quotaKeys, key)
+	}
+	sort.Slice(quotaKeys, func(i, j int) bool {
+		return quotaKeys[i].String() < quotaKeys[j].String()
+	})
+	for _, key := range quotaKeys {
+		builder.WriteString(fmt.Sprintf(
+			"homer_quota_rejections_total{tenant=%q,period=%q,resource=%q} %d\n",
+			key.Tenant, key.Period, key.Resource, r.quotaRejections[key],
+		))
+	}
+
+	builder.WriteString("# HELP homer_rate_limited_total Requests refused by a route group's rate limiter.\n")
+	builder.WriteString("# TYPE homer_rate_limited_total counter\n")
+	limitedGroups := make([]string, 0, len(r.rateLimited))
+	for group := range r.rateLimited {
+		limitedGroups = append(limitedGroups, group)
+	}
+	sort.Strings(limitedGroups)
+	for _, group := range limitedGroups {
+		builder.WriteString(fmt.Sprintf("homer_rate_limited_total{group=%q} %d\n", group, r.rateLimited[group]))
+	}
+
+	builder.WriteString("# HELP homer_shared_state_errors_total Failed operations against the shared state store.\n")
+	builder.WriteString("# TYPE homer_shared_state_errors_total counter\n")
+	failedOperations := make([]string, 0, len(r.sharedStateErrors))
+	for operation := range r.sharedStateErrors {
+		failedOperations = append(failedOperations, operation)
+	}
+	sort.Strings(failedOperations)
+	for _, operation := range failedOperations {
+		builder.WriteString(fmt.Sprintf("homer_shared_state_errors_total{operation=%q} %d\n", operation, r.sharedStateErrors[operation]))
+	}
+
+	builder.WriteString("# HELP homer_idempotent_requests_total Requests carrying an Idempotency-Key.\n")
+	builder.WriteString("# TYPE homer_idempotent_requests_total counter\n")
+	idempotencyOutcomes := make([]string, 0, len(r.idempotentRequests))
+	for outcome := range r.idempotentRequests {
+		idempotencyOutcomes = append(idempotencyOutcomes, outcome)
+	}
+	sort.Strings(idempotencyOutcomes)
+	for _, outcome := range idempotencyOutcomes {
+		builder.WriteString(fmt.Sprintf("homer_idempotent_requests_total{outcome=%q} %d\n", outcome, r.idempotentRequests[outcome]))
+	}
+
 	return builder.String()
 }
 
@@ -256,3 +835,31 @@ func (k providerKey) String() string {
 func (k connectorKey) String() string {
 	return strings.Join([]string{k.Connector, k.Operation, k.Status, k.ErrorCode}, "|")
 }
+
+func (k queueWaitKey) String() string {
+	return strings.Join([]string{k.Provider, k.Outcome}, "|")
+}
+
+func (k chaosFaultKey) String() string {
+	return strings.Join([]string{k.Provider, k.Operation, k.Fault}, "|")
+}
+
+func (k hedgeKey) String() string {
+	return strings.Join([]string{k.Provider, k.Operation, k.HedgeProvider, k.Outcome}, "|")
+}
+
+func (k moderationKey) String() string {
+	return strings.Join([]string{k.Stage, k.Moderator, k.Action}, "|")
+}
+
+func (k httpRequestKey) String() string {
+	return strings.Join([]string{k.Tenant, k.Method, k.Route, k.Status}, "|")
+}
+
+func (k quotaRejectionKey) String() string {
+	return strings.Join([]string{k.Tenant, k.Period, k.Resource}, "|")
+}
+
+func (k toolCallKey) String() string {
+	return strings.Join([]string{k.Tool, k.Status}, "|")
+}
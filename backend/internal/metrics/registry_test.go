@@ -13,6 +13,21 @@ func TestPrometheusTextContainsProviderAndConnectorSeries(t *testing.T) {
 	RecordProviderCall("mock", "summarize", "error", "timeout", 10*time.Millisecond)
 	RecordConnectorCall("google_docs", "import", "error", "connector_forbidden", 5*time.Millisecond)
 	RecordConnectorCall("google_docs", "export", "success", "none", 20*time.Millisecond)
+	AddProviderQueueDepth("openai", 2)
+	AddProviderQueueDepth("openai", -1)
+	ObserveProviderQueueWait("openai", "admitted", 40*time.Millisecond)
+	RecordHedge("openai", "summarize", "gemini", "hedge_won")
+	SetJobGauges(3, 2)
+	RecordJobRejected()
+	RecordJobOutcome("succeeded", 4*time.Second)
+	RecordWebhookDelivery("dead_lettered")
+	RecordHTTPRequest("acme", "POST", "/api/task", 200)
+	RecordAuthFailure("invalid_key")
+	RecordJWKSRefresh("success")
+	RecordQuotaRejection("acme", "day", "tokens")
+	RecordRateLimited("task")
+	RecordSharedStateError("update")
+	RecordIdempotentRequest("replayed")
 
 	output := PrometheusText()
 
@@ -25,6 +40,21 @@ func TestPrometheusTextContainsProviderAndConnectorSeries(t *testing.T) {
 		"homer_connector_requests_total{connector=\"google_docs\",operation=\"import\",status=\"error\",error_code=\"connector_forbidden\"} 1",
 		"homer_connector_requests_total{connector=\"google_docs\",operation=\"export\",status=\"success\",error_code=\"none\"} 1",
 		"# HELP homer_connector_request_duration_seconds",
+		"homer_provider_queue_depth{provider=\"openai\"} 1",
+		"homer_provider_queue_wait_seconds_count{outcome=\"admitted\",provider=\"openai\"} 1",
+		"homer_provider_hedges_total{provider=\"openai\",operation=\"summarize\",hedge_provider=\"gemini\",outcome=\"hedge_won\"} 1",
+		"homer_jobs_queue_depth 3",
+		"homer_jobs_running 2",
+		"homer_jobs_rejected_total 1",
+		"homer_job_age_seconds_bucket{outcome=\"succeeded\",le=\"5\"} 1",
+		"homer_webhook_deliveries_total{outcome=\"dead_lettered\"} 1",
+		"homer_http_requests_total{tenant=\"acme\",method=\"POST\",route=\"/api/task\",status=\"200\"} 1",
+		"homer_auth_failures_total{reason=\"invalid_key\"} 1",
+		"homer_jwks_refreshes_total{outcome=\"success\"} 1",
+		"homer_quota_rejections_total{tenant=\"acme\",period=\"day\",resource=\"tokens\"} 1",
+		"homer_rate_limited_total{group=\"task\"} 1",
+		"homer_shared_state_errors_total{operation=\"update\"} 1",
+		"homer_idempotent_requests_total{outcome=\"replayed\"} 1",
 	}
 
 	for _, substring := range expectedSubstrings {
@@ -33,3 +63,31 @@ func TestPrometheusTextContainsProviderAndConnectorSeries(t *testing.T) {
 		}
 	}
 }
+
+func TestProviderLatencyQuantileInterpolatesSuccessfulCalls(t *testing.T) {
+	ResetForTests()
+
+	if _, samples := ProviderLatencyQuantile("openai", "summarize", 0.9); samples != 0 {
+		t.Fatalf("expected no samples, got %d", samples)
+	}
+
+	for i := 0; i < 9; i++ {
+		RecordProviderCall("openai", "summarize", "success", "none", 20*time.Millisecond)
+	}
+	RecordProviderCall("openai", "summarize", "success", "none", 2*time.Second)
+	RecordProviderCall("openai", "summarize", "error", "timeout", 15*time.Second)
+	RecordProviderCall("openai", "rewrite", "success", "none", 5*time.Second)
+
+	p50, samples := ProviderLatencyQuantile("openai", "summarize", 0.5)
+	if samples != 10 {
+		t.Fatalf("expected only successful summarize calls to count, got %d", samples)
+	}
+	if p50 < 10*time.Millisecond || p50 > 25*time.Millisecond {
+		t.Fatalf("expected p50 within the 10-25ms bucket, got %s", p50)
+	}
+
+	p99, _ := ProviderLatencyQuantile("openai", "summarize", 0.99)
+	if p99 < time.Second || p99 > 2500*time.Millisecond {
+		t.Fatalf("expected p99 within the 1-2.5s bucket, got %s", p99)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"log"
 	"time"
 
+	"github.com/alanmaizon/homer/backend/internal/metrics"
 	"github.com/gin-gonic/gin"
 )
 
@@ -13,8 +14,9 @@ func Logging() gin.HandlerFunc {
 		c.Next()
 
 		log.Printf(
-			"request_id=%s method=%s path=%s status=%d duration_ms=%d",
+			"request_id=%s tenant=%s method=%s path=%s status=%d duration_ms=%d",
 			GetRequestID(c),
+			GetTenant(c),
 			c.Request.Method,
 			c.FullPath(),
 			c.Writer.Status(),
@@ -22,3 +24,16 @@ func Logging() gin.HandlerFunc {
 		)
 	}
 }
+
+// Metrics counts requests by tenant, method, route and status.
+func Metrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		metrics.RecordHTTPRequest(GetTenant(c), c.Request.Method, route, c.Writer.Status())
+	}
+}
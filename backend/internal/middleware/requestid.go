@@ -18,12 +18,18 @@ func RequestID() gin.HandlerFunc {
 			requestID = uuid.NewString()
 		}
 		c.Set(requestIDKey, requestID)
-		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), requestIDContextToken{}, requestID))
+		c.Request = c.Request.WithContext(WithRequestID(c.Request.Context(), requestID))
 		c.Writer.Header().Set("X-Request-Id", requestID)
 		c.Next()
 	}
 }
 
+// WithRequestID attaches requestID to ctx, for work that outlives the HTTP
+// request but should be logged under it.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDContextToken{}, requestID)
+}
+
 func GetRequestID(c *gin.Context) string {
 	if value, ok := c.Get(requestIDKey); ok {
 		if requestID, ok := value.(string); ok {
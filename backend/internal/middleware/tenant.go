@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	tenantKey = "tenant"
+
+	// AnonymousTenant labels requests that were not authenticated.
+	AnonymousTenant = "anonymous"
+)
+
+type tenantContextToken struct{}
+
+// SetTenant records the authenticated tenant on the request and its context.
+func SetTenant(c *gin.Context, tenant string) {
+	c.Set(tenantKey, tenant)
+	c.Request = c.Request.WithContext(WithTenant(c.Request.Context(), tenant))
+}
+
+// WithTenant attaches tenant to ctx, for work that outlives the HTTP request.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantContextToken{}, tenant)
+}
+
+// GetTenant returns the request's tenant, or AnonymousTenant.
+func GetTenant(c *gin.Context) string {
+	if value, ok := c.Get(tenantKey); ok {
+		if tenant, ok := value.(string); ok && tenant != "" {
+			return tenant
+		}
+	}
+	return AnonymousTenant
+}
+
+// GetTenantFromContext returns the tenant attached to ctx, or
+// AnonymousTenant.
+func GetTenantFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return AnonymousTenant
+	}
+	if tenant, ok := ctx.Value(tenantContextToken{}).(string); ok && tenant != "" {
+		return tenant
+	}
+	return AnonymousTenant
+}
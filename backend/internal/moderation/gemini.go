@@ -0,0 +1,64 @@
+package moderation
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/alanmaizon/homer/backend/internal/llm"
+)
+
+const geminiModeratorName = "gemini"
+
+var geminiProbabilityRank = map[string]int{
+	"NEGLIGIBLE": 1,
+	"LOW":        2,
+	"MEDIUM":     3,
+	"HIGH":       4,
+}
+
+// GeminiSafetyModerator flags content from the safety ratings Gemini returns
+// with GenerateContent. Ratings only exist once Gemini has answered, so both
+// prompt and candidate ratings are checked at the output stage; the input
+// stage and calls served by other providers are never flagged.
+type GeminiSafetyModerator struct {
+	threshold int
+}
+
+// NewGeminiSafetyModeratorFromEnv reads MODERATION_GEMINI_THRESHOLD, the
+// lowest harm probability that is flagged: LOW, MEDIUM (default) or HIGH.
+func NewGeminiSafetyModeratorFromEnv() (*GeminiSafetyModerator, error) {
+	raw := strings.ToUpper(strings.TrimSpace(os.Getenv("MODERATION_GEMINI_THRESHOLD")))
+	if raw == "" {
+		raw = "MEDIUM"
+	}
+	threshold, ok := geminiProbabilityRank[raw]
+	if !ok || raw == "NEGLIGIBLE" {
+		return nil, fmt.Errorf("MODERATION_GEMINI_THRESHOLD must be LOW, MEDIUM or HIGH, got %q", raw)
+	}
+	return &GeminiSafetyModerator{threshold: threshold}, nil
+}
+
+func (g *GeminiSafetyModerator) Name() string {
+	return geminiModeratorName
+}
+
+func (g *GeminiSafetyModerator) Moderate(ctx context.Context, stage Stage, _ []string) (Verdict, error) {
+	if stage != StageOutput {
+		return Verdict{}, nil
+	}
+
+	matched := make(map[string]bool)
+	for _, rating := range llm.SafetyRatingsFromContext(ctx) {
+		if rating.Blocked || geminiProbabilityRank[rating.Probability] >= g.threshold {
+			matched[geminiCategoryName(rating.Category)] = true
+		}
+	}
+	return verdictFromCategories(matched), nil
+}
+
+// geminiCategoryName turns HARM_CATEGORY_HATE_SPEECH into hate_speech.
+func geminiCategoryName(category string) string {
+	return strings.ToLower(strings.TrimPrefix(category, "HARM_CATEGORY_"))
+}
@@ -0,0 +1,240 @@
+// Package moderation checks task inputs and outputs against pluggable
+// content policies before they reach a provider or leave the service.
+package moderation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/alanmaizon/homer/backend/internal/domain"
+	"github.com/alanmaizon/homer/backend/internal/metrics"
+	"github.com/alanmaizon/homer/backend/internal/middleware"
+)
+
+type Stage string
+
+const (
+	StageInput  Stage = "input"
+	StageOutput Stage = "output"
+)
+
+type Action string
+
+const (
+	ActionBlock Action = "block"
+	ActionWarn  Action = "warn"
+	ActionLog   Action = "log"
+)
+
+var (
+	// ErrContentBlocked is matched by errors returned when a moderator flags
+	// content at a stage whose action is block.
+	ErrContentBlocked = errors.New("content blocked by moderation")
+	// ErrModerationUnavailable is matched by errors returned when a blocking
+	// stage cannot be checked because a moderator failed.
+	ErrModerationUnavailable = errors.New("moderation unavailable")
+)
+
+// Verdict is one moderator's assessment of a batch of texts.
+type Verdict struct {
+	Flagged    bool
+	Categories []string
+}
+
+// Moderator assesses texts at a stage. Moderators that have nothing to say
+// about a stage return an unflagged verdict.
+type Moderator interface {
+	Name() string
+	Moderate(ctx context.Context, stage Stage, texts []string) (Verdict, error)
+}
+
+// BlockedError carries the decisions that blocked a request.
+type BlockedError struct {
+	Stage     Stage
+	Decisions []domain.ModerationDecision
+}
+
+func (e *BlockedError) Error() string {
+	categories := make([]string, 0)
+	for _, decision := range e.Decisions {
+		categories = append(categories, decision.Categories...)
+	}
+	return fmt.Sprintf("%s content flagged by moderation: %s", e.Stage, strings.Join(categories, ", "))
+}
+
+func (e *BlockedError) Unwrap() error {
+	return ErrContentBlocked
+}
+
+// Code is the API error code for the blocked stage.
+func (e *BlockedError) Code() string {
+	return "moderation_" + string(e.Stage) + "_blocked"
+}
+
+// Policy runs its moderators at each stage and applies that stage's action
+// to anything they flag.
+type Policy struct {
+	moderators []Moderator
+	actions    map[Stage]Action
+}
+
+func NewPolicy(moderators []Moderator, inputAction Action, outputAction Action) *Policy {
+	return &Policy{
+		moderators: moderators,
+		actions:    map[Stage]Action{StageInput: inputAction, StageOutput: outputAction},
+	}
+}
+
+// NewPolicyFromEnv reads MODERATION_PROVIDERS (comma separated regex, openai,
+// gemini), MODERATION_ACTION and the per-stage MODERATION_INPUT_ACTION and
+// MODERATION_OUTPUT_ACTION overrides. No providers means moderation is off.
+func NewPolicyFromEnv() (*Policy, error) {
+	defaultAction, err := parseAction(os.Getenv("MODERATION_ACTION"), ActionBlock)
+	if err != nil {
+		return nil, fmt.Errorf("MODERATION_ACTION: %w", err)
+	}
+	inputAction, err := parseAction(os.Getenv("MODERATION_INPUT_ACTION"), defaultAction)
+	if err != nil {
+		return nil, fmt.Errorf("MODERATION_INPUT_ACTION: %w", err)
+	}
+	outputAction, err := parseAction(os.Getenv("MODERATION_OUTPUT_ACTION"), defaultAction)
+	if err != nil {
+		return nil, fmt.Errorf("MODERATION_OUTPUT_ACTION: %w", err)
+	}
+
+	moderators := make([]Moderator, 0, 3)
+	for _, raw := range strings.Split(os.Getenv("MODERATION_PROVIDERS"), ",") {
+		var (
+			moderator Moderator
+			err       error
+		)
+		switch name := strings.ToLower(strings.TrimSpace(raw)); name {
+		case "":
+			continue
+		case regexModeratorName:
+			moderator, err = NewRegexModeratorFromEnv()
+		case openAIModeratorName:
+			moderator, err = NewOpenAIModeratorFromEnv()
+		case geminiModeratorName:
+			moderator, err = NewGeminiSafetyModeratorFromEnv()
+		default:
+			err = fmt.Errorf("unknown moderation provider %q", name)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("MODERATION_PROVIDERS: %w", err)
+		}
+		moderators = append(moderators, moderator)
+	}
+
+	return NewPolicy(moderators, inputAction, outputAction), nil
+}
+
+func parseAction(raw string, fallback Action) (Action, error) {
+	switch action := Action(strings.ToLower(strings.TrimSpace(raw))); action {
+	case "":
+		return fallback, nil
+	case ActionBlock, ActionWarn, ActionLog:
+		return action, nil
+	default:
+		return "", fmt.Errorf("unknown moderation action %q", raw)
+	}
+}
+
+// Enabled reports whether any moderator is configured.
+func (p *Policy) Enabled() bool {
+	return p != nil && len(p.moderators) > 0
+}
+
+// Check runs every moderator on texts. Flagged content is always logged and
+// counted. At a block stage it returns a BlockedError; otherwise it returns
+// the decisions, which callers surface as warnings when the action is warn.
+// A moderator failure fails the check only at a block stage.
+func (p *Policy) Check(ctx context.Context, stage Stage, texts []string) ([]domain.ModerationDecision, error) {
+	if !p.Enabled() {
+		return nil, nil
+	}
+
+	action := p.actions[stage]
+	requestID := middleware.GetRequestIDFromContext(ctx)
+	decisions := make([]domain.ModerationDecision, 0)
+	for _, moderator := range p.moderators {
+		verdict, err := moderator.Moderate(ctx, stage, texts)
+		if err != nil {
+			log.Printf(
+				"request_id=%s component=moderation stage=%s moderator=%s event=error error=%q",
+				requestID,
+				stage,
+				moderator.Name(),
+				err.Error(),
+			)
+			if action == ActionBlock {
+				return nil, fmt.Errorf("%w: %s: %v", ErrModerationUnavailable, moderator.Name(), err)
+			}
+			continue
+		}
+		if !verdict.Flagged {
+			continue
+		}
+
+		decision := domain.ModerationDecision{
+			Stage:      string(stage),
+			Moderator:  moderator.Name(),
+			Action:     string(action),
+			Code:       "moderation_" + string(stage) + "_flagged",
+			Categories: verdict.Categories,
+		}
+		metrics.RecordModerationDecision(decision.Stage, decision.Moderator, decision.Action)
+		log.Printf(
+			"request_id=%s component=moderation stage=%s moderator=%s action=%s code=%s categories=%s",
+			requestID,
+			stage,
+			moderator.Name(),
+			action,
+			decision.Code,
+			strings.Join(verdict.Categories, ","),
+		)
+		decisions = append(decisions, decision)
+	}
+
+	if len(decisions) > 0 && action == ActionBlock {
+		return nil, &BlockedError{Stage: stage, Decisions: decisions}
+	}
+	return decisions, nil
+}
+
+// Warnings returns the decisions that should be reported to the caller.
+func Warnings(decisions []domain.ModerationDecision) []domain.ModerationDecision {
+	warnings := make([]domain.ModerationDecision, 0, len(decisions))
+	for _, decision := range decisions {
+		if decision.Action == string(ActionWarn) {
+			warnings = append(warnings, decision)
+		}
+	}
+	return warnings
+}
+
+// currentPolicy moderates nothing until SetPolicy installs the configured
+// one.
+var (
+	policyMu      sync.RWMutex
+	currentPolicy = NewPolicy(nil, ActionBlock, ActionBlock)
+)
+
+func CurrentPolicy() *Policy {
+	policyMu.RLock()
+	defer policyMu.RUnlock()
+	return currentPolicy
+}
+
+func SetPolicy(policy *Policy) {
+	if policy != nil {
+		policyMu.Lock()
+		currentPolicy = policy
+		policyMu.Unlock()
+	}
+}
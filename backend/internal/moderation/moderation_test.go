@@ -0,0 +1,212 @@
+package moderation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/alanmaizon/homer/backend/internal/llm"
+)
+
+type failingModerator struct{}
+
+func (failingModerator) Name() string {
+	return "failing"
+}
+
+func (failingModerator) Moderate(context.Context, Stage, []string) (Verdict, error) {
+	return Verdict{}, errors.New("upstream down")
+}
+
+func TestRegexModeratorFromEnv(t *testing.T) {
+	rulesPath := filepath.Join(t.TempDir(), "rules.json")
+	if err := os.WriteFile(rulesPath, []byte(`[{"category":"pii_ssn","pattern":"\\b\\d{3}-\\d{2}-\\d{4}\\b"}]`), 0o644); err != nil {
+		t.Fatalf("failed to write rules: %v", err)
+	}
+	t.Setenv("MODERATION_BLOCKED_TERMS", "darn, heck it")
+	t.Setenv("MODERATION_RULES_FILE", rulesPath)
+
+	moderator, err := NewRegexModeratorFromEnv()
+	if err != nil {
+		t.Fatalf("NewRegexModeratorFromEnv returned error: %v", err)
+	}
+
+	testCases := []struct {
+		text       string
+		categories string
+	}{
+		{text: "All good here.", categories: ""},
+		{text: "Darn, the build broke.", categories: "blocked_term"},
+		{text: "Well HECK IT, ssn 123-45-6789", categories: "blocked_term,pii_ssn"},
+		{text: "Darnell joined the team.", categories: ""},
+	}
+	for _, tc := range testCases {
+		verdict, err := moderator.Moderate(context.Background(), StageInput, []string{tc.text})
+		if err != nil {
+			t.Fatalf("Moderate returned error: %v", err)
+		}
+		if got := strings.Join(verdict.Categories, ","); got != tc.categories || verdict.Flagged != (tc.categories != "") {
+			t.Fatalf("Moderate(%q) = %+v, want categories %q", tc.text, verdict, tc.categories)
+		}
+	}
+}
+
+func TestPolicyActions(t *testing.T) {
+	moderator, err := NewRegexModerator([]Rule{{Category: "profanity", Pattern: `\bdarn\b`}})
+	if err != nil {
+		t.Fatalf("NewRegexModerator returned error: %v", err)
+	}
+	ctx := context.Background()
+
+	blocking := NewPolicy([]Moderator{moderator}, ActionBlock, ActionWarn)
+	_, err = blocking.Check(ctx, StageInput, []string{"darn"})
+	var blocked *BlockedError
+	if !errors.As(err, &blocked) || !errors.Is(err, ErrContentBlocked) {
+		t.Fatalf("expected BlockedError, got %v", err)
+	}
+	if blocked.Code() != "moderation_input_blocked" || blocked.Decisions[0].Categories[0] != "profanity" {
+		t.Fatalf("unexpected blocked error %+v", blocked)
+	}
+
+	decisions, err := blocking.Check(ctx, StageOutput, []string{"darn"})
+	if err != nil {
+		t.Fatalf("expected warn stage to pass, got %v", err)
+	}
+	warnings := Warnings(decisions)
+	if len(warnings) != 1 || warnings[0].Code != "moderation_output_flagged" || warnings[0].Action != "warn" {
+		t.Fatalf("unexpected warnings %+v", warnings)
+	}
+
+	logging := NewPolicy([]Moderator{moderator}, ActionLog, ActionLog)
+	decisions, err = logging.Check(ctx, StageOutput, []string{"darn"})
+	if err != nil || len(decisions) != 1 || len(Warnings(decisions)) != 0 {
+		t.Fatalf("expected a logged decision without warnings, got %+v err=%v", decisions, err)
+	}
+}
+
+func TestPolicyModeratorFailure(t *testing.T) {
+	ctx := context.Background()
+
+	_, err := NewPolicy([]Moderator{failingModerator{}}, ActionBlock, ActionBlock).Check(ctx, StageInput, []string{"text"})
+	if !errors.Is(err, ErrModerationUnavailable) {
+		t.Fatalf("expected ErrModerationUnavailable at a block stage, got %v", err)
+	}
+
+	if _, err := NewPolicy([]Moderator{failingModerator{}}, ActionWarn, ActionWarn).Check(ctx, StageInput, []string{"text"}); err != nil {
+		t.Fatalf("expected a warn stage to tolerate moderator failures, got %v", err)
+	}
+}
+
+func TestNewPolicyFromEnvValidation(t *testing.T) {
+	t.Setenv("MODERATION_PROVIDERS", "")
+	t.Setenv("MODERATION_ACTION", "")
+	policy, err := NewPolicyFromEnv()
+	if err != nil || policy.Enabled() {
+		t.Fatalf("expected moderation to be off by default, got enabled=%v err=%v", policy.Enabled(), err)
+	}
+
+	t.Setenv("MODERATION_ACTION", "quarantine")
+	if _, err := NewPolicyFromEnv(); err == nil || !strings.Contains(err.Error(), "MODERATION_ACTION") {
+		t.Fatalf("expected MODERATION_ACTION error, got %v", err)
+	}
+
+	t.Setenv("MODERATION_ACTION", "warn")
+	t.Setenv("MODERATION_PROVIDERS", "regex")
+	t.Setenv("MODERATION_BLOCKED_TERMS", "")
+	t.Setenv("MODERATION_RULES_FILE", "")
+	if _, err := NewPolicyFromEnv(); err == nil || !strings.Contains(err.Error(), "MODERATION_BLOCKED_TERMS") {
+		t.Fatalf("expected regex configuration error, got %v", err)
+	}
+
+	t.Setenv("MODERATION_PROVIDERS", "regex,gemini")
+	t.Setenv("MODERATION_BLOCKED_TERMS", "darn")
+	t.Setenv("MODERATION_OUTPUT_ACTION", "block")
+	policy, err = NewPolicyFromEnv()
+	if err != nil {
+		t.Fatalf("NewPolicyFromEnv returned error: %v", err)
+	}
+	if len(policy.moderators) != 2 || policy.actions[StageInput] != ActionWarn || policy.actions[StageOutput] != ActionBlock {
+		t.Fatalf("unexpected policy %+v", policy)
+	}
+}
+
+func TestOpenAIModeratorParsesFlaggedCategories(t *testing.T) {
+	var gotInput []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer key" {
+			t.Errorf("unexpected authorization header %q", r.Header.Get("Authorization"))
+		}
+		var payload struct {
+			Model string   `json:"model"`
+			Input []string `json:"input"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		gotInput = payload.Input
+		_, _ = w.Write([]byte(`{"results":[
+			{"flagged":false,"categories":{"hate":false}},
+			{"flagged":true,"categories":{"harassment":true,"violence":false,"hate":true}}
+		]}`))
+	}))
+	t.Cleanup(server.Close)
+
+	moderator := &OpenAIModerator{endpoint: server.URL, apiKey: "key", model: defaultOpenAIModeration, client: server.Client(), timeout: defaultModerationTimeout}
+	verdict, err := moderator.Moderate(context.Background(), StageOutput, []string{"fine", "  ", "not fine"})
+	if err != nil {
+		t.Fatalf("Moderate returned error: %v", err)
+	}
+	if len(gotInput) != 2 {
+		t.Fatalf("expected blank inputs to be skipped, got %q", gotInput)
+	}
+	if !verdict.Flagged || strings.Join(verdict.Categories, ",") != "harassment,hate" {
+		t.Fatalf("unexpected verdict %+v", verdict)
+	}
+}
+
+func TestOpenAIModeratorSurfacesHTTPErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, `{"error":"bad key"}`, http.StatusUnauthorized)
+	}))
+	t.Cleanup(server.Close)
+
+	moderator := &OpenAIModerator{endpoint: server.URL, apiKey: "key", client: server.Client(), timeout: defaultModerationTimeout}
+	if _, err := moderator.Moderate(context.Background(), StageInput, []string{"text"}); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Fatalf("expected status error, got %v", err)
+	}
+}
+
+func TestGeminiSafetyModeratorUsesRecordedRatings(t *testing.T) {
+	t.Setenv("MODERATION_GEMINI_THRESHOLD", "")
+	moderator, err := NewGeminiSafetyModeratorFromEnv()
+	if err != nil {
+		t.Fatalf("NewGeminiSafetyModeratorFromEnv returned error: %v", err)
+	}
+
+	ctx, info := llm.WithCallInfo(context.Background())
+	info.AddSafetyRatings(
+		llm.SafetyRating{Stage: "input", Category: "HARM_CATEGORY_HARASSMENT", Probability: "LOW"},
+		llm.SafetyRating{Stage: "output", Category: "HARM_CATEGORY_HATE_SPEECH", Probability: "MEDIUM"},
+		llm.SafetyRating{Stage: "output", Category: "HARM_CATEGORY_DANGEROUS_CONTENT", Probability: "NEGLIGIBLE", Blocked: true},
+	)
+
+	if verdict, _ := moderator.Moderate(ctx, StageInput, nil); verdict.Flagged {
+		t.Fatalf("expected the input stage to be skipped, got %+v", verdict)
+	}
+	verdict, err := moderator.Moderate(ctx, StageOutput, nil)
+	if err != nil {
+		t.Fatalf("Moderate returned error: %v", err)
+	}
+	if strings.Join(verdict.Categories, ",") != "dangerous_content,hate_speech" {
+		t.Fatalf("unexpected verdict %+v", verdict)
+	}
+
+	t.Setenv("MODERATION_GEMINI_THRESHOLD", "negligible")
+	if _, err := NewGeminiSafetyModeratorFromEnv(); err == nil {
+		t.Fatal("expected NEGLIGIBLE to be rejected as a threshold")
+	}
+}
@@ -0,0 +1,126 @@
+package moderation
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	openAIModeratorName       = "openai"
+	openAIModerationsURL      = "https://api.openai.com/v1/moderations"
+	defaultOpenAIModeration   = "omni-moderation-latest"
+	defaultModerationTimeout  = 15 * time.Second
+	maxModerationErrorBodyLen = 512
+)
+
+// OpenAIModerator calls the OpenAI moderation endpoint. It can be used with
+// any LLM provider as long as OPENAI_API_KEY is set.
+type OpenAIModerator struct {
+	endpoint string
+	apiKey   string
+	model    string
+	client   *http.Client
+	timeout  time.Duration
+}
+
+// NewOpenAIModeratorFromEnv reads OPENAI_API_KEY, OPENAI_MODERATION_MODEL and
+// LLM_TIMEOUT_MS.
+func NewOpenAIModeratorFromEnv() (*OpenAIModerator, error) {
+	apiKey := strings.TrimSpace(os.Getenv("OPENAI_API_KEY"))
+	if apiKey == "" {
+		return nil, errors.New("openai moderation requires OPENAI_API_KEY")
+	}
+	model := strings.TrimSpace(os.Getenv("OPENAI_MODERATION_MODEL"))
+	if model == "" {
+		model = defaultOpenAIModeration
+	}
+
+	timeout := defaultModerationTimeout
+	if parsed, err := strconv.Atoi(strings.TrimSpace(os.Getenv("LLM_TIMEOUT_MS"))); err == nil && parsed > 0 {
+		timeout = time.Duration(parsed) * time.Millisecond
+	}
+
+	return &OpenAIModerator{
+		endpoint: openAIModerationsURL,
+		apiKey:   apiKey,
+		model:    model,
+		client:   http.DefaultClient,
+		timeout:  timeout,
+	}, nil
+}
+
+func (o *OpenAIModerator) Name() string {
+	return openAIModeratorName
+}
+
+func (o *OpenAIModerator) Moderate(ctx context.Context, _ Stage, texts []string) (Verdict, error) {
+	inputs := make([]string, 0, len(texts))
+	for _, text := range texts {
+		if strings.TrimSpace(text) != "" {
+			inputs = append(inputs, text)
+		}
+	}
+	if len(inputs) == 0 {
+		return Verdict{}, nil
+	}
+
+	body, err := json.Marshal(map[string]any{"model": o.model, "input": inputs})
+	if err != nil {
+		return Verdict{}, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, o.timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return Verdict{}, err
+	}
+	req.Header.Set("Authorization", "Bearer "+o.apiKey)
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := o.client.Do(req)
+	if err != nil {
+		return Verdict{}, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		raw, _ := io.ReadAll(io.LimitReader(res.Body, maxModerationErrorBodyLen))
+		return Verdict{}, fmt.Errorf("openai moderation returned status %d: %s", res.StatusCode, strings.TrimSpace(string(raw)))
+	}
+
+	var parsed struct {
+		Results []struct {
+			Flagged    bool            `json:"flagged"`
+			Categories map[string]bool `json:"categories"`
+		} `json:"results"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&parsed); err != nil {
+		return Verdict{}, fmt.Errorf("openai moderation response: %w", err)
+	}
+
+	matched := make(map[string]bool)
+	for _, result := range parsed.Results {
+		if !result.Flagged {
+			continue
+		}
+		for category, flagged := range result.Categories {
+			if flagged {
+				matched[category] = true
+			}
+		}
+		if len(matched) == 0 {
+			matched["flagged"] = true
+		}
+	}
+	return verdictFromCategories(matched), nil
+}
@@ -0,0 +1,108 @@
+package moderation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	regexModeratorName  = "regex"
+	blockedTermCategory = "blocked_term"
+)
+
+// Rule flags text matching Pattern under Category.
+type Rule struct {
+	Category string `json:"category"`
+	Pattern  string `json:"pattern"`
+}
+
+type compiledRule struct {
+	category string
+	pattern  *regexp.Regexp
+}
+
+// RegexModerator flags texts matching local rules. It applies the same rules
+// to inputs and outputs.
+type RegexModerator struct {
+	rules []compiledRule
+}
+
+// NewRegexModerator compiles rules. Patterns are case-insensitive.
+func NewRegexModerator(rules []Rule) (*RegexModerator, error) {
+	compiled := make([]compiledRule, 0, len(rules))
+	for _, rule := range rules {
+		category := strings.TrimSpace(rule.Category)
+		if category == "" {
+			return nil, fmt.Errorf("moderation rule %q requires a category", rule.Pattern)
+		}
+		pattern, err := regexp.Compile("(?i)" + rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("moderation rule %s: %w", category, err)
+		}
+		compiled = append(compiled, compiledRule{category: category, pattern: pattern})
+	}
+	return &RegexModerator{rules: compiled}, nil
+}
+
+// NewRegexModeratorFromEnv reads MODERATION_BLOCKED_TERMS (comma separated
+// whole words or phrases) and MODERATION_RULES_FILE (a JSON array of
+// {"category", "pattern"} rules).
+func NewRegexModeratorFromEnv() (*RegexModerator, error) {
+	rules := make([]Rule, 0)
+	for _, term := range strings.Split(os.Getenv("MODERATION_BLOCKED_TERMS"), ",") {
+		if term = strings.TrimSpace(term); term != "" {
+			rules = append(rules, Rule{Category: blockedTermCategory, Pattern: `\b` + regexp.QuoteMeta(term) + `\b`})
+		}
+	}
+
+	if path := strings.TrimSpace(os.Getenv("MODERATION_RULES_FILE")); path != "" {
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("MODERATION_RULES_FILE: %w", err)
+		}
+		var fileRules []Rule
+		if err := json.Unmarshal(raw, &fileRules); err != nil {
+			return nil, fmt.Errorf("MODERATION_RULES_FILE: %w", err)
+		}
+		rules = append(rules, fileRules...)
+	}
+
+	if len(rules) == 0 {
+		return nil, errors.New("regex moderation requires MODERATION_BLOCKED_TERMS or MODERATION_RULES_FILE")
+	}
+	return NewRegexModerator(rules)
+}
+
+func (r *RegexModerator) Name() string {
+	return regexModeratorName
+}
+
+func (r *RegexModerator) Moderate(_ context.Context, _ Stage, texts []string) (Verdict, error) {
+	matched := make(map[string]bool)
+	for _, text := range texts {
+		for _, rule := range r.rules {
+			if !matched[rule.category] && rule.pattern.MatchString(text) {
+				matched[rule.category] = true
+			}
+		}
+	}
+	return verdictFromCategories(matched), nil
+}
+
+func verdictFromCategories(matched map[string]bool) Verdict {
+	if len(matched) == 0 {
+		return Verdict{}
+	}
+	categories := make([]string, 0, len(matched))
+	for category := range matched {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+	return Verdict{Flagged: true, Categories: categories}
+}
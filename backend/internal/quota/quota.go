@@ -0,0 +1,283 @@
+// Package quota enforces per-tenant daily and monthly usage limits.
+package quota
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Period string
+
+const (
+	PeriodDay   Period = "day"
+	PeriodMonth Period = "month"
+)
+
+var periods = []Period{PeriodDay, PeriodMonth}
+
+// ErrQuotaExceeded is matched by every *ExceededError.
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// Usage is consumption, or a limit on it where zero is unlimited.
+type Usage struct {
+	Requests   int64 `json:"requests"`
+	InputChars int64 `json:"inputChars"`
+	Tokens     int64 `json:"tokens"`
+}
+
+func (u Usage) add(other Usage) Usage {
+	return Usage{
+		Requests:   u.Requests + other.Requests,
+		InputChars: u.InputChars + other.InputChars,
+		Tokens:     u.Tokens + other.Tokens,
+	}
+}
+
+func (u Usage) negate() Usage {
+	return Usage{Requests: -u.Requests, InputChars: -u.InputChars, Tokens: -u.Tokens}
+}
+
+type Limits struct {
+	Daily   Usage `json:"daily"`
+	Monthly Usage `json:"monthly"`
+}
+
+func (l Limits) forPeriod(period Period) Usage {
+	if period == PeriodMonth {
+		return l.Monthly
+	}
+	return l.Daily
+}
+
+type Config struct {
+	Default Limits
+	Tenants map[string]Limits
+}
+
+// ConfigFromEnv reads QUOTA_DAILY_REQUESTS, QUOTA_DAILY_INPUT_CHARS,
+// QUOTA_DAILY_TOKENS, their QUOTA_MONTHLY_* counterparts, and QUOTA_TENANTS,
+// a JSON object of per-tenant {"daily": {...}, "monthly": {...}} overrides.
+func ConfigFromEnv() (Config, error) {
+	config := Config{
+		Default: Limits{
+			Daily: Usage{
+				Requests:   limitFromEnv("QUOTA_DAILY_REQUESTS"),
+				InputChars: limitFromEnv("QUOTA_DAILY_INPUT_CHARS"),
+				Tokens:     limitFromEnv("QUOTA_DAILY_TOKENS"),
+			},
+			Monthly: Usage{
+				Requests:   limitFromEnv("QUOTA_MONTHLY_REQUESTS"),
+				InputChars: limitFromEnv("QUOTA_MONTHLY_INPUT_CHARS"),
+				Tokens:     limitFromEnv("QUOTA_MONTHLY_TOKENS"),
+			},
+		},
+	}
+	if raw := strings.TrimSpace(os.Getenv("QUOTA_TENANTS")); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &config.Tenants); err != nil {
+			return Config{}, fmt.Errorf("QUOTA_TENANTS: %w", err)
+		}
+	}
+	return config, nil
+}
+
+func limitFromEnv(key string) int64 {
+	value, err := strconv.ParseInt(strings.TrimSpace(os.Getenv(key)), 10, 64)
+	if err != nil || value < 0 {
+		return 0
+	}
+	return value
+}
+
+func (c Config) limitsFor(tenant string) Limits {
+	if limits, ok := c.Tenants[tenant]; ok {
+		return limits
+	}
+	return c.Default
+}
+
+// ExceededError reports the first limit a charge would exceed.
+type ExceededError struct {
+	Tenant   string
+	Period   Period
+	Resource string
+	Limit    int64
+	Used     int64
+	ResetAt  time.Time
+}
+
+func (e *ExceededError) Error() string {
+	return fmt.Sprintf("%s %s quota of %d exceeded; resets at %s", e.Period, e.Resource, e.Limit, e.ResetAt.UTC().Format(time.RFC3339))
+}
+
+func (e *ExceededError) Is(target error) bool {
+	return target == ErrQuotaExceeded
+}
+
+type Window struct {
+	Period  Period
+	Start   time.Time
+	ResetAt time.Time
+	Used    Usage
+	Limits  Usage
+}
+
+// Reservation is a charge made by Reserve.
+type Reservation struct {
+	Tenant string    `json:"tenant"`
+	Charge Usage     `json:"charge"`
+	At     time.Time `json:"at"`
+}
+
+type Enforcer struct {
+	config Config
+	store  Store
+	now    func() time.Time
+
+	mu sync.Mutex
+}
+
+func NewEnforcer(config Config, store Store) *Enforcer {
+	return &Enforcer{config: config, store: store, now: time.Now}
+}
+
+func NewEnforcerFromEnv() (*Enforcer, error) {
+	config, err := ConfigFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	store, err := NewStoreFromEnv()
+	if err != nil {
+		return nil, err
+	}
+	return NewEnforcer(config, store), nil
+}
+
+// Reserve charges tenant, or returns an *ExceededError and charges nothing
+// when that would exceed a limit.
+func (e *Enforcer) Reserve(ctx context.Context, tenant string, charge Usage) (*Reservation, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := e.now()
+	limits := e.config.limitsFor(tenant)
+	for _, period := range periods {
+		start, reset := windowBounds(period, now)
+		used, err := e.store.Get(ctx, WindowKey{Tenant: tenant, Period: period, Start: start})
+		if err != nil {
+			return nil, err
+		}
+		if resource, limit, ok := exceeded(used.add(charge), limits.forPeriod(period)); ok {
+			return nil, &ExceededError{
+				Tenant:   tenant,
+				Period:   period,
+				Resource: resource,
+				Limit:    limit,
+				Used:     usedFor(used, resource),
+				ResetAt:  reset,
+			}
+		}
+	}
+	if err := e.addLocked(ctx, tenant, charge, now); err != nil {
+		return nil, err
+	}
+	return &Reservation{Tenant: tenant, Charge: charge, At: now}, nil
+}
+
+// Refund gives a reservation's charge back, except in windows that have
+// ended since.
+func (e *Enforcer) Refund(ctx context.Context, reservation Reservation) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := e.now()
+	for _, period := range periods {
+		start, _ := windowBounds(period, reservation.At)
+		if current, _ := windowBounds(period, now); !current.Equal(start) {
+			continue
+		}
+		if _, err := e.store.Add(ctx, WindowKey{Tenant: reservation.Tenant, Period: period, Start: start}, reservation.Charge.negate()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Record adds usage without checking limits.
+func (e *Enforcer) Record(ctx context.Context, tenant string, usage Usage) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.addLocked(ctx, tenant, usage, e.now())
+}
+
+func (e *Enforcer) addLocked(ctx context.Context, tenant string, usage Usage, now time.Time) error {
+	for _, period := range periods {
+		start, _ := windowBounds(period, now)
+		if _, err := e.store.Add(ctx, WindowKey{Tenant: tenant, Period: period, Start: start}, usage); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Report returns the tenant's daily and monthly windows, in that order.
+func (e *Enforcer) Report(ctx context.Context, tenant string) ([]Window, error) {
+	now := e.now()
+	limits := e.config.limitsFor(tenant)
+	windows := make([]Window, 0, len(periods))
+	for _, period := range periods {
+		start, reset := windowBounds(period, now)
+		used, err := e.store.Get(ctx, WindowKey{Tenant: tenant, Period: period, Start: start})
+		if err != nil {
+			return nil, err
+		}
+		windows = append(windows, Window{
+			Period:  period,
+			Start:   start,
+			ResetAt: reset,
+			Used:    used,
+			Limits:  limits.forPeriod(period),
+		})
+	}
+	return windows, nil
+}
+
+// windowBounds returns the UTC start of the period containing now and of
+// the next one.
+func windowBounds(period Period, now time.Time) (time.Time, time.Time) {
+	now = now.UTC()
+	if period == PeriodMonth {
+		start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+		return start, start.AddDate(0, 1, 0)
+	}
+	start := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	return start, start.AddDate(0, 0, 1)
+}
+
+func exceeded(total Usage, limits Usage) (string, int64, bool) {
+	switch {
+	case limits.Requests > 0 && total.Requests > limits.Requests:
+		return "requests", limits.Requests, true
+	case limits.InputChars > 0 && total.InputChars > limits.InputChars:
+		return "inputChars", limits.InputChars, true
+	case limits.Tokens > 0 && total.Tokens > limits.Tokens:
+		return "tokens", limits.Tokens, true
+	}
+	return "", 0, false
+}
+
+func usedFor(usage Usage, resource string) int64 {
+	switch resource {
+	case "requests":
+		return usage.Requests
+	case "inputChars":
+		return usage.InputChars
+	}
+	return usage.Tokens
+}
@@ -0,0 +1,158 @@
+package quota
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func newTestEnforcer(config Config, now *time.Time) *Enforcer {
+	enforcer := NewEnforcer(config, NewMemoryStore())
+	enforcer.now = func() time.Time { return *now }
+	return enforcer
+}
+
+func TestEnforcerRejectsChargesOverDailyLimit(t *testing.T) {
+	now := time.Date(2026, 3, 14, 15, 0, 0, 0, time.UTC)
+	enforcer := newTestEnforcer(Config{Default: Limits{Daily: Usage{Requests: 2, Tokens: 100}}}, &now)
+	ctx := context.Background()
+
+	for range 2 {
+		if _, err := enforcer.Reserve(ctx, "acme", Usage{Requests: 1, Tokens: 10}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+	_, err := enforcer.Reserve(ctx, "acme", Usage{Requests: 1, Tokens: 10})
+	var exceeded *ExceededError
+	if !errors.As(err, &exceeded) || !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("expected ExceededError, got %v", err)
+	}
+	if exceeded.Period != PeriodDay || exceeded.Resource != "requests" || exceeded.Limit != 2 || exceeded.Used != 2 {
+		t.Fatalf("unexpected error %+v", exceeded)
+	}
+	if want := time.Date(2026, 3, 15, 0, 0, 0, 0, time.UTC); !exceeded.ResetAt.Equal(want) {
+		t.Fatalf("expected reset at %s, got %s", want, exceeded.ResetAt)
+	}
+
+	if _, err := enforcer.Reserve(ctx, "globex", Usage{Requests: 1}); err != nil {
+		t.Fatalf("expected other tenants to be unaffected, got %v", err)
+	}
+
+	now = now.Add(12 * time.Hour)
+	if _, err := enforcer.Reserve(ctx, "acme", Usage{Requests: 1, Tokens: 10}); err != nil {
+		t.Fatalf("expected the quota to reset the next day, got %v", err)
+	}
+}
+
+func TestEnforcerAppliesMonthlyLimitsAndTenantOverrides(t *testing.T) {
+	now := time.Date(2026, 1, 31, 23, 0, 0, 0, time.UTC)
+	enforcer := newTestEnforcer(Config{
+		Default: Limits{Monthly: Usage{InputChars: 1000}},
+		Tenants: map[string]Limits{"acme": {Monthly: Usage{InputChars: 10}}},
+	}, &now)
+	ctx := context.Background()
+
+	_, err := enforcer.Reserve(ctx, "acme", Usage{Requests: 1, InputChars: 11})
+	var exceeded *ExceededError
+	if !errors.As(err, &exceeded) || exceeded.Period != PeriodMonth || exceeded.Resource != "inputChars" {
+		t.Fatalf("expected the monthly inputChars quota to be exceeded, got %v", err)
+	}
+	if want := time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC); !exceeded.ResetAt.Equal(want) {
+		t.Fatalf("expected reset at %s, got %s", want, exceeded.ResetAt)
+	}
+	if _, err := enforcer.Reserve(ctx, "globex", Usage{Requests: 1, InputChars: 11}); err != nil {
+		t.Fatalf("expected the default limits for other tenants, got %v", err)
+	}
+}
+
+func TestEnforcerReportsUsage(t *testing.T) {
+	now := time.Date(2026, 3, 14, 15, 0, 0, 0, time.UTC)
+	enforcer := newTestEnforcer(Config{Default: Limits{Daily: Usage{Tokens: 500}}}, &now)
+	ctx := context.Background()
+
+	if _, err := enforcer.Reserve(ctx, "acme", Usage{Requests: 1, InputChars: 40, Tokens: 12}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := enforcer.Record(ctx, "acme", Usage{Tokens: 8}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := enforcer.Reserve(ctx, "acme", Usage{Tokens: 1000}); err == nil {
+		t.Fatal("expected a rejected charge")
+	}
+
+	windows, err := enforcer.Report(ctx, "acme")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(windows) != 2 || windows[0].Period != PeriodDay || windows[1].Period != PeriodMonth {
+		t.Fatalf("unexpected windows %+v", windows)
+	}
+	want := Usage{Requests: 1, InputChars: 40, Tokens: 20}
+	for _, window := range windows {
+		if window.Used != want {
+			t.Fatalf("%s: expected usage %+v, got %+v", window.Period, want, window.Used)
+		}
+	}
+	if windows[0].Limits.Tokens != 500 || windows[1].Limits != (Usage{}) {
+		t.Fatalf("unexpected limits %+v %+v", windows[0].Limits, windows[1].Limits)
+	}
+	if !windows[1].Start.Equal(time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("unexpected month start %s", windows[1].Start)
+	}
+}
+
+func TestEnforcerRefundsReservations(t *testing.T) {
+	now := time.Date(2026, 3, 31, 23, 0, 0, 0, time.UTC)
+	enforcer := newTestEnforcer(Config{Default: Limits{Daily: Usage{Requests: 1}}}, &now)
+	ctx := context.Background()
+
+	reservation, err := enforcer.Reserve(ctx, "acme", Usage{Requests: 1, Tokens: 10})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := enforcer.Refund(ctx, *reservation); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := enforcer.Reserve(ctx, "acme", Usage{Requests: 1, Tokens: 10}); err != nil {
+		t.Fatalf("expected the refunded request to be available again, got %v", err)
+	}
+
+	// A refund after the windows rolled over leaves the new ones alone.
+	late, _ := enforcer.Reserve(ctx, "globex", Usage{Requests: 1})
+	now = now.Add(2 * time.Hour)
+	if _, err := enforcer.Reserve(ctx, "globex", Usage{Requests: 1}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := enforcer.Refund(ctx, *late); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	windows, _ := enforcer.Report(ctx, "globex")
+	for _, window := range windows {
+		if window.Used.Requests != 1 {
+			t.Fatalf("%s: expected the new window to keep its charge, got %+v", window.Period, window.Used)
+		}
+	}
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	t.Setenv("QUOTA_DAILY_REQUESTS", "100")
+	t.Setenv("QUOTA_MONTHLY_TOKENS", "5000000")
+	t.Setenv("QUOTA_TENANTS", `{"acme":{"daily":{"requests":10}}}`)
+
+	config, err := ConfigFromEnv()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if config.Default.Daily.Requests != 100 || config.Default.Monthly.Tokens != 5000000 {
+		t.Fatalf("unexpected defaults %+v", config.Default)
+	}
+	if limits := config.limitsFor("acme"); limits.Daily.Requests != 10 || limits.Monthly.Tokens != 0 {
+		t.Fatalf("expected acme's limits to replace the defaults, got %+v", limits)
+	}
+
+	t.Setenv("QUOTA_TENANTS", `["acme"]`)
+	if _, err := ConfigFromEnv(); err == nil {
+		t.Fatal("expected malformed QUOTA_TENANTS to fail")
+	}
+}
@@ -0,0 +1,69 @@
+package quota
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WindowKey identifies one tenant's usage counters for one period.
+type WindowKey struct {
+	Tenant string
+	Period Period
+	Start  time.Time
+}
+
+// Store persists usage counters. Implementations must be safe for concurrent
+// use; the Enforcer serializes check-and-charge itself.
+type Store interface {
+	Get(ctx context.Context, key WindowKey) (Usage, error)
+	// Add adds delta to the window's counters and returns the new totals.
+	Add(ctx context.Context, key WindowKey, delta Usage) (Usage, error)
+}
+
+// NewStoreFromEnv reads QUOTA_STORE. Only "memory" (the default) is
+// available.
+func NewStoreFromEnv() (Store, error) {
+	switch backend := strings.ToLower(strings.TrimSpace(os.Getenv("QUOTA_STORE"))); backend {
+	case "", "memory":
+		return NewMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("unsupported QUOTA_STORE %q", backend)
+	}
+}
+
+// MemoryStore keeps usage in process memory; it is lost on restart. Only
+// the latest window of each tenant and period is kept.
+type MemoryStore struct {
+	mu      sync.Mutex
+	windows map[WindowKey]Usage
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{windows: make(map[WindowKey]Usage)}
+}
+
+func (s *MemoryStore) Get(_ context.Context, key WindowKey) (Usage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.windows[key], nil
+}
+
+func (s *MemoryStore) Add(_ context.Context, key WindowKey, delta Usage) (Usage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.windows[key]; !ok {
+		for existing := range s.windows {
+			if existing.Tenant == key.Tenant && existing.Period == key.Period && existing.Start.Before(key.Start) {
+				delete(s.windows, existing)
+			}
+		}
+	}
+	usage := s.windows[key].add(delta)
+	s.windows[key] = usage
+	return usage, nil
+}
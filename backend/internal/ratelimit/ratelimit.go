@@ -0,0 +1,179 @@
+// Package ratelimit throttles callers with token buckets keyed by client
+// identity.
+package ratelimit
+
+import (
+	"container/list"
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMaxKeys = 100000
+	sweepInterval  = time.Minute
+)
+
+// Config describes one bucket per key: it holds up to Burst tokens and
+// refills at RequestsPerMinute, which must be positive. Burst defaults to
+// RequestsPerMinute.
+type Config struct {
+	RequestsPerMinute int
+	Burst             int
+	// MaxKeys bounds how many buckets are tracked; the least recently used
+	// bucket is evicted to make room. Zero means 100000.
+	MaxKeys int
+}
+
+func (c Config) burst() int {
+	if c.Burst > 0 {
+		return c.Burst
+	}
+	return c.RequestsPerMinute
+}
+
+func (c Config) perSecond() float64 {
+	return float64(c.RequestsPerMinute) / 60
+}
+
+// fillTime is how long an empty bucket takes to refill completely.
+func (c Config) fillTime() time.Duration {
+	return secondsToDuration(float64(c.burst()) / c.perSecond())
+}
+
+// Decision is the outcome of one request against its bucket.
+type Decision struct {
+	Allowed bool
+	// Limit is the bucket size and Remaining the whole tokens left.
+	Limit     int
+	Remaining int
+	// Reset is how long until the bucket is full again, and RetryAfter how
+	// long until the next token when the request was refused.
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// Limiter takes n tokens from key's bucket per call, or none when fewer are
+// left. A call for more than the burst is never allowed.
+type Limiter interface {
+	AllowN(ctx context.Context, key string, n int) (Decision, error)
+}
+
+// decide refills a bucket holding tokens, last updated at updated, to now
+// and takes n tokens if available. It returns the decision and the bucket's
+// new token count.
+func decide(config Config, tokens float64, updated time.Time, now time.Time, n int) (Decision, float64) {
+	burst := float64(config.burst())
+	rate := config.perSecond()
+	if elapsed := now.Sub(updated).Seconds(); elapsed > 0 {
+		tokens = math.Min(burst, tokens+elapsed*rate)
+	}
+
+	decision := Decision{Limit: config.burst()}
+	if tokens >= float64(n) {
+		tokens -= float64(n)
+		decision.Allowed = true
+	} else {
+		decision.RetryAfter = secondsToDuration((math.Min(float64(n), burst) - tokens) / rate)
+	}
+	decision.Remaining = int(math.Floor(tokens))
+	decision.Reset = secondsToDuration((burst - tokens) / rate)
+	return decision, tokens
+}
+
+func secondsToDuration(seconds float64) time.Duration {
+	return time.Duration(math.Ceil(seconds * float64(time.Second)))
+}
+
+type bucket struct {
+	key     string
+	tokens  float64
+	updated time.Time
+}
+
+// MemoryLimiter keeps buckets in process memory. Buckets that have refilled
+// completely are indistinguishable from new ones and are swept, so memory
+// tracks only recently active keys. Buckets are kept in a list from most to
+// least recently used, so sweeping and eviction start from the back and
+// never scan active buckets.
+type MemoryLimiter struct {
+	config Config
+	now    func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*list.Element
+	recency   *list.List
+	lastSweep time.Time
+}
+
+func NewMemoryLimiter(config Config) *MemoryLimiter {
+	if config.MaxKeys <= 0 {
+		config.MaxKeys = defaultMaxKeys
+	}
+	return &MemoryLimiter{
+		config:  config,
+		now:     time.Now,
+		buckets: make(map[string]*list.Element),
+		recency: list.New(),
+	}
+}
+
+func (l *MemoryLimiter) Allow(ctx context.Context, key string) (Decision, error) {
+	return l.AllowN(ctx, key, 1)
+}
+
+func (l *MemoryLimiter) AllowN(_ context.Context, key string, n int) (Decision, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	if now.Sub(l.lastSweep) >= sweepInterval {
+		l.sweepLocked(now)
+	}
+
+	element, ok := l.buckets[key]
+	if ok {
+		l.recency.MoveToFront(element)
+	} else {
+		if len(l.buckets) >= l.config.MaxKeys {
+			l.sweepLocked(now)
+			if len(l.buckets) >= l.config.MaxKeys {
+				l.removeLocked(l.recency.Back())
+			}
+		}
+		element = l.recency.PushFront(&bucket{key: key, tokens: float64(l.config.burst()), updated: now})
+		l.buckets[key] = element
+	}
+	b := element.Value.(*bucket)
+
+	decision, tokens := decide(l.config, b.tokens, b.updated, now, n)
+	b.tokens = tokens
+	b.updated = now
+	return decision, nil
+}
+
+// Len reports how many buckets are tracked.
+func (l *MemoryLimiter) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.buckets)
+}
+
+// sweepLocked removes refilled buckets from the back of the list, stopping
+// at the first one still refilling.
+func (l *MemoryLimiter) sweepLocked(now time.Time) {
+	l.lastSweep = now
+	fill := l.config.fillTime()
+	for element := l.recency.Back(); element != nil; element = l.recency.Back() {
+		if now.Sub(element.Value.(*bucket).updated) < fill {
+			return
+		}
+		l.removeLocked(element)
+	}
+}
+
+func (l *MemoryLimiter) removeLocked(element *list.Element) {
+	delete(l.buckets, element.Value.(*bucket).key)
+	l.recency.Remove(element)
+}
@@ -0,0 +1,121 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func newTestLimiter(config Config, now *time.Time) *MemoryLimiter {
+	limiter := NewMemoryLimiter(config)
+	limiter.now = func() time.Time { return *now }
+	return limiter
+}
+
+func TestMemoryLimiterAllowsBurstThenRefills(t *testing.T) {
+	now := time.Date(2026, 2, 22, 12, 0, 59, 0, time.UTC)
+	limiter := newTestLimiter(Config{RequestsPerMinute: 60, Burst: 3}, &now)
+	ctx := context.Background()
+
+	for i := range 3 {
+		decision, _ := limiter.Allow(ctx, "a")
+		if !decision.Allowed || decision.Limit != 3 || decision.Remaining != 2-i {
+			t.Fatalf("request %d: unexpected decision %+v", i, decision)
+		}
+	}
+	decision, _ := limiter.Allow(ctx, "a")
+	if decision.Allowed || decision.RetryAfter != time.Second || decision.Reset != 3*time.Second {
+		t.Fatalf("expected an empty bucket, got %+v", decision)
+	}
+
+	// Unlike a fixed window, crossing a minute boundary does not refill the
+	// bucket at once.
+	now = now.Add(time.Second)
+	if decision, _ := limiter.Allow(ctx, "a"); !decision.Allowed || decision.Remaining != 0 {
+		t.Fatalf("expected one refilled token, got %+v", decision)
+	}
+	if decision, _ := limiter.Allow(ctx, "a"); decision.Allowed {
+		t.Fatalf("expected the refilled token to be used up, got %+v", decision)
+	}
+
+	if decision, _ := limiter.Allow(ctx, "b"); !decision.Allowed || decision.Remaining != 2 {
+		t.Fatalf("expected each key to have its own bucket, got %+v", decision)
+	}
+}
+
+func TestMemoryLimiterEvictsIdleBuckets(t *testing.T) {
+	now := time.Date(2026, 2, 22, 12, 0, 0, 0, time.UTC)
+	limiter := newTestLimiter(Config{RequestsPerMinute: 60, Burst: 60}, &now)
+	ctx := context.Background()
+
+	for i := range 10 {
+		_, _ = limiter.Allow(ctx, fmt.Sprintf("client-%d", i))
+	}
+	if limiter.Len() != 10 {
+		t.Fatalf("expected 10 buckets, got %d", limiter.Len())
+	}
+
+	now = now.Add(2 * time.Minute)
+	_, _ = limiter.Allow(ctx, "client-new")
+	if limiter.Len() != 1 {
+		t.Fatalf("expected refilled buckets to be swept, got %d", limiter.Len())
+	}
+}
+
+func TestMemoryLimiterBoundsKeys(t *testing.T) {
+	now := time.Date(2026, 2, 22, 12, 0, 0, 0, time.UTC)
+	limiter := newTestLimiter(Config{RequestsPerMinute: 1, MaxKeys: 3}, &now)
+	ctx := context.Background()
+
+	for i := range 5 {
+		now = now.Add(time.Millisecond)
+		_, _ = limiter.Allow(ctx, fmt.Sprintf("client-%d", i))
+	}
+	if limiter.Len() != 3 {
+		t.Fatalf("expected at most 3 buckets, got %d", limiter.Len())
+	}
+	if decision, _ := limiter.Allow(ctx, "client-4"); decision.Allowed {
+		t.Fatalf("expected the most recent bucket to be kept, got %+v", decision)
+	}
+	if decision, _ := limiter.Allow(ctx, "client-0"); !decision.Allowed {
+		t.Fatalf("expected the oldest bucket to have been evicted, got %+v", decision)
+	}
+}
+
+func TestMemoryLimiterAllowNTakesSeveralTokens(t *testing.T) {
+	now := time.Date(2026, 2, 22, 12, 0, 0, 0, time.UTC)
+	limiter := newTestLimiter(Config{RequestsPerMinute: 60, Burst: 5}, &now)
+	ctx := context.Background()
+
+	if decision, _ := limiter.AllowN(ctx, "a", 4); !decision.Allowed || decision.Remaining != 1 {
+		t.Fatalf("expected four tokens to be taken, got %+v", decision)
+	}
+	decision, _ := limiter.AllowN(ctx, "a", 3)
+	if decision.Allowed || decision.Remaining != 1 || decision.RetryAfter != 2*time.Second {
+		t.Fatalf("expected a refusal that takes nothing, got %+v", decision)
+	}
+	if decision, _ := limiter.AllowN(ctx, "b", 6); decision.Allowed {
+		t.Fatalf("expected more than the burst to be refused, got %+v", decision)
+	}
+}
+
+func TestMemoryLimiterEvictsLeastRecentlyUsed(t *testing.T) {
+	now := time.Date(2026, 2, 22, 12, 0, 0, 0, time.UTC)
+	limiter := newTestLimiter(Config{RequestsPerMinute: 1, Burst: 2, MaxKeys: 3}, &now)
+	ctx := context.Background()
+
+	for _, key := range []string{"client-a", "client-b", "client-c", "client-a", "client-d"} {
+		now = now.Add(time.Millisecond)
+		_, _ = limiter.Allow(ctx, key)
+	}
+	if limiter.Len() != 3 {
+		t.Fatalf("expected at most 3 buckets, got %d", limiter.Len())
+	}
+	if decision, _ := limiter.Allow(ctx, "client-a"); decision.Allowed {
+		t.Fatalf("expected the recently used bucket to be kept, got %+v", decision)
+	}
+	if decision, _ := limiter.Allow(ctx, "client-b"); decision.Remaining != 1 {
+		t.Fatalf("expected the least recently used bucket to have been evicted, got %+v", decision)
+	}
+}
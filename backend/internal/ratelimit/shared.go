@@ -0,0 +1,64 @@
+package ratelimit
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/alanmaizon/homer/backend/internal/sharedstate"
+)
+
+// SharedLimiter keeps buckets in a sharedstate.Store so every instance
+// draws from the same bucket for a key. Buckets expire once they would have
+// refilled, so the store only holds recently active keys.
+type SharedLimiter struct {
+	config Config
+	store  sharedstate.Store
+	prefix string
+	now    func() time.Time
+}
+
+// sharedBucket is a bucket as stored: its tokens and when they were counted,
+// in Unix microseconds.
+type sharedBucket struct {
+	Tokens  float64 `json:"tokens"`
+	Updated int64   `json:"updated"`
+}
+
+// NewSharedLimiter namespaces its keys by name so limiters for different
+// route groups sharing a store keep separate buckets.
+func NewSharedLimiter(store sharedstate.Store, name string, config Config) *SharedLimiter {
+	return &SharedLimiter{
+		config: config,
+		store:  store,
+		prefix: "ratelimit:" + name + ":",
+		now:    time.Now,
+	}
+}
+
+func (l *SharedLimiter) Allow(ctx context.Context, key string) (Decision, error) {
+	return l.AllowN(ctx, key, 1)
+}
+
+func (l *SharedLimiter) AllowN(ctx context.Context, key string, n int) (Decision, error) {
+	var decision Decision
+	_, err := l.store.Update(ctx, l.prefix+key, l.config.fillTime(), func(current []byte, found bool) ([]byte, error) {
+		now := l.now()
+		stored := sharedBucket{Tokens: float64(l.config.burst()), Updated: now.UnixMicro()}
+		if found {
+			// An unreadable bucket is replaced by a full one.
+			var existing sharedBucket
+			if json.Unmarshal(current, &existing) == nil {
+				stored = existing
+			}
+		}
+
+		var tokens float64
+		decision, tokens = decide(l.config, stored.Tokens, time.UnixMicro(stored.Updated), now, n)
+		return json.Marshal(sharedBucket{Tokens: tokens, Updated: now.UnixMicro()})
+	})
+	if err != nil {
+		return Decision{}, err
+	}
+	return decision, nil
+}
@@ -0,0 +1,80 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alanmaizon/homer/backend/internal/sharedstate"
+	"github.com/alicebob/miniredis/v2"
+)
+
+func newTestSharedLimiter(t *testing.T, server *miniredis.Miniredis, name string, config Config, now *time.Time) *SharedLimiter {
+	t.Helper()
+	store, err := sharedstate.NewRedisStore(sharedstate.RedisConfig{URL: "redis://" + server.Addr()})
+	if err != nil {
+		t.Fatalf("NewRedisStore: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	limiter := NewSharedLimiter(store, name, config)
+	limiter.now = func() time.Time { return *now }
+	return limiter
+}
+
+func TestSharedLimiterSharesBucketsAcrossInstances(t *testing.T) {
+	server := miniredis.RunT(t)
+	now := time.Date(2026, 2, 22, 12, 0, 0, 0, time.UTC)
+	config := Config{RequestsPerMinute: 60, Burst: 2}
+	first := newTestSharedLimiter(t, server, "connector", config, &now)
+	second := newTestSharedLimiter(t, server, "connector", config, &now)
+	ctx := context.Background()
+
+	if decision, err := first.Allow(ctx, "key:acme/k1"); err != nil || !decision.Allowed || decision.Remaining != 1 {
+		t.Fatalf("unexpected first decision %+v err=%v", decision, err)
+	}
+	if decision, _ := second.Allow(ctx, "key:acme/k1"); !decision.Allowed || decision.Remaining != 0 {
+		t.Fatalf("expected the second instance to use the same bucket, got %+v", decision)
+	}
+	decision, _ := first.Allow(ctx, "key:acme/k1")
+	if decision.Allowed || decision.RetryAfter != time.Second || decision.Reset != 2*time.Second {
+		t.Fatalf("expected an empty bucket, got %+v", decision)
+	}
+
+	now = now.Add(time.Second)
+	if decision, _ := second.Allow(ctx, "key:acme/k1"); !decision.Allowed {
+		t.Fatalf("expected one refilled token, got %+v", decision)
+	}
+}
+
+func TestSharedLimiterSeparatesGroupsAndExpiresBuckets(t *testing.T) {
+	server := miniredis.RunT(t)
+	now := time.Date(2026, 2, 22, 12, 0, 0, 0, time.UTC)
+	config := Config{RequestsPerMinute: 1}
+	task := newTestSharedLimiter(t, server, "task", config, &now)
+	connector := newTestSharedLimiter(t, server, "connector", config, &now)
+	ctx := context.Background()
+
+	_, _ = task.Allow(ctx, "ip:10.0.0.1")
+	if decision, _ := connector.Allow(ctx, "ip:10.0.0.1"); !decision.Allowed {
+		t.Fatalf("expected groups to keep separate buckets, got %+v", decision)
+	}
+
+	if ttl := server.TTL("homer:ratelimit:task:ip:10.0.0.1"); ttl <= 0 || ttl > time.Minute {
+		t.Fatalf("expected the bucket to expire once refilled, got ttl=%s", ttl)
+	}
+	server.FastForward(time.Minute)
+	if keys := server.Keys(); len(keys) != 0 {
+		t.Fatalf("expected refilled buckets to expire, got %v", keys)
+	}
+}
+
+func TestSharedLimiterReportsStoreErrors(t *testing.T) {
+	server := miniredis.RunT(t)
+	now := time.Now()
+	limiter := newTestSharedLimiter(t, server, "task", Config{RequestsPerMinute: 60}, &now)
+	server.Close()
+
+	if _, err := limiter.Allow(context.Background(), "ip:10.0.0.1"); err == nil {
+		t.Fatalf("expected an error when the store is unreachable")
+	}
+}
@@ -0,0 +1,257 @@
+package sharedstate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alanmaizon/homer/backend/internal/metrics"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	defaultRedisTimeout      = 2 * time.Second
+	defaultRedisMaxIdleConns = 8
+	maxUpdateAttempts        = 16
+)
+
+// RedisConfig points a RedisStore at a server speaking the Redis protocol,
+// such as Redis, Valkey or Memorystore.
+type RedisConfig struct {
+	// URL is redis://[[user]:password@]host[:port][/db], or rediss:// for
+	// TLS.
+	URL string
+	// KeyPrefix is prepended to every key so deployments can share a
+	// database. It defaults to "homer:".
+	KeyPrefix string
+	// Timeout bounds dialing and each command unless the context ends
+	// sooner. It defaults to 2s.
+	Timeout      time.Duration
+	MaxIdleConns int
+}
+
+// RedisConfigFromEnv reads REDIS_URL, SHARED_STATE_KEY_PREFIX and
+// REDIS_TIMEOUT_MS.
+func RedisConfigFromEnv() (RedisConfig, error) {
+	config := RedisConfig{
+		URL:       strings.TrimSpace(os.Getenv("REDIS_URL")),
+		KeyPrefix: os.Getenv("SHARED_STATE_KEY_PREFIX"),
+	}
+	if config.URL == "" {
+		return RedisConfig{}, errors.New("REDIS_URL is required when SHARED_STATE_STORE=redis")
+	}
+	if ms, err := strconv.Atoi(strings.TrimSpace(os.Getenv("REDIS_TIMEOUT_MS"))); err == nil && ms > 0 {
+		config.Timeout = time.Duration(ms) * time.Millisecond
+	}
+	return config, nil
+}
+
+// RedisStore is a Store backed by a Redis-protocol server. Update uses
+// WATCH/MULTI/EXEC and Take uses MULTI/GET/DEL, so no scripting or recent
+// server version is required.
+type RedisStore struct {
+	client *redis.Client
+	prefix string
+}
+
+// NewRedisStore validates config without connecting; connections are opened
+// on first use and pooled.
+func NewRedisStore(config RedisConfig) (*RedisStore, error) {
+	parsed, err := url.Parse(config.URL)
+	if err != nil {
+		return nil, fmt.Errorf("REDIS_URL: %w", err)
+	}
+	if parsed.Scheme != "redis" && parsed.Scheme != "rediss" {
+		return nil, fmt.Errorf("REDIS_URL: unsupported scheme %q", parsed.Scheme)
+	}
+	if parsed.Hostname() == "" {
+		return nil, errors.New("REDIS_URL: host is required")
+	}
+	options, err := redis.ParseURL(config.URL)
+	if err != nil {
+		return nil, fmt.Errorf("REDIS_URL: %w", err)
+	}
+
+	timeout := config.Timeout
+	if timeout <= 0 {
+		timeout = defaultRedisTimeout
+	}
+	maxIdle := config.MaxIdleConns
+	if maxIdle <= 0 {
+		maxIdle = defaultRedisMaxIdleConns
+	}
+	options.DialTimeout = timeout
+	options.ReadTimeout = timeout
+	options.WriteTimeout = timeout
+	options.ContextTimeoutEnabled = true
+	options.MaxIdleConns = maxIdle
+	options.MaxRetries = -1
+
+	prefix := config.KeyPrefix
+	if prefix == "" {
+		prefix = defaultKeyPrefix
+	}
+	return &RedisStore{client: redis.NewClient(options), prefix: prefix}, nil
+}
+
+func (s *RedisStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	value, err := s.client.Get(ctx, s.prefix+key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, failed("get", err)
+	}
+	return value, true, nil
+}
+
+func (s *RedisStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if err := s.client.Set(ctx, s.prefix+key, value, expiration(ttl)).Err(); err != nil {
+		return failed("set", err)
+	}
+	return nil
+}
+
+func (s *RedisStore) SetIfAbsent(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error) {
+	stored, err := s.client.SetNX(ctx, s.prefix+key, value, expiration(ttl)).Result()
+	if err != nil {
+		return false, failed("set", err)
+	}
+	return stored, nil
+}
+
+func (s *RedisStore) Delete(ctx context.Context, key string) error {
+	if err := s.client.Del(ctx, s.prefix+key).Err(); err != nil {
+		return failed("delete", err)
+	}
+	return nil
+}
+
+func (s *RedisStore) DeleteIf(ctx context.Context, key string, match func([]byte) bool) (bool, error) {
+	prefixed := s.prefix + key
+	for attempt := 0; attempt < maxUpdateAttempts; attempt++ {
+		deleted := false
+		err := s.client.Watch(ctx, func(tx *redis.Tx) (err error) {
+			executed := false
+			// As in Update, a WATCH must not outlive the call.
+			defer func() {
+				if !executed || (err != nil && !errors.Is(err, redis.TxFailedErr)) {
+					_ = tx.Unwatch(context.WithoutCancel(ctx)).Err()
+				}
+			}()
+
+			current, err := tx.Get(ctx, prefixed).Bytes()
+			if errors.Is(err, redis.Nil) {
+				return nil
+			}
+			if err != nil || !match(current) {
+				return err
+			}
+			executed = true
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.Del(ctx, prefixed)
+				return nil
+			})
+			deleted = err == nil
+			return err
+		}, prefixed)
+		switch {
+		case errors.Is(err, redis.TxFailedErr):
+			continue
+		case err != nil:
+			return false, failed("delete", err)
+		}
+		return deleted, nil
+	}
+	metrics.RecordSharedStateError("delete")
+	return false, ErrConflict
+}
+
+func (s *RedisStore) Take(ctx context.Context, key string) ([]byte, bool, error) {
+	var get *redis.StringCmd
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		get = pipe.Get(ctx, s.prefix+key)
+		pipe.Del(ctx, s.prefix+key)
+		return nil
+	})
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, false, failed("take", err)
+	}
+	value, err := get.Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, failed("take", err)
+	}
+	return value, true, nil
+}
+
+func (s *RedisStore) Update(ctx context.Context, key string, ttl time.Duration, fn func([]byte, bool) ([]byte, error)) ([]byte, error) {
+	prefixed := s.prefix + key
+	for attempt := 0; attempt < maxUpdateAttempts; attempt++ {
+		var next []byte
+		var fnErr error
+		err := s.client.Watch(ctx, func(tx *redis.Tx) (err error) {
+			// The connection goes back to the pool afterwards, so a WATCH
+			// left armed by an error would abort its next transaction.
+			// UNWATCH is sent even if ctx has ended; when it fails the
+			// connection is discarded instead.
+			defer func() {
+				if (err != nil && !errors.Is(err, redis.TxFailedErr)) || fnErr != nil {
+					_ = tx.Unwatch(context.WithoutCancel(ctx)).Err()
+				}
+			}()
+
+			current, err := tx.Get(ctx, prefixed).Bytes()
+			found := err == nil
+			if err != nil && !errors.Is(err, redis.Nil) {
+				return err
+			}
+			next, fnErr = fn(current, found)
+			if fnErr != nil {
+				return nil
+			}
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.Set(ctx, prefixed, next, expiration(ttl))
+				return nil
+			})
+			return err
+		}, prefixed)
+		switch {
+		case errors.Is(err, redis.TxFailedErr):
+			continue
+		case err != nil:
+			return nil, failed("update", err)
+		case fnErr != nil:
+			return nil, fnErr
+		}
+		return next, nil
+	}
+	metrics.RecordSharedStateError("update")
+	return nil, ErrConflict
+}
+
+// Close closes the connection pool.
+func (s *RedisStore) Close() error {
+	return s.client.Close()
+}
+
+func failed(operation string, err error) error {
+	metrics.RecordSharedStateError(operation)
+	return fmt.Errorf("shared state %s: %w", operation, err)
+}
+
+// expiration rounds ttl up to whole milliseconds, the server's resolution,
+// so a short positive ttl never turns into no expiry.
+func expiration(ttl time.Duration) time.Duration {
+	if ttl <= 0 {
+		return 0
+	}
+	return (ttl + time.Millisecond - 1) / time.Millisecond * time.Millisecond
+}
@@ -0,0 +1,65 @@
+// Package sharedstate holds state that every instance of a deployment must
+// see, such as rate-limit buckets and OAuth sessions.
+package sharedstate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+const defaultKeyPrefix = "homer:"
+
+// ErrConflict is returned by Update when other writers kept changing the key
+// and no attempt could be committed.
+var ErrConflict = errors.New("shared state update conflicted")
+
+// Store is a key-value store shared between instances. Implementations must
+// be safe for concurrent use.
+type Store interface {
+	// Get returns the value at key; found is false when it is missing or
+	// expired.
+	Get(ctx context.Context, key string) (value []byte, found bool, err error)
+	// Set stores value at key. A positive ttl expires it; zero keeps it.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// SetIfAbsent stores value at key, as in Set, unless key already holds a
+	// value, and reports whether it did.
+	SetIfAbsent(ctx context.Context, key string, value []byte, ttl time.Duration) (bool, error)
+	Delete(ctx context.Context, key string) error
+	// DeleteIf deletes key when match accepts its current value, atomically
+	// with respect to other writers, and reports whether it did. match may
+	// run more than once and must not have side effects.
+	DeleteIf(ctx context.Context, key string, match func(current []byte) bool) (bool, error)
+	// Take returns the value at key and deletes it in one step, so only one
+	// caller can take it.
+	Take(ctx context.Context, key string) (value []byte, found bool, err error)
+	// Update replaces the value at key with what fn returns for the current
+	// one, atomically with respect to other writers, and sets ttl as in Set.
+	// fn may run more than once and must not have side effects.
+	Update(ctx context.Context, key string, ttl time.Duration, fn func(current []byte, found bool) ([]byte, error)) ([]byte, error)
+}
+
+// NewStoreFromEnv reads SHARED_STATE_STORE. "memory" (the default) returns
+// nil: callers keep state in process memory, which suits a single instance.
+// "redis" returns a RedisStore configured by RedisConfigFromEnv.
+func NewStoreFromEnv() (Store, error) {
+	switch backend := strings.ToLower(strings.TrimSpace(os.Getenv("SHARED_STATE_STORE"))); backend {
+	case "", "memory":
+		return nil, nil
+	case "redis":
+		config, err := RedisConfigFromEnv()
+		if err != nil {
+			return nil, err
+		}
+		store, err := NewRedisStore(config)
+		if err != nil {
+			return nil, err
+		}
+		return store, nil
+	default:
+		return nil, fmt.Errorf("unsupported SHARED_STATE_STORE %q", backend)
+	}
+}
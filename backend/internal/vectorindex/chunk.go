@@ -0,0 +1,61 @@
+package vectorindex
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Chunk splits text into pieces of at most size runes, overlapping by
+// overlap runes. Cuts prefer the last paragraph break, sentence end or
+// whitespace in the second half of a window so chunks rarely split words.
+func Chunk(text string, size int, overlap int) []string {
+	runes := []rune(strings.TrimSpace(text))
+	if len(runes) == 0 {
+		return nil
+	}
+	if size <= 0 || len(runes) <= size {
+		return []string{string(runes)}
+	}
+	if overlap < 0 || overlap >= size/2 {
+		overlap = 0
+	}
+
+	chunks := make([]string, 0, len(runes)/size+1)
+	for start := 0; start < len(runes); {
+		end := min(start+size, len(runes))
+		if end < len(runes) {
+			end = start + cutPoint(runes[start:end])
+		}
+		if piece := strings.TrimSpace(string(runes[start:end])); piece != "" {
+			chunks = append(chunks, piece)
+		}
+		if end >= len(runes) {
+			break
+		}
+		start = max(end-overlap, start+1)
+	}
+	return chunks
+}
+
+func cutPoint(window []rune) int {
+	half := len(window) / 2
+	best := -1
+	for _, boundary := range []func(int) bool{
+		func(i int) bool { return window[i] == '\n' && i > 0 && window[i-1] == '\n' },
+		func(i int) bool {
+			return (window[i] == '.' || window[i] == '!' || window[i] == '?') && i+1 < len(window) && unicode.IsSpace(window[i+1])
+		},
+		func(i int) bool { return unicode.IsSpace(window[i]) },
+	} {
+		for i := len(window) - 1; i >= half; i-- {
+			if boundary(i) {
+				best = i + 1
+				break
+			}
+		}
+		if best > 0 {
+			return best
+		}
+	}
+	return len(window)
+}
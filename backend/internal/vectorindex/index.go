@@ -0,0 +1,241 @@
+// Package vectorindex is a small in-memory vector store with cosine
+// similarity search. An index holds vectors from a single embedding model,
+// not the text they were computed from, and can be saved to and loaded from
+// a JSON file.
+package vectorindex
+
+import (
+	"container/list"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+const fileVersion = 1
+
+var ErrDimensionMismatch = errors.New("vector dimensions do not match index")
+
+type Entry struct {
+	ID         string    `json:"id"`
+	DocumentID string    `json:"documentId,omitempty"`
+	Vector     []float32 `json:"vector"`
+}
+
+type Result struct {
+	Entry
+	Score float64 `json:"score"`
+}
+
+// Index is safe for concurrent use.
+type Index struct {
+	mu         sync.Mutex
+	model      string
+	dimensions int
+	maxEntries int
+	entries    map[string]*list.Element
+	recency    *list.List
+}
+
+type indexFile struct {
+	Version    int     `json:"version"`
+	Model      string  `json:"model"`
+	Dimensions int     `json:"dimensions"`
+	Entries    []Entry `json:"entries"`
+}
+
+// New returns an empty index for vectors produced by model. The dimension is
+// fixed by the first vector added.
+func New(model string) *Index {
+	return &Index{model: model, entries: make(map[string]*list.Element), recency: list.New()}
+}
+
+// SetMaxEntries bounds the index to n entries, evicting the least recently
+// added or read ones. Zero removes the bound.
+func (i *Index) SetMaxEntries(n int) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.maxEntries = max(n, 0)
+	i.evictLocked()
+}
+
+func (i *Index) Model() string {
+	return i.model
+}
+
+func (i *Index) Len() int {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	return len(i.entries)
+}
+
+// Upsert adds entries, replacing any with the same ID.
+func (i *Index) Upsert(entries ...Entry) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	for _, entry := range entries {
+		if entry.ID == "" {
+			return errors.New("vector index entry requires an id")
+		}
+		if len(entry.Vector) == 0 {
+			return fmt.Errorf("vector index entry %s has no vector", entry.ID)
+		}
+		if i.dimensions == 0 {
+			i.dimensions = len(entry.Vector)
+		}
+		if len(entry.Vector) != i.dimensions {
+			return fmt.Errorf("%w: entry %s has %d, index has %d", ErrDimensionMismatch, entry.ID, len(entry.Vector), i.dimensions)
+		}
+		if element, ok := i.entries[entry.ID]; ok {
+			element.Value = entry
+			i.recency.MoveToFront(element)
+			continue
+		}
+		i.entries[entry.ID] = i.recency.PushFront(entry)
+	}
+	i.evictLocked()
+	return nil
+}
+
+func (i *Index) Get(id string) (Entry, bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	element, ok := i.entries[id]
+	if !ok {
+		return Entry{}, false
+	}
+	i.recency.MoveToFront(element)
+	return element.Value.(Entry), true
+}
+
+func (i *Index) Delete(ids ...string) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	for _, id := range ids {
+		if element, ok := i.entries[id]; ok {
+			i.removeLocked(element)
+		}
+	}
+}
+
+func (i *Index) evictLocked() {
+	for i.maxEntries > 0 && len(i.entries) > i.maxEntries {
+		i.removeLocked(i.recency.Back())
+	}
+}
+
+func (i *Index) removeLocked(element *list.Element) {
+	i.recency.Remove(element)
+	delete(i.entries, element.Value.(Entry).ID)
+	if len(i.entries) == 0 {
+		i.dimensions = 0
+	}
+}
+
+// Search returns up to k entries ranked by cosine similarity to query. When
+// filter is non-nil only entries it accepts are considered. Ties are broken
+// by ID so results are stable.
+func (i *Index) Search(query []float32, k int, filter func(Entry) bool) ([]Result, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if k <= 0 || len(i.entries) == 0 {
+		return nil, nil
+	}
+	if len(query) != i.dimensions {
+		return nil, fmt.Errorf("%w: query has %d, index has %d", ErrDimensionMismatch, len(query), i.dimensions)
+	}
+
+	results := make([]Result, 0, len(i.entries))
+	for _, element := range i.entries {
+		entry := element.Value.(Entry)
+		if filter != nil && !filter(entry) {
+			continue
+		}
+		results = append(results, Result{Entry: entry, Score: Cosine(query, entry.Vector)})
+	}
+	sort.Slice(results, func(a, b int) bool {
+		if results[a].Score != results[b].Score {
+			return results[a].Score > results[b].Score
+		}
+		return results[a].ID < results[b].ID
+	})
+	if len(results) > k {
+		results = results[:k]
+	}
+	return results, nil
+}
+
+// Cosine returns the cosine similarity of a and b, or 0 when either is a zero
+// vector or the lengths differ.
+func Cosine(a, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot, normA, normB float64
+	for idx := range a {
+		dot += float64(a[idx]) * float64(b[idx])
+		normA += float64(a[idx]) * float64(a[idx])
+		normB += float64(b[idx]) * float64(b[idx])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+// Save writes the index to path atomically.
+func (i *Index) Save(path string) error {
+	i.mu.Lock()
+	file := indexFile{Version: fileVersion, Model: i.model, Dimensions: i.dimensions, Entries: make([]Entry, 0, len(i.entries))}
+	for _, element := range i.entries {
+		file.Entries = append(file.Entries, element.Value.(Entry))
+	}
+	i.mu.Unlock()
+
+	sort.Slice(file.Entries, func(a, b int) bool { return file.Entries[a].ID < file.Entries[b].ID })
+	encoded, err := json.Marshal(file)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("save vector index: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, encoded, 0o600); err != nil {
+		return fmt.Errorf("save vector index: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("save vector index: %w", err)
+	}
+	return nil
+}
+
+// Load reads an index written by Save. A missing file is reported with an
+// error matching os.ErrNotExist.
+func Load(path string) (*Index, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file indexFile
+	if err := json.Unmarshal(raw, &file); err != nil {
+		return nil, fmt.Errorf("load vector index %s: %w", path, err)
+	}
+	if file.Version != fileVersion {
+		return nil, fmt.Errorf("load vector index %s: unsupported version %d", path, file.Version)
+	}
+
+	index := New(file.Model)
+	if err := index.Upsert(file.Entries...); err != nil {
+		return nil, fmt.Errorf("load vector index %s: %w", path, err)
+	}
+	return index, nil
+}
@@ -0,0 +1,125 @@
+package vectorindex
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIndexSearchRanksByCosineSimilarity(t *testing.T) {
+	index := New("test-model")
+	if err := index.Upsert(
+		Entry{ID: "east", DocumentID: "d1", Vector: []float32{1, 0}},
+		Entry{ID: "north", DocumentID: "d1", Vector: []float32{0, 1}},
+		Entry{ID: "north-east", DocumentID: "d2", Vector: []float32{1, 1}},
+	); err != nil {
+		t.Fatalf("Upsert returned error: %v", err)
+	}
+
+	results, err := index.Search([]float32{2, 0.1}, 2, nil)
+	if err != nil {
+		t.Fatalf("Search returned error: %v", err)
+	}
+	if len(results) != 2 || results[0].ID != "east" || results[1].ID != "north-east" {
+		t.Fatalf("unexpected ranking %+v", results)
+	}
+	if results[0].Score <= results[1].Score {
+		t.Fatalf("expected descending scores, got %+v", results)
+	}
+
+	filtered, err := index.Search([]float32{2, 0.1}, 5, func(entry Entry) bool { return entry.DocumentID == "d2" })
+	if err != nil {
+		t.Fatalf("Search returned error: %v", err)
+	}
+	if len(filtered) != 1 || filtered[0].ID != "north-east" {
+		t.Fatalf("expected filter to keep only d2, got %+v", filtered)
+	}
+}
+
+func TestIndexRejectsDimensionMismatch(t *testing.T) {
+	index := New("test-model")
+	if err := index.Upsert(Entry{ID: "a", Vector: []float32{1, 0, 0}}); err != nil {
+		t.Fatalf("Upsert returned error: %v", err)
+	}
+
+	if err := index.Upsert(Entry{ID: "b", Vector: []float32{1, 0}}); !errors.Is(err, ErrDimensionMismatch) {
+		t.Fatalf("expected ErrDimensionMismatch on upsert, got %v", err)
+	}
+	if _, err := index.Search([]float32{1, 0}, 1, nil); !errors.Is(err, ErrDimensionMismatch) {
+		t.Fatalf("expected ErrDimensionMismatch on search, got %v", err)
+	}
+}
+
+func TestIndexSaveAndLoadRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "index.json")
+	index := New("test-model")
+	if err := index.Upsert(
+		Entry{ID: "a", DocumentID: "d1", Vector: []float32{0.5, 0.25}},
+		Entry{ID: "b", DocumentID: "d2", Vector: []float32{0, 1}},
+	); err != nil {
+		t.Fatalf("Upsert returned error: %v", err)
+	}
+	if err := index.Save(path); err != nil {
+		t.Fatalf("Save returned error: %v", err)
+	}
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	}
+	if loaded.Model() != "test-model" || loaded.Len() != 2 {
+		t.Fatalf("unexpected loaded index model=%s len=%d", loaded.Model(), loaded.Len())
+	}
+	entry, ok := loaded.Get("a")
+	if !ok || entry.DocumentID != "d1" || entry.Vector[1] != 0.25 {
+		t.Fatalf("unexpected loaded entry %+v", entry)
+	}
+
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.json")); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("expected os.ErrNotExist for a missing index, got %v", err)
+	}
+}
+
+func TestIndexEvictsLeastRecentlyUsedEntries(t *testing.T) {
+	index := New("test-model")
+	index.SetMaxEntries(2)
+	if err := index.Upsert(Entry{ID: "a", Vector: []float32{1, 0}}, Entry{ID: "b", Vector: []float32{0, 1}}); err != nil {
+		t.Fatalf("Upsert returned error: %v", err)
+	}
+	if _, ok := index.Get("a"); !ok {
+		t.Fatalf("expected a to be indexed")
+	}
+	if err := index.Upsert(Entry{ID: "c", Vector: []float32{1, 1}}); err != nil {
+		t.Fatalf("Upsert returned error: %v", err)
+	}
+
+	if _, ok := index.Get("b"); ok || index.Len() != 2 {
+		t.Fatalf("expected b to be evicted, len=%d", index.Len())
+	}
+	if _, ok := index.Get("a"); !ok {
+		t.Fatalf("expected the recently read entry to stay")
+	}
+}
+
+func TestChunkPrefersNaturalBoundaries(t *testing.T) {
+	text := strings.Repeat("Alpha beta gamma. ", 10) + "\n\n" + strings.Repeat("Delta epsilon zeta. ", 10)
+
+	chunks := Chunk(text, 200, 20)
+	if len(chunks) < 2 {
+		t.Fatalf("expected several chunks, got %d", len(chunks))
+	}
+	for _, chunk := range chunks {
+		if len([]rune(chunk)) > 200 {
+			t.Fatalf("chunk exceeds size: %d runes", len([]rune(chunk)))
+		}
+		if !strings.HasSuffix(chunk, ".") {
+			t.Fatalf("expected chunk to end on a sentence boundary, got %q", chunk)
+		}
+	}
+
+	if got := Chunk("  short text  ", 200, 20); len(got) != 1 || got[0] != "short text" {
+		t.Fatalf("expected short text as a single chunk, got %q", got)
+	}
+}
@@ -0,0 +1,61 @@
+package webhooks
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+const defaultDeadLetterLimit = 1000
+
+// DeadLetter is a callback that could not be delivered.
+type DeadLetter struct {
+	ID        string          `json:"id"`
+	URL       string          `json:"url"`
+	Event     string          `json:"event"`
+	RequestID string          `json:"requestId,omitempty"`
+	JobID     string          `json:"jobId,omitempty"`
+	Body      json.RawMessage `json:"body"`
+	Attempts  int             `json:"attempts"`
+	LastError string          `json:"lastError"`
+	FailedAt  time.Time       `json:"failedAt"`
+}
+
+// DeadLetterStore keeps callbacks that exhausted their retries.
+type DeadLetterStore interface {
+	Add(ctx context.Context, letter DeadLetter) error
+	List(ctx context.Context) ([]DeadLetter, error)
+}
+
+// MemoryDeadLetterStore keeps the most recent dead letters in memory,
+// dropping the oldest beyond its limit.
+type MemoryDeadLetterStore struct {
+	mu      sync.Mutex
+	limit   int
+	letters []DeadLetter
+}
+
+func NewMemoryDeadLetterStore(limit int) *MemoryDeadLetterStore {
+	if limit <= 0 {
+		limit = defaultDeadLetterLimit
+	}
+	return &MemoryDeadLetterStore{limit: limit}
+}
+
+func (s *MemoryDeadLetterStore) Add(_ context.Context, letter DeadLetter) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.letters = append(s.letters, letter)
+	if overflow := len(s.letters) - s.limit; overflow > 0 {
+		s.letters = append([]DeadLetter(nil), s.letters[overflow:]...)
+	}
+	return nil
+}
+
+// List returns the stored dead letters, oldest first.
+func (s *MemoryDeadLetterStore) List(_ context.Context) ([]DeadLetter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]DeadLetter{}, s.letters...), nil
+}
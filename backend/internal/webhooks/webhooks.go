@@ -0,0 +1,407 @@
+// Package webhooks delivers signed task-completion callbacks.
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/alanmaizon/homer/backend/internal/metrics"
+	"github.com/google/uuid"
+)
+
+const (
+	SignatureHeader = "X-Homer-Signature"
+	EventHeader     = "X-Homer-Event"
+	JobIDHeader     = "X-Homer-Job-Id"
+
+	EventTaskSucceeded = "task.succeeded"
+	EventTaskFailed    = "task.failed"
+
+	defaultMaxAttempts      = 5
+	defaultInitialBackoffMs = 1000
+	defaultMaxBackoffMs     = 60000
+	defaultTimeoutMs        = 10000
+
+	maxErrorBodyBytes = 512
+)
+
+var (
+	ErrCallbacksDisabled  = errors.New("callbacks are disabled because WEBHOOK_SECRET is not set")
+	ErrInvalidCallbackURL = errors.New("invalid callback URL")
+	ErrInvalidSignature   = errors.New("invalid webhook signature")
+	ErrForbiddenAddress   = errors.New("callback address is not publicly routable")
+	ErrDispatcherClosed   = errors.New("webhook dispatcher is closed")
+)
+
+type Config struct {
+	Secret         string
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Timeout        time.Duration
+	AllowedHosts   []string
+	// AllowPrivateNetworks lets callbacks reach loopback, private and
+	// link-local addresses.
+	AllowPrivateNetworks bool
+}
+
+// ConfigFromEnv reads WEBHOOK_SECRET, WEBHOOK_MAX_ATTEMPTS,
+// WEBHOOK_INITIAL_BACKOFF_MS, WEBHOOK_MAX_BACKOFF_MS, WEBHOOK_TIMEOUT_MS,
+// WEBHOOK_ALLOWED_HOSTS and WEBHOOK_ALLOW_PRIVATE_NETWORKS.
+func ConfigFromEnv() Config {
+	allowPrivate, _ := strconv.ParseBool(strings.TrimSpace(os.Getenv("WEBHOOK_ALLOW_PRIVATE_NETWORKS")))
+	config := Config{
+		Secret:         strings.TrimSpace(os.Getenv("WEBHOOK_SECRET")),
+		MaxAttempts:    positiveIntFromEnv("WEBHOOK_MAX_ATTEMPTS", defaultMaxAttempts),
+		InitialBackoff: time.Duration(positiveIntFromEnv("WEBHOOK_INITIAL_BACKOFF_MS", defaultInitialBackoffMs)) * time.Millisecond,
+		MaxBackoff:     time.Duration(positiveIntFromEnv("WEBHOOK_MAX_BACKOFF_MS", defaultMaxBackoffMs)) * time.Millisecond,
+		Timeout:        time.Duration(positiveIntFromEnv("WEBHOOK_TIMEOUT_MS", defaultTimeoutMs)) * time.Millisecond,
+
+		AllowPrivateNetworks: allowPrivate,
+	}
+	for _, host := range strings.Split(os.Getenv("WEBHOOK_ALLOWED_HOSTS"), ",") {
+		if host = strings.ToLower(strings.TrimSpace(host)); host != "" {
+			config.AllowedHosts = append(config.AllowedHosts, host)
+		}
+	}
+	return config
+}
+
+type Delivery struct {
+	URL       string
+	Event     string
+	RequestID string
+	JobID     string
+	Body      []byte
+}
+
+// Dispatcher posts callbacks with exponential backoff and dead-letters the
+// ones that never succeed.
+type Dispatcher struct {
+	config      Config
+	client      *http.Client
+	deadLetters DeadLetterStore
+	now         func() time.Time
+	sleep       func(ctx context.Context, d time.Duration) error
+
+	base     context.Context
+	stop     context.CancelFunc
+	mu       sync.Mutex
+	closed   bool
+	inFlight sync.WaitGroup
+}
+
+func NewDispatcher(config Config, deadLetters DeadLetterStore) *Dispatcher {
+	base, stop := context.WithCancel(context.Background())
+	return &Dispatcher{
+		config:      config,
+		client:      newClient(config.AllowPrivateNetworks),
+		deadLetters: deadLetters,
+		now:         time.Now,
+		sleep:       sleepContext,
+		base:        base,
+		stop:        stop,
+	}
+}
+
+func NewDispatcherFromEnv() *Dispatcher {
+	return NewDispatcher(ConfigFromEnv(), NewMemoryDeadLetterStore(positiveIntFromEnv("WEBHOOK_DEAD_LETTER_LIMIT", defaultDeadLetterLimit)))
+}
+
+func (d *Dispatcher) DeadLetters() DeadLetterStore {
+	return d.deadLetters
+}
+
+func (d *Dispatcher) ValidateURL(raw string) error {
+	if d.config.Secret == "" {
+		return ErrCallbacksDisabled
+	}
+	parsed, err := url.Parse(raw)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("%w: must be an absolute http or https URL", ErrInvalidCallbackURL)
+	}
+	host := strings.ToLower(parsed.Hostname())
+	if !d.config.AllowPrivateNetworks {
+		if addr, err := netip.ParseAddr(host); host == "localhost" || (err == nil && forbiddenAddress(addr)) {
+			return fmt.Errorf("%w: host %q is not publicly routable", ErrInvalidCallbackURL, host)
+		}
+	}
+	if len(d.config.AllowedHosts) == 0 {
+		return nil
+	}
+	for _, allowed := range d.config.AllowedHosts {
+		if host == allowed {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: host %q is not in WEBHOOK_ALLOWED_HOSTS", ErrInvalidCallbackURL, host)
+}
+
+// Send delivers in the background. After Close the delivery is
+// dead-lettered without being attempted.
+func (d *Dispatcher) Send(delivery Delivery) {
+	d.mu.Lock()
+	closed := d.closed
+	if !closed {
+		d.inFlight.Add(1)
+	}
+	d.mu.Unlock()
+	if closed {
+		metrics.RecordWebhookDelivery("dead_lettered")
+		d.deadLetter(delivery, 0, ErrDispatcherClosed)
+		return
+	}
+	go func() {
+		defer d.inFlight.Done()
+		d.Deliver(d.base, delivery)
+	}()
+}
+
+// Close waits for in-flight deliveries, retries included, until ctx ends;
+// the rest are canceled and dead-lettered.
+func (d *Dispatcher) Close(ctx context.Context) {
+	d.mu.Lock()
+	d.closed = true
+	d.mu.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		d.inFlight.Wait()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		d.stop()
+		<-drained
+	}
+	d.stop()
+}
+
+// Deliver posts delivery with retries and reports whether it was delivered.
+func (d *Dispatcher) Deliver(ctx context.Context, delivery Delivery) bool {
+	backoff := d.config.InitialBackoff
+	attempts := max(d.config.MaxAttempts, 1)
+	var (
+		lastErr error
+		made    int
+	)
+	for attempt := 1; attempt <= attempts; attempt++ {
+		made = attempt
+		started := d.now()
+		status, err := d.attempt(ctx, delivery)
+		retryable := err != nil && retryableDelivery(status) && !errors.Is(err, ErrForbiddenAddress)
+		d.logAttempt(delivery, attempt, status, started, err)
+		if err == nil {
+			metrics.RecordWebhookDelivery("delivered")
+			return true
+		}
+		lastErr = err
+		if !retryable || attempt == attempts {
+			break
+		}
+		if err := d.sleep(ctx, backoff); err != nil {
+			lastErr = fmt.Errorf("%w (retry abandoned: %v)", lastErr, err)
+			break
+		}
+		backoff = min(backoff*2, d.config.MaxBackoff)
+	}
+
+	metrics.RecordWebhookDelivery("dead_lettered")
+	d.deadLetter(delivery, made, lastErr)
+	return false
+}
+
+func (d *Dispatcher) attempt(ctx context.Context, delivery Delivery) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.config.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, delivery.Event)
+	req.Header.Set(SignatureHeader, Sign([]byte(d.config.Secret), d.now(), delivery.Body))
+	if delivery.RequestID != "" {
+		req.Header.Set("X-Request-Id", delivery.RequestID)
+	}
+	if delivery.JobID != "" {
+		req.Header.Set(JobIDHeader, delivery.JobID)
+	}
+
+	res, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer res.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(res.Body, maxErrorBodyBytes))
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return res.StatusCode, fmt.Errorf("receiver returned %d: %s", res.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return res.StatusCode, nil
+}
+
+func (d *Dispatcher) logAttempt(delivery Delivery, attempt int, status int, started time.Time, err error) {
+	result := "delivered"
+	errText := ""
+	if err != nil {
+		result = "failed"
+		errText = err.Error()
+	}
+	log.Printf(
+		"request_id=%s component=webhook event=%s job_id=%s attempt=%d status=%s http_status=%d duration_ms=%d error=%q",
+		delivery.RequestID,
+		delivery.Event,
+		delivery.JobID,
+		attempt,
+		result,
+		status,
+		d.now().Sub(started).Milliseconds(),
+		errText,
+	)
+}
+
+func (d *Dispatcher) deadLetter(delivery Delivery, attempts int, err error) {
+	letter := DeadLetter{
+		ID:        uuid.NewString(),
+		URL:       delivery.URL,
+		Event:     delivery.Event,
+		RequestID: delivery.RequestID,
+		JobID:     delivery.JobID,
+		Body:      append([]byte(nil), delivery.Body...),
+		Attempts:  attempts,
+		LastError: err.Error(),
+		FailedAt:  d.now(),
+	}
+	if storeErr := d.deadLetters.Add(context.Background(), letter); storeErr != nil {
+		log.Printf("request_id=%s component=webhook event=dead_letter_failed error=%q", delivery.RequestID, storeErr.Error())
+		return
+	}
+	log.Printf("request_id=%s component=webhook event=dead_lettered dead_letter_id=%s attempts=%d", delivery.RequestID, letter.ID, attempts)
+}
+
+// newClient does not follow redirects and, unless allowPrivate is set,
+// checks the resolved address at dial time so DNS names pointing inside the
+// network are refused too. That is also why callbacks bypass HTTP proxies.
+func newClient(allowPrivate bool) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if !allowPrivate {
+		dialer := &net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+			Control:   refuseForbiddenAddress,
+		}
+		transport.Proxy = nil
+		transport.DialContext = dialer.DialContext
+	}
+	return &http.Client{
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+func refuseForbiddenAddress(_ string, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	if forbiddenAddress(addr) {
+		return fmt.Errorf("%w: %s", ErrForbiddenAddress, addr)
+	}
+	return nil
+}
+
+func forbiddenAddress(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() ||
+		addr.IsLinkLocalMulticast() || addr.IsUnspecified()
+}
+
+// retryableDelivery treats status 0 as a network error.
+func retryableDelivery(status int) bool {
+	return status == 0 || status == http.StatusRequestTimeout || status == http.StatusTooManyRequests || status >= 500
+}
+
+// Sign returns the X-Homer-Signature value for body sent at timestamp:
+// "t=<unix seconds>,v1=<hex HMAC-SHA256 of "<t>.<body>">".
+func Sign(secret []byte, timestamp time.Time, body []byte) string {
+	unix := strconv.FormatInt(timestamp.Unix(), 10)
+	return "t=" + unix + ",v1=" + signature(secret, unix, body)
+}
+
+// Verify also rejects timestamps more than tolerance from now, so
+// receivers can refuse replayed callbacks.
+func Verify(secret []byte, header string, body []byte, now time.Time, tolerance time.Duration) error {
+	var unix, provided string
+	for _, part := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch key {
+		case "t":
+			unix = value
+		case "v1":
+			provided = value
+		}
+	}
+	seconds, err := strconv.ParseInt(unix, 10, 64)
+	if err != nil || provided == "" {
+		return fmt.Errorf("%w: malformed header", ErrInvalidSignature)
+	}
+	if skew := now.Sub(time.Unix(seconds, 0)); skew > tolerance || skew < -tolerance {
+		return fmt.Errorf("%w: timestamp outside tolerance", ErrInvalidSignature)
+	}
+	if !hmac.Equal([]byte(provided), []byte(signature(secret, unix, body))) {
+		return fmt.Errorf("%w: signature mismatch", ErrInvalidSignature)
+	}
+	return nil
+}
+
+func signature(secret []byte, unix string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(unix))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func positiveIntFromEnv(key string, fallback int) int {
+	value, err := strconv.Atoi(strings.TrimSpace(os.Getenv(key)))
+	if err != nil || value <= 0 {
+		return fallback
+	}
+	return value
+}
@@ -0,0 +1,245 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var testSecret = []byte("shh")
+
+type receiver struct {
+	mu       sync.Mutex
+	statuses []int
+	bodies   [][]byte
+	headers  []http.Header
+}
+
+func (r *receiver) handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.bodies = append(r.bodies, body)
+		r.headers = append(r.headers, req.Header.Clone())
+		status := http.StatusOK
+		if len(r.bodies) <= len(r.statuses) {
+			status = r.statuses[len(r.bodies)-1]
+		}
+		w.WriteHeader(status)
+	}
+}
+
+// newTestDispatcher allows private networks since test receivers listen on
+// loopback.
+func newTestDispatcher(config Config) (*Dispatcher, *[]time.Duration) {
+	config.Secret = string(testSecret)
+	config.AllowPrivateNetworks = true
+	if config.MaxAttempts == 0 {
+		config.MaxAttempts = 3
+	}
+	if config.InitialBackoff == 0 {
+		config.InitialBackoff = time.Second
+	}
+	if config.MaxBackoff == 0 {
+		config.MaxBackoff = time.Minute
+	}
+	if config.Timeout == 0 {
+		config.Timeout = time.Second
+	}
+	dispatcher := NewDispatcher(config, NewMemoryDeadLetterStore(0))
+	sleeps := make([]time.Duration, 0)
+	dispatcher.sleep = func(_ context.Context, d time.Duration) error {
+		sleeps = append(sleeps, d)
+		return nil
+	}
+	return dispatcher, &sleeps
+}
+
+func TestDeliverSignsAndRetriesWithBackoff(t *testing.T) {
+	rec := &receiver{statuses: []int{http.StatusServiceUnavailable, http.StatusTooManyRequests}}
+	server := httptest.NewServer(rec.handler())
+	t.Cleanup(server.Close)
+
+	dispatcher, sleeps := newTestDispatcher(Config{MaxAttempts: 5})
+	delivered := dispatcher.Deliver(context.Background(), Delivery{
+		URL:       server.URL,
+		Event:     EventTaskSucceeded,
+		RequestID: "req-1",
+		JobID:     "job-1",
+		Body:      []byte(`{"result":"done"}`),
+	})
+	if !delivered {
+		t.Fatalf("expected the third attempt to be delivered")
+	}
+	if len(rec.bodies) != 3 {
+		t.Fatalf("expected 3 attempts, got %d", len(rec.bodies))
+	}
+	if want := []time.Duration{time.Second, 2 * time.Second}; len(*sleeps) != 2 || (*sleeps)[0] != want[0] || (*sleeps)[1] != want[1] {
+		t.Fatalf("expected backoff %v, got %v", want, *sleeps)
+	}
+
+	header := rec.headers[2]
+	if header.Get(EventHeader) != EventTaskSucceeded || header.Get("X-Request-Id") != "req-1" || header.Get(JobIDHeader) != "job-1" {
+		t.Fatalf("unexpected headers %v", header)
+	}
+	if err := Verify(testSecret, header.Get(SignatureHeader), rec.bodies[2], time.Now(), time.Minute); err != nil {
+		t.Fatalf("signature did not verify: %v", err)
+	}
+	letters, _ := dispatcher.DeadLetters().List(context.Background())
+	if len(letters) != 0 {
+		t.Fatalf("expected no dead letters, got %+v", letters)
+	}
+}
+
+func TestDeliverDeadLettersFailures(t *testing.T) {
+	rec := &receiver{statuses: []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway, http.StatusBadRequest}}
+	server := httptest.NewServer(rec.handler())
+	t.Cleanup(server.Close)
+
+	dispatcher, sleeps := newTestDispatcher(Config{MaxAttempts: 3, InitialBackoff: time.Second, MaxBackoff: time.Second})
+	if dispatcher.Deliver(context.Background(), Delivery{URL: server.URL, Event: EventTaskFailed, Body: []byte(`{}`)}) {
+		t.Fatalf("expected delivery to fail after retries")
+	}
+	if len(*sleeps) != 2 || (*sleeps)[1] != time.Second {
+		t.Fatalf("expected backoff capped at 1s, got %v", *sleeps)
+	}
+
+	// Client errors other than 408 and 429 are not retried.
+	if dispatcher.Deliver(context.Background(), Delivery{URL: server.URL, Event: EventTaskFailed, Body: []byte(`{}`)}) {
+		t.Fatalf("expected delivery to fail")
+	}
+	if len(rec.bodies) != 4 {
+		t.Fatalf("expected a single attempt for a 400, got %d attempts in total", len(rec.bodies))
+	}
+
+	letters, _ := dispatcher.DeadLetters().List(context.Background())
+	if len(letters) != 2 || letters[0].Attempts != 3 || letters[1].Attempts != 1 || letters[1].LastError == "" {
+		t.Fatalf("unexpected dead letters %+v", letters)
+	}
+}
+
+func TestCloseDrainsRetriesUntilDeadline(t *testing.T) {
+	rec := &receiver{statuses: []int{http.StatusServiceUnavailable}}
+	server := httptest.NewServer(rec.handler())
+	t.Cleanup(server.Close)
+
+	dispatcher, _ := newTestDispatcher(Config{InitialBackoff: 10 * time.Millisecond})
+	dispatcher.sleep = sleepContext
+	dispatcher.Send(Delivery{URL: server.URL, Event: EventTaskSucceeded, Body: []byte(`{}`)})
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	dispatcher.Close(ctx)
+	if letters, _ := dispatcher.DeadLetters().List(context.Background()); len(rec.bodies) != 2 || len(letters) != 0 {
+		t.Fatalf("expected the retry to be delivered before Close returned, got %d attempts and dead letters %+v", len(rec.bodies), letters)
+	}
+
+	dispatcher.Send(Delivery{URL: server.URL, Event: EventTaskSucceeded, Body: []byte(`{}`)})
+	letters, _ := dispatcher.DeadLetters().List(context.Background())
+	if len(letters) != 1 || letters[0].LastError != ErrDispatcherClosed.Error() {
+		t.Fatalf("expected a delivery after Close to be dead-lettered, got %+v", letters)
+	}
+
+	rec = &receiver{statuses: []int{http.StatusServiceUnavailable}}
+	slow := httptest.NewServer(rec.handler())
+	t.Cleanup(slow.Close)
+	dispatcher, _ = newTestDispatcher(Config{InitialBackoff: time.Minute})
+	dispatcher.sleep = sleepContext
+	dispatcher.Send(Delivery{URL: slow.URL, Event: EventTaskSucceeded, Body: []byte(`{}`)})
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	dispatcher.Close(ctx)
+	letters, _ = dispatcher.DeadLetters().List(context.Background())
+	if len(letters) != 1 || !strings.Contains(letters[0].LastError, "retry abandoned") {
+		t.Fatalf("expected the pending retry to be dead-lettered at the deadline, got %+v", letters)
+	}
+}
+
+func TestVerifyRejectsTamperingAndStaleTimestamps(t *testing.T) {
+	sent := time.Unix(1700000000, 0)
+	header := Sign(testSecret, sent, []byte(`{"a":1}`))
+
+	if err := Verify(testSecret, header, []byte(`{"a":1}`), sent.Add(10*time.Second), time.Minute); err != nil {
+		t.Fatalf("expected signature to verify, got %v", err)
+	}
+	for name, check := range map[string]error{
+		"body":   Verify(testSecret, header, []byte(`{"a":2}`), sent, time.Minute),
+		"secret": Verify([]byte("other"), header, []byte(`{"a":1}`), sent, time.Minute),
+		"stale":  Verify(testSecret, header, []byte(`{"a":1}`), sent.Add(2*time.Minute), time.Minute),
+		"format": Verify(testSecret, "v1=abc", []byte(`{"a":1}`), sent, time.Minute),
+	} {
+		if !errors.Is(check, ErrInvalidSignature) {
+			t.Fatalf("%s: expected ErrInvalidSignature, got %v", name, check)
+		}
+	}
+}
+
+func TestValidateURL(t *testing.T) {
+	if err := NewDispatcher(Config{}, NewMemoryDeadLetterStore(0)).ValidateURL("https://example.com/hook"); !errors.Is(err, ErrCallbacksDisabled) {
+		t.Fatalf("expected ErrCallbacksDisabled without a secret, got %v", err)
+	}
+
+	dispatcher, _ := newTestDispatcher(Config{AllowedHosts: []string{"hooks.example.com"}})
+	if err := dispatcher.ValidateURL("https://hooks.example.com/done"); err != nil {
+		t.Fatalf("expected allowed host to validate, got %v", err)
+	}
+	for _, raw := range []string{"ftp://hooks.example.com/done", "/relative", "https://evil.example.com/done"} {
+		if err := dispatcher.ValidateURL(raw); !errors.Is(err, ErrInvalidCallbackURL) {
+			t.Fatalf("%s: expected ErrInvalidCallbackURL, got %v", raw, err)
+		}
+	}
+}
+
+func TestValidateURLRefusesPrivateAddresses(t *testing.T) {
+	dispatcher := NewDispatcher(Config{Secret: string(testSecret)}, NewMemoryDeadLetterStore(0))
+	for _, raw := range []string{"http://127.0.0.1:8080/hook", "http://localhost/hook", "http://10.0.0.5/hook", "http://169.254.169.254/latest", "http://[::1]/hook", "http://[::ffff:192.168.1.1]/hook"} {
+		if err := dispatcher.ValidateURL(raw); !errors.Is(err, ErrInvalidCallbackURL) {
+			t.Fatalf("%s: expected ErrInvalidCallbackURL, got %v", raw, err)
+		}
+	}
+	if err := dispatcher.ValidateURL("https://hooks.example.com/done"); err != nil {
+		t.Fatalf("expected a public host to validate, got %v", err)
+	}
+}
+
+func TestDeliverRefusesPrivateAddressesAtDialTime(t *testing.T) {
+	rec := &receiver{}
+	server := httptest.NewServer(rec.handler())
+	t.Cleanup(server.Close)
+
+	// Deliver does not call ValidateURL, so this reaches the dial-time check
+	// that also catches DNS names resolving to internal addresses.
+	dispatcher := NewDispatcher(Config{Secret: string(testSecret), MaxAttempts: 3, Timeout: time.Second}, NewMemoryDeadLetterStore(0))
+	if dispatcher.Deliver(context.Background(), Delivery{URL: server.URL, Event: EventTaskSucceeded, Body: []byte(`{}`)}) {
+		t.Fatalf("expected delivery to a loopback address to be refused")
+	}
+	if len(rec.bodies) != 0 {
+		t.Fatalf("expected the receiver not to be reached, got %d requests", len(rec.bodies))
+	}
+	letters, _ := dispatcher.DeadLetters().List(context.Background())
+	if len(letters) != 1 || letters[0].Attempts != 1 || !strings.Contains(letters[0].LastError, ErrForbiddenAddress.Error()) {
+		t.Fatalf("expected one unretried dead letter, got %+v", letters)
+	}
+}
+
+func TestDeliverDoesNotFollowRedirects(t *testing.T) {
+	target := &receiver{}
+	targetServer := httptest.NewServer(target.handler())
+	t.Cleanup(targetServer.Close)
+	redirector := httptest.NewServer(http.RedirectHandler(targetServer.URL, http.StatusTemporaryRedirect))
+	t.Cleanup(redirector.Close)
+
+	dispatcher, _ := newTestDispatcher(Config{MaxAttempts: 1})
+	if dispatcher.Deliver(context.Background(), Delivery{URL: redirector.URL, Event: EventTaskSucceeded, Body: []byte(`{}`)}) {
+		t.Fatalf("expected a redirect to fail the delivery")
+	}
+	if len(target.bodies) != 0 {
+		t.Fatalf("expected the redirect not to be followed, got %d requests", len(target.bodies))
+	}
+}